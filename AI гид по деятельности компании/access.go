@@ -0,0 +1,46 @@
+package main
+
+import (
+	"slices"
+)
+
+// Проверяет, является ли пользователь администратором бота
+func isAdmin(userID int64) bool {
+	return slices.Contains(config.AdminIDs, userID)
+}
+
+// Проверяет, разрешено ли пользователю обращаться к боту.
+// Если списки разрешённых пользователей и чатов пусты, доступ открыт всем, кроме заблокированных.
+func isAccessAllowed(userID, chatID int64) bool {
+	if slices.Contains(config.BlockedUserIDs, userID) {
+		return false
+	}
+	if isAdmin(userID) {
+		return true
+	}
+
+	state.mu.Lock()
+	runtimeAllowed := slices.Contains(state.AllowedUserIDs, userID)
+	hasRuntimeList := len(state.AllowedUserIDs) > 0
+	state.mu.Unlock()
+
+	if len(config.AllowedUserIDs) == 0 && len(config.AllowedChatIDs) == 0 && !hasRuntimeList {
+		return true
+	}
+
+	return runtimeAllowed ||
+		slices.Contains(config.AllowedUserIDs, userID) ||
+		slices.Contains(config.AllowedChatIDs, chatID)
+}
+
+// Добавляет пользователя в список разрешённых и сохраняет его в файл состояния
+func allowUser(userID int64) error {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	if slices.Contains(state.AllowedUserIDs, userID) {
+		return nil
+	}
+	state.AllowedUserIDs = append(state.AllowedUserIDs, userID)
+	return state.saveLocked()
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Передаёт сообщения обработчику обновлений и ждёт, пока он их разберёт
+func handleMessages(b *botInstance, messages ...*tgbotapi.Message) {
+	updates := make(chan tgbotapi.Update, len(messages))
+	for _, message := range messages {
+		updates <- tgbotapi.Update{Message: message}
+	}
+	close(updates)
+	handleTelegramUpdates(b, updates)
+}
+
+// Сообщение пользователя без доступа получает отказ на языке Telegram и не меняет его сессию
+// и отметку о блокировке бота. Сообщение пользователя с доступом снимает отметку
+func TestAccessCheckedBeforeSession(t *testing.T) {
+	useTestConfig(t, "allowed_user_ids: [1]\n")
+	b, sender := newSenderBot(t)
+	b.sessions.GetOrCreate(privateSession(2)).Language = "ru"
+	b.sessions.MarkBlocked(3)
+	b.sessions.MarkBlocked(1)
+
+	denied := privateMessage(2, 1, "Как оформить отпуск?")
+	denied.From.LanguageCode = "en"
+	handleMessages(b, denied, privateMessage(3, 2, "Как оформить отпуск?"), commandMessage(1, "/language"))
+
+	if !b.sessions.IsBlocked(3) || b.sessions.IsBlocked(1) {
+		t.Errorf("Отметка о блокировке: у пользователя без доступа %v, want true; у пользователя с доступом %v, want false",
+			b.sessions.IsBlocked(3), b.sessions.IsBlocked(1))
+	}
+	texts := sender.texts()
+	if len(texts) != 2 || texts[0] != "Access to the bot is denied." {
+		t.Errorf("Отправлено %q, want отказ на языке Telegram и выбор языка", texts)
+	}
+}
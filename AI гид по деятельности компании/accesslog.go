@@ -0,0 +1,58 @@
+package main
+
+import (
+	"log/slog"
+	"time"
+	"unicode/utf8"
+)
+
+// accessEntry — итог обработки одного вопроса пользователя. Записывается в журнал одной
+// строкой со всеми полями, чтобы по журналу можно было строить панели без сопоставления
+// нескольких записей.
+type accessEntry struct {
+	start          time.Time
+	userID, chatID int64
+	inputChars     int
+	outputChars    int
+	// Длительность запусков ассистента без ожидания в очереди и отправки ответа
+	runLatency time.Duration
+	// Повторные запуски: после пустого ответа и с резервной моделью
+	retries int
+	cached  bool
+	// Категория ошибки. Пустая — ответ доставлен
+	category string
+}
+
+func newAccessEntry(chatID, userID int64, question string) *accessEntry {
+	return &accessEntry{
+		start:      time.Now(),
+		userID:     userID,
+		chatID:     chatID,
+		inputChars: utf8.RuneCountInString(question),
+	}
+}
+
+// Отмечает доставленный ответ
+func (e *accessEntry) answered(answer string) {
+	e.outputChars = utf8.RuneCountInString(answer)
+}
+
+// Отмечает ошибку обработки
+func (e *accessEntry) failed(category string) {
+	e.category = category
+}
+
+func (e *accessEntry) write(log *slog.Logger) {
+	log.Info("Запрос обработан",
+		"user_id", e.userID,
+		"chat_id", e.chatID,
+		"input_chars", e.inputChars,
+		"output_chars", e.outputChars,
+		"run_latency_ms", e.runLatency.Milliseconds(),
+		"total_latency_ms", time.Since(e.start).Milliseconds(),
+		"retries", e.retries,
+		"cached", e.cached,
+		"success", e.category == "",
+		"error_category", e.category,
+	)
+}
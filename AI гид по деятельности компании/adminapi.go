@@ -0,0 +1,273 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Регистрирует API администратора в mux служебного HTTP-сервера. Запросы авторизуются заголовком
+// Authorization: Bearer <admin_api_token>. Бот выбирается параметром ?bot=<имя>, по умолчанию первый.
+//
+//	GET    /api/sessions       — пользователи с сессиями: число сообщений и последняя активность
+//	GET    /api/sessions/{id}  — история диалога пользователя, как в /export
+//	DELETE /api/sessions/{id}  — сброс контекста, как в /reset
+//	GET    /api/config         — настройки без секретов
+//	GET    /api/knowledge      — файлы Vector Store, как в /list_files
+//	POST   /api/resync         — синхронизация базы знаний, как по resync_schedule
+func registerAdminAPI(mux *http.ServeMux, bots []*botInstance) {
+	handle := func(pattern string, handler func(w http.ResponseWriter, r *http.Request, b *botInstance)) {
+		mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+			if !adminAPIAuthorized(r) {
+				writeAPIError(w, http.StatusUnauthorized, "unauthorized")
+				return
+			}
+			b := adminAPIBot(r, bots)
+			if b == nil {
+				writeAPIError(w, http.StatusNotFound, "unknown bot")
+				return
+			}
+			handler(w, r, b)
+		})
+	}
+
+	handle("GET /api/sessions", handleAPISessions)
+	handle("GET /api/sessions/{id}", handleAPISession)
+	handle("DELETE /api/sessions/{id}", handleAPIResetSession)
+	handle("GET /api/config", handleAPIConfig)
+	handle("GET /api/knowledge", handleAPIKnowledge)
+	handle("POST /api/resync", handleAPIResync)
+	slog.Info("API администратора доступно на служебном HTTP-сервере", "path", "/api/")
+}
+
+// Проверяет токен из заголовка Authorization
+func adminAPIAuthorized(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(config.AdminAPIToken)) == 1
+}
+
+// Возвращает бота из параметра bot, по умолчанию первого. nil — бота с таким именем нет.
+func adminAPIBot(r *http.Request, bots []*botInstance) *botInstance {
+	name := r.URL.Query().Get("bot")
+	if name == "" {
+		return bots[0]
+	}
+	i := slices.IndexFunc(bots, func(b *botInstance) bool { return b.cfg.Name == name })
+	if i < 0 {
+		return nil
+	}
+	return bots[i]
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeAPIError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+// Сессия пользователя в ответе /api/sessions
+type apiSession struct {
+	UserID       int64     `json:"user_id"`
+	Messages     int       `json:"messages"`
+	LastActivity time.Time `json:"last_activity"`
+	ThreadID     string    `json:"thread_id,omitempty"`
+}
+
+func handleAPISessions(w http.ResponseWriter, r *http.Request, b *botInstance) {
+	userIDs := b.sessions.UserIDs()
+	slices.Sort(userIDs)
+
+	sessions := make([]apiSession, 0, len(userIDs))
+	for _, userID := range userIDs {
+		session, exists := b.sessions.Get(privateSession(userID))
+		if !exists {
+			continue
+		}
+		session.mu.Lock()
+		sessions = append(sessions, apiSession{
+			UserID:       userID,
+			Messages:     len(session.Messages),
+			LastActivity: session.LastActivity,
+			ThreadID:     session.ThreadID,
+		})
+		session.mu.Unlock()
+	}
+	writeJSON(w, http.StatusOK, sessions)
+}
+
+// Возвращает ID пользователя из пути запроса. false — ID неверный, ответ уже отправлен
+func apiUserID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	userID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid user id")
+		return 0, false
+	}
+	return userID, true
+}
+
+func handleAPISession(w http.ResponseWriter, r *http.Request, b *botInstance) {
+	userID, ok := apiUserID(w, r)
+	if !ok {
+		return
+	}
+	if _, exists := b.sessions.Get(privateSession(userID)); !exists {
+		writeAPIError(w, http.StatusNotFound, "session not found")
+		return
+	}
+
+	messages := loadExportMessages(newRequestContext(), b, privateSession(userID))
+	if messages == nil {
+		messages = []exportedMessage{}
+	}
+	writeJSON(w, http.StatusOK, struct {
+		UserID   int64             `json:"user_id"`
+		Messages []exportedMessage `json:"messages"`
+	}{userID, messages})
+}
+
+func handleAPIResetSession(w http.ResponseWriter, r *http.Request, b *botInstance) {
+	userID, ok := apiUserID(w, r)
+	if !ok {
+		return
+	}
+	session, exists := b.sessions.Get(privateSession(userID))
+	if !exists {
+		writeAPIError(w, http.StatusNotFound, "session not found")
+		return
+	}
+	if threadID := resetSession(session); threadID != "" && config.DeleteUnusedThreads {
+		deleteThreadLater(b, threadID)
+	}
+	b.log.Info("Контекст диалога сброшен через API администратора", "user_id", userID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func handleAPIConfig(w http.ResponseWriter, r *http.Request, b *botInstance) {
+	redacted, err := redactedConfig()
+	if err != nil {
+		b.log.Error("Ошибка формирования настроек для API администратора", "error", err)
+		writeAPIError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	writeJSON(w, http.StatusOK, redacted)
+}
+
+// Возвращает настройки с ключами из config.yaml, в которых секреты заменены на ***
+func redactedConfig() (interface{}, error) {
+	c := config
+	c.Bots = slices.Clone(config.Bots)
+	hide := func(s *string) {
+		if *s != "" {
+			*s = "***"
+		}
+	}
+	hide(&c.APIKey)
+	hide(&c.TelegramBotToken)
+	hide(&c.WebhookSecretToken)
+	hide(&c.S3SecretAccessKey)
+	hide(&c.ConversationLogSalt)
+	hide(&c.AdminAPIToken)
+	for i := range c.Bots {
+		hide(&c.Bots[i].TelegramBotToken)
+	}
+
+	// Ключи берутся из тегов yaml, чтобы совпадать с config.yaml
+	data, err := yaml.Marshal(&c)
+	if err != nil {
+		return nil, err
+	}
+	var v interface{}
+	if err := yaml.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	return jsonCompatible(v), nil
+}
+
+// Заменяет словари yaml с ключами interface{} на map[string]interface{}, которые понимает encoding/json
+func jsonCompatible(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			m[fmt.Sprint(key)] = jsonCompatible(value)
+		}
+		return m
+	case []interface{}:
+		for i := range v {
+			v[i] = jsonCompatible(v[i])
+		}
+	}
+	return v
+}
+
+// Файл базы знаний в ответе /api/knowledge
+type apiFile struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Size      int64     `json:"size"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+func handleAPIKnowledge(w http.ResponseWriter, r *http.Request, b *botInstance) {
+	if b.vectorStoreID == "" {
+		writeJSON(w, http.StatusOK, []apiFile{})
+		return
+	}
+	ctx := newRequestContext()
+	files, err := loadKnowledgeFiles(ctx, b)
+	if err != nil {
+		requestLog(ctx, b.log).Error("Ошибка получения списка файлов базы знаний", "error", err)
+		writeAPIError(w, http.StatusBadGateway, "failed to list knowledge base files")
+		return
+	}
+
+	result := make([]apiFile, len(files))
+	for i, f := range files {
+		result[i] = apiFile(f)
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func handleAPIResync(w http.ResponseWriter, r *http.Request, b *botInstance) {
+	ctx := newRequestContext()
+	start := time.Now()
+	report, err := syncKnowledgeBase(ctx, b)
+	switch {
+	case errors.Is(err, errSyncInProgress):
+		writeAPIError(w, http.StatusConflict, err.Error())
+		return
+	case err != nil:
+		requestLog(ctx, b.log).Error("Ошибка синхронизации базы знаний", "error", err)
+		writeAPIError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	requestLog(ctx, b.log).Info("База знаний синхронизирована по запросу API администратора: "+report.String(),
+		"duration", time.Since(start).Round(time.Millisecond))
+
+	failed := make([]string, len(report.Failed))
+	for i, f := range report.Failed {
+		failed[i] = f.Name
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"added":     report.Added,
+		"updated":   report.Updated,
+		"removed":   report.Removed,
+		"unchanged": report.Unchanged,
+		"failed":    failed,
+	})
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"proxyapi-bot/internal/openai"
+)
+
+const testAdminToken = "admin-secret"
+
+// Сервер API администратора для ботов bots
+func newAdminAPIServer(t *testing.T, bots ...*botInstance) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	registerAdminAPI(mux, bots)
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// Выполняет запрос к API администратора с токеном token. Возвращает код ответа и тело
+func adminRequest(t *testing.T, server *httptest.Server, method, path, token string) (int, string) {
+	t.Helper()
+	req, err := http.NewRequest(method, server.URL+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(body)
+}
+
+func TestAdminAPIAuthorization(t *testing.T) {
+	useTestConfig(t, "admin_api_token: "+testAdminToken+"\n")
+	b, _ := newTestBot(t, &openai.Mock{})
+	server := newAdminAPIServer(t, b)
+
+	tests := []struct {
+		name   string
+		header string
+		want   int
+	}{
+		{"без заголовка", "", http.StatusUnauthorized},
+		{"неверный токен", "Bearer wrong-token", http.StatusUnauthorized},
+		{"токен без Bearer", testAdminToken, http.StatusUnauthorized},
+		{"пустой токен", "Bearer ", http.StatusUnauthorized},
+		{"верный токен", "Bearer " + testAdminToken, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", server.URL+"/api/sessions", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Errorf("Код ответа %d, want %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+}
+
+// Бот выбирается параметром ?bot=, неизвестное имя — 404
+func TestAdminAPIBotSelection(t *testing.T) {
+	useTestConfig(t, "admin_api_token: "+testAdminToken+"\n")
+	first, _ := newTestBot(t, &openai.Mock{})
+	second, _ := newTestBot(t, &openai.Mock{})
+	second.cfg.Name = "second"
+	second.sessions.GetOrCreate(privateSession(200))
+	server := newAdminAPIServer(t, first, second)
+
+	tests := []struct {
+		path       string
+		wantStatus int
+		// Пользователи в ответе
+		wantUsers []int64
+	}{
+		{"/api/sessions", http.StatusOK, []int64{}},
+		{"/api/sessions?bot=second", http.StatusOK, []int64{200}},
+		{"/api/sessions?bot=missing", http.StatusNotFound, nil},
+	}
+	for _, tt := range tests {
+		status, body := adminRequest(t, server, "GET", tt.path, testAdminToken)
+		if status != tt.wantStatus {
+			t.Errorf("GET %s: код ответа %d, want %d: %s", tt.path, status, tt.wantStatus, body)
+			continue
+		}
+		if tt.wantUsers == nil {
+			continue
+		}
+		var sessions []apiSession
+		if err := json.Unmarshal([]byte(body), &sessions); err != nil {
+			t.Fatalf("GET %s: %v: %s", tt.path, err, body)
+		}
+		users := []int64{}
+		for _, s := range sessions {
+			users = append(users, s.UserID)
+		}
+		if !slices.Equal(users, tt.wantUsers) {
+			t.Errorf("GET %s: пользователи %v, want %v", tt.path, users, tt.wantUsers)
+		}
+	}
+}
+
+func TestAdminAPIConfigRedactsSecrets(t *testing.T) {
+	useTestConfig(t, "admin_api_token: "+testAdminToken+"\n"+
+		"webhook_secret_token: webhook-secret\n"+
+		"s3_secret_access_key: s3-secret\n"+
+		"conversation_log_salt: log-salt\n")
+	b, _ := newTestBot(t, &openai.Mock{})
+	server := newAdminAPIServer(t, b)
+
+	status, body := adminRequest(t, server, "GET", "/api/config", testAdminToken)
+	if status != http.StatusOK {
+		t.Fatalf("Код ответа %d: %s", status, body)
+	}
+	for _, secret := range []string{"sk-test-secret", "123456:test-token", testAdminToken, "webhook-secret", "s3-secret", "log-salt"} {
+		if strings.Contains(body, secret) {
+			t.Errorf("Ответ содержит секрет %q", secret)
+		}
+	}
+
+	var got map[string]interface{}
+	if err := json.Unmarshal([]byte(body), &got); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"api_key", "telegram_bot_token", "admin_api_token", "webhook_secret_token", "s3_secret_access_key", "conversation_log_salt"} {
+		if got[key] != "***" {
+			t.Errorf("%s = %v, want ***", key, got[key])
+		}
+	}
+	// Остальные настройки выводятся как есть, с ключами из config.yaml
+	if got["model"] != "gpt-4o" || got["api_url"] != "https://api.example.com/v1" {
+		t.Errorf("model %v, api_url %v", got["model"], got["api_url"])
+	}
+	bots, _ := got["bots"].([]interface{})
+	if len(bots) != 1 || bots[0].(map[string]interface{})["telegram_bot_token"] != "***" {
+		t.Errorf("bots = %v, ожидается скрытый telegram_bot_token", got["bots"])
+	}
+	// Настройки бота не меняются при выводе
+	if config.APIKey != "sk-test-secret" || config.Bots[0].TelegramBotToken != "123456:test-token" {
+		t.Error("redactedConfig изменил глобальную конфигурацию")
+	}
+}
+
+func TestAdminAPIResetSession(t *testing.T) {
+	useTestConfig(t, "admin_api_token: "+testAdminToken+"\ndelete_unused_threads: true\n")
+	deleted := make(chan string, 1)
+	b, _ := newTestBot(t, &openai.Mock{
+		DeleteThreadFunc: func(ctx context.Context, threadID string) error {
+			deleted <- threadID
+			return nil
+		},
+	})
+	session := b.sessions.GetOrCreate(privateSession(100))
+	session.Messages = []map[string]interface{}{{"role": "user", "content": "вопрос"}}
+	session.ThreadID = "thread_1"
+	server := newAdminAPIServer(t, b)
+
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"/api/sessions/abc", http.StatusBadRequest},
+		{"/api/sessions/999", http.StatusNotFound},
+		{"/api/sessions/100", http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		if status, body := adminRequest(t, server, "DELETE", tt.path, testAdminToken); status != tt.want {
+			t.Errorf("DELETE %s: код ответа %d, want %d: %s", tt.path, status, tt.want, body)
+		}
+	}
+
+	if got := historyTexts(session); len(got) != 0 || session.ThreadID != "" {
+		t.Errorf("После сброса история %q, поток %q", got, session.ThreadID)
+	}
+	select {
+	case threadID := <-deleted:
+		if threadID != "thread_1" {
+			t.Errorf("Удалён поток %s, want thread_1", threadID)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Поток сброшенной сессии не удалён")
+	}
+}
+
+func TestAdminAPIResync(t *testing.T) {
+	useTestConfig(t, "admin_api_token: "+testAdminToken+"\n")
+	writeKnowledgeBase(t, "same.txt", "new.txt")
+	var uploaded, registered, removed []string
+	b, _ := newTestBot(t, &openai.Mock{
+		UploadFileFunc: func(ctx context.Context, fileName string, r io.Reader) (string, error) {
+			uploaded = append(uploaded, fileName)
+			return "file-" + fileName, nil
+		},
+		AddFileToVectorStoreFunc: func(ctx context.Context, vectorStoreID, fileID string) error {
+			registered = append(registered, fileID)
+			return nil
+		},
+		RemoveFileFromVectorStoreFunc: func(ctx context.Context, vectorStoreID, fileID string) error {
+			removed = append(removed, fileID)
+			return nil
+		},
+		DeleteFileFunc: func(ctx context.Context, fileID string) error { return nil },
+	})
+	b.source, _ = newBotFileSource(b.cfg)
+	sum := sha256.Sum256([]byte("содержимое same.txt"))
+	b.kbSync.reset(b.vectorStoreID, map[string]syncedFile{
+		"same.txt":    {ID: "file-same", Hash: hex.EncodeToString(sum[:])},
+		"removed.txt": {ID: "file-removed", Hash: "old"},
+	})
+	server := newAdminAPIServer(t, b)
+
+	status, body := adminRequest(t, server, "POST", "/api/resync", testAdminToken)
+	if status != http.StatusOK {
+		t.Fatalf("Код ответа %d: %s", status, body)
+	}
+	var report struct {
+		Added, Updated, Removed, Unchanged int
+		Failed                             []string
+	}
+	if err := json.Unmarshal([]byte(body), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Added != 1 || report.Updated != 0 || report.Removed != 1 || report.Unchanged != 1 || len(report.Failed) != 0 {
+		t.Errorf("Итог синхронизации: %s", body)
+	}
+	if !slices.Equal(uploaded, []string{"new.txt"}) || !slices.Equal(registered, []string{"file-new.txt"}) || !slices.Equal(removed, []string{"file-removed"}) {
+		t.Errorf("Загружены %q, зарегистрированы %q, удалены %q", uploaded, registered, removed)
+	}
+
+	// Пока идёт синхронизация, повторный запрос отклоняется
+	b.kbSync.running.Store(true)
+	if status, body := adminRequest(t, server, "POST", "/api/resync", testAdminToken); status != http.StatusConflict {
+		t.Errorf("Повторная синхронизация: код ответа %d, want 409: %s", status, body)
+	}
+}
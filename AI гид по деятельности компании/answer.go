@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	// Максимальная длина текстового сообщения Telegram в символах
+	telegramMessageLimit = 4096
+	// Длина подписи к документу с ответом
+	answerCaptionLength = 200
+)
+
+// Отправляет ответ ассистента. Длинный ответ (или по запросу пользователя) отправляется
+// документом .md, а при ошибке загрузки документа — несколькими сообщениями.
+func sendAnswer(b *botInstance, chatID int64, question, answer string, asFile bool) error {
+	length := utf8.RuneCountInString(answer)
+	if asFile || (config.AnswerAsFileThreshold > 0 && length > config.AnswerAsFileThreshold) {
+		err := sendAnswerAsFile(b, chatID, question, answer)
+		if err == nil {
+			return nil
+		}
+		b.log.Error("Ошибка отправки ответа документом, ответ будет разбит на сообщения", "user_id", chatID, "error", err)
+	}
+
+	return sendLongMessage(b, chatID, answer)
+}
+
+// Отправляет ответ документом с подписью из начала ответа
+func sendAnswerAsFile(b *botInstance, chatID int64, question, answer string) error {
+	name := answerFileName(question, time.Now())
+	doc := tgbotapi.NewDocument(chatID, tgbotapi.FileBytes{Name: name, Bytes: []byte(answer)})
+	doc.Caption = truncateRunes(answer, answerCaptionLength)
+
+	_, err := b.sender.Send(doc)
+	return err
+}
+
+// Разбивает текст на части, умещающиеся в одно сообщение Telegram, и отправляет их по порядку
+func sendLongMessage(b *botInstance, chatID int64, text string) error {
+	for _, part := range splitMessage(text, telegramMessageLimit) {
+		if err := sendMessage(b, tgbotapi.NewMessage(chatID, part)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Делит текст на части не длиннее limit символов, по возможности по границам строк
+func splitMessage(text string, limit int) []string {
+	var parts []string
+	runes := []rune(text)
+
+	for len(runes) > limit {
+		cut := limit
+		for i := limit; i > limit/2; i-- {
+			if runes[i] == '\n' {
+				cut = i
+				break
+			}
+		}
+		parts = append(parts, strings.TrimRight(string(runes[:cut]), "\n"))
+		runes = []rune(strings.TrimLeft(string(runes[cut:]), "\n"))
+	}
+
+	if len(runes) > 0 {
+		parts = append(parts, string(runes))
+	}
+	return parts
+}
+
+// Формирует имя файла из начала вопроса и времени ответа
+func answerFileName(question string, t time.Time) string {
+	base := sanitizeFileName(truncateRunes(question, 40))
+	if base == "" {
+		base = "answer"
+	}
+	return fmt.Sprintf("%s_%s.md", base, t.Format("20060102_150405"))
+}
+
+// Оставляет в имени файла только буквы, цифры, точки, дефисы и подчёркивания
+func sanitizeFileName(name string) string {
+	var b strings.Builder
+	for _, r := range strings.TrimSpace(name) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '.':
+			b.WriteRune(r)
+		default:
+			b.WriteRune('_')
+		}
+	}
+	return strings.Trim(b.String(), "._")
+}
+
+// Обрезает строку до n символов
+func truncateRunes(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n])
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"proxyapi-bot/internal/openai"
+)
+
+// Ответ в кэше
+type cachedAnswer struct {
+	Key     string    `json:"key"`
+	Bot     string    `json:"bot"`
+	Answer  string    `json:"answer"`
+	Expires time.Time `json:"expires"`
+}
+
+// answerCacheStore — кэш ответов на вопросы без контекста с вытеснением давно не использованных записей.
+// Нулевой указатель означает, что кэш отключён, и все методы ничего не делают.
+type answerCacheStore struct {
+	mu         sync.Mutex
+	ttl        time.Duration
+	maxEntries int
+	path       string
+	// Элементы списка — *cachedAnswer, в начале недавно использованные
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+var answerCache *answerCacheStore
+
+// Создаёт кэш ответов. Если задан path, загружает сохранённые записи.
+func openAnswerCache(ttl time.Duration, maxEntries int, path string) (*answerCacheStore, error) {
+	c := &answerCacheStore{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		path:       path,
+		order:      list.New(),
+		entries:    make(map[string]*list.Element),
+	}
+	if path == "" {
+		return c, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return c, nil
+		}
+		return nil, fmt.Errorf("Ошибка чтения файла кэша ответов: %v", err)
+	}
+
+	var saved []cachedAnswer
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, fmt.Errorf("Ошибка разбора файла кэша ответов: %v", err)
+	}
+	// Записи сохранены от недавно использованных к давним
+	now := time.Now()
+	for i := range saved {
+		if saved[i].Expires.After(now) && len(c.entries) < c.maxEntries {
+			c.entries[saved[i].Key] = c.order.PushBack(&saved[i])
+		}
+	}
+	return c, nil
+}
+
+// Возвращает ключ кэша для вопроса: хеш от имени бота, предшествующих вопросу сообщений
+// диалога и самого вопроса без регистра, знаков препинания и лишних пробелов
+func answerCacheKey(bot string, history []map[string]interface{}, question string) string {
+	h := sha256.New()
+	h.Write([]byte(bot))
+	for _, m := range history {
+		role, _ := m["role"].(string)
+		text, imageURL := messageText(m)
+		fmt.Fprintf(h, "\x00%s\x00%s\x00%s", role, cacheNormalize(text), imageURL)
+	}
+	h.Write([]byte("\x00" + cacheNormalize(question)))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Приводит текст к виду для ключа кэша: без регистра, знаков препинания и лишних пробелов
+func cacheNormalize(text string) string {
+	return normalizeQuery(strings.Map(func(r rune) rune {
+		if unicode.IsPunct(r) {
+			return ' '
+		}
+		return r
+	}, text))
+}
+
+// Возвращает ответ из кэша, если он есть и не устарел
+func (c *answerCacheStore) Get(key string) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return "", false
+	}
+	entry := elem.Value.(*cachedAnswer)
+	if time.Now().After(entry.Expires) {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+		return "", false
+	}
+	c.order.MoveToFront(elem)
+	return entry.Answer, true
+}
+
+// Сохраняет ответ в кэше, вытесняя давно не использованные записи
+func (c *answerCacheStore) Put(key, bot, answer string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := &cachedAnswer{Key: key, Bot: bot, Answer: answer, Expires: time.Now().Add(c.ttl)}
+	if elem, ok := c.entries[key]; ok {
+		elem.Value = entry
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.order.PushFront(entry)
+	for c.order.Len() > c.maxEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cachedAnswer).Key)
+	}
+}
+
+// Удаляет из кэша ответы бота. Пустое имя удаляет все ответы. Возвращает количество удалённых записей.
+func (c *answerCacheStore) Clear(bot string) int {
+	if c == nil {
+		return 0
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	removed := 0
+	for key, elem := range c.entries {
+		if bot == "" || elem.Value.(*cachedAnswer).Bot == bot {
+			c.order.Remove(elem)
+			delete(c.entries, key)
+			removed++
+		}
+	}
+	return removed
+}
+
+// Сохраняет кэш в файл, если он задан. Вызывается при завершении работы.
+func (c *answerCacheStore) Save() {
+	if c == nil || c.path == "" {
+		return
+	}
+
+	c.mu.Lock()
+	saved := make([]cachedAnswer, 0, c.order.Len())
+	for elem := c.order.Front(); elem != nil; elem = elem.Next() {
+		saved = append(saved, *elem.Value.(*cachedAnswer))
+	}
+	c.mu.Unlock()
+
+	data, err := json.Marshal(saved)
+	if err != nil {
+		slog.Error("Ошибка формирования файла кэша ответов", "error", err)
+		return
+	}
+	if err := writeFileAtomic(c.path, data); err != nil {
+		slog.Error("Ошибка записи файла кэша ответов", "error", err)
+	}
+}
+
+// Отправляет пользователю ответ из кэша без запуска ассистента. Возвращает true, если ответ доставлен.
+func deliverCachedAnswer(ctx context.Context, b *botInstance, chatID, userID int64, session *UserSession, run runRequest, answer string) bool {
+	log := requestLog(ctx, b.log)
+	start := time.Now()
+	log.Info("Ответ взят из кэша", "user_id", userID)
+	metrics.cacheHits.Add(1)
+	promCacheHits.Inc(b.cfg.Name)
+
+	transcript.Write(userID, "assistant", answer)
+	if !deliverAnswer(ctx, b, chatID, userID, run, answer) {
+		return false
+	}
+
+	// Ответ из кэша учитывается в средней длительности, чтобы была видна экономия
+	latency := time.Since(start)
+	metrics.ObserveRunLatency(latency)
+	conversationLog.Write(b.cfg.Name, userID, run.Question, answer, latency, openai.Usage{}, "", "")
+	completeAnswer(ctx, b, chatID, userID, session, run, "", answer)
+	return true
+}
+
+// /cache_clear — очищает кэш ответов бота
+func handleCacheClearCommand(b *botInstance, message *tgbotapi.Message) {
+	lang := userLanguage(b, message.From)
+	if !isAdmin(message.From.ID) {
+		sendMessage(b, tgbotapi.NewMessage(message.Chat.ID, t(lang, "common.admin_only")))
+		return
+	}
+	if answerCache == nil {
+		sendMessage(b, tgbotapi.NewMessage(message.Chat.ID, t(lang, "cache.disabled")))
+		return
+	}
+
+	removed := answerCache.Clear(b.cfg.Name)
+	b.log.Info("Кэш ответов очищен", "admin_id", message.From.ID, "removed", removed)
+	sendMessage(b, tgbotapi.NewMessage(message.Chat.ID, t(lang, "cache.cleared", removed)))
+}
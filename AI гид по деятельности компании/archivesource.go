@@ -0,0 +1,262 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// archiveSource распаковывает архивы .zip источника во временный каталог и вместо архива
+// возвращает его файлы под именами вида bundle.zip/report.pdf. Версия файлов архива — хэш
+// архива, поэтому пока архив не изменился, синхронизация не открывает его файлы, и архив
+// не распаковывается. Архив распаковывается при первом открытии одного из его файлов.
+// Вложенные архивы пропускаются.
+type archiveSource struct {
+	source FileSource
+	log    *slog.Logger
+	// Архивы по имени архива
+	archives map[string]*sourceArchive
+	// Архивы файлов и ошибки чтения архивов по имени из последнего List
+	members map[string]*sourceArchive
+	errors  map[string]error
+}
+
+// sourceArchive — копия архива из источника и каталог dir, в который он распакован
+type sourceArchive struct {
+	name    string
+	hash    string
+	zipPath string
+	files   []FileInfo
+	// Файлы в архиве по имени в источнике
+	entries map[string]string
+	// Пути распакованных файлов по имени в источнике. Пусто, пока архив не распакован
+	dir   string
+	paths map[string]string
+}
+
+func newArchiveSource(source FileSource, log *slog.Logger) *archiveSource {
+	return &archiveSource{source: source, log: log, archives: make(map[string]*sourceArchive)}
+}
+
+func isZipArchive(name string) bool {
+	return strings.EqualFold(path.Ext(name), ".zip")
+}
+
+func (s *archiveSource) List(ctx context.Context) ([]FileInfo, error) {
+	list, err := s.source.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.members = make(map[string]*sourceArchive)
+	s.errors = make(map[string]error)
+
+	var files []FileInfo
+	listed := make(map[string]bool)
+	for _, file := range list {
+		if !isZipArchive(file.Name) {
+			files = append(files, file)
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		listed[file.Name] = true
+
+		archive, err := s.scan(ctx, file.Name)
+		if err != nil {
+			// Архив попадает в итог загрузки с ошибкой, как недоступный файл
+			s.errors[file.Name] = err
+			files = append(files, FileInfo{Name: file.Name, Size: -1})
+			continue
+		}
+		for _, member := range archive.files {
+			s.members[member.Name] = archive
+		}
+		files = append(files, archive.files...)
+	}
+
+	// Архивы, которых больше нет в источнике
+	for name, archive := range s.archives {
+		if !listed[name] {
+			archive.remove()
+			delete(s.archives, name)
+		}
+	}
+	return files, nil
+}
+
+func (s *archiveSource) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	if err, ok := s.errors[name]; ok {
+		return nil, err
+	}
+	archive, ok := s.members[name]
+	if !ok {
+		return s.source.Open(ctx, name)
+	}
+	if archive.paths == nil {
+		if err := s.extract(archive); err != nil {
+			return nil, err
+		}
+	}
+	return os.Open(archive.paths[name])
+}
+
+// Копирует архив во временный файл и читает список его файлов, если содержимое изменилось
+// с прошлого чтения
+func (s *archiveSource) scan(ctx context.Context, name string) (*sourceArchive, error) {
+	r, err := s.source.Open(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	// zip читает архив с произвольных позиций, поэтому он сохраняется в файл целиком
+	tmp, err := os.CreateTemp("", "kb-archive-*.zip")
+	if err != nil {
+		return nil, err
+	}
+	defer tmp.Close()
+
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(tmp, hash), io.LimitReader(r, config.ArchiveMaxExtractedBytes+1))
+	if err == nil && n > config.ArchiveMaxExtractedBytes {
+		err = fmt.Errorf("Архив %s больше %d байт", name, config.ArchiveMaxExtractedBytes)
+	} else if err != nil {
+		err = fmt.Errorf("Ошибка чтения архива %s: %v", name, err)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+
+	if archive, ok := s.archives[name]; ok {
+		if archive.hash == sum {
+			os.Remove(tmp.Name())
+			return archive, nil
+		}
+		archive.remove()
+		delete(s.archives, name)
+	}
+
+	archive := &sourceArchive{name: name, hash: sum, zipPath: tmp.Name(), entries: make(map[string]string)}
+	if err := s.readEntries(tmp, n, archive); err != nil {
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+	s.archives[name] = archive
+	return archive, nil
+}
+
+// Читает список файлов архива. Файлы с путём за пределами каталога и вложенные архивы
+// пропускаются. Общий размер файлов ограничен archive_max_extracted_bytes.
+func (s *archiveSource) readEntries(r io.ReaderAt, size int64, archive *sourceArchive) error {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return fmt.Errorf("Ошибка чтения архива %s: %v", archive.name, err)
+	}
+	var total uint64
+	for _, entry := range zr.File {
+		if entry.FileInfo().IsDir() {
+			continue
+		}
+		local := filepath.FromSlash(entry.Name)
+		if !filepath.IsLocal(local) || strings.Contains(entry.Name, "\\") {
+			s.log.Warn("Файл архива с небезопасным путём пропущен", "archive", archive.name, "entry", entry.Name)
+			continue
+		}
+		if isZipArchive(entry.Name) {
+			s.log.Warn("Вложенный архив пропущен", "archive", archive.name, "entry", entry.Name)
+			continue
+		}
+		total += entry.UncompressedSize64
+		if total > uint64(config.ArchiveMaxExtractedBytes) {
+			return fmt.Errorf("Распакованные файлы архива %s больше %d байт", archive.name, config.ArchiveMaxExtractedBytes)
+		}
+
+		fileName := archive.name + "/" + entry.Name
+		archive.entries[fileName] = entry.Name
+		archive.files = append(archive.files, FileInfo{Name: fileName, Size: int64(entry.UncompressedSize64), Version: "zip:" + archive.hash})
+	}
+	return nil
+}
+
+// Распаковывает файлы архива во временный каталог. Размер в заголовке архива может
+// не совпадать с действительным, поэтому общий размер ограничивается и при распаковке.
+func (s *archiveSource) extract(archive *sourceArchive) error {
+	zr, err := zip.OpenReader(archive.zipPath)
+	if err != nil {
+		return fmt.Errorf("Ошибка чтения архива %s: %v", archive.name, err)
+	}
+	defer zr.Close()
+	dir, err := os.MkdirTemp("", "kb-zip-*")
+	if err != nil {
+		return err
+	}
+
+	paths := make(map[string]string, len(archive.entries))
+	var total int64
+	for _, entry := range zr.File {
+		fileName := archive.name + "/" + entry.Name
+		if _, ok := archive.entries[fileName]; !ok {
+			continue
+		}
+		target := filepath.Join(dir, filepath.FromSlash(entry.Name))
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			os.RemoveAll(dir)
+			return err
+		}
+		n, err := extractZipFile(entry, target, config.ArchiveMaxExtractedBytes-total+1)
+		if err == nil {
+			total += n
+			if total > config.ArchiveMaxExtractedBytes {
+				err = fmt.Errorf("Распакованные файлы архива %s больше %d байт", archive.name, config.ArchiveMaxExtractedBytes)
+			}
+		} else {
+			err = fmt.Errorf("Ошибка распаковки %s из архива %s: %v", entry.Name, archive.name, err)
+		}
+		if err != nil {
+			os.RemoveAll(dir)
+			return err
+		}
+		paths[fileName] = target
+	}
+	s.log.Info("Архив базы знаний распакован", "archive", archive.name, "files", len(paths))
+	archive.dir, archive.paths = dir, paths
+	return nil
+}
+
+// Удаляет копию архива и распакованные файлы
+func (a *sourceArchive) remove() {
+	os.Remove(a.zipPath)
+	if a.dir != "" {
+		os.RemoveAll(a.dir)
+	}
+}
+
+// Распаковывает файл архива, записывая не больше limit байт
+func extractZipFile(entry *zip.File, target string, limit int64) (int64, error) {
+	r, err := entry.Open()
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+
+	file, err := os.Create(target)
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(file, io.LimitReader(r, limit))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return n, err
+}
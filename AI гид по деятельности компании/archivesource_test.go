@@ -0,0 +1,136 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"proxyapi-bot/internal/openai"
+)
+
+// Создаёт архив name в каталоге files_path с файлами files
+func writeZip(t *testing.T, name string, files map[string]string) {
+	t.Helper()
+	if err := os.MkdirAll(config.FilesPath, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(filepath.Join(config.FilesPath, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	for _, entry := range slices.Sorted(maps.Keys(files)) {
+		w, err := zw.Create(entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(w, files[entry])
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Файлы архива перечисляются без распаковки, небезопасные пути и вложенные архивы
+// пропускаются, а распаковка происходит при первом открытии файла
+func TestArchiveSource(t *testing.T) {
+	useTestConfig(t, "")
+	// Копии и распакованные файлы архивов удаляются вместе с каталогом теста
+	t.Setenv("TMPDIR", t.TempDir())
+	writeKnowledgeBase(t, "plain.txt")
+	writeZip(t, "bundle.zip", map[string]string{
+		"report.txt":     "отчёт",
+		"docs/guide.txt": "руководство",
+		"../evil.txt":    "вне каталога",
+		"inner.zip":      "вложенный архив",
+	})
+	source := newArchiveSource(localSource{dir: config.FilesPath}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	list, err := source.List(context.Background())
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	var names []string
+	for _, file := range list {
+		names = append(names, file.Name)
+		if file.Name != "plain.txt" && !strings.HasPrefix(file.Version, "zip:") {
+			t.Errorf("Версия %s = %q, want хэш архива", file.Name, file.Version)
+		}
+	}
+	if want := []string{"bundle.zip/docs/guide.txt", "bundle.zip/report.txt", "plain.txt"}; !slices.Equal(names, want) {
+		t.Errorf("Файлы = %q, want %q", names, want)
+	}
+	archive := source.archives["bundle.zip"]
+	if archive.paths != nil {
+		t.Error("Архив распакован при получении списка")
+	}
+
+	r, err := source.Open(context.Background(), "bundle.zip/report.txt")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	data, _ := io.ReadAll(r)
+	r.Close()
+	if string(data) != "отчёт" || archive.paths == nil {
+		t.Errorf("Содержимое = %q, архив распакован: %v", data, archive.paths != nil)
+	}
+}
+
+// После перезапуска неизменённый архив не распаковывается заново, а изменённый
+// загружается снова
+func TestSyncSkipsUnchangedArchive(t *testing.T) {
+	useTestConfig(t, "")
+	// Копии и распакованные файлы архивов удаляются вместе с каталогом теста
+	t.Setenv("TMPDIR", t.TempDir())
+	writeZip(t, "bundle.zip", map[string]string{"report.txt": "отчёт v1"})
+	var uploaded []string
+	mock := &openai.Mock{
+		UploadFileFunc: func(ctx context.Context, fileName string, r io.Reader) (string, error) {
+			data, _ := io.ReadAll(r)
+			uploaded = append(uploaded, string(data))
+			return fmt.Sprintf("file-%d", len(uploaded)), nil
+		},
+		AddFileToVectorStoreFunc:      func(ctx context.Context, vectorStoreID, fileID string) error { return nil },
+		RemoveFileFromVectorStoreFunc: func(ctx context.Context, vectorStoreID, fileID string) error { return nil },
+		DeleteFileFunc:                func(ctx context.Context, fileID string) error { return nil },
+	}
+	// Бот после запуска: источник создаётся заново, список файлов берётся из файла состояния
+	start := func() (*botInstance, *archiveSource) {
+		b, _ := newTestBot(t, mock)
+		source := newArchiveSource(localSource{dir: config.FilesPath}, b.log)
+		b.source = source
+		saved, _ := savedKnowledgeFor("test")
+		b.kbSync.reset(b.vectorStoreID, saved.Files)
+		return b, source
+	}
+
+	b, _ := start()
+	if report, err := syncKnowledgeBase(context.Background(), b); err != nil || report.Added != 1 {
+		t.Fatalf("Первая синхронизация: %s, %v", report, err)
+	}
+
+	b, source := start()
+	if report, err := syncKnowledgeBase(context.Background(), b); err != nil || report.Unchanged != 1 {
+		t.Errorf("Синхронизация после перезапуска: %s, %v", report, err)
+	}
+	if source.archives["bundle.zip"].paths != nil {
+		t.Error("Неизменённый архив распакован заново")
+	}
+
+	writeZip(t, "bundle.zip", map[string]string{"report.txt": "отчёт v2"})
+	if report, err := syncKnowledgeBase(context.Background(), b); err != nil || report.Updated != 1 {
+		t.Errorf("Синхронизация изменённого архива: %s, %v", report, err)
+	}
+	if want := []string{"отчёт v1", "отчёт v2"}; !slices.Equal(uploaded, want) {
+		t.Errorf("Загружены %q, want %q", uploaded, want)
+	}
+}
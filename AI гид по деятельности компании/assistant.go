@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"proxyapi-bot/internal/openai"
+)
+
+// Возвращает ID ассистента бота. Ассистент из файла состояния переиспользуется: если имя,
+// инструкции, модель или инструменты в конфигурации изменились, они меняются у него на месте.
+// Новый ассистент создаётся, только если сохранённого нет или он удалён на стороне API.
+func ensureAssistant(ctx context.Context, b *botInstance, tools []openai.Tool) (string, error) {
+	cfg, log := b.cfg, b.log
+	saved, exists := savedAssistantFor(cfg.Name)
+
+	desired := savedAssistant{
+		Name:                 cfg.Name,
+		Instructions:         cfg.Instructions,
+		Model:                cfg.Model,
+		Tools:                slices.Clone(cfg.Tools),
+		InstructionsOverride: saved.InstructionsOverride,
+	}
+	if desired.InstructionsOverride != "" {
+		log.Info("Применяются инструкции, заданные командой /set_instructions, а не из конфигурации")
+		desired.Instructions = desired.InstructionsOverride
+	}
+	b.cfg.Instructions = desired.Instructions
+
+	if exists && saved.ID != "" {
+		update, changes := assistantChanges(saved, desired, tools)
+		if len(changes) == 0 {
+			log.Info("Используется сохранённый ассистент", "assistant_id", saved.ID)
+			return saved.ID, nil
+		}
+
+		err := b.api.ModifyAssistant(ctx, saved.ID, update)
+		if err == nil {
+			log.Info("Настройки сохранённого ассистента изменены", "assistant_id", saved.ID, "changes", strings.Join(changes, "; "))
+			desired.ID = saved.ID
+			return saved.ID, saveAssistant(cfg.Name, desired)
+		}
+
+		var apiErr *openai.APIError
+		if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+			return "", fmt.Errorf("Ошибка изменения ассистента: %v", err)
+		}
+		log.Warn("Сохранённый ассистент не найден, будет создан новый", "assistant_id", saved.ID)
+	}
+
+	id, err := b.api.CreateAssistant(ctx, desired.Name, desired.Instructions, desired.Model, tools)
+	if err != nil {
+		return "", fmt.Errorf("Ошибка создания ассистента: %v", err)
+	}
+	desired.ID = id
+	if err := saveAssistant(cfg.Name, desired); err != nil {
+		log.Error("Ошибка сохранения состояния", "error", err)
+	}
+	return id, nil
+}
+
+// Сравнивает сохранённые настройки ассистента с нужными. Возвращает изменения для запроса
+// и их описание для журнала
+func assistantChanges(saved, desired savedAssistant, tools []openai.Tool) (openai.AssistantUpdate, []string) {
+	var update openai.AssistantUpdate
+	var changes []string
+
+	if saved.Name != desired.Name {
+		update.Name = desired.Name
+		changes = append(changes, fmt.Sprintf("name: %q → %q", saved.Name, desired.Name))
+	}
+	if saved.Instructions != desired.Instructions {
+		update.Instructions = desired.Instructions
+		changes = append(changes, fmt.Sprintf("instructions: %d → %d символов",
+			utf8.RuneCountInString(saved.Instructions), utf8.RuneCountInString(desired.Instructions)))
+	}
+	if saved.Model != desired.Model {
+		update.Model = desired.Model
+		changes = append(changes, fmt.Sprintf("model: %s → %s", saved.Model, desired.Model))
+	}
+	if !slices.Equal(saved.Tools, desired.Tools) {
+		update.Tools = tools
+		changes = append(changes, fmt.Sprintf("tools: %v → %v", saved.Tools, desired.Tools))
+	}
+	return update, changes
+}
+
+// /set_instructions <text> — заменяет инструкции ассистента без перезапуска и сохраняет их
+// в файле состояния, /set_instructions reset — возвращает инструкции из конфигурации
+func handleSetInstructionsCommand(b *botInstance, message *tgbotapi.Message) {
+	lang := userLanguage(b, message.From)
+	if !isAdmin(message.From.ID) {
+		sendMessage(b, tgbotapi.NewMessage(message.Chat.ID, t(lang, "common.admin_only")))
+		return
+	}
+
+	args := commandArgs(message)
+	if args == "" {
+		sendMessage(b, tgbotapi.NewMessage(message.Chat.ID, t(lang, "set_instructions.usage")))
+		return
+	}
+
+	saved, _ := savedAssistantFor(b.cfg.Name)
+	instructions, override, reply := args, args, t(lang, "set_instructions.done")
+	if args == "reset" {
+		instructions, override, reply = configInstructions(b.cfg.Name), "", t(lang, "set_instructions.reset")
+	}
+
+	ctx := newRequestContext()
+	if err := b.api.ModifyAssistant(ctx, b.assistantID, openai.AssistantUpdate{Instructions: instructions}); err != nil {
+		requestLog(ctx, b.log).Error("Ошибка изменения инструкций ассистента", "error", err)
+		sendMessage(b, tgbotapi.NewMessage(message.Chat.ID, t(lang, "set_instructions.failed")))
+		return
+	}
+
+	b.cfg.Instructions = instructions
+	saved.ID = b.assistantID
+	saved.Instructions = instructions
+	saved.InstructionsOverride = override
+	if err := saveAssistant(b.cfg.Name, saved); err != nil {
+		b.log.Error("Ошибка сохранения состояния", "error", err)
+	}
+
+	b.log.Info("Инструкции ассистента изменены командой", "admin_id", message.From.ID,
+		"chars", utf8.RuneCountInString(instructions), "reset", override == "")
+	sendMessage(b, tgbotapi.NewMessage(message.Chat.ID, reply))
+}
+
+// Возвращает инструкции бота из конфигурации
+func configInstructions(botName string) string {
+	for _, bot := range config.Bots {
+		if bot.Name == botName {
+			return bot.Instructions
+		}
+	}
+	return config.Instructions
+}
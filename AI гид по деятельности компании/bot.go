@@ -0,0 +1,288 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"proxyapi-bot/internal/openai"
+)
+
+// BotConfig — настройки отдельного Telegram-бота. Незаданные поля берутся
+// из настроек верхнего уровня config.yaml; api_url и api_key общие для всех ботов.
+type BotConfig struct {
+	Name                string   `yaml:"name"`
+	TelegramBotToken    string   `yaml:"telegram_bot_token"`
+	FilesPath           string   `yaml:"files_path"`
+	FilesSource         string   `yaml:"files_source"`
+	FileURLs            []string `yaml:"file_urls"`
+	Instructions        string   `yaml:"instructions"`
+	Model               string   `yaml:"model"`
+	Tools               []string `yaml:"tools"`
+	MaxContextMessages  int      `yaml:"max_context_messages"`
+	MaxCompletionTokens int      `yaml:"max_completion_tokens"`
+	MaxPromptTokens     int      `yaml:"max_prompt_tokens"`
+	UserRateLimit       string   `yaml:"user_rate_limit"`
+}
+
+// Заполняет список ботов: при пустом списке создаёт единственного бота из настроек
+// верхнего уровня, иначе дополняет незаданные поля каждого бота этими настройками
+func (c *Config) normalizeBots() error {
+	if len(c.Bots) == 0 {
+		c.Bots = []BotConfig{{}}
+	}
+
+	names := make(map[string]bool, len(c.Bots))
+	for i := range c.Bots {
+		bot := &c.Bots[i]
+		if bot.Name == "" {
+			bot.Name = c.Name
+		}
+		// По имени бота различаются записи журналов, кэша ответов и списки пользователей
+		if names[bot.Name] {
+			return fmt.Errorf("Имя бота %q используется несколько раз", bot.Name)
+		}
+		names[bot.Name] = true
+		if bot.TelegramBotToken == "" {
+			bot.TelegramBotToken = c.TelegramBotToken
+		}
+		if bot.FilesPath == "" {
+			bot.FilesPath = c.FilesPath
+		}
+		if bot.FilesSource == "" {
+			bot.FilesSource = c.FilesSource
+		}
+		if len(bot.FileURLs) == 0 {
+			bot.FileURLs = c.FileURLs
+		}
+		if _, err := newBotFileSource(*bot); err != nil {
+			return fmt.Errorf("Ошибка в настройках бота %s: %v", bot.Name, err)
+		}
+		if bot.Instructions == "" {
+			bot.Instructions = c.Instructions
+		}
+		if bot.Model == "" {
+			bot.Model = c.Model
+		}
+		if len(bot.Tools) == 0 {
+			bot.Tools = c.Tools
+		}
+		if err := validateTools(bot.Tools, c.Functions); err != nil {
+			return fmt.Errorf("Ошибка в настройках бота %s: %v", bot.Name, err)
+		}
+		if bot.MaxContextMessages <= 0 {
+			bot.MaxContextMessages = c.MaxContextMessages
+		}
+		if bot.MaxCompletionTokens == 0 {
+			bot.MaxCompletionTokens = c.MaxCompletionTokens
+		}
+		if bot.MaxCompletionTokens < 0 {
+			return fmt.Errorf("Некорректное значение max_completion_tokens у бота %s: %d", bot.Name, bot.MaxCompletionTokens)
+		}
+		if bot.MaxPromptTokens == 0 {
+			bot.MaxPromptTokens = c.MaxPromptTokens
+		}
+		if err := validateMaxPromptTokens(bot.MaxPromptTokens); err != nil {
+			return fmt.Errorf("Ошибка в настройках бота %s: %v", bot.Name, err)
+		}
+		if bot.UserRateLimit == "" {
+			bot.UserRateLimit = c.UserRateLimit
+		}
+		if _, err := parseRateLimit(bot.UserRateLimit); err != nil {
+			return fmt.Errorf("Ошибка разбора user_rate_limit у бота %s: %v", bot.Name, err)
+		}
+	}
+	return nil
+}
+
+// BotSender — методы Telegram Bot API, через которые бот отправляет сообщения и получает файлы
+type BotSender interface {
+	Send(c tgbotapi.Chattable) (tgbotapi.Message, error)
+	Request(c tgbotapi.Chattable) (*tgbotapi.APIResponse, error)
+	GetFileDirectURL(fileID string) (string, error)
+}
+
+var _ BotSender = (*tgbotapi.BotAPI)(nil)
+
+// botInstance — запущенный бот со своим ассистентом, Vector Store и сессиями пользователей
+type botInstance struct {
+	cfg       BotConfig
+	rateLimit RateLimit
+
+	tg *tgbotapi.BotAPI
+	// Отправка сообщений и запросов к Telegram. Обычно это tg, при проверке кода бота — подмена,
+	// сохраняющая отправленные сообщения
+	sender   BotSender
+	api      openai.AssistantAPI
+	sessions *SessionStore
+	log      *slog.Logger
+
+	assistantID   string
+	vectorStoreID string
+	// База знаний пуста: ассистент работает без Vector Store и инструмента file_search
+	chatOnly bool
+	// Получает фрагменты ответа по мере поступления. nil — ответ отправляется целиком
+	onDelta func(text string)
+	// Файлы Vector Store для /list_files
+	kbFiles knowledgeFilesCache
+	// Источник файлов базы знаний и загруженные из него файлы для повторной синхронизации
+	source FileSource
+	kbSync knowledgeSync
+	// Очереди запусков по пользователям: ответы одному пользователю отправляются по порядку
+	queues userQueues
+	// Диалоги, переданные операторам, по сообщениям в чате поддержки
+	handoffs handoffRelay
+	// Имя и ID бота в Telegram для распознавания обращений к нему в группах
+	username  string
+	botUserID int64
+
+	health botHealth
+}
+
+// Формирует инструменты ассистента по их типам с настройками из конфигурации
+func assistantTools(toolTypes []string) []openai.Tool {
+	tools := make([]openai.Tool, 0, len(toolTypes))
+	for _, toolType := range toolTypes {
+		// Каждая функция из functions — отдельный инструмент
+		if toolType == toolFunction {
+			tools = append(tools, functionTools(config.Functions)...)
+			continue
+		}
+		tool := openai.Tool{Type: toolType}
+		if toolType == "file_search" && config.FileSearchMaxResults > 0 {
+			tool.FileSearch = &openai.FileSearchOptions{MaxNumResults: config.FileSearchMaxResults}
+		}
+		tools = append(tools, tool)
+	}
+	return tools
+}
+
+// Создаёт клиент API с настройками из конфигурации
+func newAPIClient(log *slog.Logger) *openai.Client {
+	api := openai.New(config.ApiURL, config.APIKey, log)
+	api.MaxResponseBytes = config.MaxResponseBytes
+	api.StreamTimeout = time.Duration(config.StreamTimeoutSeconds) * time.Second
+	api.MaxAnswerBytes = config.MaxAnswerBytes
+	api.Provider = config.Provider
+	api.AzureAPIVersion = config.AzureAPIVersion
+	api.AzureDeployment = config.AzureDeployment
+	return api
+}
+
+// Авторизует бота в Telegram, создаёт ассистента и Vector Store с файлами
+func startBot(cfg BotConfig) (*botInstance, error) {
+	b := newBotInstance(cfg)
+
+	// Инициализация Telegram Bot
+	tg, err := tgbotapi.NewBotAPI(cfg.TelegramBotToken)
+	if err != nil {
+		return nil, fmt.Errorf("Ошибка инициализации Telegram бота: %v", err)
+	}
+	tg.Debug = false
+	b.tg = tg
+	b.sender = tg
+	b.health.telegramOK = time.Now() // NewBotAPI выполняет getMe
+	b.username = tg.Self.UserName
+	b.botUserID = tg.Self.ID
+	b.log.Info("Telegram бот авторизован", "username", tg.Self.UserName)
+
+	if err := setupAssistant(context.Background(), b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Создаёт бота без подключения к Telegram и без ассистента
+func newBotInstance(cfg BotConfig) *botInstance {
+	log := slog.With("bot", cfg.Name)
+	rateLimit, _ := parseRateLimit(cfg.UserRateLimit) // Проверено при загрузке конфигурации
+
+	return &botInstance{
+		cfg:       cfg,
+		rateLimit: rateLimit,
+		api:       newAPIClient(log),
+		sessions:  NewSessionStore(),
+		log:       log,
+		kbSync:    knowledgeSync{bot: cfg.Name},
+	}
+}
+
+// Готовит ассистента бота и Vector Store с файлами базы знаний: сохранённый с прошлого запуска
+// Vector Store синхронизируется с источником, иначе создаётся новый. Ассистент готовится
+// параллельно с загрузкой файлов, так как эти шаги не зависят друг от друга, а затем
+// Vector Store привязывается к ассистенту.
+func setupAssistant(ctx context.Context, b *botInstance) error {
+	cfg, log := b.cfg, b.log
+	start := time.Now()
+	steps := newStartupSteps(ctx, log)
+	defer steps.Close()
+
+	// Создание ассистента или изменение сохранённого
+	tools := assistantTools(cfg.Tools)
+	steps.Go("подготовка ассистента", func(ctx context.Context) error {
+		var err error
+		b.assistantID, err = ensureAssistant(ctx, b, tools)
+		return err
+	})
+
+	// Синхронизация сохранённого Vector Store или создание нового и загрузка файлов
+	var uploads uploadReport
+	steps.Go("загрузка базы знаний", func(ctx context.Context) error {
+		b.source, _ = newBotFileSource(cfg) // Проверено при загрузке конфигурации
+		var reused bool
+		var err error
+		uploads, reused, err = reuseKnowledgeBase(ctx, b)
+		if err != nil || reused {
+			return err
+		}
+		b.vectorStoreID, uploads, err = createVectorStoreAndUploadFiles(ctx, b.api, log, b.source)
+		if err != nil {
+			return fmt.Errorf("Ошибка создания Vector Store и загрузки файлов: %v", err)
+		}
+		if err := b.kbSync.reset(b.vectorStoreID, uploads.Files); err != nil {
+			log.Warn("Не удалось сохранить базу знаний в файле состояния", "error", err)
+		}
+		return nil
+	})
+
+	if err := steps.Wait(); err != nil {
+		return err
+	}
+
+	// Пустой Vector Store не подключается: поиск по нему ничего не находит, и ассистент
+	// отвечал бы так, будто в документах нет ответа
+	if uploads.Uploaded == 0 {
+		if !config.AllowEmptyKnowledgeBase {
+			return fmt.Errorf("Ни один файл базы знаний не загружен (%s), запуск прерван. "+
+				"Чтобы запустить бота без базы знаний, укажите allow_empty_knowledge_base: true", uploads)
+		}
+		log.Warn("БАЗА ЗНАНИЙ ПУСТА: ни один файл не загружен, ассистент работает без поиска по документам")
+		b.chatOnly = true
+		b.vectorStoreID = ""
+		b.cfg.Tools = slices.DeleteFunc(slices.Clone(b.cfg.Tools), func(tool string) bool { return tool == "file_search" })
+		tools = assistantTools(b.cfg.Tools)
+	}
+
+	// Привязка Vector Store к ассистенту
+	err := steps.Run("привязка Vector Store", func(ctx context.Context) error {
+		if err := b.api.UpdateAssistant(ctx, b.assistantID, b.vectorStoreID, tools); err != nil {
+			return fmt.Errorf("Ошибка обновления ассистента: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if limit, ok := modelContextLimit(b.cfg.Model); ok {
+		log.Info("Окно контекста модели", "model", b.cfg.Model, "context_tokens", limit, "history_tokens", historyTokenBudget(b, b.cfg.Model))
+	} else {
+		log.Warn("Окно контекста модели неизвестно, история обрезается только по max_context_messages: задайте его в model_context_limits", "model", b.cfg.Model)
+	}
+	log.Info("Ассистент готов к работе", "assistant_id", b.assistantID, "ready_in", time.Since(start).Round(time.Millisecond))
+	return nil
+}
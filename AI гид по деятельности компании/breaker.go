@@ -0,0 +1,140 @@
+package main
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Состояния автоматического выключателя
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerOpen:
+		return "open"
+	case breakerHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// circuitBreaker размыкается после threshold ошибок подряд в пределах window
+// и отклоняет запросы до истечения cooldown, после чего пропускает один пробный запрос.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	window    time.Duration
+	cooldown  time.Duration
+
+	state        breakerState
+	failures     int
+	firstFailure time.Time
+	openedAt     time.Time
+	probing      bool
+}
+
+var runBreaker *circuitBreaker
+
+func newCircuitBreaker(threshold int, window, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{threshold: threshold, window: window, cooldown: cooldown}
+}
+
+// Allow сообщает, можно ли выполнить запрос
+func (b *circuitBreaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.setStateLocked(breakerHalfOpen)
+		b.probing = true
+		return true
+	case breakerHalfOpen:
+		// Пока пробный запрос не завершился, остальные отклоняются
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	default:
+		return true
+	}
+}
+
+// Trip размыкает выключатель независимо от числа ошибок, например при исчерпании квоты
+func (b *circuitBreaker) Trip() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.openedAt = time.Now()
+	b.probing = false
+	if b.state != breakerOpen {
+		b.setStateLocked(breakerOpen)
+	}
+}
+
+// State возвращает текущее состояние выключателя
+func (b *circuitBreaker) State() breakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// Record учитывает результат запроса, пропущенного через Allow
+func (b *circuitBreaker) Record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.probing = false
+
+	if err == nil {
+		b.failures = 0
+		if b.state != breakerClosed {
+			b.setStateLocked(breakerClosed)
+		}
+		return
+	}
+
+	if b.state == breakerHalfOpen {
+		b.openedAt = now
+		b.setStateLocked(breakerOpen)
+		return
+	}
+
+	if b.failures == 0 || now.Sub(b.firstFailure) > b.window {
+		b.failures = 0
+		b.firstFailure = now
+	}
+	b.failures++
+
+	if b.failures >= b.threshold {
+		b.openedAt = now
+		b.setStateLocked(breakerOpen)
+	}
+}
+
+// Release освобождает пропущенный через Allow запрос, результат которого не говорит о состоянии
+// API, например отменённый пользователем. Состояние не меняется, а если запрос был пробным,
+// пробным станет следующий.
+func (b *circuitBreaker) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+func (b *circuitBreaker) setStateLocked(state breakerState) {
+	slog.Warn("Изменение состояния автоматического выключателя", "from", b.state.String(), "to", state.String(), "failures", b.failures)
+	b.state = state
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"slices"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Telegram допускает около 30 сообщений в секунду для разных чатов
+const maxBroadcastRate = 30
+
+// Данные кнопок подтверждения рассылки
+const (
+	broadcastCallbackPrefix = "broadcast:"
+	broadcastConfirmData    = broadcastCallbackPrefix + "confirm"
+	broadcastCancelData     = broadcastCallbackPrefix + "cancel"
+)
+
+// /broadcast <text> — рассылает сообщение всем известным пользователям.
+// /broadcast_test — только подсчитывает получателей.
+// Рассылка большой аудитории начинается только после подтверждения кнопкой.
+func handleBroadcastCommand(b *botInstance, message *tgbotapi.Message, dryRun bool) {
+	lang := userLanguage(b, message.From)
+	if !isAdmin(message.From.ID) {
+		sendMessage(b, tgbotapi.NewMessage(message.Chat.ID, t(lang, "common.admin_only")))
+		return
+	}
+
+	recipients := broadcastRecipients(b)
+
+	if dryRun {
+		sendMessage(b, tgbotapi.NewMessage(message.Chat.ID, t(lang, "broadcast.recipients", len(recipients))))
+		return
+	}
+
+	text := commandArgs(message)
+	if text == "" {
+		sendMessage(b, tgbotapi.NewMessage(message.Chat.ID, t(lang, "broadcast.usage")))
+		return
+	}
+
+	if len(recipients) > config.BroadcastConfirmThreshold {
+		session := b.sessions.GetOrCreate(chatSession(message.Chat, message.From.ID))
+		session.mu.Lock()
+		session.pendingBroadcast = text
+		session.mu.Unlock()
+
+		msg := tgbotapi.NewMessage(message.Chat.ID, t(lang, "broadcast.confirm", len(recipients)))
+		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(t(lang, "broadcast.confirm_button"), broadcastConfirmData),
+			tgbotapi.NewInlineKeyboardButtonData(t(lang, "broadcast.cancel_button"), broadcastCancelData),
+		))
+		sendMessage(b, msg)
+		return
+	}
+
+	startBroadcast(b, message.From.ID, message.Chat.ID, lang, recipients, text)
+}
+
+// Обрабатывает подтверждение или отмену рассылки, ожидающей решения администратора
+func handleBroadcastCallback(b *botInstance, query *tgbotapi.CallbackQuery) {
+	lang := userLanguage(b, query.From)
+	if !isAdmin(query.From.ID) {
+		b.sender.Request(tgbotapi.NewCallback(query.ID, t(lang, "common.admin_only")))
+		return
+	}
+
+	// Текст извлекается из сессии один раз, чтобы повторное нажатие не запустило рассылку дважды
+	var text string
+	if session, exists := b.sessions.Get(chatSession(query.Message.Chat, query.From.ID)); exists {
+		session.mu.Lock()
+		text = session.pendingBroadcast
+		session.pendingBroadcast = ""
+		session.mu.Unlock()
+	}
+
+	b.sender.Request(tgbotapi.NewCallback(query.ID, ""))
+
+	reply := t(lang, "broadcast.cancelled")
+	if text == "" {
+		reply = t(lang, "broadcast.nothing")
+	}
+	if query.Data != broadcastConfirmData || text == "" {
+		b.sender.Request(tgbotapi.NewEditMessageText(query.Message.Chat.ID, query.Message.MessageID, reply))
+		return
+	}
+
+	b.sender.Request(tgbotapi.NewEditMessageText(query.Message.Chat.ID, query.Message.MessageID, t(lang, "broadcast.started")))
+	startBroadcast(b, query.From.ID, query.Message.Chat.ID, lang, broadcastRecipients(b), text)
+}
+
+// Получатели рассылки: пользователи с активными сессиями и сохранённые в файле состояния,
+// кроме заблокировавших бота
+func broadcastRecipients(b *botInstance) []int64 {
+	recipients := b.sessions.UserIDs()
+	for _, userID := range knownUsers(b.cfg.Name) {
+		if !slices.Contains(recipients, userID) {
+			recipients = append(recipients, userID)
+		}
+	}
+	return slices.DeleteFunc(recipients, b.sessions.IsBlocked)
+}
+
+// Запускает рассылку и по её завершении отправляет отчёт администратору
+func startBroadcast(b *botInstance, adminID, adminChatID int64, lang string, recipients []int64, text string) {
+	b.log.Info("Запуск рассылки", "admin_id", adminID, "recipients", len(recipients))
+
+	// Рассылка выполняется в отдельной горутине, чтобы не задерживать обработку обычных сообщений
+	go func() {
+		delivered, failed, blocked := broadcast(b, recipients, text)
+		b.log.Info("Рассылка завершена", "delivered", delivered, "failed", failed, "blocked", blocked)
+		sendMessage(b, tgbotapi.NewMessage(adminChatID, t(lang, "broadcast.done", delivered, failed, blocked)))
+	}()
+}
+
+// Отправляет текст получателям с ограничением скорости config.BroadcastRate сообщений в секунду.
+// Повторы при 429 с ожиданием retry_after выполняет sendMessage.
+func broadcast(b *botInstance, recipients []int64, text string) (delivered, failed, blocked int) {
+	ticker := time.NewTicker(time.Second / time.Duration(config.BroadcastRate))
+	defer ticker.Stop()
+
+	for _, userID := range recipients {
+		<-ticker.C
+
+		err := sendMessage(b, tgbotapi.NewMessage(userID, text))
+		switch {
+		case err == nil:
+			delivered++
+		case isBlockedByUser(err):
+			blocked++
+		default:
+			failed++
+		}
+	}
+	return delivered, failed, blocked
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"proxyapi-bot/internal/openai"
+)
+
+const testAdminID = 1
+
+// Команда администратора в личном чате
+func commandMessage(userID int64, text string) *tgbotapi.Message {
+	message := privateMessage(userID, 1, text)
+	command, _, _ := strings.Cut(text, " ")
+	message.Entities = []tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: len(command)}}
+	return message
+}
+
+// Бот с пользователями users, у которых есть сессии
+func newBroadcastBot(t *testing.T, users ...int64) (*botInstance, *fakeSender) {
+	t.Helper()
+	b, sender := newTestBot(t, &openai.Mock{})
+	for _, userID := range users {
+		b.sessions.GetOrCreate(privateSession(userID))
+	}
+	return b, sender
+}
+
+// Доставленные, неудачные и заблокированные отправки считаются отдельно, а заблокировавший бота
+// пользователь исключается из следующих рассылок
+func TestBroadcastCounts(t *testing.T) {
+	useTestConfig(t, "")
+	b, sender := newBroadcastBot(t, 10, 20, 30, 40, 50)
+	sender.errors = map[int64]error{
+		20: &tgbotapi.Error{Code: 403, Message: "Forbidden: bot was blocked by the user"},
+		30: &tgbotapi.Error{Code: 400, Message: "Bad Request: chat not found"},
+	}
+
+	delivered, failed, blocked := broadcast(b, broadcastRecipients(b), "Бот будет недоступен с 22:00")
+	if delivered != 3 || failed != 1 || blocked != 1 {
+		t.Errorf("Доставлено %d, ошибок %d, заблокировали %d; want 3, 1, 1", delivered, failed, blocked)
+	}
+	if !b.sessions.IsBlocked(20) {
+		t.Error("Заблокировавший бота пользователь не отмечен")
+	}
+	recipients := broadcastRecipients(b)
+	slices.Sort(recipients)
+	if want := []int64{10, 30, 40, 50}; !slices.Equal(recipients, want) {
+		t.Errorf("Получатели следующей рассылки %v, want %v", recipients, want)
+	}
+}
+
+// Получатели — пользователи с сессиями и сохранённые в файле состояния, без повторов
+func TestBroadcastRecipients(t *testing.T) {
+	useTestConfig(t, "")
+	b, _ := newBroadcastBot(t, 10, 20)
+	rememberUser(b.cfg.Name, 20)
+	rememberUser(b.cfg.Name, 30)
+	rememberUser("other", 40)
+
+	recipients := broadcastRecipients(b)
+	slices.Sort(recipients)
+	if want := []int64{10, 20, 30}; !slices.Equal(recipients, want) {
+		t.Errorf("Получатели %v, want %v", recipients, want)
+	}
+}
+
+func TestBroadcastCommand(t *testing.T) {
+	tests := []struct {
+		name string
+		from int64
+		text string
+		want func() string
+	}{
+		{"не администратор", 10, "/broadcast привет", func() string { return translate("ru", "common.admin_only") }},
+		{"без текста", testAdminID, "/broadcast", func() string { return translate("ru", "broadcast.usage") }},
+		{"подсчёт получателей", testAdminID, "/broadcast_test", func() string { return translate("ru", "broadcast.recipients", 3) }},
+		{"рассылка", testAdminID, "/broadcast Новый прайс", func() string { return translate("ru", "broadcast.done", 3, 0, 0) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestConfig(t, "admin_ids: [1]\n")
+			b, sender := newBroadcastBot(t, 10, 20, 30)
+
+			handleBroadcastCommand(b, commandMessage(tt.from, tt.text), tt.text == "/broadcast_test")
+			sender.waitText(t, tt.want())
+		})
+	}
+}
+
+// Рассылка большой аудитории начинается после подтверждения, повторное нажатие её не повторяет
+func TestBroadcastConfirmation(t *testing.T) {
+	useTestConfig(t, "admin_ids: [1]\nbroadcast_confirm_threshold: 2\n")
+	b, sender := newBroadcastBot(t, 10, 20, 30)
+
+	handleBroadcastCommand(b, commandMessage(testAdminID, "/broadcast Новый прайс"), false)
+	sender.waitText(t, translate("ru", "broadcast.confirm", 3))
+	if slices.Contains(sender.texts(), "Новый прайс") {
+		t.Fatal("Рассылка начата до подтверждения")
+	}
+
+	callback := &tgbotapi.CallbackQuery{
+		ID:      "cb_1",
+		From:    &tgbotapi.User{ID: testAdminID, LanguageCode: "ru"},
+		Message: privateMessage(testAdminID, 5, ""),
+		Data:    broadcastConfirmData,
+	}
+	// Сессия администратора появилась при подготовке рассылки, поэтому он тоже получатель
+	handleBroadcastCallback(b, callback)
+	sender.waitText(t, translate("ru", "broadcast.done", 4, 0, 0))
+	handleBroadcastCallback(b, callback)
+	sender.waitText(t, translate("ru", "broadcast.nothing"))
+
+	delivered := 0
+	for _, text := range sender.texts() {
+		if text == "Новый прайс" {
+			delivered++
+		}
+	}
+	if delivered != 4 {
+		t.Errorf("Сообщение рассылки отправлено %d раз, want 4", delivered)
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"proxyapi-bot/internal/openai"
+)
+
+// checkReport — отчёт режима --check. Строки маскируются так же, как записи журнала.
+type checkReport struct {
+	w      io.Writer
+	failed bool
+}
+
+func (r *checkReport) ok(format string, args ...interface{}) {
+	fmt.Fprintln(r.w, "[OK]     "+redact(fmt.Sprintf(format, args...)))
+}
+
+func (r *checkReport) info(format string, args ...interface{}) {
+	fmt.Fprintln(r.w, "         "+redact(fmt.Sprintf(format, args...)))
+}
+
+func (r *checkReport) fail(format string, args ...interface{}) {
+	r.failed = true
+	fmt.Fprintln(r.w, "[ОШИБКА] "+redact(fmt.Sprintf(format, args...)))
+}
+
+// Проверяет настройки без запуска ботов: конфигурацию, ключ API и модели, токены Telegram
+// и файлы базы знаний. Используются те же клиенты и источники файлов, что и при обычном запуске,
+// но ассистенты и Vector Store не создаются. Возвращает true, если ошибок не найдено.
+func runCheck(w io.Writer, configPath string) bool {
+	report := &checkReport{w: w}
+
+	if err := loadConfig(configPath); err != nil {
+		report.fail("Конфигурация %s: %v", configPath, err)
+		return false
+	}
+	setRedactedSecrets(&config)
+	report.ok("Конфигурация %s загружена, ботов: %d", configPath, len(config.Bots))
+
+	ctx := context.Background()
+	api := newAPIClient(slog.Default())
+	models, err := api.ListModels(ctx)
+	if err != nil {
+		report.fail("Ключ API: %v", err)
+	} else {
+		report.ok("Ключ API принят, доступно моделей: %d", len(models))
+	}
+
+	for _, cfg := range config.Bots {
+		fmt.Fprintf(w, "\nБот %s\n", cfg.Name)
+		checkBotModel(report, cfg, models, err == nil)
+		checkBotTelegram(report, cfg)
+		checkBotFiles(ctx, report, cfg)
+	}
+
+	fmt.Fprintln(w)
+	if report.failed {
+		fmt.Fprintln(w, "Проверка завершена с ошибками")
+		return false
+	}
+	fmt.Fprintln(w, "Проверка завершена успешно")
+	return true
+}
+
+// Проверяет, что модель бота есть в списке моделей API
+func checkBotModel(report *checkReport, cfg BotConfig, models []string, listed bool) {
+	switch {
+	case !listed:
+		report.info("Модель %s не проверена: список моделей не получен", cfg.Model)
+	case config.Provider == openai.ProviderAzure:
+		// Azure OpenAI возвращает базовые модели, а не развёртывания
+		report.info("Модель %s не проверена: для azure используется развёртывание %s", cfg.Model, config.AzureDeployment)
+	case slices.Contains(models, cfg.Model):
+		report.ok("Модель %s доступна", cfg.Model)
+	default:
+		report.fail("Модель %s не найдена среди доступных моделей", cfg.Model)
+	}
+}
+
+// Проверяет токен бота запросом getMe
+func checkBotTelegram(report *checkReport, cfg BotConfig) {
+	tg, err := tgbotapi.NewBotAPI(cfg.TelegramBotToken)
+	if err != nil {
+		report.fail("Токен Telegram: %v", err)
+		return
+	}
+	report.ok("Токен Telegram принят, бот @%s", tg.Self.UserName)
+}
+
+// Перечисляет файлы, которые будут загружены в базу знаний, недоступные файлы и пропускаемые подкаталоги
+func checkBotFiles(ctx context.Context, report *checkReport, cfg BotConfig) {
+	source, _ := newBotFileSource(cfg) // Проверено при загрузке конфигурации
+	files, err := source.List(ctx)
+	if err != nil {
+		report.fail("Файлы базы знаний: %v", err)
+		return
+	}
+	if len(files) == 0 {
+		if config.AllowEmptyKnowledgeBase {
+			report.info("Файлы базы знаний: нет файлов для загрузки, бот будет работать без поиска по документам")
+		} else {
+			report.fail("Файлы базы знаний: нет файлов для загрузки, запуск будет прерван")
+		}
+	}
+
+	// Файлы открываются, чтобы найти недоступные до запуска, но не загружаются
+	var total int64
+	sizeKnown := true
+	readable := 0
+	for _, file := range files {
+		r, err := source.Open(ctx, file.Name)
+		if err != nil {
+			report.fail("не удастся загрузить: %s: %v", file.Name, err)
+			continue
+		}
+		r.Close()
+		readable++
+
+		if file.Size < 0 {
+			sizeKnown = false
+			report.info("будет загружен: %s", file.Name)
+			continue
+		}
+		total += file.Size
+		report.info("будет загружен: %s (%d байт)", file.Name, file.Size)
+	}
+
+	// Подкаталоги локального источника не загружаются
+	if combined, ok := source.(*combinedSource); ok {
+		source = combined.sources[0]
+	}
+	if local, ok := source.(localSource); ok {
+		entries, _ := os.ReadDir(local.dir)
+		for _, entry := range entries {
+			if entry.IsDir() {
+				report.info("будет пропущен: %s (каталог)", entry.Name())
+			}
+		}
+	}
+
+	if len(files) > 0 && readable == 0 && !config.AllowEmptyKnowledgeBase {
+		report.fail("Файлы базы знаний: ни один файл не открывается, запуск будет прерван")
+	}
+	if readable > 0 {
+		if sizeKnown {
+			report.ok("Файлов для загрузки: %d из %d, общий размер %d байт", readable, len(files), total)
+		} else {
+			report.ok("Файлов для загрузки: %d из %d, размер известен не для всех файлов", readable, len(files))
+		}
+	}
+}
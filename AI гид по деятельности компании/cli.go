@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Запуск бота в терминале недоступен для операций, которым нужен сервер Telegram
+var errCLIUnsupported = errors.New("Операция недоступна в режиме --cli")
+
+// HTML-теги ответов, отправляемых в Telegram с ParseMode HTML
+var htmlTagPattern = regexp.MustCompile(`<[^>]+>`)
+
+// cliSender выводит сообщения бота в терминал вместо отправки в Telegram.
+// Ответ ассистента выводится по фрагментам по мере поступления, поэтому при отправке
+// того же ответа сообщением повторно печатается только текст, которого не было в потоке.
+type cliSender struct {
+	mu  sync.Mutex
+	out io.Writer
+	// Выведенный по фрагментам текст, ещё не сопоставленный с отправленными сообщениями
+	streamed  string
+	messageID int
+}
+
+// Выводит очередной фрагмент ответа ассистента
+func (s *cliSender) onDelta(text string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.streamed == "" {
+		fmt.Fprint(s.out, "\n")
+	}
+	s.streamed += text
+	fmt.Fprint(s.out, text)
+}
+
+// Печатает текст сообщения, пропуская уже выведенную по фрагментам часть
+func (s *cliSender) printLocked(text string) {
+	if s.streamed != "" {
+		fmt.Fprint(s.out, "\n")
+		switch {
+		// Длинный ответ отправляется несколькими сообщениями, каждое из них — часть потока
+		case strings.HasPrefix(s.streamed, text):
+			s.streamed = strings.TrimLeft(s.streamed[len(text):], "\n")
+			if s.streamed == "" {
+				fmt.Fprint(s.out, "> ")
+			}
+			return
+		// К ответу могут быть добавлены пометки, которых не было в потоке
+		case strings.HasPrefix(text, s.streamed):
+			text = strings.TrimLeft(text[len(s.streamed):], "\n")
+		}
+		s.streamed = ""
+		if text == "" {
+			fmt.Fprint(s.out, "> ")
+			return
+		}
+	}
+	fmt.Fprintf(s.out, "\n%s\n> ", text)
+}
+
+func (s *cliSender) Send(c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch msg := c.(type) {
+	case tgbotapi.MessageConfig:
+		text := msg.Text
+		if msg.ParseMode == tgbotapi.ModeHTML {
+			text = html.UnescapeString(htmlTagPattern.ReplaceAllString(text, ""))
+		}
+		if markup, ok := msg.ReplyMarkup.(tgbotapi.InlineKeyboardMarkup); ok {
+			for _, row := range markup.InlineKeyboard {
+				for _, button := range row {
+					text += "\n[" + button.Text + "]"
+				}
+			}
+		}
+		s.printLocked(text)
+	case tgbotapi.DocumentConfig:
+		s.printLocked(msg.Caption)
+	case tgbotapi.PhotoConfig:
+		s.printLocked("(изображение)")
+	case tgbotapi.VoiceConfig:
+		s.printLocked("(голосовое сообщение)")
+	}
+
+	s.messageID++
+	return tgbotapi.Message{MessageID: s.messageID, Date: int(time.Now().Unix())}, nil
+}
+
+func (s *cliSender) Request(c tgbotapi.Chattable) (*tgbotapi.APIResponse, error) {
+	return &tgbotapi.APIResponse{Ok: true}, nil
+}
+
+func (s *cliSender) GetFileDirectURL(fileID string) (string, error) {
+	return "", errCLIUnsupported
+}
+
+// streamObserver передаёт фрагменты ответа в onDelta, а остальные сведения о запуске —
+// в отладку, которая может быть выключена (нулевой указатель)
+type streamObserver struct {
+	*runDebug
+	onDelta func(text string)
+}
+
+func (o streamObserver) OnDelta(text string) {
+	o.onDelta(text)
+}
+
+// Пользователь, от имени которого пишет CLI: первый администратор, чтобы были доступны
+// команды администратора, или условный ID, если администраторы не заданы
+func cliUserID() int64 {
+	if len(config.AdminIDs) > 0 {
+		return config.AdminIDs[0]
+	}
+	return 1
+}
+
+// Запускает диалог с ассистентом первого бота из конфигурации в терминале без Telegram.
+// Сообщения проходят тот же путь, что и сообщения из Telegram: команды, сессия, запуск
+// ассистента и отправка ответа, только отправка выполняется в терминал.
+// /reset сбрасывает контекст, /quit завершает работу. Возвращает код завершения программы.
+func runCLI(in io.Reader, out io.Writer) int {
+	b := newBotInstance(config.Bots[0])
+	sender := &cliSender{out: out}
+	b.sender = sender
+	b.onDelta = sender.onDelta
+
+	if err := setupAssistant(context.Background(), b); err != nil {
+		fmt.Fprintln(out, redact(err.Error()))
+		return 1
+	}
+
+	updates := make(chan tgbotapi.Update)
+	go handleTelegramUpdates(b, updates)
+	defer close(updates)
+
+	user := &tgbotapi.User{ID: cliUserID(), FirstName: "cli"}
+	chat := &tgbotapi.Chat{ID: user.ID, Type: "private"}
+
+	fmt.Fprintf(out, "Бот %s готов. /reset — сбросить контекст, /quit — выход\n> ", b.cfg.Name)
+	scanner := bufio.NewScanner(in)
+	for updateID := 1; scanner.Scan(); updateID++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "/quit" {
+			return 0
+		}
+		if text == "" {
+			fmt.Fprint(out, "> ")
+			continue
+		}
+
+		message := &tgbotapi.Message{
+			MessageID: updateID,
+			From:      user,
+			Chat:      chat,
+			Date:      int(time.Now().Unix()),
+			Text:      text,
+		}
+		// Команда распознаётся по сущности bot_command, как в сообщениях Telegram
+		if strings.HasPrefix(text, "/") {
+			command, _, _ := strings.Cut(text, " ")
+			message.Entities = []tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: len(command)}}
+		}
+		updates <- tgbotapi.Update{UpdateID: updateID, Message: message}
+	}
+	return 0
+}
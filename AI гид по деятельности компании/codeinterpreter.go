@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"proxyapi-bot/internal/openai"
+)
+
+const (
+	// Наибольшая длина вывода кода: сообщение с ним и заголовком должно уместиться в лимит Telegram
+	codeOutputLimit = 3500
+	// Наибольшая длина подписи к фотографии или документу в Telegram
+	telegramCaptionLimit = 1024
+	// Наибольший размер фотографии, которую принимает Telegram. Изображения больше отправляются документом
+	telegramPhotoMaxBytes = 10 << 20
+)
+
+// Можно ли отправить ответ подписью к первому файлу ассистента вместо отдельного сообщения.
+// Потоковый ответ уже показан пользователю, голосовой и ответ документом отправляются как обычно.
+func captionAnswer(b *botInstance, run runRequest, answer string, result openai.RunResult) bool {
+	return len(result.Files) > 0 && answer != "" && b.onDelta == nil && !run.Voice && !run.AsFile &&
+		utf8.RuneCountInString(answer) <= telegramCaptionLimit
+}
+
+// Отправляет пользователю после ответа вывод кода и файлы, созданные инструментом code_interpreter.
+// Изображения отправляются фотографиями, остальные файлы — документами. Непустой caption
+// становится подписью к первому файлу, а если его отправить не удалось — отдельным сообщением.
+func sendRunOutputs(ctx context.Context, b *botInstance, chatID int64, lang string, result openai.RunResult, caption string) {
+	log := requestLog(ctx, b.log)
+
+	if config.CodeOutputMaxChars > 0 && len(result.CodeOutputs) > 0 {
+		output := truncateRunes(strings.Join(result.CodeOutputs, "\n"), config.CodeOutputMaxChars)
+		msg := tgbotapi.NewMessage(chatID, t(lang, "code.output")+"\n<pre>"+html.EscapeString(output)+"</pre>")
+		msg.ParseMode = tgbotapi.ModeHTML
+		sendMessage(b, msg)
+	}
+
+	for i, file := range result.Files {
+		name := file.Name
+		if name == "" || name == "." || name == "/" {
+			name = fmt.Sprintf("file-%d", i+1)
+			if file.Image {
+				name = fmt.Sprintf("image-%d.png", i+1)
+			}
+		}
+
+		if err := sendGeneratedFile(ctx, b, chatID, file, name, caption); err != nil {
+			log.Error("Ошибка отправки файла ассистента", "file_id", file.FileID, "error", err)
+			text := t(lang, "code.file_failed")
+			if errors.Is(err, openai.ErrFileTooLarge) {
+				text = t(lang, "code.file_too_large", name, config.CodeFileMaxBytes>>20)
+			}
+			if caption != "" {
+				text = caption + "\n\n" + text
+			}
+			sendMessage(b, tgbotapi.NewMessage(chatID, text))
+		} else {
+			log.Info("Файл ассистента отправлен пользователю", "file_id", file.FileID, "file_name", name, "image", file.Image)
+		}
+		caption = ""
+	}
+}
+
+// Скачивает файл ассистента во временный файл и отправляет его пользователю.
+// Временный файл удаляется после отправки.
+func sendGeneratedFile(ctx context.Context, b *botInstance, chatID int64, file openai.GeneratedFile, name, caption string) error {
+	tmp, err := os.CreateTemp("", "assistant-file-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if err := b.api.DownloadFile(ctx, file.FileID, tmp, config.CodeFileMaxBytes); err != nil {
+		return err
+	}
+	size, err := tmp.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	data := tgbotapi.FileReader{Name: name, Reader: tmp}
+	if file.Image && size <= telegramPhotoMaxBytes {
+		photo := tgbotapi.NewPhoto(chatID, data)
+		photo.Caption = caption
+		_, err = b.sender.Send(photo)
+		return err
+	}
+	doc := tgbotapi.NewDocument(chatID, data)
+	doc.Caption = caption
+	_, err = b.sender.Send(doc)
+	return err
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	"proxyapi-bot/internal/openai"
+)
+
+// Ассистент, создавший график и CSV. Содержимое файлов отдаёт DownloadFile
+// с ограничением размера, как настоящий клиент
+func generatedFilesAPI(text string, contents map[string]string) *openai.Mock {
+	return &openai.Mock{
+		CreateThreadRunFunc: func(ctx context.Context, req openai.RunRequest, observer openai.RunObserver) (openai.RunResult, error) {
+			return openai.RunResult{
+				Text:        text,
+				RunID:       "run_test",
+				Files:       []openai.GeneratedFile{{FileID: "file-img", Image: true}, {FileID: "file-csv", Name: "report.csv"}},
+				CodeOutputs: []string{"rows: 2"},
+			}, nil
+		},
+		DownloadFileFunc: func(ctx context.Context, fileID string, w io.Writer, maxBytes int64) error {
+			content := contents[fileID]
+			if int64(len(content)) > maxBytes {
+				return openai.ErrFileTooLarge
+			}
+			_, err := io.WriteString(w, content)
+			return err
+		},
+	}
+}
+
+// Изображение отправляется фотографией с ответом в подписи, файл — документом, а временные
+// файлы удаляются после отправки
+func TestCodeInterpreterFiles(t *testing.T) {
+	useTestConfig(t, "code_output_max_chars: 1000\n")
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+	b, sender := newTestBot(t, generatedFilesAPI("Вот график продаж", map[string]string{"file-img": "PNG", "file-csv": "a,b\n1,2\n"}))
+
+	handleUserQuery(context.Background(), b, privateMessage(100, 1, "Построй график"), "Построй график", "", "", false, false)
+	waitQueues(t, b)
+
+	want := []sentFile{
+		{Name: "image-1.png", Caption: "Вот график продаж", Photo: true, Data: "PNG"},
+		{Name: "report.csv", Data: "a,b\n1,2\n"},
+	}
+	if got := sender.sentFiles(); !slices.Equal(got, want) {
+		t.Errorf("Отправлены файлы %+v, want %+v", got, want)
+	}
+	texts := sender.texts()
+	if slices.Contains(texts, "Вот график продаж") {
+		t.Error("Ответ отправлен отдельным сообщением, хотя стал подписью к изображению")
+	}
+	if len(texts) == 0 || !strings.Contains(texts[0], "rows: 2") {
+		t.Errorf("Вывод кода не отправлен: %q", texts)
+	}
+	if entries, _ := os.ReadDir(tmp); len(entries) != 0 {
+		t.Errorf("Временные файлы не удалены: %v", entries)
+	}
+}
+
+// Файл больше code_file_max_bytes не отправляется, пользователь получает сообщение о размере,
+// а подпись не теряется
+func TestCodeInterpreterFileTooLarge(t *testing.T) {
+	useTestConfig(t, "code_file_max_bytes: 4\n")
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+	b, sender := newTestBot(t, generatedFilesAPI("Вот график продаж", map[string]string{"file-img": "large image", "file-csv": "a,b"}))
+
+	handleUserQuery(context.Background(), b, privateMessage(100, 1, "Построй график"), "Построй график", "", "", false, false)
+	waitQueues(t, b)
+
+	sender.waitText(t, "Вот график продаж\n\n"+translate("ru", "code.file_too_large", "image-1.png", int64(0)))
+	if want := []sentFile{{Name: "report.csv", Data: "a,b"}}; !slices.Equal(sender.sentFiles(), want) {
+		t.Errorf("Отправлены файлы %+v, want %+v", sender.sentFiles(), want)
+	}
+	if entries, _ := os.ReadDir(tmp); len(entries) != 0 {
+		t.Errorf("Временные файлы не удалены: %v", entries)
+	}
+}
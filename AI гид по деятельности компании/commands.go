@@ -0,0 +1,245 @@
+package main
+
+import (
+	"html"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Обработчики служебных команд по имени команды. Новая команда добавляется сюда
+var commandHandlers = map[string]func(b *botInstance, message *tgbotapi.Message){
+	"allow":            handleAllowCommand,
+	"stats":            handleStatsCommand,
+	"debug":            handleDebugCommand,
+	"status":           handleStatusCommand,
+	"temp":             handleTempCommand,
+	"model":            handleModelCommand,
+	"language":         handleLanguageCommand,
+	"reset":            handleResetCommand,
+	"instruct":         handleInstructCommand,
+	"voice_on":         func(b *botInstance, message *tgbotapi.Message) { handleVoiceCommand(b, message, true) },
+	"voice_off":        func(b *botInstance, message *tgbotapi.Message) { handleVoiceCommand(b, message, false) },
+	"broadcast":        func(b *botInstance, message *tgbotapi.Message) { handleBroadcastCommand(b, message, false) },
+	"broadcast_test":   func(b *botInstance, message *tgbotapi.Message) { handleBroadcastCommand(b, message, true) },
+	"good":             func(b *botInstance, message *tgbotapi.Message) { handleRateCommand(b, message, feedbackGood) },
+	"bad":              func(b *botInstance, message *tgbotapi.Message) { handleRateCommand(b, message, feedbackBad) },
+	"feedback":         handleFeedbackCommand,
+	"operator":         handleOperatorCommand,
+	"cache_clear":      handleCacheClearCommand,
+	"set_instructions": handleSetInstructionsCommand,
+	"list_files":       handleListFilesCommand,
+	"kb_list":          handleListFilesCommand,
+	"delete_file":      handleDeleteFileCommand,
+	"kb_remove":        handleKBRemoveCommand,
+	"export":           handleExportCommand,
+	"table":            handleTableCommand,
+	"stop":             handleStopCommand,
+	"version":          handleVersionCommand,
+}
+
+// Команда сообщения: имя без «/» и «@бота» в нижнем регистре и аргументы без крайних пробелов
+type botCommand struct {
+	Name string
+	Args string
+}
+
+// Разбирает команду сообщения. ok = false — сообщение не команда или команда вида
+// /команда@бот адресована другому боту в группе.
+func parseCommand(b *botInstance, message *tgbotapi.Message) (cmd botCommand, ok bool) {
+	if !message.IsCommand() {
+		return botCommand{}, false
+	}
+	if _, target, found := strings.Cut(message.CommandWithAt(), "@"); found && b.username != "" && !strings.EqualFold(target, b.username) {
+		return botCommand{}, false
+	}
+	return botCommand{Name: strings.ToLower(message.Command()), Args: commandArgs(message)}, true
+}
+
+// Аргументы команды без крайних пробелов
+func commandArgs(message *tgbotapi.Message) string {
+	return strings.TrimSpace(message.CommandArguments())
+}
+
+// Обрабатывает служебные команды бота.
+// Возвращает true, если сообщение было командой и обработано, иначе сообщение передаётся ассистенту.
+func handleCommand(b *botInstance, message *tgbotapi.Message, cmd botCommand) bool {
+	handler, ok := commandHandlers[cmd.Name]
+	if !ok {
+		return false
+	}
+	handler(b, message)
+	return true
+}
+
+// /allow <user_id> — выдаёт пользователю доступ к боту без перезапуска
+func handleAllowCommand(b *botInstance, message *tgbotapi.Message) {
+	lang := userLanguage(b, message.From)
+	if !isAdmin(message.From.ID) {
+		sendMessage(b, tgbotapi.NewMessage(message.Chat.ID, t(lang, "common.admin_only")))
+		return
+	}
+
+	userID, err := strconv.ParseInt(commandArgs(message), 10, 64)
+	if err != nil {
+		sendMessage(b, tgbotapi.NewMessage(message.Chat.ID, t(lang, "allow.usage")))
+		return
+	}
+
+	if err := allowUser(userID); err != nil {
+		b.log.Error("Ошибка сохранения списка разрешённых пользователей", "error", err)
+		sendMessage(b, tgbotapi.NewMessage(message.Chat.ID, t(lang, "allow.save_failed")))
+		return
+	}
+
+	b.log.Info("Пользователю выдан доступ", "user_id", userID, "admin_id", message.From.ID)
+	sendMessage(b, tgbotapi.NewMessage(message.Chat.ID, t(lang, "allow.done", userID)))
+}
+
+// /stats — показывает администратору метрики работы бота
+func handleStatsCommand(b *botInstance, message *tgbotapi.Message) {
+	if !isAdmin(message.From.ID) {
+		sendMessage(b, tgbotapi.NewMessage(message.Chat.ID, t(userLanguage(b, message.From), "common.admin_only")))
+		return
+	}
+
+	// Моноширинный блок удобнее читать с телефона
+	msg := tgbotapi.NewMessage(message.Chat.ID, "<pre>"+html.EscapeString(metrics.Report(b.sessions.Len())+quotaReport()+spendReport())+"</pre>")
+	msg.ParseMode = tgbotapi.ModeHTML
+	sendMessage(b, msg)
+}
+
+// /status — показывает администратору загрузку: выполняющиеся запуски и очередь
+func handleStatusCommand(b *botInstance, message *tgbotapi.Message) {
+	lang := userLanguage(b, message.From)
+	if !isAdmin(message.From.ID) {
+		sendMessage(b, tgbotapi.NewMessage(message.Chat.ID, t(lang, "common.admin_only")))
+		return
+	}
+
+	reply := t(lang, "status.report",
+		runSlots.InFlight(), runSlots.Capacity(), runSlots.Queued(), runBreaker.State())
+	sendMessage(b, tgbotapi.NewMessage(message.Chat.ID, reply))
+}
+
+// /temp <value> — задаёт температуру для ответов пользователю,
+// /temp reset — возвращает значение по умолчанию, /temp без аргументов — показывает текущее
+func handleTempCommand(b *botInstance, message *tgbotapi.Message) {
+	lang := userLanguage(b, message.From)
+	session := b.sessions.GetOrCreate(chatSession(message.Chat, message.From.ID))
+	args := commandArgs(message)
+
+	var reply string
+	session.mu.Lock()
+	switch args {
+	case "":
+		current := *config.Temperature
+		if session.Temperature != nil {
+			current = *session.Temperature
+		}
+		reply = t(lang, "temp.current", current)
+	case "language":
+		handleLanguageCommand(b, message)
+	case "reset":
+		session.Temperature = nil
+		reply = t(lang, "temp.reset", *config.Temperature)
+	default:
+		value, err := strconv.ParseFloat(strings.Replace(args, ",", ".", 1), 64)
+		if err != nil || validateTemperature(value) != nil {
+			reply = t(lang, "temp.usage")
+		} else {
+			session.Temperature = &value
+			reply = t(lang, "temp.set", value)
+		}
+	}
+	session.mu.Unlock()
+
+	sendMessage(b, tgbotapi.NewMessage(message.Chat.ID, reply))
+}
+
+// /reset — очищает историю диалога. Новый поток будет создан при следующем вопросе
+func handleResetCommand(b *botInstance, message *tgbotapi.Message) {
+	threadID := resetSession(b.sessions.GetOrCreate(chatSession(message.Chat, message.From.ID)))
+	if threadID != "" && config.DeleteUnusedThreads {
+		deleteThreadLater(b, threadID)
+	}
+	b.log.Info("Контекст диалога сброшен", "user_id", message.From.ID)
+	sendMessage(b, tgbotapi.NewMessage(message.Chat.ID, t(userLanguage(b, message.From), "reset.done")))
+}
+
+// Очищает историю диалога и настройки, заданные пользователем для диалога.
+// Возвращает ID потока, который больше не используется сессией.
+func resetSession(session *UserSession) (threadID string) {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	threadID = session.ThreadID
+	session.dropped += len(session.Messages)
+	session.Messages = []map[string]interface{}{}
+	session.ThreadID = ""
+	session.AdditionalInstructions = ""
+	session.Model = ""
+	session.lastFailedRun = nil
+	session.lastQuery = ""
+	return threadID
+}
+
+// /instruct <text> — задаёт дополнительные указания ассистенту для ответов пользователю,
+// /instruct reset — удаляет их, /instruct без аргументов — показывает текущие
+func handleInstructCommand(b *botInstance, message *tgbotapi.Message) {
+	lang := userLanguage(b, message.From)
+	session := b.sessions.GetOrCreate(chatSession(message.Chat, message.From.ID))
+	args := commandArgs(message)
+
+	var reply string
+	session.mu.Lock()
+	switch {
+	case args == "" && session.AdditionalInstructions == "":
+		reply = t(lang, "instruct.usage", config.MaxInstructionsChars)
+	case args == "":
+		reply = t(lang, "instruct.current", session.AdditionalInstructions)
+	case args == "reset":
+		session.AdditionalInstructions = ""
+		reply = t(lang, "instruct.reset")
+	case utf8.RuneCountInString(args) > config.MaxInstructionsChars:
+		reply = t(lang, "instruct.too_long", config.MaxInstructionsChars)
+	default:
+		session.AdditionalInstructions = args
+		reply = t(lang, "instruct.set")
+	}
+	session.mu.Unlock()
+
+	sendMessage(b, tgbotapi.NewMessage(message.Chat.ID, reply))
+}
+
+// Объединяет указания из конфигурации и указания пользователя
+func joinInstructions(parts ...string) string {
+	var nonEmpty []string
+	for _, part := range parts {
+		if part = strings.TrimSpace(part); part != "" {
+			nonEmpty = append(nonEmpty, part)
+		}
+	}
+	return strings.Join(nonEmpty, "\n\n")
+}
+
+// /voice_on и /voice_off — включают и выключают голосовые ответы
+func handleVoiceCommand(b *botInstance, message *tgbotapi.Message, enabled bool) {
+	lang := userLanguage(b, message.From)
+	if config.TTSMode == ttsModeOff {
+		sendMessage(b, tgbotapi.NewMessage(message.Chat.ID, t(lang, "voice.disabled")))
+		return
+	}
+
+	session := b.sessions.GetOrCreate(chatSession(message.Chat, message.From.ID))
+	session.mu.Lock()
+	session.VoiceReplies = enabled
+	session.mu.Unlock()
+
+	reply := t(lang, "voice.replies_off")
+	if enabled {
+		reply = t(lang, "voice.replies_on")
+	}
+	sendMessage(b, tgbotapi.NewMessage(message.Chat.ID, reply))
+}
@@ -0,0 +1,101 @@
+package main
+
+import "unicode/utf8"
+
+// Окна контекста моделей OpenAI в токенах. Значения из model_context_limits заменяют эти
+var defaultContextLimits = map[string]int{
+	"gpt-4o":        128000,
+	"gpt-4o-mini":   128000,
+	"gpt-4.1":       1047576,
+	"gpt-4.1-mini":  1047576,
+	"gpt-4.1-nano":  1047576,
+	"gpt-4-turbo":   128000,
+	"gpt-4":         8192,
+	"gpt-3.5-turbo": 16385,
+	"o1":            200000,
+	"o1-mini":       128000,
+	"o3":            200000,
+	"o3-mini":       200000,
+	"o4-mini":       200000,
+}
+
+// Сколько токенов оставляется под ответ, если max_completion_tokens не задан
+const defaultCompletionReserve = 4096
+
+// Возвращает окно контекста модели в токенах. false — окно неизвестно
+func modelContextLimit(model string) (int, bool) {
+	return lookupModel(model, config.ModelContextLimits, defaultContextLimits)
+}
+
+// Возвращает, сколько токенов может занять история диалога с моделью. Из окна контекста
+// вычитается место под ответ и четверть оставшегося под инструкции ассистента и результаты
+// поиска по базе знаний. 0 — окно модели неизвестно и история обрезается только по числу сообщений.
+func historyTokenBudget(b *botInstance, model string) int {
+	limit, ok := modelContextLimit(model)
+	if !ok {
+		return 0
+	}
+	completion := b.cfg.MaxCompletionTokens
+	if completion == 0 {
+		completion = defaultCompletionReserve
+	}
+	prompt := limit - completion
+	if b.cfg.MaxPromptTokens > 0 {
+		prompt = min(prompt, b.cfg.MaxPromptTokens)
+	}
+	return max(prompt-prompt/4, 1)
+}
+
+// Модель, которой ответит ассистент: выбранная пользователем или модель бота
+func sessionModel(b *botInstance, session *UserSession) string {
+	if session.Model != "" {
+		return session.Model
+	}
+	return b.cfg.Model
+}
+
+// Оценивает число токенов в тексте без токенизатора: в среднем токен — около трёх символов
+// русского текста, поэтому для английского оценка получается с запасом
+func estimateTokens(text string) int {
+	return utf8.RuneCountInString(text)/3 + 1
+}
+
+// Оценивает число токенов сообщения истории: учитывается только текст, изображения и вложения
+// считаются в запасе под инструкции
+func estimateMessageTokens(message map[string]interface{}) int {
+	tokens := 4 // Служебные токены роли и границ сообщения
+	switch content := message["content"].(type) {
+	case string:
+		tokens += estimateTokens(content)
+	case []map[string]interface{}:
+		for _, part := range content {
+			if text, ok := part["text"].(string); ok {
+				tokens += estimateTokens(text)
+			}
+		}
+	}
+	return tokens
+}
+
+// Обрезает историю по числу сообщений, а затем по окну контекста модели сессии: старые
+// сообщения отбрасываются, пока история не уложится в historyTokenBudget. Последнее сообщение
+// остаётся всегда. Вызывается под session.mu.
+func trimHistory(b *botInstance, session *UserSession) {
+	if limit := contextLimit(b, session); len(session.Messages) > limit {
+		session.dropped += len(session.Messages) - limit
+		session.Messages = session.Messages[len(session.Messages)-limit:]
+	}
+	budget := historyTokenBudget(b, sessionModel(b, session))
+	if budget == 0 {
+		return
+	}
+	tokens := 0
+	for i := len(session.Messages) - 1; i >= 0; i-- {
+		tokens += estimateMessageTokens(session.Messages[i])
+		if tokens > budget && i < len(session.Messages)-1 {
+			session.dropped += i + 1
+			session.Messages = session.Messages[i+1:]
+			return
+		}
+	}
+}
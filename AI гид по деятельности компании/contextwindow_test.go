@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"proxyapi-bot/internal/openai"
+)
+
+func TestModelContextLimit(t *testing.T) {
+	useTestConfig(t, "model_context_limits:\n  gpt-4o: 64000\n  my-model: 5000\n")
+
+	tests := []struct {
+		model  string
+		want   int
+		wantOK bool
+	}{
+		// Значение из конфигурации заменяет встроенное
+		{"gpt-4o", 64000, true},
+		{"gpt-4o-2024-08-06", 64000, true},
+		{"my-model", 5000, true},
+		// Самый длинный подходящий префикс: gpt-4o-mini, а не gpt-4o из конфигурации
+		{"gpt-4o-mini", 128000, true},
+		{"gpt-4", 8192, true},
+		{"o3-mini-2025-01-31", 200000, true},
+		{"unknown-model", 0, false},
+	}
+	for _, tt := range tests {
+		if got, ok := modelContextLimit(tt.model); got != tt.want || ok != tt.wantOK {
+			t.Errorf("modelContextLimit(%q) = %d, %v; want %d, %v", tt.model, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+// Из окна контекста вычитается место под ответ и четверть остатка под инструкции и поиск
+func TestHistoryTokenBudget(t *testing.T) {
+	tests := []struct {
+		name  string
+		extra string
+		want  int
+	}{
+		{"место под ответ по умолчанию", "", (20000 - defaultCompletionReserve) * 3 / 4},
+		{"max_completion_tokens", "max_completion_tokens: 1000\n", 19000 - 19000/4},
+		{"max_prompt_tokens меньше окна", "max_completion_tokens: 1000\nmax_prompt_tokens: 8000\n", 6000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestConfig(t, "model_context_limits:\n  gpt-4o: 20000\n"+tt.extra)
+			b, _ := newTestBot(t, &openai.Mock{})
+			if got := historyTokenBudget(b, "gpt-4o"); got != tt.want {
+				t.Errorf("historyTokenBudget = %d, want %d", got, tt.want)
+			}
+			if got := historyTokenBudget(b, "unknown-model"); got != 0 {
+				t.Errorf("Для неизвестной модели historyTokenBudget = %d, want 0", got)
+			}
+		})
+	}
+}
+
+// Сообщение истории примерно из tokens токенов
+func historyMessage(role string, tokens int) map[string]interface{} {
+	return map[string]interface{}{"role": role, "content": strings.Repeat("абв", tokens-5)}
+}
+
+// История обрезается по окну контекста модели сессии, но последнее сообщение остаётся всегда
+func TestTrimHistoryByTokens(t *testing.T) {
+	// Бюджет истории: (5500 - 4096) * 3/4 = 1053 токена
+	useTestConfig(t, "max_context_messages: 20\nmodel_context_limits:\n  gpt-4o: 5500\n  small: 4200\n")
+	b, _ := newTestBot(t, &openai.Mock{})
+
+	session := &UserSession{}
+	for i := range 6 {
+		session.Messages = append(session.Messages, historyMessage([]string{"user", "assistant"}[i%2], 300))
+	}
+	trimHistory(b, session)
+	if len(session.Messages) != 3 {
+		t.Errorf("После обрезки %d сообщений, want 3", len(session.Messages))
+	}
+
+	// Модель, выбранная пользователем, с окном меньше одного сообщения
+	session.Model = "small"
+	trimHistory(b, session)
+	if len(session.Messages) != 1 {
+		t.Errorf("После обрезки по окну small %d сообщений, want 1", len(session.Messages))
+	}
+
+	// Окно неизвестной модели не ограничивает историю
+	session.Model = "unknown-model"
+	session.Messages = append(session.Messages, historyMessage("user", 5000), historyMessage("assistant", 5000))
+	trimHistory(b, session)
+	if len(session.Messages) != 3 {
+		t.Errorf("Для неизвестной модели %d сообщений, want 3", len(session.Messages))
+	}
+}
+
+// Вопрос, который один не помещается в окно контекста, отклоняется без запуска ассистента
+func TestQueryExceedsContextWindow(t *testing.T) {
+	useTestConfig(t, "model_context_limits:\n  gpt-4o: 5500\n")
+	runs := 0
+	b, sender := newTestBot(t, &openai.Mock{
+		CreateThreadRunFunc: func(ctx context.Context, req openai.RunRequest, observer openai.RunObserver) (openai.RunResult, error) {
+			runs++
+			return openai.RunResult{Text: "ответ"}, nil
+		},
+	})
+	const userID = 100
+
+	// Около 1167 токенов при бюджете 1053
+	long := strings.Repeat("абв", 1167)
+	handleUserQuery(context.Background(), b, privateMessage(userID, 1, long), long, "", "", false, false)
+	waitQueues(t, b)
+	sender.waitText(t, translate("ru", "query.too_long"))
+	if runs != 0 {
+		t.Fatalf("Ассистент запущен %d раз для слишком длинного вопроса", runs)
+	}
+	if session, ok := b.sessions.Get(privateSession(userID)); ok && len(session.Messages) != 0 {
+		t.Errorf("Слишком длинный вопрос попал в историю: %d сообщений", len(session.Messages))
+	}
+
+	handleUserQuery(context.Background(), b, privateMessage(userID, 2, "короткий вопрос"), "короткий вопрос", "", "", false, false)
+	waitQueues(t, b)
+	if runs != 1 {
+		t.Errorf("Ассистент запущен %d раз для короткого вопроса, want 1", runs)
+	}
+}
+
+// При запуске в журнал пишется окно контекста модели бота или предупреждение, что оно неизвестно
+func TestSetupAssistantLogsContextLimit(t *testing.T) {
+	tests := []struct {
+		model string
+		want  string
+	}{
+		{"gpt-4o", "context_tokens=128000"},
+		{"unknown-model", "Окно контекста модели неизвестно"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			useTestConfig(t, "")
+			newFakeOpenAI(t, "")
+			writeKnowledgeBase(t, "about.txt")
+			b, _ := newSenderBot(t)
+			b.cfg.Model = tt.model
+			var log bytes.Buffer
+			b.log = slog.New(slog.NewTextHandler(&log, nil))
+
+			if err := setupAssistant(context.Background(), b); err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(log.String(), tt.want) {
+				t.Errorf("В журнале нет %q:\n%s", tt.want, log.String())
+			}
+		})
+	}
+}
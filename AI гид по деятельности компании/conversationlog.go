@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"proxyapi-bot/internal/openai"
+)
+
+// Запись журнала диалогов: один вопрос и ответ на него
+type conversationEntry struct {
+	Time          time.Time    `json:"time"`
+	Bot           string       `json:"bot"`
+	UserID        string       `json:"user_id"`
+	Question      string       `json:"question"`
+	Answer        string       `json:"answer,omitempty"`
+	LatencyMs     int64        `json:"latency_ms"`
+	Usage         openai.Usage `json:"usage"`
+	ErrorCategory string       `json:"error_category,omitempty"`
+	// Маршрут вопроса при routing_enabled, например smalltalk/chat
+	Route string `json:"route,omitempty"`
+}
+
+// conversationLogWriter пишет журнал диалогов в файлы JSON Lines, по одному на день:
+// для conversation_log_path "logs/conversations.jsonl" это logs/conversations-2024-06-01.jsonl.
+// Нулевой указатель означает, что журнал отключён, и все методы ничего не делают.
+type conversationLogWriter struct {
+	mu   sync.Mutex
+	base string
+	ext  string
+	salt string
+	day  string
+	file *os.File
+	buf  *bufio.Writer
+}
+
+var conversationLog *conversationLogWriter
+
+// Открывает журнал диалогов и запускает периодический сброс буфера на диск
+func openConversationLog(path, salt string) (*conversationLogWriter, error) {
+	ext := filepath.Ext(path)
+	w := &conversationLogWriter{base: strings.TrimSuffix(path, ext), ext: ext, salt: salt}
+
+	w.mu.Lock()
+	err := w.openLocked(time.Now())
+	w.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		for range time.Tick(time.Second) {
+			w.Flush()
+		}
+	}()
+	return w, nil
+}
+
+// Открывает файл журнала за день, к которому относится время now
+func (w *conversationLogWriter) openLocked(now time.Time) error {
+	day := now.Format(time.DateOnly)
+	path := w.base + "-" + day + w.ext
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("Ошибка открытия журнала диалогов: %v", err)
+	}
+
+	w.day = day
+	w.file = file
+	w.buf = bufio.NewWriter(file)
+	return nil
+}
+
+// Возвращает ID пользователя для журнала: хеш с солью, если она задана
+func (w *conversationLogWriter) userKey(userID int64) string {
+	id := strconv.FormatInt(userID, 10)
+	if w.salt == "" {
+		return id
+	}
+	sum := sha256.Sum256([]byte(w.salt + id))
+	return hex.EncodeToString(sum[:8])
+}
+
+// Добавляет в журнал завершённый обмен сообщениями. Для неудавшегося запроса передаётся категория ошибки,
+// для вопроса, прошедшего маршрутизацию, — её решение.
+func (w *conversationLogWriter) Write(bot string, userID int64, question, answer string, latency time.Duration, usage openai.Usage, errorCategory, route string) {
+	if w == nil {
+		return
+	}
+
+	now := time.Now()
+	line, err := json.Marshal(conversationEntry{
+		Time:          now,
+		Bot:           bot,
+		UserID:        w.userKey(userID),
+		Question:      question,
+		Answer:        answer,
+		LatencyMs:     latency.Milliseconds(),
+		Usage:         usage,
+		ErrorCategory: errorCategory,
+		Route:         route,
+	})
+	if err != nil {
+		slog.Error("Ошибка формирования записи журнала диалогов", "error", err)
+		return
+	}
+	line = append(line, '\n')
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if now.Format(time.DateOnly) != w.day {
+		if err := w.rotateLocked(now); err != nil {
+			slog.Error("Ошибка ротации журнала диалогов", "error", err)
+		}
+	}
+
+	if _, err := w.buf.Write(line); err != nil {
+		slog.Error("Ошибка записи журнала диалогов", "error", err)
+	}
+}
+
+// Закрывает файл за прошедший день и открывает файл за новый
+func (w *conversationLogWriter) rotateLocked(now time.Time) error {
+	if err := w.buf.Flush(); err != nil {
+		return err
+	}
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+	return w.openLocked(now)
+}
+
+// Сбрасывает буфер на диск
+func (w *conversationLogWriter) Flush() {
+	if w == nil {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.buf.Flush(); err != nil {
+		slog.Error("Ошибка записи журнала диалогов", "error", err)
+	}
+}
+
+// Читает записи из файла журнала диалогов
+func readConversationLog(path string) ([]conversationEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []conversationEntry
+	scanner := bufio.NewScanner(file)
+	// Ответы ассистента могут быть длиннее стандартного буфера строки
+	scanner.Buffer(make([]byte, 64<<10), 16<<20)
+	for scanner.Scan() {
+		var entry conversationEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return entries, fmt.Errorf("Ошибка разбора записи журнала диалогов: %v", err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
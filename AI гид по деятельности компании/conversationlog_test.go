@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"proxyapi-bot/internal/openai"
+)
+
+// Путь файла журнала за сегодня для conversation_log_path path
+func todayConversationLog(path string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "-" + time.Now().Format(time.DateOnly) + ext
+}
+
+// Одновременные записи не перемешиваются: каждая строка читается целиком
+func TestConversationLogConcurrentWrites(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "conversations.jsonl")
+	w, err := openConversationLog(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const (
+		goroutines = 50
+		entries    = 40
+	)
+	// Ответ длиннее буфера bufio, чтобы строки записывались на диск по частям
+	answer := strings.Repeat("ответ ", 1000)
+	var wg sync.WaitGroup
+	for g := range goroutines {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range entries {
+				question := fmt.Sprintf("вопрос %d-%d", g, i)
+				w.Write("test", int64(g), question, question+" "+answer, time.Second, openai.Usage{TotalTokens: int64(i)}, "", "")
+			}
+		}()
+	}
+	wg.Wait()
+	w.Flush()
+
+	got, err := readConversationLog(todayConversationLog(path))
+	if err != nil {
+		t.Fatalf("readConversationLog: %v", err)
+	}
+	if len(got) != goroutines*entries {
+		t.Fatalf("Прочитано %d записей, want %d", len(got), goroutines*entries)
+	}
+	seen := make(map[string]bool, len(got))
+	for _, entry := range got {
+		if entry.Answer != entry.Question+" "+answer || entry.LatencyMs != 1000 || entry.Bot != "test" {
+			t.Fatalf("Запись повреждена: вопрос %q, ответ из %d символов", entry.Question, len(entry.Answer))
+		}
+		if seen[entry.Question] {
+			t.Errorf("Запись %q повторяется", entry.Question)
+		}
+		seen[entry.Question] = true
+	}
+}
+
+// С солью вместо ID пользователя пишется его хеш, одинаковый для одного пользователя
+func TestConversationLogUserKey(t *testing.T) {
+	plain := &conversationLogWriter{}
+	if got := plain.userKey(42); got != "42" {
+		t.Errorf("Без соли userKey(42) = %q, want 42", got)
+	}
+
+	salted := &conversationLogWriter{salt: "соль"}
+	key := salted.userKey(42)
+	if key == "42" || len(key) != 16 {
+		t.Errorf("С солью userKey(42) = %q, ожидается хеш из 16 символов", key)
+	}
+	if salted.userKey(42) != key || salted.userKey(43) == key {
+		t.Error("Хеш должен совпадать для одного пользователя и различаться для разных")
+	}
+	if other := (&conversationLogWriter{salt: "другая"}).userKey(42); other == key {
+		t.Error("Хеш не зависит от соли")
+	}
+}
+
+// Записи нового дня пишутся в файл с его датой, файл прошедшего дня закрывается
+func TestConversationLogRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "conversations.jsonl")
+	w := &conversationLogWriter{base: strings.TrimSuffix(path, ".jsonl"), ext: ".jsonl"}
+	if err := w.openLocked(time.Date(2024, 6, 1, 23, 59, 0, 0, time.Local)); err != nil {
+		t.Fatal(err)
+	}
+	old := strings.TrimSuffix(path, ".jsonl") + "-2024-06-01.jsonl"
+	if _, err := os.Stat(old); err != nil {
+		t.Fatalf("Файл за 2024-06-01 не создан: %v", err)
+	}
+
+	w.Write("test", 1, "вопрос", "ответ", 0, openai.Usage{}, "timeout", "")
+	w.Flush()
+
+	if w.day != time.Now().Format(time.DateOnly) {
+		t.Errorf("День журнала %s после записи, want сегодня", w.day)
+	}
+	if entries, err := readConversationLog(old); err != nil || len(entries) != 0 {
+		t.Errorf("В файле прошедшего дня %d записей, %v", len(entries), err)
+	}
+	entries, err := readConversationLog(todayConversationLog(path))
+	if err != nil || len(entries) != 1 || entries[0].ErrorCategory != "timeout" {
+		t.Errorf("Записи за сегодня: %+v, %v", entries, err)
+	}
+}
+
+// Отключённый журнал — нулевой указатель, вызовы которого ничего не делают
+func TestConversationLogDisabled(t *testing.T) {
+	var w *conversationLogWriter
+	w.Write("test", 1, "вопрос", "ответ", 0, openai.Usage{}, "", "")
+	w.Flush()
+}
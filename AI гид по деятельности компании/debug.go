@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// runDebug собирает тело запроса запуска и типы событий SSE для команды /debug.
+// Заголовки запроса, в том числе Authorization, не сохраняются.
+type runDebug struct {
+	mu          sync.Mutex
+	requestBody []byte
+	events      map[string]int
+}
+
+func (d *runDebug) OnRequestBody(body []byte) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	d.requestBody = body
+	d.mu.Unlock()
+}
+
+func (d *runDebug) OnEvent(event string) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	if d.events == nil {
+		d.events = make(map[string]int)
+	}
+	d.events[event]++
+	d.mu.Unlock()
+}
+
+// Формирует отчёт: тело запроса с отступами и количество событий каждого типа
+func (d *runDebug) report() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var b strings.Builder
+	b.WriteString("Запрос:\n")
+	var pretty bytes.Buffer
+	if err := json.Indent(&pretty, d.requestBody, "", "  "); err != nil {
+		b.Write(d.requestBody)
+	} else {
+		b.Write(pretty.Bytes())
+	}
+
+	names := make([]string, 0, len(d.events))
+	for name := range d.events {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	b.WriteString("\n\nСобытия SSE:\n")
+	if len(names) == 0 {
+		b.WriteString("нет\n")
+	}
+	for _, name := range names {
+		fmt.Fprintf(&b, "%s: %d\n", name, d.events[name])
+	}
+	return b.String()
+}
+
+// /debug on|off — включает для администратора отправку отладочных сведений о его запусках
+func handleDebugCommand(b *botInstance, message *tgbotapi.Message) {
+	lang := userLanguage(b, message.From)
+	if !isAdmin(message.From.ID) {
+		sendMessage(b, tgbotapi.NewMessage(message.Chat.ID, t(lang, "common.admin_only")))
+		return
+	}
+
+	var enabled bool
+	switch commandArgs(message) {
+	case "on":
+		enabled = true
+	case "off":
+		enabled = false
+	default:
+		sendMessage(b, tgbotapi.NewMessage(message.Chat.ID, t(lang, "debug.usage")))
+		return
+	}
+
+	session := b.sessions.GetOrCreate(chatSession(message.Chat, message.From.ID))
+	session.mu.Lock()
+	session.Debug = enabled
+	session.mu.Unlock()
+
+	reply := t(lang, "debug.off")
+	if enabled {
+		reply = t(lang, "debug.on")
+	}
+	sendMessage(b, tgbotapi.NewMessage(message.Chat.ID, reply))
+}
+
+// Отправляет администратору отладочные сведения о запуске. Адреса изображений
+// содержат токен бота, поэтому отчёт маскируется так же, как журнал.
+func sendRunDebug(b *botInstance, chatID int64, debug *runDebug) {
+	if debug == nil {
+		return
+	}
+	if err := sendLongMessage(b, chatID, redact(debug.report())); err != nil {
+		b.log.Error("Ошибка отправки отладочных сведений", "chat_id", chatID, "error", err)
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Данные кнопок /delete_file: page:<страница> — страница списка, pick:<страница>:<file_id> —
+// запрос подтверждения, yes:<страница>:<file_id> — удаление
+const (
+	deleteFileCallbackPrefix = "delfile:"
+	deleteFilePagePrefix     = deleteFileCallbackPrefix + "page:"
+	deleteFilePickPrefix     = deleteFileCallbackPrefix + "pick:"
+	deleteFileConfirmPrefix  = deleteFileCallbackPrefix + "yes:"
+	// Длина имени файла на кнопке
+	deleteFileButtonLength = 40
+)
+
+// Формирует страницу списка файлов с кнопкой удаления для каждого файла
+func deleteFilesMessage(lang string, files []knowledgeFile, page int) (string, tgbotapi.InlineKeyboardMarkup) {
+	text, shown, nav := knowledgeFilesPage(lang, files, page, deleteFilePagePrefix)
+	page = max(0, min(page, (len(files)-1)/listFilesPageSize))
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, file := range shown {
+		data := deleteFilePickPrefix + strconv.Itoa(page) + ":" + file.ID
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🗑 "+truncateRunes(file.Name, deleteFileButtonLength), data)))
+	}
+	if len(nav) > 0 {
+		rows = append(rows, nav)
+	}
+	return t(lang, "delete_file.choose") + "\n\n" + text, tgbotapi.InlineKeyboardMarkup{InlineKeyboard: rows}
+}
+
+// /delete_file — показывает администратору файлы базы знаний с кнопками удаления
+func handleDeleteFileCommand(b *botInstance, message *tgbotapi.Message) {
+	lang := userLanguage(b, message.From)
+	if !isAdmin(message.From.ID) {
+		sendMessage(b, tgbotapi.NewMessage(message.Chat.ID, t(lang, "common.admin_only")))
+		return
+	}
+	if b.vectorStoreID == "" {
+		sendMessage(b, tgbotapi.NewMessage(message.Chat.ID, t(lang, "list_files.no_store")))
+		return
+	}
+
+	ctx := newRequestContext()
+	files, err := loadKnowledgeFiles(ctx, b)
+	if err != nil {
+		requestLog(ctx, b.log).Error("Ошибка получения списка файлов базы знаний", "error", err)
+		sendMessage(b, tgbotapi.NewMessage(message.Chat.ID, t(lang, "list_files.failed")))
+		return
+	}
+	if len(files) == 0 {
+		sendMessage(b, tgbotapi.NewMessage(message.Chat.ID, t(lang, "list_files.empty")))
+		return
+	}
+
+	text, markup := deleteFilesMessage(lang, files, 0)
+	msg := tgbotapi.NewMessage(message.Chat.ID, text)
+	msg.ReplyMarkup = markup
+	sendMessage(b, msg)
+}
+
+// Обрабатывает кнопки /delete_file: листание списка, выбор файла и подтверждение удаления
+func handleDeleteFileCallback(b *botInstance, query *tgbotapi.CallbackQuery) {
+	lang := userLanguage(b, query.From)
+	if !isAdmin(query.From.ID) {
+		b.sender.Request(tgbotapi.NewCallback(query.ID, t(lang, "common.admin_only")))
+		return
+	}
+	if b.vectorStoreID == "" {
+		b.sender.Request(tgbotapi.NewCallback(query.ID, ""))
+		return
+	}
+
+	action, args, _ := strings.Cut(strings.TrimPrefix(query.Data, deleteFileCallbackPrefix), ":")
+	pageArg, fileID, _ := strings.Cut(args, ":")
+	page, _ := strconv.Atoi(pageArg)
+
+	ctx := newRequestContext()
+	log := requestLog(ctx, b.log)
+	files, err := loadKnowledgeFiles(ctx, b)
+	if err != nil {
+		log.Error("Ошибка получения списка файлов базы знаний", "error", err)
+		b.sender.Request(tgbotapi.NewCallback(query.ID, t(lang, "list_files.failed")))
+		return
+	}
+	chatID, messageID := query.Message.Chat.ID, query.Message.MessageID
+
+	i := slices.IndexFunc(files, func(f knowledgeFile) bool { return f.ID == fileID })
+	switch action {
+	case "pick":
+		// Файл уже удалён, например по другому сообщению со списком
+		if i < 0 {
+			b.sender.Request(tgbotapi.NewCallback(query.ID, t(lang, "delete_file.already_deleted")))
+			break
+		}
+		b.sender.Request(tgbotapi.NewCallback(query.ID, ""))
+		edit := tgbotapi.NewEditMessageTextAndMarkup(chatID, messageID, t(lang, "delete_file.confirm", files[i].Name),
+			tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData(t(lang, "delete_file.confirm_button"), deleteFileConfirmPrefix+strconv.Itoa(page)+":"+fileID),
+				tgbotapi.NewInlineKeyboardButtonData(t(lang, "delete_file.cancel_button"), deleteFilePagePrefix+strconv.Itoa(page)),
+			)))
+		b.sender.Request(edit)
+		return
+	case "yes":
+		// Повторное нажатие не удаляет файл второй раз: он уже удалён или удаляется
+		if i < 0 || !b.kbFiles.beginDelete(fileID) {
+			b.sender.Request(tgbotapi.NewCallback(query.ID, t(lang, "delete_file.already_deleted")))
+			break
+		}
+		err := deleteKnowledgeFile(ctx, b, fileID)
+		b.kbFiles.endDelete(fileID, err == nil)
+		if err != nil {
+			log.Error("Ошибка удаления файла базы знаний", "admin_id", query.From.ID, "file_id", fileID, "error", err)
+			b.sender.Request(tgbotapi.NewCallback(query.ID, t(lang, "delete_file.failed")))
+			return
+		}
+		log.Info("Файл удалён из базы знаний", "admin_id", query.From.ID, "file_id", fileID, "file_name", files[i].Name)
+		b.sender.Request(tgbotapi.NewCallback(query.ID, t(lang, "delete_file.done", files[i].Name)))
+		files = slices.Delete(slices.Clone(files), i, i+1)
+	default:
+		b.sender.Request(tgbotapi.NewCallback(query.ID, ""))
+	}
+
+	// Список на сообщении обновляется: после удаления в нём уже нет удалённого файла
+	if len(files) == 0 {
+		b.sender.Request(tgbotapi.NewEditMessageText(chatID, messageID, t(lang, "list_files.empty")))
+		return
+	}
+	text, markup := deleteFilesMessage(lang, files, page)
+	b.sender.Request(tgbotapi.NewEditMessageTextAndMarkup(chatID, messageID, text, markup))
+}
+
+// Убирает файл из Vector Store бота и удаляет его из хранилища файлов API.
+// Уже удалённый файл не считается ошибкой, поэтому удаление можно повторить.
+func deleteKnowledgeFile(ctx context.Context, b *botInstance, fileID string) error {
+	return removeKnowledgeFile(ctx, b, fileID, true)
+}
+
+// Убирает файл из Vector Store бота. Если deleteFile, файл удаляется и из хранилища файлов API,
+// иначе его можно снова добавить в Vector Store без повторной загрузки.
+func removeKnowledgeFile(ctx context.Context, b *botInstance, fileID string, deleteFile bool) error {
+	if err := b.api.RemoveFileFromVectorStore(ctx, b.vectorStoreID, fileID); err != nil && !isNotFound(err) {
+		return fmt.Errorf("Ошибка удаления файла из Vector Store: %v", err)
+	}
+	if deleteFile {
+		if err := b.api.DeleteFile(ctx, fileID); err != nil && !isNotFound(err) {
+			return fmt.Errorf("Ошибка удаления файла: %v", err)
+		}
+		if err := forgetUpload(fileID); err != nil {
+			b.log.Warn("Не удалось обновить файл состояния после удаления файла", "file_id", fileID, "error", err)
+		}
+	}
+	if err := b.kbSync.forget(fileID); err != nil {
+		b.log.Warn("Не удалось сохранить базу знаний в файле состояния", "file_id", fileID, "error", err)
+	}
+	return nil
+}
+
+// Отмечает файл как удаляемый. Возвращает false, если файл уже удаляется.
+func (c *knowledgeFilesCache) beginDelete(fileID string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.deleting[fileID] {
+		return false
+	}
+	if c.deleting == nil {
+		c.deleting = make(map[string]bool)
+	}
+	c.deleting[fileID] = true
+	return true
+}
+
+// Снимает отметку удаления. Удалённый файл убирается из кэшированного списка.
+func (c *knowledgeFilesCache) endDelete(fileID string, deleted bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.deleting, fileID)
+	if deleted {
+		c.files = slices.DeleteFunc(slices.Clone(c.files), func(f knowledgeFile) bool { return f.ID == fileID })
+	}
+}
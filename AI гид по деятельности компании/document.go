@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"proxyapi-bot/internal/openai"
+)
+
+// Документ превышает document_max_bytes
+var errDocumentTooLarge = errors.New("Документ слишком большой")
+
+// Проверяет, что сообщение содержит документ с подписью /ask и вопросы по документам включены
+func isAskDocumentMessage(message *tgbotapi.Message) bool {
+	_, ok := askDocumentQuestion(message)
+	return ok
+}
+
+// Возвращает вопрос из подписи документа вида /ask <вопрос>. Только такие документы
+// прикладываются к вопросу, остальные документы бот не обрабатывает.
+func askDocumentQuestion(message *tgbotapi.Message) (string, bool) {
+	if !config.DocumentQAEnabled || message.Document == nil {
+		return "", false
+	}
+	command, question, _ := strings.Cut(strings.TrimSpace(message.Caption), " ")
+	// В группах команда может содержать имя бота: /ask@имя_бота
+	command, _, _ = strings.Cut(command, "@")
+	if command != "/ask" {
+		return "", false
+	}
+	return strings.TrimSpace(question), true
+}
+
+// Вложения сообщения пользователя с документом для поиска file_search
+func documentAttachments(fileID string) []openai.Attachment {
+	return []openai.Attachment{openai.FileSearchAttachment(fileID)}
+}
+
+// Возвращает вложения вопроса для добавления в поток
+func (r runRequest) attachments() []openai.Attachment {
+	if r.DocumentFileID == "" {
+		return nil
+	}
+	return documentAttachments(r.DocumentFileID)
+}
+
+// Обрабатывает документ с подписью /ask: загружает его в API и задаёт вопрос, приложив
+// документ только к этому сообщению. В Vector Store бота документ не добавляется.
+func handleDocumentMessage(ctx context.Context, b *botInstance, message *tgbotapi.Message, question, lang string) {
+	log := requestLog(ctx, b.log)
+	fileID, err := uploadDocument(ctx, b, message.Document)
+	if err != nil {
+		log.Error("Ошибка загрузки документа", "user_id", message.From.ID, "file_name", message.Document.FileName, "error", err)
+		text := t(lang, "document.failed")
+		if errors.Is(err, errDocumentTooLarge) {
+			text = t(lang, "document.too_large", config.DocumentMaxBytes>>20)
+		}
+		sendMessage(b, tgbotapi.NewMessage(message.Chat.ID, text))
+		return
+	}
+
+	if question == "" {
+		question = t(lang, "document.default_question")
+	}
+	// Если вопрос отклонён, документ больше не понадобится
+	if !handleUserQuery(ctx, b, message, question, "", fileID, false, false) {
+		deleteDocumentFile(ctx, b, fileID)
+	}
+}
+
+// Скачивает документ из Telegram и загружает его в API. Возвращает ID файла.
+func uploadDocument(ctx context.Context, b *botInstance, document *tgbotapi.Document) (string, error) {
+	if int64(document.FileSize) > config.DocumentMaxBytes {
+		return "", errDocumentTooLarge
+	}
+
+	fileURL, err := b.sender.GetFileDirectURL(document.FileID)
+	if err != nil {
+		return "", fmt.Errorf("Ошибка получения файла документа: %v", err)
+	}
+
+	resp, err := http.Get(fileURL)
+	if err != nil {
+		return "", fmt.Errorf("Ошибка скачивания документа: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Ошибка скачивания документа: статус %d", resp.StatusCode)
+	}
+
+	// Размер, указанный Telegram, может отсутствовать, поэтому ограничиваем и само скачивание
+	data, err := io.ReadAll(io.LimitReader(resp.Body, config.DocumentMaxBytes+1))
+	if err != nil {
+		return "", fmt.Errorf("Ошибка скачивания документа: %v", err)
+	}
+	if int64(len(data)) > config.DocumentMaxBytes {
+		return "", errDocumentTooLarge
+	}
+
+	return b.api.UploadFile(ctx, document.FileName, bytes.NewReader(data))
+}
+
+// Удаляет документ после ответа и убирает его из истории, чтобы новый поток,
+// созданный из истории, не ссылался на удалённый файл. Документ не удаляется после
+// неудавшегося запуска, пока его можно повторить кнопкой "Повторить".
+func removeDocument(ctx context.Context, b *botInstance, session *UserSession, fileID string) {
+	session.mu.Lock()
+	for _, m := range session.Messages {
+		if attachments, ok := m["attachments"].([]openai.Attachment); ok && len(attachments) > 0 && attachments[0].FileID == fileID {
+			delete(m, "attachments")
+		}
+	}
+	session.mu.Unlock()
+
+	deleteDocumentFile(ctx, b, fileID)
+}
+
+// Удаляет загруженный документ из хранилища файлов API
+func deleteDocumentFile(ctx context.Context, b *botInstance, fileID string) {
+	log := requestLog(ctx, b.log)
+	if err := b.api.DeleteFile(ctx, fileID); err != nil {
+		log.Warn("Не удалось удалить документ", "file_id", fileID, "error", err)
+		return
+	}
+	log.Info("Документ удалён", "file_id", fileID)
+}
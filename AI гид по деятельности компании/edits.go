@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"math"
+	"slices"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Вопрос, ответ на который ещё не отправлен. По нему правка сообщения пользователя находит
+// запуск: вопрос в очереди заменяется, а запуск в работе отменяется и начинается заново.
+// Поля меняются под session.mu.
+type pendingQuestion struct {
+	MessageID int
+	// Текст вопроса, который получит ассистент
+	Question string
+	// Сообщение вопроса в истории сессии, общее с копией истории в запуске
+	message map[string]interface{}
+	// Номер сообщения вопроса с начала диалога, см. UserSession.dropped
+	seq int
+	// Запуск начат: правка больше не может изменить вопрос на месте
+	started bool
+	// Правка заменила вопрос или пользователь остановил запуск командой /stop: ответ не отправляется
+	superseded bool
+	cancel     context.CancelFunc
+	// Параметры запуска для повтора с исправленным вопросом
+	run runRequest
+}
+
+// Запоминает вопрос из сообщения messageID, которое лежит в истории под индексом index, перед
+// постановкой запуска в очередь и возвращает контекст, который отменяется при правке вопроса
+// во время запуска. Вызывается под session.mu.
+func trackPendingLocked(ctx context.Context, session *UserSession, messageID int, run *runRequest, index int) context.Context {
+	ctx, cancel := context.WithCancel(ctx)
+	pending := &pendingQuestion{
+		MessageID: messageID,
+		Question:  run.Question,
+		message:   session.Messages[index],
+		seq:       session.dropped + index,
+		cancel:    cancel,
+		run:       *run,
+	}
+	if session.pending == nil {
+		session.pending = make(map[int]*pendingQuestion)
+	}
+	session.pending[messageID] = pending
+	run.Pending = pending
+	return ctx
+}
+
+// Отмечает начало запуска и подставляет в него вопрос с учётом правок. false — вопрос заменён
+// правкой и запуск не нужен
+func startPending(session *UserSession, run *runRequest) bool {
+	if run.Pending == nil {
+		return true
+	}
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	if run.Pending.superseded {
+		return false
+	}
+	run.Pending.started = true
+	if run.Question != run.Pending.Question {
+		run.Question = run.Pending.Question
+		// Ключ кэша построен по прежнему тексту вопроса
+		run.CacheKey = ""
+	}
+	return true
+}
+
+// Перед отправкой ответа проверяет, что вопрос не заменён правкой, и перестаёт отслеживать его:
+// правка после этого обрабатывается как новое сообщение. false — ответ отправлять не нужно
+func finishPending(session *UserSession, pending *pendingQuestion) bool {
+	if pending == nil {
+		return true
+	}
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	if pending.superseded {
+		return false
+	}
+	if session.pending[pending.MessageID] == pending {
+		delete(session.pending, pending.MessageID)
+	}
+	return true
+}
+
+// Перестаёт отслеживать вопрос и освобождает контекст его запуска
+func dropPending(session *UserSession, pending *pendingQuestion) {
+	if pending == nil {
+		return
+	}
+	session.mu.Lock()
+	if session.pending[pending.MessageID] == pending {
+		delete(session.pending, pending.MessageID)
+	}
+	session.mu.Unlock()
+	pending.cancel()
+}
+
+// Обрабатывает правку текстового сообщения. Вопрос в очереди заменяется новым текстом, запуск
+// в работе отменяется и начинается заново с новым текстом, а правка вопроса, на который уже
+// дан ответ, обрабатывается как новый вопрос. В истории остаётся только исправленный текст.
+func handleEditedMessage(b *botInstance, message *tgbotapi.Message) {
+	if message.From == nil || message.Text == "" || message.IsCommand() {
+		return
+	}
+	if config.SupportChatID != 0 && message.Chat.ID == config.SupportChatID {
+		return
+	}
+	if !message.Chat.IsPrivate() && config.GroupRequireMention && !addressedToBot(b, message) {
+		return
+	}
+	userID := message.From.ID
+	if !isAccessAllowed(userID, message.Chat.ID) {
+		return
+	}
+
+	ctx := newRequestContext()
+	log := requestLog(ctx, b.log)
+	lang := userLanguage(b, message.From)
+	key := chatSession(message.Chat, userID)
+	session := b.sessions.GetOrCreate(key)
+
+	session.mu.Lock()
+	operator := session.Mode == sessionModeOperator
+	_, tracked := session.pending[message.MessageID]
+	session.mu.Unlock()
+	if operator {
+		return
+	}
+	if !tracked {
+		log.Info("Изменён вопрос, на который уже дан ответ: он обрабатывается как новый", "user_id", userID, "message_id", message.MessageID)
+		handleUserQuery(ctx, b, message, message.Text, "", "", false, false)
+		return
+	}
+
+	// Исправленный вопрос проверяется так же, как новый. Отклонённая правка оставляет прежний вопрос
+	if !checkQuery(ctx, b, message, message.Text, lang) {
+		return
+	}
+
+	session.mu.Lock()
+	pending := session.pending[message.MessageID]
+	if pending == nil {
+		// Ответ отправлен, пока проверялась правка
+		session.mu.Unlock()
+		handleUserQuery(ctx, b, message, message.Text, "", "", false, false)
+		return
+	}
+	if !fitsContextWindowLocked(log, b, session, userID, message.Text) {
+		session.mu.Unlock()
+		sendMessage(b, tgbotapi.NewMessage(message.Chat.ID, t(lang, "query.too_long")))
+		return
+	}
+
+	// Частые правки ограничиваются так же, как новые вопросы
+	if b.rateLimit.Enabled() {
+		allowed, wait, warn := session.limiter.allow(b.rateLimit, time.Now())
+		if !allowed {
+			session.mu.Unlock()
+			log.Warn("Превышено ограничение частоты запросов при правке вопроса", "user_id", userID)
+			if warn {
+				sendMessage(b, tgbotapi.NewMessage(message.Chat.ID, t(lang, "query.rate_limited", int(math.Ceil(wait.Seconds())))))
+			}
+			return
+		}
+	}
+	session.lastQuery = normalizeQuery(message.Text)
+	session.lastQueryAt = time.Now()
+
+	if !pending.started {
+		// Запуск ещё не начат и копия истории в нём ссылается на то же сообщение
+		pending.Question = message.Text
+		pending.message["content"] = userContent(message.Text, "")
+		session.mu.Unlock()
+		transcript.Write(userID, "user", message.Text)
+		log.Info("Вопрос в очереди заменён исправленным", "user_id", userID, "message_id", message.MessageID)
+		return
+	}
+
+	// Запуск в работе читает своё сообщение истории, поэтому оно заменяется новым, а не меняется
+	i := pending.seq - session.dropped
+	if i < 0 || i >= len(session.Messages) {
+		// Сообщение уже отброшено из истории, исправленный вопрос задаётся заново
+		session.mu.Unlock()
+		handleUserQuery(ctx, b, message, message.Text, "", "", false, false)
+		return
+	}
+	pending.superseded = true
+	pending.cancel()
+	edited := map[string]interface{}{"role": "user", "content": userContent(message.Text, "")}
+	session.Messages[i] = edited
+	// Прежний текст уже мог попасть в поток OpenAI: новый поток создаётся из исправленной истории,
+	// а прежний удаляется, как при /reset
+	if session.ThreadID != "" && config.DeleteUnusedThreads {
+		deleteThreadLater(b, session.ThreadID)
+	}
+	session.ThreadID = ""
+
+	run := pending.run
+	run.Question = message.Text
+	run.Messages = slices.Clone(session.Messages[:i+1])
+	run.CacheKey = ""
+	run.ThreadID = ""
+	if run.Debug != nil {
+		run.Debug = &runDebug{}
+	}
+	ctx = trackPendingLocked(ctx, session, message.MessageID, &run, i)
+	session.mu.Unlock()
+
+	transcript.Write(userID, "user", message.Text)
+	log.Info("Вопрос изменён во время запуска, запуск начинается заново", "user_id", userID, "message_id", message.MessageID)
+	chatID := message.Chat.ID
+	b.queues.Submit(key.queueID(), func() { processRun(ctx, b, chatID, userID, session, run) })
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"proxyapi-bot/internal/openai"
+)
+
+// Подмена запусков ассистента: запуск сообщает о начале в started и отвечает текстом вопроса
+// после закрытия release или возвращает ошибку отмены
+type blockingRuns struct {
+	mu        sync.Mutex
+	questions []string
+	started   chan string
+	release   chan struct{}
+}
+
+func newBlockingRuns() *blockingRuns {
+	return &blockingRuns{started: make(chan string, 10), release: make(chan struct{})}
+}
+
+func (r *blockingRuns) run(ctx context.Context, req openai.RunRequest, observer openai.RunObserver) (openai.RunResult, error) {
+	question, _ := req.Messages[len(req.Messages)-1]["content"].(string)
+	r.mu.Lock()
+	r.questions = append(r.questions, question)
+	r.mu.Unlock()
+	r.started <- question
+
+	select {
+	case <-r.release:
+		return openai.RunResult{Text: "ответ на " + question, RunID: "run_test"}, nil
+	case <-ctx.Done():
+		return openai.RunResult{RunID: "run_test"}, ctx.Err()
+	}
+}
+
+// Вопросы всех запусков по порядку
+func (r *blockingRuns) asked() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.questions)
+}
+
+// Ждёт начала запуска и возвращает его вопрос
+func (r *blockingRuns) waitStarted(t *testing.T) string {
+	t.Helper()
+	select {
+	case question := <-r.started:
+		return question
+	case <-time.After(5 * time.Second):
+		t.Fatal("Запуск не начался")
+		return ""
+	}
+}
+
+// Тексты сообщений истории сессии
+func historyTexts(session *UserSession) []string {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	var texts []string
+	for _, m := range session.Messages {
+		text, _ := m["content"].(string)
+		texts = append(texts, text)
+	}
+	return texts
+}
+
+func TestEditQueuedQuestion(t *testing.T) {
+	useTestConfig(t, "")
+	runs := newBlockingRuns()
+	b, sender := newTestBot(t, &openai.Mock{CreateThreadRunFunc: runs.run})
+	const userID = 100
+
+	handleUserQuery(context.Background(), b, privateMessage(userID, 1, "первый"), "первый", "", "", false, false)
+	runs.waitStarted(t)
+	handleUserQuery(context.Background(), b, privateMessage(userID, 2, "второй"), "второй", "", "", false, false)
+
+	// Второй вопрос ждёт в очереди и заменяется на месте
+	handleEditedMessage(b, privateMessage(userID, 2, "второй исправленный"))
+	close(runs.release)
+	waitQueues(t, b)
+
+	if got, want := runs.asked(), []string{"первый", "второй исправленный"}; !slices.Equal(got, want) {
+		t.Errorf("Вопросы запусков = %q, want %q", got, want)
+	}
+	if got := sender.texts(); !slices.Equal(got, []string{"ответ на первый", "ответ на второй исправленный"}) {
+		t.Errorf("Отправлено %q", got)
+	}
+	session, _ := b.sessions.Get(privateSession(userID))
+	// Вопрос попадает в историю при получении, а ответ — при отправке
+	if got, want := historyTexts(session), []string{"первый", "второй исправленный", "ответ на первый", "ответ на второй исправленный"}; !slices.Equal(got, want) {
+		t.Errorf("История = %q, want %q", got, want)
+	}
+}
+
+func TestEditRunningQuestion(t *testing.T) {
+	useTestConfig(t, "delete_unused_threads: true\n")
+	runs := newBlockingRuns()
+	deleted := make(chan string, 1)
+	var threads int
+	b, sender := newTestBot(t, &openai.Mock{
+		CreateThreadRunFunc: runs.run,
+		CreateThreadFunc: func(ctx context.Context, messages []map[string]interface{}, vectorStoreID string) (string, error) {
+			threads++
+			return []string{"thread_1", "thread_2"}[threads-1], nil
+		},
+		CancelRunFunc: func(ctx context.Context, threadID, runID string) error { return nil },
+		DeleteThreadFunc: func(ctx context.Context, threadID string) error {
+			deleted <- threadID
+			return nil
+		},
+	})
+	const userID = 100
+
+	handleUserQuery(context.Background(), b, privateMessage(userID, 1, "вопрос"), "вопрос", "", "", false, false)
+	runs.waitStarted(t)
+
+	// Запуск в работе отменяется и начинается заново в новом потоке
+	handleEditedMessage(b, privateMessage(userID, 1, "вопрос исправленный"))
+	if question := runs.waitStarted(t); question != "вопрос исправленный" {
+		t.Fatalf("Вопрос повторного запуска = %q", question)
+	}
+	select {
+	case threadID := <-deleted:
+		if threadID != "thread_1" {
+			t.Errorf("Удалён поток %s, want thread_1", threadID)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Поток с прежним текстом вопроса не удалён")
+	}
+	close(runs.release)
+	waitQueues(t, b)
+
+	if got := sender.texts(); !slices.Equal(got, []string{"ответ на вопрос исправленный"}) {
+		t.Errorf("Отправлено %q, ожидается только ответ на исправленный вопрос", got)
+	}
+	session, _ := b.sessions.Get(privateSession(userID))
+	if got, want := historyTexts(session), []string{"вопрос исправленный", "ответ на вопрос исправленный"}; !slices.Equal(got, want) {
+		t.Errorf("История = %q, want %q", got, want)
+	}
+	if session.ThreadID != "thread_2" {
+		t.Errorf("ThreadID = %q, want thread_2", session.ThreadID)
+	}
+}
+
+// Вопрос в работе находится в истории по номеру с начала диалога, даже если новый вопрос
+// в очереди сдвинул историю, отбросив старые сообщения
+func TestEditRunningQuestionAfterTrim(t *testing.T) {
+	useTestConfig(t, "max_context_messages: 3\n")
+	runs := newBlockingRuns()
+	b, sender := newTestBot(t, &openai.Mock{
+		CreateThreadRunFunc: runs.run,
+		CancelRunFunc:       func(ctx context.Context, threadID, runID string) error { return nil },
+	})
+	const userID = 100
+
+	handleUserQuery(context.Background(), b, privateMessage(userID, 1, "первый"), "первый", "", "", false, false)
+	runs.waitStarted(t)
+	runs.release <- struct{}{}
+	waitQueues(t, b)
+
+	handleUserQuery(context.Background(), b, privateMessage(userID, 2, "второй"), "второй", "", "", false, false)
+	runs.waitStarted(t)
+	// Третий вопрос отбрасывает из истории первый, и второй сдвигается
+	handleUserQuery(context.Background(), b, privateMessage(userID, 3, "третий"), "третий", "", "", false, false)
+	handleEditedMessage(b, privateMessage(userID, 2, "второй исправленный"))
+	close(runs.release)
+	waitQueues(t, b)
+
+	if got, want := runs.asked(), []string{"первый", "второй", "третий", "второй исправленный"}; !slices.Equal(got, want) {
+		t.Errorf("Вопросы запусков = %q, want %q", got, want)
+	}
+	if got, want := sender.texts(), []string{"ответ на первый", "ответ на третий", "ответ на второй исправленный"}; !slices.Equal(got, want) {
+		t.Errorf("Отправлено %q, want %q", got, want)
+	}
+	session, _ := b.sessions.Get(privateSession(userID))
+	if got, want := historyTexts(session), []string{"третий", "ответ на третий", "ответ на второй исправленный"}; !slices.Equal(got, want) {
+		t.Errorf("История = %q, want %q", got, want)
+	}
+}
+
+// Отклонённая правка оставляет прежний вопрос: запуск не отменяется, а пользователь получает отказ
+func TestEditRejected(t *testing.T) {
+	tests := []struct {
+		name  string
+		extra string
+		edit  string
+		setup func(b *botInstance)
+		// Отказ, который получит пользователь
+		notice func() string
+	}{
+		{
+			name:   "длиннее max_input_chars",
+			extra:  "max_input_chars: 50\n",
+			edit:   strings.Repeat("а", 60),
+			notice: func() string { return translate("ru", "query.input_too_long", 60, 50) },
+		},
+		{
+			name:   "исчерпан дневной лимит",
+			extra:  "user_daily_runs: 1\n",
+			edit:   "вопрос исправленный",
+			setup:  func(b *botInstance) { b.sessions.AddUsage(100, 0) },
+			notice: func() string { return translate("ru", "quota.exceeded") },
+		},
+		{
+			name:   "отклонено модерацией",
+			extra:  "moderation_enabled: true\n",
+			edit:   "плохой вопрос",
+			notice: func() string { return translate("ru", "moderation.refused") },
+		},
+		{
+			name:   "не помещается в окно контекста",
+			extra:  "model_context_limits:\n  gpt-4o: 5000\n",
+			edit:   strings.Repeat("а", 3000),
+			notice: func() string { return translate("ru", "query.too_long") },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestConfig(t, tt.extra)
+			runs := newBlockingRuns()
+			b, sender := newTestBot(t, &openai.Mock{
+				CreateThreadRunFunc: runs.run,
+				ModerateFunc: func(ctx context.Context, model, text string) (*openai.ModerationResult, error) {
+					return &openai.ModerationResult{Flagged: strings.Contains(text, "плох")}, nil
+				},
+			})
+			const userID = 100
+
+			handleUserQuery(context.Background(), b, privateMessage(userID, 1, "вопрос"), "вопрос", "", "", false, false)
+			runs.waitStarted(t)
+			if tt.setup != nil {
+				tt.setup(b)
+			}
+			handleEditedMessage(b, privateMessage(userID, 1, tt.edit))
+			close(runs.release)
+			waitQueues(t, b)
+
+			if got := runs.asked(); !slices.Equal(got, []string{"вопрос"}) {
+				t.Errorf("Вопросы запусков = %q, want только исходный", got)
+			}
+			if got, want := sender.texts(), []string{tt.notice(), "ответ на вопрос"}; !slices.Equal(got, want) {
+				t.Errorf("Отправлено %q, want %q", got, want)
+			}
+			session, _ := b.sessions.Get(privateSession(userID))
+			if got, want := historyTexts(session), []string{"вопрос", "ответ на вопрос"}; !slices.Equal(got, want) {
+				t.Errorf("История = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+// Пробный запуск после размыкания выключателя, отменённый правкой или командой /stop,
+// не оставляет выключатель занятым: следующий запуск пропускается
+func TestCancelledProbeReleasesBreaker(t *testing.T) {
+	tests := []struct {
+		name   string
+		cancel func(b *botInstance)
+		// Вопрос запуска, который начинается после отмены
+		next string
+	}{
+		{
+			name: "правка вопроса",
+			cancel: func(b *botInstance) {
+				handleEditedMessage(b, privateMessage(100, 1, "вопрос исправленный"))
+			},
+			next: "вопрос исправленный",
+		},
+		{
+			name: "команда /stop",
+			cancel: func(b *botInstance) {
+				handleStopCommand(b, privateMessage(100, 2, "/stop"))
+				waitQueues(t, b)
+				handleUserQuery(context.Background(), b, privateMessage(100, 3, "другой вопрос"), "другой вопрос", "", "", false, false)
+			},
+			next: "другой вопрос",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestConfig(t, "")
+			runBreaker = newCircuitBreaker(1, time.Minute, time.Millisecond)
+			runBreaker.Trip()
+			time.Sleep(5 * time.Millisecond)
+			runs := newBlockingRuns()
+			b, sender := newTestBot(t, &openai.Mock{CreateThreadRunFunc: runs.run})
+
+			handleUserQuery(context.Background(), b, privateMessage(100, 1, "вопрос"), "вопрос", "", "", false, false)
+			runs.waitStarted(t)
+			if state := runBreaker.State(); state != breakerHalfOpen {
+				t.Fatalf("Состояние выключателя %s, want half-open", state)
+			}
+			tt.cancel(b)
+			if question := runs.waitStarted(t); question != tt.next {
+				t.Fatalf("Вопрос следующего запуска = %q, want %q", question, tt.next)
+			}
+			close(runs.release)
+			waitQueues(t, b)
+
+			sender.waitText(t, "ответ на "+tt.next)
+			if state := runBreaker.State(); state != breakerClosed {
+				t.Errorf("Состояние выключателя %s, want closed", state)
+			}
+		})
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"proxyapi-bot/internal/openai"
+)
+
+// Категории ошибок, показываемых пользователю
+const (
+	userErrorOverloaded  = "overloaded"
+	userErrorTimeout     = "timeout"
+	userErrorTooLong     = "too_long"
+	userErrorInternal    = "internal"
+	userErrorUnavailable = "unavailable"
+	userErrorBusy        = "busy"
+	userErrorQuota       = "quota"
+	userErrorParameter   = "unsupported_parameter"
+)
+
+// Тексты ошибок для пользователя, раздел errors в config.yaml.
+// Заданный текст используется для всех языков, незаданный берётся из файлов локализации.
+type ErrorMessages struct {
+	Overloaded string `yaml:"overloaded"`
+	Timeout    string `yaml:"timeout"`
+	TooLong    string `yaml:"too_long"`
+	Internal   string `yaml:"internal"`
+	// Показывается, пока автоматический выключатель разомкнут
+	Unavailable string `yaml:"unavailable"`
+	// Показывается, когда достигнут лимит одновременных запусков и очередь заполнена
+	Busy string `yaml:"busy"`
+	// Показывается, когда исчерпана квота ключа API
+	Quota string `yaml:"quota"`
+	// Показывается, когда модель отклонила параметр запуска, например temperature
+	UnsupportedParameter string `yaml:"unsupported_parameter"`
+}
+
+// Возвращает текст ошибки для пользователя по категории
+func (m ErrorMessages) forCategory(lang, category string) string {
+	var text string
+	switch category {
+	case userErrorOverloaded:
+		text = m.Overloaded
+	case userErrorTimeout:
+		text = m.Timeout
+	case userErrorTooLong:
+		text = m.TooLong
+	case userErrorUnavailable:
+		text = m.Unavailable
+	case userErrorBusy:
+		text = m.Busy
+	case userErrorQuota:
+		text = m.Quota
+	case userErrorParameter:
+		text = m.UnsupportedParameter
+	default:
+		category = userErrorInternal
+		text = m.Internal
+	}
+	if text != "" {
+		return text
+	}
+	return t(lang, "error."+category)
+}
+
+// Определяет категорию ошибки для сообщения пользователю
+func classifyError(err error) string {
+	if isQuotaExceeded(err) {
+		return userErrorQuota
+	}
+
+	if isUnsupportedParameter(err) {
+		return userErrorParameter
+	}
+
+	var runErr *openai.RunError
+	if errors.As(err, &runErr) {
+		if runErr.Code == "rate_limit_exceeded" || runErr.Code == "server_error" {
+			return userErrorOverloaded
+		}
+		return userErrorInternal
+	}
+
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) {
+		if apiErr.StatusCode == http.StatusTooManyRequests || apiErr.StatusCode >= 500 {
+			return userErrorOverloaded
+		}
+		return userErrorInternal
+	}
+
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return userErrorTimeout
+	}
+
+	if isMessageTooLong(err) {
+		return userErrorTooLong
+	}
+
+	return userErrorInternal
+}
+
+// Проверяет, что запрос отклонён из-за исчерпания квоты ключа API:
+// в ответе с кодом ошибки или в событии потока
+func isQuotaExceeded(err error) bool {
+	var runErr *openai.RunError
+	if errors.As(err, &runErr) {
+		return runErr.Code == openai.QuotaErrorCode
+	}
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.ErrorCode == openai.QuotaErrorCode
+	}
+	return false
+}
+
+// Проверяет, что запуск не удался из-за недоступности модели: перегрузка или сбой
+// на стороне API либо модель не найдена
+func isModelUnavailable(err error) bool {
+	var apiErr *openai.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	switch {
+	case apiErr.StatusCode >= 500:
+		return true
+	case apiErr.StatusCode == http.StatusTooManyRequests:
+		// Исчерпанный баланс не зависит от модели
+		return apiErr.ErrorCode != openai.QuotaErrorCode
+	case isUnsupportedParameter(err):
+		// Резервная модель получит те же параметры, поэтому повтор не поможет
+		return false
+	case apiErr.StatusCode == http.StatusNotFound || apiErr.StatusCode == http.StatusBadRequest:
+		// Текст сообщения не проверяется: слово model встречается и в ошибках, которые
+		// резервная модель не исправит, например о превышении окна контекста
+		return modelErrorCodes[apiErr.ErrorCode] || apiErr.Param == "model"
+	}
+	return false
+}
+
+// Коды ошибок API, означающие, что модель или развёртывание Azure OpenAI недоступны
+var modelErrorCodes = map[string]bool{
+	"model_not_found":     true,
+	"model_not_available": true,
+	"DeploymentNotFound":  true,
+}
+
+// Проверяет, что модель отклонила параметр запуска, например temperature у рассуждающей модели,
+// которую не указали в reasoning_model_prefixes
+func isUnsupportedParameter(err error) bool {
+	var apiErr *openai.APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusBadRequest &&
+		(apiErr.ErrorCode == "unsupported_parameter" || apiErr.ErrorCode == "unsupported_value")
+}
+
+// Проверяет, что запрос отклонён, потому что модель не принимает изображения
+func isImageUnsupported(err error) bool {
+	var runErr *openai.RunError
+	if errors.As(err, &runErr) {
+		return strings.Contains(runErr.Message, "image")
+	}
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == http.StatusBadRequest && strings.Contains(apiErr.Message, "image")
+	}
+	return false
+}
+
+// Проверяет, что объект запроса не найден на стороне API, например уже удалён
+func isNotFound(err error) bool {
+	var apiErr *openai.APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// Проверяет, что Telegram отклонил сообщение из-за превышения длины
+func isMessageTooLong(err error) bool {
+	var tgErr *tgbotapi.Error
+	if !errors.As(err, &tgErr) {
+		return false
+	}
+	return strings.Contains(tgErr.Message, "message is too long")
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"proxyapi-bot/internal/openai"
+)
+
+func TestIsModelUnavailable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"модель не найдена", &openai.APIError{StatusCode: 404, ErrorCode: "model_not_found", Message: "The model `gpt-x` does not exist"}, true},
+		{"развёртывание Azure не найдено", &openai.APIError{StatusCode: 404, ErrorCode: "DeploymentNotFound", Message: "The API deployment does not exist"}, true},
+		{"ошибка параметра model", &openai.APIError{StatusCode: 400, ErrorCode: "invalid_request_error", Param: "model", Message: "Invalid model"}, true},
+		{"окно контекста", &openai.APIError{StatusCode: 400, ErrorCode: "context_length_exceeded", Param: "messages", Message: "This model's maximum context length is 128000 tokens"}, false},
+		{"слово model в сообщении", &openai.APIError{StatusCode: 400, ErrorCode: "invalid_request_error", Message: "Invalid value for model parameters"}, false},
+		{"поток не найден", &openai.APIError{StatusCode: 404, ErrorCode: "invalid_request_error", Message: "No thread found with id"}, false},
+		{"неподдерживаемый параметр", &openai.APIError{StatusCode: 400, ErrorCode: "unsupported_parameter", Param: "model", Message: "temperature is not supported with this model"}, false},
+		{"сбой API", &openai.APIError{StatusCode: 503, Message: "overloaded"}, true},
+		{"ограничение частоты", &openai.APIError{StatusCode: 429, ErrorCode: "rate_limit_exceeded"}, true},
+		{"исчерпана квота", &openai.APIError{StatusCode: 429, ErrorCode: openai.QuotaErrorCode}, false},
+		{"ошибка в обёртке", fmt.Errorf("запуск: %w", &openai.APIError{StatusCode: 404, ErrorCode: "model_not_found"}), true},
+		{"не ошибка API", fmt.Errorf("model"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isModelUnavailable(tt.err); got != tt.want {
+				t.Errorf("isModelUnavailable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+// Категория сообщения пользователю определяется по коду ответа и коду ошибки API
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"неверный ключ", &openai.APIError{StatusCode: 401, ErrorCode: "invalid_api_key"}, userErrorInternal},
+		{"исчерпана квота", &openai.APIError{StatusCode: 429, ErrorCode: openai.QuotaErrorCode}, userErrorQuota},
+		{"ограничение частоты", &openai.APIError{StatusCode: 429, ErrorCode: "rate_limit_exceeded"}, userErrorOverloaded},
+		{"неподдерживаемый параметр", &openai.APIError{StatusCode: 400, ErrorCode: "unsupported_parameter", Param: "temperature"}, userErrorParameter},
+		{"сбой сервера", &openai.APIError{StatusCode: 500, Message: "Internal Server Error"}, userErrorOverloaded},
+		{"квота в потоке", &openai.RunError{Code: openai.QuotaErrorCode}, userErrorQuota},
+		{"перегрузка в потоке", &openai.RunError{Code: "server_error"}, userErrorOverloaded},
+		{"ошибка в обёртке", fmt.Errorf("запуск: %w", &openai.APIError{StatusCode: 503}), userErrorOverloaded},
+		{"таймаут", fmt.Errorf("запуск: %w", context.DeadlineExceeded), userErrorTimeout},
+		{"прочая ошибка", fmt.Errorf("неизвестная ошибка"), userErrorInternal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyError(tt.err); got != tt.want {
+				t.Errorf("classifyError(%v) = %q, want %q", tt.err, got, tt.want)
+			}
+		})
+	}
+}
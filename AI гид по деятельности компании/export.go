@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Запись истории в файле /export
+type exportedMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+	// Время сообщения. Известно только для сообщений из потока OpenAI
+	Time *time.Time `json:"time,omitempty"`
+	// К вопросу приложено изображение. Само изображение в выгрузку не попадает
+	Image bool `json:"image,omitempty"`
+}
+
+// exportRenderer формирует файл истории диалога в одном из форматов /export
+type exportRenderer interface {
+	Render(lang, botName string, messages []exportedMessage, now time.Time) ([]byte, error)
+}
+
+// Форматы /export по расширению файла. Первый в exportFormats используется по умолчанию.
+var (
+	exportFormats   = []string{"txt", "md", "json"}
+	exportRenderers = map[string]exportRenderer{
+		"txt":  textExport{},
+		"md":   markdownExport{},
+		"json": jsonExport{},
+	}
+)
+
+// Возвращает текст сообщения истории и адрес приложенного изображения
+func messageText(m map[string]interface{}) (text, imageURL string) {
+	switch content := m["content"].(type) {
+	case string:
+		return content, ""
+	case []map[string]interface{}:
+		for _, part := range content {
+			switch part["type"] {
+			case "text":
+				text, _ = part["text"].(string)
+			case "image_url":
+				if image, ok := part["image_url"].(map[string]interface{}); ok {
+					imageURL, _ = image["url"].(string)
+				}
+			}
+		}
+	}
+	return text, imageURL
+}
+
+// /export — отправляет пользователю его историю диалога документом, /export md — в Markdown,
+// /export json — в формате JSON. Если у пользователя есть поток OpenAI, выгружаются все
+// сообщения потока, иначе — история из сессии (не больше max_context_messages).
+func handleExportCommand(b *botInstance, message *tgbotapi.Message) {
+	lang := userLanguage(b, message.From)
+	format := strings.ToLower(commandArgs(message))
+	if format == "" {
+		format = exportFormats[0]
+	}
+	renderer, ok := exportRenderers[format]
+	if !ok {
+		sendMessage(b, tgbotapi.NewMessage(message.Chat.ID, t(lang, "export.usage")))
+		return
+	}
+
+	ctx := newRequestContext()
+	log := requestLog(ctx, b.log)
+	messages := loadExportMessages(ctx, b, chatSession(message.Chat, message.From.ID))
+	if len(messages) == 0 {
+		sendMessage(b, tgbotapi.NewMessage(message.Chat.ID, t(lang, "export.empty")))
+		return
+	}
+
+	now := time.Now()
+	data, err := renderer.Render(lang, b.cfg.Name, messages, now)
+	if err != nil {
+		log.Error("Ошибка формирования истории диалога", "user_id", message.From.ID, "error", err)
+		sendMessage(b, tgbotapi.NewMessage(message.Chat.ID, t(lang, "export.failed")))
+		return
+	}
+	name := "dialog-" + now.Format("2006-01-02-1504") + "." + format
+
+	doc := tgbotapi.NewDocument(message.Chat.ID, tgbotapi.FileBytes{Name: name, Bytes: data})
+	doc.Caption = t(lang, "export.caption", len(messages))
+	if _, err := b.sender.Send(doc); err != nil {
+		log.Error("Ошибка отправки истории диалога", "user_id", message.From.ID, "error", err)
+		sendMessage(b, tgbotapi.NewMessage(message.Chat.ID, t(lang, "export.failed")))
+		return
+	}
+	log.Info("История диалога выгружена", "user_id", message.From.ID, "messages", len(messages), "format", format)
+}
+
+// Возвращает историю диалога сессии. Поток берётся только из этой сессии,
+// поэтому в выгрузку не попадают чужие диалоги. Если поток недоступен,
+// выгружается история из сессии.
+func loadExportMessages(ctx context.Context, b *botInstance, key sessionKey) []exportedMessage {
+	session, exists := b.sessions.Get(key)
+	if !exists {
+		return nil
+	}
+	session.mu.Lock()
+	threadID := session.ThreadID
+	var messages []exportedMessage
+	for _, m := range session.Messages {
+		role, _ := m["role"].(string)
+		text, imageURL := messageText(m)
+		messages = append(messages, exportedMessage{Role: role, Content: text, Image: imageURL != ""})
+	}
+	session.mu.Unlock()
+
+	if threadID == "" {
+		return messages
+	}
+	threadMessages, err := b.api.ListThreadMessages(ctx, threadID)
+	if err != nil {
+		requestLog(ctx, b.log).Warn("Не удалось получить сообщения потока, выгружается история сессии",
+			"chat_id", key.ChatID, "user_id", key.UserID, "thread_id", threadID, "error", err)
+		return messages
+	}
+
+	messages = messages[:0]
+	for _, m := range threadMessages {
+		created := time.Unix(m.CreatedAt, 0)
+		messages = append(messages, exportedMessage{Role: m.Role, Content: m.Text, Time: &created})
+	}
+	return messages
+}
+
+// Подпись автора реплики
+func exportAuthor(lang string, m exportedMessage) string {
+	if m.Role == "user" {
+		return t(lang, "export.role_user")
+	}
+	return t(lang, "export.role_assistant")
+}
+
+// textExport — реплики по порядку с подписью автора
+type textExport struct{}
+
+func (textExport) Render(lang, botName string, messages []exportedMessage, now time.Time) ([]byte, error) {
+	var text strings.Builder
+	fmt.Fprintf(&text, "%s\n%s\n", t(lang, "export.title", botName), now.Format("02.01.2006 15:04"))
+	for _, m := range messages {
+		author := exportAuthor(lang, m)
+		if m.Time != nil {
+			author += " (" + m.Time.Format("02.01.2006 15:04") + ")"
+		}
+		fmt.Fprintf(&text, "\n%s:\n%s\n", author, m.Content)
+		if m.Image {
+			text.WriteString(t(lang, "export.image") + "\n")
+		}
+	}
+	return []byte(text.String()), nil
+}
+
+// markdownExport — реплики под заголовками с автором и временем. Ответы ассистента уже
+// в Markdown, поэтому текст вставляется без изменений.
+type markdownExport struct{}
+
+func (markdownExport) Render(lang, botName string, messages []exportedMessage, now time.Time) ([]byte, error) {
+	var text strings.Builder
+	fmt.Fprintf(&text, "# %s\n\n_%s_\n", t(lang, "export.title", botName), now.Format("02.01.2006 15:04"))
+	for _, m := range messages {
+		fmt.Fprintf(&text, "\n## %s", exportAuthor(lang, m))
+		if m.Time != nil {
+			fmt.Fprintf(&text, " · %s", m.Time.Format("02.01.2006 15:04"))
+		}
+		fmt.Fprintf(&text, "\n\n%s\n", m.Content)
+		if m.Image {
+			fmt.Fprintf(&text, "\n_%s_\n", t(lang, "export.image"))
+		}
+	}
+	return []byte(text.String()), nil
+}
+
+// jsonExport — записи exportedMessage массивом JSON
+type jsonExport struct{}
+
+func (jsonExport) Render(lang, botName string, messages []exportedMessage, now time.Time) ([]byte, error) {
+	return json.MarshalIndent(messages, "", "  ")
+}
@@ -0,0 +1,433 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeOpenAI — тестовый сервер с эндпоинтами API, которые бот использует при запуске
+// и ответе на вопрос. Запуски отвечают потоком SSE с текстом answer
+type fakeOpenAI struct {
+	t  *testing.T
+	mu sync.Mutex
+	// Текст ответа ассистента
+	answer string
+	// Файлы, загрузка которых завершается ошибкой
+	failUploads map[string]bool
+	// Имена загруженных файлов по порядку
+	uploaded []string
+	// Созданные Vector Store и ID файлов, зарегистрированных в Vector Store
+	vectorStores     int
+	vectorStoreFiles []string
+	// Vector Store удалён на стороне API: список его файлов отвечает 404
+	vectorStoreLost bool
+	// Vector Store, подключённый к ассистенту
+	assistantVectorStore string
+	// Вопросы, добавленные в потоки или переданные при их создании
+	questions []string
+	threads   int
+	// Поле truncation_strategy каждого запуска в JSON, null — не передано
+	truncation []string
+}
+
+// Запускает сервер и направляет на него api_url конфигурации. Вызывается после useTestConfig
+func newFakeOpenAI(t *testing.T, answer string) *fakeOpenAI {
+	t.Helper()
+	api := &fakeOpenAI{t: t, answer: answer, failUploads: map[string]bool{}}
+	server := httptest.NewServer(api)
+	t.Cleanup(server.Close)
+	config.ApiURL = server.URL
+	return api
+}
+
+func (f *fakeOpenAI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer sk-test-secret" {
+		f.t.Errorf("%s %s: Authorization %q", r.Method, r.URL.Path, r.Header.Get("Authorization"))
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	path := r.URL.Path
+	switch {
+	case r.Method == "POST" && path == "/assistants":
+		io.WriteString(w, `{"id":"asst_1","object":"assistant"}`)
+	case r.Method == "POST" && path == "/assistants/asst_1":
+		var body struct {
+			ToolResources struct {
+				FileSearch struct {
+					VectorStoreIDs []string `json:"vector_store_ids"`
+				} `json:"file_search"`
+			} `json:"tool_resources"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		f.assistantVectorStore = strings.Join(body.ToolResources.FileSearch.VectorStoreIDs, ",")
+		io.WriteString(w, `{"id":"asst_1","object":"assistant"}`)
+	case r.Method == "POST" && path == "/vector_stores":
+		f.vectorStores++
+		fmt.Fprintf(w, `{"id":"vs_%d","object":"vector_store"}`, f.vectorStores)
+	case r.Method == "GET" && strings.HasPrefix(path, "/vector_stores/") && strings.HasSuffix(path, "/files"):
+		if f.vectorStoreLost {
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, `{"error":{"message":"No vector store found","type":"invalid_request_error"}}`)
+			return
+		}
+		data := make([]string, len(f.vectorStoreFiles))
+		for i, id := range f.vectorStoreFiles {
+			data[i] = fmt.Sprintf(`{"id":%q,"status":"completed"}`, id)
+		}
+		fmt.Fprintf(w, `{"data":[%s],"has_more":false}`, strings.Join(data, ","))
+	case r.Method == "DELETE" && strings.HasPrefix(path, "/vector_stores/"):
+		fileID := path[strings.LastIndex(path, "/")+1:]
+		f.vectorStoreFiles = slices.DeleteFunc(f.vectorStoreFiles, func(id string) bool { return id == fileID })
+		fmt.Fprintf(w, `{"id":%q,"deleted":true}`, fileID)
+	case r.Method == "GET" && strings.HasPrefix(path, "/files/"):
+		var n int
+		fmt.Sscanf(path, "/files/file-%d", &n)
+		if n < 1 || n > len(f.uploaded) {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintf(w, `{"id":"file-%d","object":"file","filename":%q}`, n, f.uploaded[n-1])
+	case r.Method == "DELETE" && strings.HasPrefix(path, "/files/"):
+		fmt.Fprintf(w, `{"id":%q,"deleted":true}`, strings.TrimPrefix(path, "/files/"))
+	case r.Method == "POST" && path == "/files":
+		_, header, err := r.FormFile("file")
+		if err != nil {
+			f.t.Errorf("Файл не найден в запросе загрузки: %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if f.failUploads[header.Filename] {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, `{"error":{"message":"Invalid file format","type":"invalid_request_error","code":"unsupported_file"}}`)
+			return
+		}
+		f.uploaded = append(f.uploaded, header.Filename)
+		fmt.Fprintf(w, `{"id":"file-%d","object":"file"}`, len(f.uploaded))
+	case r.Method == "POST" && strings.HasPrefix(path, "/vector_stores/") && strings.HasSuffix(path, "/files"):
+		var body struct {
+			FileID string `json:"file_id"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		f.vectorStoreFiles = append(f.vectorStoreFiles, body.FileID)
+		fmt.Fprintf(w, `{"id":%q,"object":"vector_store.file"}`, body.FileID)
+	case r.Method == "POST" && path == "/threads":
+		var body struct {
+			Messages []struct {
+				Role    string `json:"role"`
+				Content string `json:"content"`
+			} `json:"messages"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		if n := len(body.Messages); n > 0 {
+			f.questions = append(f.questions, body.Messages[n-1].Content)
+		}
+		f.threads++
+		fmt.Fprintf(w, `{"id":"thread_%d","object":"thread"}`, f.threads)
+	case r.Method == "POST" && strings.HasPrefix(path, "/threads/") && strings.HasSuffix(path, "/messages"):
+		var body struct {
+			Content string `json:"content"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		f.questions = append(f.questions, body.Content)
+		io.WriteString(w, `{"id":"msg_1","object":"thread.message"}`)
+	case r.Method == "POST" && strings.HasPrefix(path, "/threads/") && strings.HasSuffix(path, "/runs"):
+		threadID := strings.Split(path, "/")[2]
+		var body struct {
+			TruncationStrategy json.RawMessage `json:"truncation_strategy"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		if body.TruncationStrategy == nil {
+			body.TruncationStrategy = json.RawMessage("null")
+		}
+		f.truncation = append(f.truncation, string(body.TruncationStrategy))
+		w.Header().Set("Content-Type", "text/event-stream")
+		// Ответ приходит двумя фрагментами
+		half := len([]rune(f.answer)) / 2
+		for _, part := range []string{string([]rune(f.answer)[:half]), string([]rune(f.answer)[half:])} {
+			fmt.Fprintf(w, `data: {"object":"thread.message.delta","delta":{"content":[{"type":"text","text":{"value":%q}}]}}`+"\n\n", part)
+		}
+		fmt.Fprintf(w, `data: {"object":"thread.run","id":"run_1","thread_id":%q,"status":"completed","usage":{"total_tokens":15}}`+"\n\n", threadID)
+		io.WriteString(w, "data: [DONE]\n\n")
+	default:
+		f.t.Errorf("Неожиданный запрос %s %s", r.Method, path)
+		http.NotFound(w, r)
+	}
+}
+
+// Создаёт файлы базы знаний в каталоге files_path
+func writeKnowledgeBase(t *testing.T, names ...string) {
+	t.Helper()
+	if err := os.MkdirAll(config.FilesPath, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(config.FilesPath, name), []byte("содержимое "+name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// Запуск: ассистент создаётся, файлы загружаются в Vector Store, и он подключается к ассистенту
+func TestSetupAssistant(t *testing.T) {
+	useTestConfig(t, "")
+	api := newFakeOpenAI(t, "")
+	writeKnowledgeBase(t, "about.txt", "contacts.txt")
+	b, _ := newSenderBot(t)
+
+	if err := setupAssistant(context.Background(), b); err != nil {
+		t.Fatalf("setupAssistant: %v", err)
+	}
+	if b.assistantID != "asst_1" || b.vectorStoreID != "vs_1" || b.chatOnly {
+		t.Errorf("assistantID %q, vectorStoreID %q, chatOnly %v", b.assistantID, b.vectorStoreID, b.chatOnly)
+	}
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	if want := []string{"about.txt", "contacts.txt"}; !slices.Equal(api.uploaded, want) {
+		t.Errorf("Загружены %q, want %q", api.uploaded, want)
+	}
+	if want := []string{"file-1", "file-2"}; !slices.Equal(api.vectorStoreFiles, want) {
+		t.Errorf("В Vector Store зарегистрированы %q, want %q", api.vectorStoreFiles, want)
+	}
+	if api.assistantVectorStore != "vs_1" {
+		t.Errorf("К ассистенту подключён Vector Store %q, want vs_1", api.assistantVectorStore)
+	}
+	if saved, ok := savedAssistantFor("test"); !ok || saved.ID != "asst_1" {
+		t.Errorf("Сохранённый ассистент = %+v, %v", saved, ok)
+	}
+}
+
+// После перезапуска сохранённый Vector Store переиспользуется: загружаются только новые
+// и изменённые файлы, а удалённые из источника убираются. Если Vector Store удалён на стороне
+// API, создаётся новый
+func TestSetupAssistantReusesKnowledgeBase(t *testing.T) {
+	useTestConfig(t, "")
+	api := newFakeOpenAI(t, "")
+	writeKnowledgeBase(t, "about.txt", "contacts.txt", "old.txt")
+	b, _ := newSenderBot(t)
+	if err := setupAssistant(context.Background(), b); err != nil {
+		t.Fatalf("setupAssistant: %v", err)
+	}
+
+	// Перезапуск: состояние читается из файла, источник за это время изменился
+	if err := os.WriteFile(filepath.Join(config.FilesPath, "contacts.txt"), []byte("новые контакты"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(config.FilesPath, "old.txt")); err != nil {
+		t.Fatal(err)
+	}
+	writeKnowledgeBase(t, "news.txt")
+	state = &BotState{}
+	if err := loadState(config.StateFile); err != nil {
+		t.Fatal(err)
+	}
+	b, _ = newSenderBot(t)
+	if err := setupAssistant(context.Background(), b); err != nil {
+		t.Fatalf("setupAssistant после перезапуска: %v", err)
+	}
+
+	api.mu.Lock()
+	if b.vectorStoreID != "vs_1" || api.vectorStores != 1 || api.assistantVectorStore != "vs_1" {
+		t.Errorf("vectorStoreID %q, создано Vector Store %d, к ассистенту подключён %q", b.vectorStoreID, api.vectorStores, api.assistantVectorStore)
+	}
+	if want := []string{"about.txt", "contacts.txt", "old.txt", "contacts.txt", "news.txt"}; !slices.Equal(api.uploaded, want) {
+		t.Errorf("Загружены %q, want %q", api.uploaded, want)
+	}
+	if want := []string{"file-1", "file-4", "file-5"}; !slices.Equal(api.vectorStoreFiles, want) {
+		t.Errorf("В Vector Store %q, want %q", api.vectorStoreFiles, want)
+	}
+	api.vectorStoreLost = true
+	api.mu.Unlock()
+	saved, _ := savedKnowledgeFor("test")
+	if saved.VectorStoreID != "vs_1" || len(saved.Files) != 3 || saved.Files["contacts.txt"].ID != "file-4" {
+		t.Errorf("Сохранённая база знаний = %+v", saved)
+	}
+
+	// Vector Store удалён: создаётся новый, а загруженные файлы переиспользуются
+	b, _ = newSenderBot(t)
+	if err := setupAssistant(context.Background(), b); err != nil {
+		t.Fatalf("setupAssistant без Vector Store: %v", err)
+	}
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	if b.vectorStoreID != "vs_2" || api.assistantVectorStore != "vs_2" || len(api.uploaded) != 5 {
+		t.Errorf("vectorStoreID %q, к ассистенту подключён %q, загружены %q", b.vectorStoreID, api.assistantVectorStore, api.uploaded)
+	}
+	if saved, _ := savedKnowledgeFor("test"); saved.VectorStoreID != "vs_2" || len(saved.Files) != 3 {
+		t.Errorf("Сохранённая база знаний = %+v", saved)
+	}
+}
+
+// Ошибки загрузки отдельных файлов не прерывают запуск, а пустая база знаний прерывает,
+// если она не разрешена явно
+func TestSetupAssistantUploadErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		extra       string
+		failUploads []string
+		wantErr     string
+		// Подключённый к ассистенту Vector Store
+		wantVectorStore string
+	}{
+		{
+			name:            "часть файлов",
+			failUploads:     []string{"about.txt"},
+			wantVectorStore: "vs_1",
+		},
+		{
+			name:        "все файлы",
+			failUploads: []string{"about.txt", "contacts.txt"},
+			wantErr:     "Ни один файл базы знаний не загружен",
+		},
+		{
+			name:        "все файлы при allow_empty_knowledge_base",
+			extra:       "allow_empty_knowledge_base: true\n",
+			failUploads: []string{"about.txt", "contacts.txt"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestConfig(t, tt.extra)
+			api := newFakeOpenAI(t, "")
+			for _, name := range tt.failUploads {
+				api.failUploads[name] = true
+			}
+			writeKnowledgeBase(t, "about.txt", "contacts.txt")
+			b, _ := newSenderBot(t)
+
+			err := setupAssistant(context.Background(), b)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("setupAssistant = %v, want ошибку с %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("setupAssistant: %v", err)
+			}
+			if b.vectorStoreID != tt.wantVectorStore || b.chatOnly != (tt.wantVectorStore == "") {
+				t.Errorf("vectorStoreID %q, chatOnly %v", b.vectorStoreID, b.chatOnly)
+			}
+			api.mu.Lock()
+			defer api.mu.Unlock()
+			if api.assistantVectorStore != tt.wantVectorStore {
+				t.Errorf("К ассистенту подключён Vector Store %q, want %q", api.assistantVectorStore, tt.wantVectorStore)
+			}
+			if len(api.vectorStoreFiles) != 2-len(tt.failUploads) {
+				t.Errorf("В Vector Store зарегистрированы %q", api.vectorStoreFiles)
+			}
+		})
+	}
+}
+
+// Вопрос пользователя проходит через поток и запуск API, и ответ доставляется в Telegram
+func TestUserMessageReply(t *testing.T) {
+	useTestConfig(t, "")
+	api := newFakeOpenAI(t, "Центр работает с 9 до 18.")
+	b, sender := newSenderBot(t)
+	b.assistantID, b.vectorStoreID = "asst_1", "vs_1"
+	const userID = 100
+
+	handleUserQuery(context.Background(), b, privateMessage(userID, 1, "Когда работает центр?"), "Когда работает центр?", "", "", false, false)
+	waitQueues(t, b)
+
+	texts := sender.texts()
+	if len(texts) == 0 || texts[len(texts)-1] != "Центр работает с 9 до 18." {
+		t.Fatalf("Отправлено %q, ожидается ответ ассистента", texts)
+	}
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	if !slices.Equal(api.questions, []string{"Когда работает центр?"}) {
+		t.Errorf("Вопросы в API = %q", api.questions)
+	}
+	session, _ := b.sessions.Get(privateSession(userID))
+	if got, want := historyTexts(session), []string{"Когда работает центр?", "Центр работает с 9 до 18."}; !slices.Equal(got, want) {
+		t.Errorf("История = %q, want %q", got, want)
+	}
+	if session.ThreadID != "thread_1" {
+		t.Errorf("ThreadID = %q, want thread_1", session.ThreadID)
+	}
+}
+
+// История сессии не превышает max_context_messages: отбрасываются самые старые сообщения
+func TestHistoryTrimmedAtMaxContextMessages(t *testing.T) {
+	useTestConfig(t, "max_context_messages: 4\n")
+	newFakeOpenAI(t, "ответ")
+	b, _ := newSenderBot(t)
+	b.assistantID, b.vectorStoreID = "asst_1", "vs_1"
+	const userID = 100
+
+	for i, question := range []string{"первый", "второй", "третий"} {
+		handleUserQuery(context.Background(), b, privateMessage(userID, i+1, question), question, "", "", false, false)
+		waitQueues(t, b)
+	}
+
+	session, _ := b.sessions.Get(privateSession(userID))
+	if got, want := historyTexts(session), []string{"второй", "ответ", "третий", "ответ"}; !slices.Equal(got, want) {
+		t.Errorf("История = %q, want %q", got, want)
+	}
+}
+
+// truncation_strategy передаётся в каждом запуске, а last_messages в режиме потоков
+// ограничивает и локальную историю вместо max_context_messages
+func TestTruncationStrategy(t *testing.T) {
+	tests := []struct {
+		name  string
+		extra string
+		// Ожидаемое поле truncation_strategy запусков
+		wantStrategy string
+		wantHistory  []string
+	}{
+		{
+			name:         "не задана",
+			wantStrategy: "null",
+			wantHistory:  []string{"первый", "ответ", "второй", "ответ", "третий", "ответ"},
+		},
+		{
+			name:         "auto",
+			extra:        "truncation_strategy:\n  type: auto\n",
+			wantStrategy: `{"type":"auto"}`,
+			wantHistory:  []string{"первый", "ответ", "второй", "ответ", "третий", "ответ"},
+		},
+		{
+			name:         "last_messages",
+			extra:        "truncation_strategy:\n  type: last_messages\n  last_messages: 2\n",
+			wantStrategy: `{"type":"last_messages","last_messages":2}`,
+			wantHistory:  []string{"третий", "ответ"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestConfig(t, "max_context_messages: 10\n"+tt.extra)
+			api := newFakeOpenAI(t, "ответ")
+			b, _ := newSenderBot(t)
+			b.assistantID, b.vectorStoreID = "asst_1", "vs_1"
+			const userID = 100
+
+			for i, question := range []string{"первый", "второй", "третий"} {
+				handleUserQuery(context.Background(), b, privateMessage(userID, i+1, question), question, "", "", false, false)
+				waitQueues(t, b)
+			}
+
+			api.mu.Lock()
+			defer api.mu.Unlock()
+			if want := []string{tt.wantStrategy, tt.wantStrategy, tt.wantStrategy}; !slices.Equal(api.truncation, want) {
+				t.Errorf("truncation_strategy запусков = %q, want %q", api.truncation, want)
+			}
+			session, _ := b.sessions.Get(privateSession(userID))
+			if got := historyTexts(session); !slices.Equal(got, tt.wantHistory) {
+				t.Errorf("История = %q, want %q", got, tt.wantHistory)
+			}
+		})
+	}
+}
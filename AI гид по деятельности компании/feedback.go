@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Оценки ответа
+const (
+	feedbackGood = "good"
+	feedbackBad  = "bad"
+)
+
+// Запись журнала отзывов: оценка пользователем последнего ответа
+type feedbackEntry struct {
+	Time     time.Time `json:"time"`
+	Bot      string    `json:"bot"`
+	UserID   int64     `json:"user_id"`
+	RunID    string    `json:"run_id,omitempty"`
+	Rating   string    `json:"rating"`
+	Question string    `json:"question"`
+}
+
+// Последний полученный пользователем ответ, который можно оценить
+type answerRef struct {
+	RunID    string
+	Question string
+}
+
+// feedbackWriter дописывает отзывы в файл JSON Lines.
+// Нулевой указатель означает, что отзывы не собираются.
+type feedbackWriter struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+}
+
+var feedbackLog *feedbackWriter
+
+// Открывает журнал отзывов для дозаписи
+func openFeedbackLog(path string) (*feedbackWriter, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("Ошибка открытия журнала отзывов: %v", err)
+	}
+	return &feedbackWriter{path: path, file: file}, nil
+}
+
+// Записывает отзыв. Записи небольшие и редкие, поэтому пишутся сразу, без буфера.
+func (w *feedbackWriter) Write(entry feedbackEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("Ошибка формирования записи журнала отзывов: %v", err)
+	}
+	line = append(line, '\n')
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, err := w.file.Write(line); err != nil {
+		return fmt.Errorf("Ошибка записи журнала отзывов: %v", err)
+	}
+	return nil
+}
+
+// Подсчитывает оценки в журнале отзывов по всем ботам
+func (w *feedbackWriter) Summary() (good, bad int, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	file, err := os.Open(w.path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	// Вопросы могут быть длиннее стандартного буфера строки
+	scanner.Buffer(make([]byte, 64<<10), 16<<20)
+	for scanner.Scan() {
+		var entry feedbackEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return good, bad, fmt.Errorf("Ошибка разбора записи журнала отзывов: %v", err)
+		}
+		switch entry.Rating {
+		case feedbackGood:
+			good++
+		case feedbackBad:
+			bad++
+		}
+	}
+	return good, bad, scanner.Err()
+}
+
+// Запоминает ответ, доставленный пользователю, чтобы его можно было оценить
+func rememberAnswer(session *UserSession, runID, question string) {
+	session.mu.Lock()
+	session.lastAnswer = &answerRef{RunID: runID, Question: question}
+	session.mu.Unlock()
+}
+
+// /good и /bad — оценивают последний ответ ассистента. Каждый ответ оценивается один раз.
+func handleRateCommand(b *botInstance, message *tgbotapi.Message, rating string) {
+	lang := userLanguage(b, message.From)
+	if feedbackLog == nil {
+		sendMessage(b, tgbotapi.NewMessage(message.Chat.ID, t(lang, "feedback.disabled")))
+		return
+	}
+
+	var answer *answerRef
+	if session, exists := b.sessions.Get(chatSession(message.Chat, message.From.ID)); exists {
+		session.mu.Lock()
+		answer = session.lastAnswer
+		session.lastAnswer = nil
+		session.mu.Unlock()
+	}
+	if answer == nil {
+		sendMessage(b, tgbotapi.NewMessage(message.Chat.ID, t(lang, "feedback.no_answer")))
+		return
+	}
+
+	err := feedbackLog.Write(feedbackEntry{
+		Time:     time.Now(),
+		Bot:      b.cfg.Name,
+		UserID:   message.From.ID,
+		RunID:    answer.RunID,
+		Rating:   rating,
+		Question: answer.Question,
+	})
+	if err != nil {
+		b.log.Error("Ошибка сохранения отзыва", "user_id", message.From.ID, "error", err)
+		sendMessage(b, tgbotapi.NewMessage(message.Chat.ID, t(lang, "feedback.save_failed")))
+		return
+	}
+
+	b.log.Info("Получен отзыв об ответе", "user_id", message.From.ID, "run_id", answer.RunID, "rating", rating)
+	msg := tgbotapi.NewMessage(message.Chat.ID, t(lang, "feedback.thanks"))
+	// После плохой оценки пользователю предлагается связаться с оператором
+	if rating == feedbackBad && config.SupportChatID != 0 {
+		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+			tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(t(lang, "operator.button"), operatorCallbackData)),
+		)
+	}
+	sendMessage(b, msg)
+}
+
+// /feedback — показывает администратору сводку оценок ответов
+func handleFeedbackCommand(b *botInstance, message *tgbotapi.Message) {
+	lang := userLanguage(b, message.From)
+	if !isAdmin(message.From.ID) {
+		sendMessage(b, tgbotapi.NewMessage(message.Chat.ID, t(lang, "common.admin_only")))
+		return
+	}
+	if feedbackLog == nil {
+		sendMessage(b, tgbotapi.NewMessage(message.Chat.ID, t(lang, "feedback.disabled")))
+		return
+	}
+
+	good, bad, err := feedbackLog.Summary()
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		b.log.Error("Ошибка чтения журнала отзывов", "error", err)
+		sendMessage(b, tgbotapi.NewMessage(message.Chat.ID, t(lang, "feedback.read_failed")))
+		return
+	}
+
+	if good+bad == 0 {
+		sendMessage(b, tgbotapi.NewMessage(message.Chat.ID, t(lang, "feedback.empty")))
+		return
+	}
+	satisfaction := good * 100 / (good + bad)
+	sendMessage(b, tgbotapi.NewMessage(message.Chat.ID, t(lang, "feedback.summary", good+bad, good, bad, satisfaction)))
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// FileInfo — файл базы знаний в источнике
+type FileInfo struct {
+	// Имя файла относительно корня источника, под ним файл загружается в API
+	Name string
+	Size int64
+	// Версия содержимого, если источник её знает, например ETag. Файл с той же версией,
+	// что и при загрузке, считается неизменённым и не читается
+	Version string
+}
+
+// FileSource — источник файлов базы знаний: локальный каталог, HTTP-сервер или бакет S3
+type FileSource interface {
+	List(ctx context.Context) ([]FileInfo, error)
+	Open(ctx context.Context, name string) (io.ReadCloser, error)
+}
+
+// Создаёт источник файлов по files_source. Пустое значение — локальный каталог files_path.
+//
+//	file:///srv/kb или путь без схемы — локальный каталог;
+//	https://example.com/kb/ — файлы, перечисленные в https://example.com/kb/index.txt;
+//	s3://bucket/prefix — объекты бакета S3 с этим префиксом.
+func newFileSource(filesSource, filesPath string) (FileSource, error) {
+	if filesSource == "" {
+		return localSource{dir: filesPath}, nil
+	}
+
+	u, err := url.Parse(filesSource)
+	if err != nil {
+		return nil, fmt.Errorf("Неверный files_source %s: %v", filesSource, err)
+	}
+	switch u.Scheme {
+	case "", "file":
+		dir := u.Path
+		if u.Scheme == "" {
+			dir = filesSource
+		}
+		return localSource{dir: dir}, nil
+	case "http", "https":
+		if !strings.HasSuffix(u.Path, "/") {
+			u.Path += "/"
+		}
+		return httpSource{base: u}, nil
+	case "s3":
+		endpoint := config.S3Endpoint
+		if endpoint == "" {
+			endpoint = "https://s3.amazonaws.com"
+		}
+		prefix := strings.TrimPrefix(u.Path, "/")
+		if prefix != "" && !strings.HasSuffix(prefix, "/") {
+			prefix += "/"
+		}
+		return s3Source{endpoint: endpoint, bucket: u.Host, prefix: prefix, creds: loadS3Credentials()}, nil
+	}
+	return nil, fmt.Errorf("Неподдерживаемая схема files_source: %s", u.Scheme)
+}
+
+// localSource — файлы каталога на диске (без вложенных каталогов)
+type localSource struct {
+	dir string
+}
+
+func (s localSource) List(ctx context.Context) ([]FileInfo, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []FileInfo
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, FileInfo{Name: entry.Name(), Size: info.Size()})
+	}
+	return files, nil
+}
+
+func (s localSource) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	return os.Open(filepath.Join(s.dir, name))
+}
+
+// httpSource — файлы на HTTP-сервере. Список файлов берётся из index.txt в корне:
+// по одному относительному пути в строке, пустые строки и строки с # пропускаются.
+type httpSource struct {
+	base *url.URL
+}
+
+func (s httpSource) List(ctx context.Context) ([]FileInfo, error) {
+	body, err := s.get(ctx, "index.txt")
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	var files []FileInfo
+	scanner := bufio.NewScanner(body)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		files = append(files, FileInfo{Name: line, Size: -1})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("Ошибка чтения списка файлов: %v", err)
+	}
+	return files, nil
+}
+
+func (s httpSource) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	return s.get(ctx, name)
+}
+
+func (s httpSource) get(ctx context.Context, name string) (io.ReadCloser, error) {
+	ref, err := url.Parse(name)
+	if err != nil {
+		return nil, err
+	}
+	return httpGet(ctx, s.base.ResolveReference(ref).String())
+}
+
+// s3Source — объекты бакета S3 или совместимого хранилища (MinIO). Запросы подписываются
+// ключами доступа, без ключей бакет должен разрешать анонимное чтение и получение списка объектов.
+type s3Source struct {
+	endpoint string
+	bucket   string
+	prefix   string
+	creds    s3Credentials
+}
+
+func (s s3Source) List(ctx context.Context) ([]FileInfo, error) {
+	var files []FileInfo
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {s.prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		body, err := s.get(ctx, "", query)
+		if err != nil {
+			return nil, err
+		}
+
+		var result struct {
+			Contents []struct {
+				Key  string `xml:"Key"`
+				Size int64  `xml:"Size"`
+			} `xml:"Contents"`
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+		}
+		err = xml.NewDecoder(body).Decode(&result)
+		body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("Ошибка разбора списка объектов S3: %v", err)
+		}
+
+		for _, object := range result.Contents {
+			name := strings.TrimPrefix(object.Key, s.prefix)
+			// Ключи, оканчивающиеся на /, обозначают каталоги
+			if name == "" || strings.HasSuffix(name, "/") {
+				continue
+			}
+			files = append(files, FileInfo{Name: name, Size: object.Size})
+		}
+
+		if !result.IsTruncated {
+			return files, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+func (s s3Source) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	return s.get(ctx, s.prefix+name, nil)
+}
+
+// Запрашивает объект key бакета (пустой key — сам бакет) в адресации по пути
+// endpoint/bucket/key, которую поддерживают и Amazon S3, и MinIO
+func (s s3Source) get(ctx context.Context, key string, query url.Values) (io.ReadCloser, error) {
+	u, err := url.Parse(s.endpoint)
+	if err != nil {
+		return nil, err
+	}
+	u.Path = path.Join("/", u.Path, s.bucket, key)
+	u.RawPath = s3EscapePath(u.Path)
+	u.RawQuery = s3CanonicalQuery(query)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	s.creds.sign(req, time.Now())
+	return doGet(req)
+}
+
+// Выполняет GET и возвращает тело успешного ответа
+func httpGet(ctx context.Context, rawURL string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	return doGet(req)
+}
+
+func doGet(req *http.Request) (io.ReadCloser, error) {
+	rawURL := req.URL.Redacted()
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("Ошибка загрузки %s: статус %d", rawURL, resp.StatusCode)
+	}
+	return resp.Body, nil
+}
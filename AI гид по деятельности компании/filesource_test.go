@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestNewFileSource(t *testing.T) {
+	tests := []struct {
+		source  string
+		want    FileSource
+		wantErr bool
+	}{
+		{"", localSource{dir: "./files"}, false},
+		{"file:///srv/kb", localSource{dir: "/srv/kb"}, false},
+		{"/srv/kb", localSource{dir: "/srv/kb"}, false},
+		{"kb/docs", localSource{dir: "kb/docs"}, false},
+		{"ftp://example.com/kb", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := newFileSource(tt.source, "./files")
+		if (err != nil) != tt.wantErr || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("newFileSource(%q) = %#v, %v; want %#v, ошибка %v", tt.source, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+// Локальный источник перечисляет файлы каталога с размерами, пропуская вложенные каталоги
+func TestLocalSource(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{"about.txt": "О компании", "prices.csv": "услуга,цена\n"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "archive", "old.txt"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	source, err := newFileSource("file://"+dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	files, err := source.List(ctx)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	want := []FileInfo{{Name: "about.txt", Size: int64(len("О компании"))}, {Name: "prices.csv", Size: int64(len("услуга,цена\n"))}}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("List = %+v, want %+v", files, want)
+	}
+
+	r, err := source.Open(ctx, "about.txt")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer r.Close()
+	if content, _ := io.ReadAll(r); string(content) != "О компании" {
+		t.Errorf("Содержимое about.txt: %q", content)
+	}
+
+	if _, err := source.Open(ctx, "missing.txt"); err == nil {
+		t.Error("Открыт несуществующий файл")
+	}
+}
+
+// Отсутствующий каталог — ошибка, а пустой — пустой список
+func TestLocalSourceEmpty(t *testing.T) {
+	ctx := context.Background()
+	if _, err := (localSource{dir: filepath.Join(t.TempDir(), "missing")}).List(ctx); err == nil {
+		t.Error("List отсутствующего каталога без ошибки")
+	}
+	files, err := localSource{dir: t.TempDir()}.List(ctx)
+	if err != nil || len(files) != 0 {
+		t.Errorf("List пустого каталога = %+v, %v", files, err)
+	}
+}
+
+// Хранилище S3 с бакетом kb: список объектов отдаётся страницами по две записи
+// с continuation-token, объекты — по пути /kb/<ключ>
+func newS3Server(t *testing.T, objects map[string]string, keys []string) (*httptest.Server, *[]string) {
+	t.Helper()
+	var tokens []string
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") {
+			t.Errorf("%s: Authorization %q", r.URL.Path, r.Header.Get("Authorization"))
+		}
+		if r.URL.Path != "/kb" {
+			content, ok := objects[strings.TrimPrefix(r.URL.Path, "/kb/")]
+			if !ok {
+				http.Error(w, "<Error><Code>NoSuchKey</Code></Error>", http.StatusNotFound)
+				return
+			}
+			io.WriteString(w, content)
+			return
+		}
+
+		query := r.URL.Query()
+		if query.Get("list-type") != "2" || query.Get("prefix") != "docs/" {
+			t.Errorf("Запрос списка %q", r.URL.RawQuery)
+		}
+		token := query.Get("continuation-token")
+		mu.Lock()
+		tokens = append(tokens, token)
+		mu.Unlock()
+		start := 0
+		if token != "" {
+			start, _ = strconv.Atoi(strings.TrimPrefix(token, "page-"))
+		}
+		end := min(start+2, len(keys))
+		fmt.Fprint(w, "<ListBucketResult>")
+		for _, key := range keys[start:end] {
+			fmt.Fprintf(w, "<Contents><Key>%s</Key><Size>%d</Size></Contents>", key, len(objects[key]))
+		}
+		if end < len(keys) {
+			fmt.Fprintf(w, "<IsTruncated>true</IsTruncated><NextContinuationToken>page-%d</NextContinuationToken>", end)
+		}
+		fmt.Fprint(w, "</ListBucketResult>")
+	}))
+	t.Cleanup(server.Close)
+	return server, &tokens
+}
+
+// Список объектов S3 собирается со всех страниц, без префикса и без ключей каталогов
+func TestS3SourceList(t *testing.T) {
+	objects := map[string]string{
+		"docs/about.txt":      "О компании",
+		"docs/prices.csv":     "услуга,цена\n",
+		"docs/archive/":       "",
+		"docs/archive/old.md": "# Старое",
+		"docs/contacts.txt":   "Телефон",
+	}
+	server, tokens := newS3Server(t, objects, []string{"docs/about.txt", "docs/archive/", "docs/archive/old.md", "docs/contacts.txt", "docs/prices.csv"})
+	source := s3Source{endpoint: server.URL, bucket: "kb", prefix: "docs/", creds: s3Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret", Region: "us-east-1"}}
+
+	files, err := source.List(context.Background())
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	want := []FileInfo{
+		{Name: "about.txt", Size: int64(len(objects["docs/about.txt"]))},
+		{Name: "archive/old.md", Size: int64(len(objects["docs/archive/old.md"]))},
+		{Name: "contacts.txt", Size: int64(len(objects["docs/contacts.txt"]))},
+		{Name: "prices.csv", Size: int64(len(objects["docs/prices.csv"]))},
+	}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("List = %+v, want %+v", files, want)
+	}
+	if want := []string{"", "page-2", "page-4"}; !reflect.DeepEqual(*tokens, want) {
+		t.Errorf("continuation-token запросов %q, want %q", *tokens, want)
+	}
+}
+
+// Объект открывается по ключу с префиксом, а ошибка хранилища возвращается с кодом ответа
+func TestS3SourceOpen(t *testing.T) {
+	server, _ := newS3Server(t, map[string]string{"docs/прайс 2024.txt": "Цены"}, nil)
+	source := s3Source{endpoint: server.URL, bucket: "kb", prefix: "docs/", creds: s3Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret", Region: "us-east-1"}}
+	ctx := context.Background()
+
+	r, err := source.Open(ctx, "прайс 2024.txt")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	content, _ := io.ReadAll(r)
+	r.Close()
+	if string(content) != "Цены" {
+		t.Errorf("Содержимое объекта: %q", content)
+	}
+
+	if _, err := source.Open(ctx, "missing.txt"); err == nil || !strings.Contains(err.Error(), "статус 404") {
+		t.Errorf("Open отсутствующего объекта: %v, want ошибку со статусом 404", err)
+	}
+}
+
+// Ошибка хранилища и неразборчивый ответ при получении списка — ошибка List
+func TestS3SourceListErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		wantErr string
+	}{
+		{"доступ запрещён", func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "<Error><Code>AccessDenied</Code></Error>", http.StatusForbidden)
+		}, "статус 403"},
+		{"не XML", func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, "<html>")
+		}, "Ошибка разбора списка объектов S3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(tt.handler)
+			defer server.Close()
+			source := s3Source{endpoint: server.URL, bucket: "kb"}
+			if _, err := source.List(context.Background()); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("List = %v, want ошибку с %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"proxyapi-bot/internal/openai"
+)
+
+const (
+	// Префикс данных кнопки с предложенным вопросом, за ним следует ID вопроса в сессии
+	followupCallbackPrefix = "followup:"
+	maxFollowups           = 3
+	// Сколько предложенных вопросов хранится в сессии, чтобы работали кнопки под предыдущими ответами
+	maxStoredFollowups = 30
+	// Максимальная длина текста на кнопке
+	followupButtonLength = 60
+)
+
+const followupPrompt = `Предложи до трёх коротких уточняющих вопросов, которые пользователь может задать после этого ответа. ` +
+	`Вопросы должны быть на языке пользователя и не длиннее 60 символов. ` +
+	`Верни только JSON вида {"questions": ["...", "..."]}.`
+
+// Запрашивает у модели варианты следующих вопросов по паре вопрос–ответ
+func suggestFollowups(ctx context.Context, api openai.AssistantAPI, model, question, answer string) ([]string, error) {
+	content, err := api.ChatCompletionJSON(ctx, model, followupPrompt, "Вопрос: "+question+"\n\nОтвет: "+answer)
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Questions []string `json:"questions"`
+	}
+	if err := json.Unmarshal([]byte(content), &result); err != nil {
+		return nil, fmt.Errorf("Ошибка разбора предложенных вопросов: %v", err)
+	}
+
+	var questions []string
+	for _, q := range result.Questions {
+		q = strings.TrimSpace(q)
+		if q != "" {
+			questions = append(questions, q)
+		}
+		if len(questions) == maxFollowups {
+			break
+		}
+	}
+	return questions, nil
+}
+
+// Предлагает пользователю следующие вопросы кнопками. Ошибки только логируются:
+// ответ уже доставлен, и без предложений можно обойтись.
+func sendFollowups(ctx context.Context, b *botInstance, chatID, userID int64, session *UserSession, lang, question, answer string) {
+	log := requestLog(ctx, b.log)
+	questions, err := suggestFollowups(ctx, b.api, config.FollowupModel, question, answer)
+	if err != nil {
+		log.Warn("Не удалось получить предложенные вопросы", "user_id", userID, "error", err)
+		return
+	}
+	if len(questions) == 0 {
+		return
+	}
+
+	// Данные кнопки ограничены 64 байтами, поэтому в них передаётся только ID вопроса
+	var rows [][]tgbotapi.InlineKeyboardButton
+	session.mu.Lock()
+	if session.followups == nil {
+		session.followups = make(map[int]string)
+	}
+	for _, q := range questions {
+		session.nextFollowupID++
+		id := session.nextFollowupID
+		session.followups[id] = q
+		delete(session.followups, id-maxStoredFollowups)
+
+		data := followupCallbackPrefix + strconv.Itoa(id)
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(truncateRunes(q, followupButtonLength), data)))
+	}
+	session.mu.Unlock()
+
+	msg := tgbotapi.NewMessage(chatID, t(lang, "followup.header"))
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	sendMessage(b, msg)
+}
+
+// Обрабатывает нажатие кнопки с предложенным вопросом: задаёт его так, как будто пользователь написал его сам
+func handleFollowupCallback(b *botInstance, query *tgbotapi.CallbackQuery) {
+	id, err := strconv.Atoi(strings.TrimPrefix(query.Data, followupCallbackPrefix))
+	if err != nil {
+		b.sender.Request(tgbotapi.NewCallback(query.ID, ""))
+		return
+	}
+
+	lang := userLanguage(b, query.From)
+
+	var question string
+	if session, exists := b.sessions.Get(chatSession(query.Message.Chat, query.From.ID)); exists {
+		session.mu.Lock()
+		question = session.followups[id]
+		session.mu.Unlock()
+	}
+
+	if question == "" {
+		b.sender.Request(tgbotapi.NewCallback(query.ID, t(lang, "followup.expired")))
+		return
+	}
+
+	b.sender.Request(tgbotapi.NewCallback(query.ID, ""))
+	sendMessage(b, tgbotapi.NewMessage(query.Message.Chat.ID, t(lang, "followup.question", question)))
+
+	// Сообщение с кнопками отправлено ботом, поэтому автором вопроса указываем нажавшего пользователя
+	message := *query.Message
+	message.From = query.From
+	ctx := newRequestContext()
+	requestLog(ctx, b.log).Info("Выбран предложенный вопрос", "user_id", query.From.ID, "query", question)
+	handleUserQuery(ctx, b, &message, question, "", "", false, false)
+}
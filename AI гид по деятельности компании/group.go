@@ -0,0 +1,43 @@
+package main
+
+import (
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Проверяет, что сообщение в группе обращено к боту: это команда без @ или с его именем,
+// ответ на его сообщение или упоминание @бота в тексте или подписи. Упоминание убирается
+// из текста, чтобы не попасть в вопрос ассистенту.
+func addressedToBot(b *botInstance, message *tgbotapi.Message) bool {
+	if message.IsCommand() {
+		_, addressed := parseCommand(b, message)
+		return addressed
+	}
+	if reply := message.ReplyToMessage; reply != nil && reply.From != nil && reply.From.ID == b.botUserID {
+		return true
+	}
+	if b.username == "" {
+		return false
+	}
+
+	mention := "@" + b.username
+	addressed := false
+	for _, text := range []*string{&message.Text, &message.Caption} {
+		if i := indexMention(*text, mention); i >= 0 {
+			*text = strings.TrimSpace((*text)[:i] + (*text)[i+len(mention):])
+			addressed = true
+		}
+	}
+	return addressed
+}
+
+// Возвращает позицию упоминания в тексте без учёта регистра имени. -1 — упоминания нет
+func indexMention(text, mention string) int {
+	for i := 0; i+len(mention) <= len(text); i++ {
+		if text[i] == '@' && strings.EqualFold(text[i:i+len(mention)], mention) {
+			return i
+		}
+	}
+	return -1
+}
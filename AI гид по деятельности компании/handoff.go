@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Режим сессии: сообщения пользователя передаются оператору в support_chat_id, а не ассистенту
+const sessionModeOperator = "operator"
+
+// Данные кнопки "Связаться с оператором" под сообщением о плохой оценке ответа
+const operatorCallbackData = "operator"
+
+// Диалог пользователя, переданный оператору
+type handoffTarget struct {
+	Key sessionKey
+	// Чат пользователя, в который копируются ответы операторов
+	ChatID int64
+	Lang   string
+}
+
+// handoffRelay сопоставляет сообщения в чате поддержки с диалогами пользователей: оператор
+// отвечает на пересланное сообщение, и ответ по его ID находит пользователя. Соответствие
+// хранится в памяти, поэтому после перезапуска операторы не могут ответить на старые сообщения.
+type handoffRelay struct {
+	mu sync.Mutex
+	// Диалог по ID сообщения в чате поддержки
+	targets map[int]handoffTarget
+	// Сообщения в чате поддержки по диалогу, чтобы убрать их при /close
+	messages map[sessionKey][]int
+}
+
+func (r *handoffRelay) add(messageID int, target handoffTarget) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.targets == nil {
+		r.targets = make(map[int]handoffTarget)
+		r.messages = make(map[sessionKey][]int)
+	}
+	r.targets[messageID] = target
+	r.messages[target.Key] = append(r.messages[target.Key], messageID)
+}
+
+func (r *handoffRelay) lookup(messageID int) (handoffTarget, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	target, ok := r.targets[messageID]
+	return target, ok
+}
+
+// Забывает все сообщения диалога в чате поддержки
+func (r *handoffRelay) remove(key sessionKey) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, messageID := range r.messages[key] {
+		delete(r.targets, messageID)
+	}
+	delete(r.messages, key)
+}
+
+// /operator — передаёт диалог оператору
+func handleOperatorCommand(b *botInstance, message *tgbotapi.Message) {
+	startHandoff(b, message.Chat, message.From, userLanguage(b, message.From))
+}
+
+// Обрабатывает нажатие кнопки "Связаться с оператором"
+func handleOperatorCallback(b *botInstance, query *tgbotapi.CallbackQuery) {
+	b.sender.Request(tgbotapi.NewCallback(query.ID, ""))
+	b.sender.Request(tgbotapi.NewEditMessageReplyMarkup(query.Message.Chat.ID, query.Message.MessageID, tgbotapi.InlineKeyboardMarkup{InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{}}))
+	startHandoff(b, query.Message.Chat, query.From, userLanguage(b, query.From))
+}
+
+// Пересылает последние сообщения диалога в support_chat_id и переводит сессию в режим
+// оператора: дальше сообщения пользователя получает оператор, пока он не отправит /close
+func startHandoff(b *botInstance, chat *tgbotapi.Chat, user *tgbotapi.User, lang string) {
+	if config.SupportChatID == 0 {
+		sendMessage(b, tgbotapi.NewMessage(chat.ID, t(lang, "operator.disabled")))
+		return
+	}
+	key := chatSession(chat, user.ID)
+	session := b.sessions.GetOrCreate(key)
+	session.mu.Lock()
+	if session.Mode == sessionModeOperator {
+		session.mu.Unlock()
+		sendMessage(b, tgbotapi.NewMessage(chat.ID, t(lang, "operator.already")))
+		return
+	}
+	session.Mode = sessionModeOperator
+	session.mu.Unlock()
+
+	ctx := newRequestContext()
+	log := requestLog(ctx, b.log)
+	target := handoffTarget{Key: key, ChatID: chat.ID, Lang: lang}
+	for _, part := range splitMessage(handoffTranscript(ctx, b, key, chat, user), telegramMessageLimit) {
+		sent, err := b.sender.Send(tgbotapi.NewMessage(config.SupportChatID, part))
+		if err != nil {
+			log.Error("Ошибка отправки диалога в чат поддержки", "user_id", user.ID, "support_chat_id", config.SupportChatID, "error", err)
+			session.mu.Lock()
+			session.Mode = ""
+			session.mu.Unlock()
+			b.handoffs.remove(key)
+			sendMessage(b, tgbotapi.NewMessage(chat.ID, t(lang, "operator.failed")))
+			return
+		}
+		b.handoffs.add(sent.MessageID, target)
+	}
+
+	log.Info("Диалог передан оператору", "user_id", user.ID, "chat_id", chat.ID)
+	sendMessage(b, tgbotapi.NewMessage(chat.ID, t(lang, "operator.started")))
+}
+
+// Формирует сообщение для операторов: кто обратился и последние handoff_transcript_messages
+// сообщений диалога
+func handoffTranscript(ctx context.Context, b *botInstance, key sessionKey, chat *tgbotapi.Chat, user *tgbotapi.User) string {
+	var sb strings.Builder
+	name := strings.TrimSpace(user.FirstName + " " + user.LastName)
+	if user.UserName != "" {
+		name += " @" + user.UserName
+	}
+	fmt.Fprintf(&sb, "Запрос оператора от %s (ID %d)", name, user.ID)
+	if !chat.IsPrivate() {
+		fmt.Fprintf(&sb, " в чате %s (ID %d)", chat.Title, chat.ID)
+	}
+	sb.WriteString("\nОтветьте на это или следующие сообщения, чтобы написать пользователю, /close в ответе — вернуть его ассистенту.\n")
+
+	messages := loadExportMessages(ctx, b, key)
+	if n := config.HandoffTranscriptMessages; len(messages) > n {
+		messages = messages[len(messages)-n:]
+	}
+	for _, m := range messages {
+		role := "Пользователь"
+		if m.Role == "assistant" {
+			role = "Ассистент"
+		}
+		fmt.Fprintf(&sb, "\n%s: %s\n", role, m.Content)
+	}
+	return sb.String()
+}
+
+// Передаёт сообщение пользователя оператору, если диалог в режиме оператора. Команды
+// обрабатываются как обычно. Возвращает true, если сообщение передано.
+func relayToOperator(b *botInstance, message *tgbotapi.Message) bool {
+	if config.SupportChatID == 0 || message.IsCommand() {
+		return false
+	}
+	key := chatSession(message.Chat, message.From.ID)
+	session, exists := b.sessions.Get(key)
+	if !exists {
+		return false
+	}
+	session.mu.Lock()
+	operator := session.Mode == sessionModeOperator
+	session.LastActivity = message.Time()
+	session.mu.Unlock()
+	if !operator {
+		return false
+	}
+
+	lang := userLanguage(b, message.From)
+	sent, err := b.sender.Send(tgbotapi.NewForward(config.SupportChatID, message.Chat.ID, message.MessageID))
+	if err != nil {
+		b.log.Error("Ошибка пересылки сообщения оператору", "user_id", message.From.ID, "error", err)
+		sendMessage(b, tgbotapi.NewMessage(message.Chat.ID, t(lang, "operator.failed")))
+		return true
+	}
+	b.handoffs.add(sent.MessageID, handoffTarget{Key: key, ChatID: message.Chat.ID, Lang: lang})
+	return true
+}
+
+// Обрабатывает сообщение в чате поддержки: ответ оператора на сообщение диалога копируется
+// пользователю, /close в ответе возвращает пользователя к ассистенту. Остальные сообщения
+// чата поддержки бот не читает.
+func handleSupportMessage(b *botInstance, message *tgbotapi.Message) {
+	if message.ReplyToMessage == nil {
+		return
+	}
+	target, ok := b.handoffs.lookup(message.ReplyToMessage.MessageID)
+	if !ok {
+		return
+	}
+
+	if cmd, ok := parseCommand(b, message); ok && cmd.Name == "close" {
+		if session, exists := b.sessions.Get(target.Key); exists {
+			session.mu.Lock()
+			session.Mode = ""
+			session.mu.Unlock()
+		}
+		b.handoffs.remove(target.Key)
+		b.log.Info("Оператор вернул диалог ассистенту", "operator_id", message.From.ID, "chat_id", target.ChatID, "user_id", target.Key.UserID)
+		sendMessage(b, tgbotapi.NewMessage(target.ChatID, t(target.Lang, "operator.closed")))
+		reply := tgbotapi.NewMessage(message.Chat.ID, "Диалог возвращён ассистенту.")
+		reply.ReplyToMessageID = message.MessageID
+		sendMessage(b, reply)
+		return
+	}
+
+	if _, err := b.sender.Send(tgbotapi.NewCopyMessage(target.ChatID, message.Chat.ID, message.MessageID)); err != nil {
+		b.log.Error("Ошибка отправки ответа оператора пользователю", "chat_id", target.ChatID, "error", err)
+		reply := tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("Не удалось доставить ответ пользователю: %v", err))
+		reply.ReplyToMessageID = message.MessageID
+		sendMessage(b, reply)
+		return
+	}
+	// Следующий ответ оператор может дать на своё же сообщение
+	b.handoffs.add(message.MessageID, target)
+}
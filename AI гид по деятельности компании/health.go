@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Интервал проверки связи с Telegram для /readyz
+const telegramProbeInterval = time.Minute
+
+// botHealth — сведения о состоянии бота для проверки готовности
+type botHealth struct {
+	mu sync.Mutex
+	// Время последнего успешного запроса getMe или getUpdates
+	telegramOK time.Time
+	// Количество неудачных запросов к Telegram подряд
+	telegramFailures int
+	// Идёт повторная синхронизация базы знаний
+	resyncing bool
+}
+
+// Периодически проверяет связь с Telegram запросом getMe
+func (b *botInstance) runTelegramProbe() {
+	ticker := time.NewTicker(telegramProbeInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		_, err := b.tg.GetMe()
+		if failures := b.recordTelegramResult(err); err != nil {
+			b.log.Warn("Не удалось проверить связь с Telegram", "failures", failures, "error", err)
+		}
+	}
+}
+
+// Учитывает результат запроса к Telegram (getMe или getUpdates) в состоянии готовности.
+// Возвращает количество неудачных запросов подряд
+func (b *botInstance) recordTelegramResult(err error) int {
+	b.health.mu.Lock()
+	defer b.health.mu.Unlock()
+
+	if err != nil {
+		b.health.telegramFailures++
+	} else {
+		b.health.telegramOK = time.Now()
+		b.health.telegramFailures = 0
+	}
+	return b.health.telegramFailures
+}
+
+// Отмечает начало и окончание повторной синхронизации базы знаний
+func (b *botInstance) setResyncing(resyncing bool) {
+	b.health.mu.Lock()
+	b.health.resyncing = resyncing
+	b.health.mu.Unlock()
+
+	// После синхронизации ответы из кэша могут не соответствовать новой базе знаний
+	if !resyncing {
+		if removed := answerCache.Clear(b.cfg.Name); removed > 0 {
+			b.log.Info("Кэш ответов очищен после синхронизации базы знаний", "removed", removed)
+		}
+	}
+}
+
+// Проверяет готовность бота. Возвращает причину, если бот не готов.
+func (b *botInstance) readiness() (bool, string) {
+	if b.assistantID == "" {
+		return false, "assistant not created"
+	}
+	if b.vectorStoreID == "" && !b.chatOnly {
+		return false, "vector store not indexed"
+	}
+
+	b.health.mu.Lock()
+	defer b.health.mu.Unlock()
+
+	if config.ReadinessStrictResync && b.health.resyncing {
+		return false, "knowledge base resync in progress"
+	}
+	if b.health.telegramFailures >= config.ReadinessMaxTelegramFailures {
+		return false, "telegram unreachable"
+	}
+	if time.Since(b.health.telegramOK) > config.ReadinessTelegramMaxAge {
+		return false, "telegram getMe is stale"
+	}
+	return true, ""
+}
+
+// Состояние бота в ответе /readyz
+type botReadiness struct {
+	Name          string `json:"name"`
+	Ready         bool   `json:"ready"`
+	Reason        string `json:"reason,omitempty"`
+	AssistantID   string `json:"assistant_id"`
+	VectorStoreID string `json:"vector_store_id"`
+}
+
+// Регистрирует /healthz (процесс работает) и /readyz (все боты готовы отвечать) на служебном HTTP-сервере
+func registerHealthHandlers(bots []*botInstance) {
+	metricsMux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok\n"))
+	})
+
+	metricsMux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		response := struct {
+			Ready bool `json:"ready"`
+			buildInfo
+			Uptime        string         `json:"uptime"`
+			UptimeSeconds int64          `json:"uptime_seconds"`
+			Bots          []botReadiness `json:"bots"`
+		}{Ready: true, buildInfo: currentBuild()}
+
+		uptime := time.Since(metrics.startTime)
+		response.Uptime = uptime.Truncate(time.Second).String()
+		response.UptimeSeconds = int64(uptime.Seconds())
+
+		for _, b := range bots {
+			ready, reason := b.readiness()
+			response.Ready = response.Ready && ready
+			response.Bots = append(response.Bots, botReadiness{
+				Name:          b.cfg.Name,
+				Ready:         ready,
+				Reason:        reason,
+				AssistantID:   b.assistantID,
+				VectorStoreID: b.vectorStoreID,
+			})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if !response.Ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(response)
+	})
+}
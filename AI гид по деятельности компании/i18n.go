@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Префикс данных кнопки выбора языка, за ним следует код языка
+const languageCallbackPrefix = "lang:"
+
+// Тексты сообщений для пользователя по коду языка, загружаются из locales/*.yaml
+var locales = map[string]map[string]string{}
+
+// Загружает все наборы сообщений из каталога. Набор для языка по умолчанию обязателен.
+// О ключах, отсутствующих в других наборах, сообщается предупреждением: для них
+// будут показаны тексты на языке по умолчанию.
+func loadLocales(dir, defaultLanguage string) error {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.yaml"))
+	if err != nil {
+		return fmt.Errorf("Ошибка поиска файлов локализации: %v", err)
+	}
+
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("Ошибка чтения файла локализации %s: %v", path, err)
+		}
+
+		messages := map[string]string{}
+		if err := yaml.Unmarshal(data, &messages); err != nil {
+			return fmt.Errorf("Ошибка разбора файла локализации %s: %v", path, err)
+		}
+
+		lang := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		locales[lang] = messages
+	}
+
+	base, ok := locales[defaultLanguage]
+	if !ok {
+		return fmt.Errorf("Не найден файл локализации для языка по умолчанию: %s", filepath.Join(dir, defaultLanguage+".yaml"))
+	}
+
+	for lang, messages := range locales {
+		for key := range base {
+			if _, ok := messages[key]; !ok {
+				slog.Warn("В файле локализации отсутствует ключ", "language", lang, "key", key)
+			}
+		}
+		for key := range messages {
+			if _, ok := base[key]; !ok {
+				slog.Warn("Ключ локализации отсутствует в языке по умолчанию", "language", lang, "key", key)
+			}
+		}
+	}
+	return nil
+}
+
+// Возвращает текст сообщения на языке lang, подставляя аргументы.
+// Если текста нет, используется язык по умолчанию, а в крайнем случае сам ключ.
+func t(lang, key string, args ...interface{}) string {
+	text, ok := locales[lang][key]
+	if !ok {
+		text, ok = locales[config.DefaultLanguage][key]
+	}
+	if !ok {
+		text = key
+	}
+	if len(args) == 0 {
+		return text
+	}
+	return fmt.Sprintf(text, args...)
+}
+
+// Коды загруженных языков в алфавитном порядке
+func availableLanguages() []string {
+	langs := make([]string, 0, len(locales))
+	for lang := range locales {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	return langs
+}
+
+// Определяет язык по коду из Telegram, например "en-US" → "en".
+// Если такого набора сообщений нет, используется язык по умолчанию.
+func detectLanguage(code string) string {
+	lang := strings.ToLower(strings.SplitN(code, "-", 2)[0])
+	if _, ok := locales[lang]; ok {
+		return lang
+	}
+	return config.DefaultLanguage
+}
+
+// Возвращает язык пользователя: выбранный командой /language или определённый по профилю Telegram
+func userLanguage(b *botInstance, user *tgbotapi.User) string {
+	if session, exists := b.sessions.Get(privateSession(user.ID)); exists {
+		session.mu.Lock()
+		lang := session.Language
+		session.mu.Unlock()
+		if lang != "" {
+			return lang
+		}
+	}
+	return detectLanguage(user.LanguageCode)
+}
+
+// /language — предлагает выбрать язык сообщений бота
+func handleLanguageCommand(b *botInstance, message *tgbotapi.Message) {
+	lang := userLanguage(b, message.From)
+
+	var row []tgbotapi.InlineKeyboardButton
+	for _, code := range availableLanguages() {
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData(t(code, "language.name"), languageCallbackPrefix+code))
+	}
+
+	msg := tgbotapi.NewMessage(message.Chat.ID, t(lang, "language.choose"))
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(row)
+	sendMessage(b, msg)
+}
+
+// Обрабатывает выбор языка кнопкой и запоминает его в сессии пользователя
+func handleLanguageCallback(b *botInstance, query *tgbotapi.CallbackQuery) {
+	lang := strings.TrimPrefix(query.Data, languageCallbackPrefix)
+	if _, ok := locales[lang]; !ok {
+		b.sender.Request(tgbotapi.NewCallback(query.ID, ""))
+		return
+	}
+
+	// Язык — настройка пользователя, поэтому он хранится в сессии личного чата и в группах тоже
+	session := b.sessions.GetOrCreate(privateSession(query.From.ID))
+	session.mu.Lock()
+	session.Language = lang
+	session.mu.Unlock()
+
+	b.log.Info("Пользователь выбрал язык", "user_id", query.From.ID, "language", lang)
+	b.sender.Request(tgbotapi.NewCallback(query.ID, ""))
+	b.sender.Request(tgbotapi.NewEditMessageText(query.Message.Chat.ID, query.Message.MessageID, t(lang, "language.set", t(lang, "language.name"))))
+}
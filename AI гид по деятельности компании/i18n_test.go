@@ -0,0 +1,78 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Глагол форматирования fmt без учёта %%
+var formatVerb = regexp.MustCompile(`%[-+# 0]*[0-9]*(?:\.[0-9]+)?[a-zA-Z]`)
+
+// Загружает файл локализации так же, как loadLocales
+func readLocale(t *testing.T, path string) map[string]string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Чтение %s: %v", path, err)
+	}
+	messages := map[string]string{}
+	if err := yaml.Unmarshal(data, &messages); err != nil {
+		t.Fatalf("Разбор %s: %v", path, err)
+	}
+	return messages
+}
+
+// Наборы сообщений всех языков содержат одни и те же ключи с одинаковыми аргументами форматирования
+func TestLocalesConsistent(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("locales", "*.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) < 2 {
+		t.Fatalf("Найдено файлов локализации: %d, ожидается не меньше двух", len(paths))
+	}
+
+	base := readLocale(t, filepath.Join("locales", "ru.yaml"))
+	for _, path := range paths {
+		messages := readLocale(t, path)
+		for key, text := range base {
+			other, ok := messages[key]
+			if !ok {
+				t.Errorf("%s: нет ключа %q", path, key)
+				continue
+			}
+			want := formatVerb.FindAllString(strings.ReplaceAll(text, "%%", ""), -1)
+			got := formatVerb.FindAllString(strings.ReplaceAll(other, "%%", ""), -1)
+			if !slices.Equal(got, want) {
+				t.Errorf("%s: аргументы %q = %v, в ru.yaml %v", path, key, got, want)
+			}
+		}
+		for key := range messages {
+			if _, ok := base[key]; !ok {
+				t.Errorf("%s: ключа %q нет в ru.yaml", path, key)
+			}
+		}
+	}
+}
+
+func TestLoadLocales(t *testing.T) {
+	saved := locales
+	t.Cleanup(func() { locales = saved })
+	locales = map[string]map[string]string{}
+
+	if err := loadLocales("locales", "ru"); err != nil {
+		t.Fatalf("loadLocales: %v", err)
+	}
+	if got := availableLanguages(); !slices.Equal(got, []string{"en", "ru"}) {
+		t.Errorf("availableLanguages() = %v", got)
+	}
+	if err := loadLocales("locales", "de"); err == nil {
+		t.Error("loadLocales без файла языка по умолчанию вернула nil")
+	}
+}
@@ -0,0 +1,37 @@
+package openai
+
+import (
+	"context"
+	"io"
+)
+
+// AssistantAPI — операции API, которые использует бот. Реализуется Client,
+// для проверки кода бота без сети — Mock.
+type AssistantAPI interface {
+	CreateAssistant(ctx context.Context, name, instructions, model string, tools []Tool) (string, error)
+	UpdateAssistant(ctx context.Context, assistantID, vectorStoreID string, tools []Tool) error
+	ModifyAssistant(ctx context.Context, assistantID string, update AssistantUpdate) error
+	ListAssistants(ctx context.Context) ([]AssistantInfo, error)
+	DeleteAssistant(ctx context.Context, assistantID string) error
+	UploadFile(ctx context.Context, fileName string, r io.Reader) (string, error)
+	DeleteFile(ctx context.Context, fileID string) error
+	GetFile(ctx context.Context, fileID string) (FileInfo, error)
+	DownloadFile(ctx context.Context, fileID string, w io.Writer, maxBytes int64) error
+	CreateVectorStore(ctx context.Context) (string, error)
+	AddFileToVectorStore(ctx context.Context, vectorStoreID, fileID string) error
+	ListVectorStoreFiles(ctx context.Context, vectorStoreID string) ([]VectorStoreFile, error)
+	RemoveFileFromVectorStore(ctx context.Context, vectorStoreID, fileID string) error
+	CreateThread(ctx context.Context, messages []map[string]interface{}, vectorStoreID string) (string, error)
+	AddThreadMessage(ctx context.Context, threadID, role string, content interface{}, attachments []Attachment) error
+	ListThreadMessages(ctx context.Context, threadID string) ([]ThreadMessage, error)
+	DeleteThread(ctx context.Context, threadID string) error
+	// Запускает ассистента с потоковой передачей ответа. observer может быть nil.
+	CreateThreadRun(ctx context.Context, req RunRequest, observer RunObserver) (RunResult, error)
+	CancelRun(ctx context.Context, threadID, runID string) error
+	ChatCompletion(ctx context.Context, model, system, user string) (string, error)
+	ChatCompletionJSON(ctx context.Context, model, system, user string) (string, error)
+	Moderate(ctx context.Context, model, text string) (*ModerationResult, error)
+	SynthesizeSpeech(ctx context.Context, model, voice, text string) ([]byte, error)
+	TranscribeAudio(ctx context.Context, url, model, filePath string) (string, error)
+	ListModels(ctx context.Context) ([]string, error)
+}
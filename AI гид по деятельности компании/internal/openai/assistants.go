@@ -0,0 +1,269 @@
+package openai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+)
+
+type AssistantCreateRequest struct {
+	Name         string `json:"name"`
+	Instructions string `json:"instructions"`
+	Model        string `json:"model"`
+	Tools        []Tool `json:"tools"`
+}
+
+type Tool struct {
+	Type       string              `json:"type"`
+	FileSearch *FileSearchOptions  `json:"file_search,omitempty"`
+	Function   *FunctionDefinition `json:"function,omitempty"`
+}
+
+// Описание функции для инструмента function
+type FunctionDefinition struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// JSON Schema аргументов. Пусто — функция без аргументов
+	Parameters json.RawMessage `json:"parameters,omitempty"`
+}
+
+// Настройки инструмента file_search
+type FileSearchOptions struct {
+	// Количество фрагментов, возвращаемых поиском. 0 — значение API по умолчанию
+	MaxNumResults int `json:"max_num_results,omitempty"`
+}
+
+type AssistantCreateResponse struct {
+	ID string `json:"id"`
+}
+
+// Создаёт ассистента с заданными инструментами и возвращает его ID
+func (c *Client) CreateAssistant(ctx context.Context, name, instructions, model string, tools []Tool) (string, error) {
+	if tools == nil {
+		tools = []Tool{}
+	}
+
+	requestBody := AssistantCreateRequest{
+		Name:         name,
+		Instructions: instructions,
+		Model:        c.assistantModel(model),
+		Tools:        tools,
+	}
+
+	reqBody, err := json.Marshal(requestBody)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := c.newRequest(ctx, "POST", "assistants", bytes.NewBuffer(reqBody))
+	if err != nil {
+		return "", err
+	}
+
+	// Логирование запроса
+	c.logger(ctx).Debug("Создание ассистента: отправка запроса", "url", req.URL)
+
+	resp, err := c.do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	c.logger(ctx).Debug("Получен ответ при создании ассистента", "body", string(body))
+
+	if resp.StatusCode != http.StatusOK {
+		c.logger(ctx).Error("Ошибка создания ассистента", "status_code", resp.StatusCode, "body", string(body))
+		return "", newAPIError(resp.StatusCode, body)
+	}
+
+	var assistantResponse AssistantCreateResponse
+	if err := json.Unmarshal(body, &assistantResponse); err != nil {
+		return "", err
+	}
+
+	c.logger(ctx).Info("Ассистент создан", "assistant_id", assistantResponse.ID)
+	return assistantResponse.ID, nil
+}
+
+// Ресурсы инструмента file_search с одним Vector Store
+func fileSearchResources(vectorStoreID string) map[string]interface{} {
+	return map[string]interface{}{
+		"file_search": map[string]interface{}{
+			"vector_store_ids": []string{vectorStoreID},
+		},
+	}
+}
+
+// Подключает к ассистенту Vector Store для поиска по файлам. Пустой vectorStoreID оставляет
+// ресурсы без изменений. Если tools не nil, заменяет и набор инструментов ассистента.
+func (c *Client) UpdateAssistant(ctx context.Context, assistantID, vectorStoreID string, tools []Tool) error {
+	updateBody := map[string]interface{}{}
+	if vectorStoreID != "" {
+		updateBody["tool_resources"] = fileSearchResources(vectorStoreID)
+	}
+	if tools != nil {
+		updateBody["tools"] = tools
+	}
+
+	reqBody, err := json.Marshal(updateBody)
+	if err != nil {
+		return err
+	}
+
+	req, err := c.newRequest(ctx, "POST", BuildURL("assistants", assistantID), bytes.NewBuffer(reqBody))
+	if err != nil {
+		return err
+	}
+
+	c.logger(ctx).Debug("Обновление ассистента", "assistant_id", assistantID)
+
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		c.logger(ctx).Error("Ошибка обновления ассистента", "status_code", resp.StatusCode, "body", string(body))
+		return newAPIError(resp.StatusCode, body)
+	}
+
+	c.logger(ctx).Info("Ассистент успешно обновлен", "assistant_id", assistantID)
+	return nil
+}
+
+// Изменяемые настройки ассистента. Пустые поля не отправляются и остаются прежними
+type AssistantUpdate struct {
+	Name         string `json:"name,omitempty"`
+	Instructions string `json:"instructions,omitempty"`
+	Model        string `json:"model,omitempty"`
+	Tools        []Tool `json:"tools,omitempty"`
+}
+
+// Изменяет имя, инструкции, модель или инструменты существующего ассистента
+func (c *Client) ModifyAssistant(ctx context.Context, assistantID string, update AssistantUpdate) error {
+	if update.Model != "" {
+		update.Model = c.assistantModel(update.Model)
+	}
+
+	reqBody, err := json.Marshal(update)
+	if err != nil {
+		return err
+	}
+
+	req, err := c.newRequest(ctx, "POST", BuildURL("assistants", assistantID), bytes.NewBuffer(reqBody))
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		c.logger(ctx).Error("Ошибка изменения ассистента", "status_code", resp.StatusCode, "body", string(body))
+		return newAPIError(resp.StatusCode, body)
+	}
+
+	c.logger(ctx).Info("Настройки ассистента изменены", "assistant_id", assistantID)
+	return nil
+}
+
+// Ассистент из списка ассистентов ключа API
+type AssistantInfo struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Model     string `json:"model"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// Возвращает всех ассистентов ключа API, загружая список по страницам
+func (c *Client) ListAssistants(ctx context.Context) ([]AssistantInfo, error) {
+	var assistants []AssistantInfo
+	after := ""
+	for {
+		req, err := c.newRequest(ctx, "GET", "assistants", nil)
+		if err != nil {
+			return nil, err
+		}
+		query := req.URL.Query()
+		query.Set("limit", "100")
+		if after != "" {
+			query.Set("after", after)
+		}
+		req.URL.RawQuery = query.Encode()
+
+		resp, err := c.do(req)
+		if err != nil {
+			return nil, err
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			c.logger(ctx).Error("Ошибка получения списка ассистентов", "status_code", resp.StatusCode, "body", string(body))
+			return nil, newAPIError(resp.StatusCode, body)
+		}
+
+		var page struct {
+			Data    []AssistantInfo `json:"data"`
+			HasMore bool            `json:"has_more"`
+			LastID  string          `json:"last_id"`
+		}
+		if err := json.Unmarshal(body, &page); err != nil {
+			return nil, err
+		}
+		assistants = append(assistants, page.Data...)
+
+		if !page.HasMore || page.LastID == "" {
+			return assistants, nil
+		}
+		after = page.LastID
+	}
+}
+
+// Удаляет ассистента. Его потоки и файлы при этом не удаляются
+func (c *Client) DeleteAssistant(ctx context.Context, assistantID string) error {
+	req, err := c.newRequest(ctx, "DELETE", BuildURL("assistants", assistantID), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return newAPIError(resp.StatusCode, body)
+	}
+
+	c.logger(ctx).Info("Ассистент удалён", "assistant_id", assistantID)
+	return nil
+}
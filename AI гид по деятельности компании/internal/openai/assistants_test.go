@@ -0,0 +1,171 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeAssistantsAPI имитирует эндпоинты assistants, files, vector_stores и threads/runs
+// и запоминает, что в них передано
+type fakeAssistantsAPI struct {
+	t  *testing.T
+	mu sync.Mutex
+	// Содержимое загруженных файлов по ID
+	files map[string]string
+	// ID файлов, зарегистрированных в Vector Store
+	vectorStoreFiles []string
+	// Vector Store, подключённый к ассистенту
+	assistantVectorStore string
+	// Тело запроса запуска
+	run map[string]interface{}
+}
+
+func (f *fakeAssistantsAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer test-key" || r.Header.Get("OpenAI-Beta") != "assistants=v2" {
+		f.t.Errorf("%s %s: заголовки Authorization %q, OpenAI-Beta %q", r.Method, r.URL.Path, r.Header.Get("Authorization"), r.Header.Get("OpenAI-Beta"))
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch {
+	case r.Method == "POST" && r.URL.Path == "/assistants":
+		io.WriteString(w, `{"id":"asst_1","object":"assistant"}`)
+	case r.Method == "POST" && r.URL.Path == "/files":
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			f.t.Errorf("Файл не найден в запросе загрузки: %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		data, _ := io.ReadAll(file)
+		if r.FormValue("purpose") != "assistants" {
+			f.t.Errorf("purpose = %q, want assistants", r.FormValue("purpose"))
+		}
+		id := fmt.Sprintf("file-%d", len(f.files)+1)
+		f.files[id] = header.Filename + ":" + string(data)
+		fmt.Fprintf(w, `{"id":%q,"object":"file"}`, id)
+	case r.Method == "POST" && r.URL.Path == "/vector_stores":
+		io.WriteString(w, `{"id":"vs_1","object":"vector_store"}`)
+	case r.Method == "POST" && r.URL.Path == "/vector_stores/vs_1/files":
+		var body struct {
+			FileID string `json:"file_id"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		f.vectorStoreFiles = append(f.vectorStoreFiles, body.FileID)
+		fmt.Fprintf(w, `{"id":%q,"object":"vector_store.file"}`, body.FileID)
+	case r.Method == "POST" && r.URL.Path == "/assistants/asst_1":
+		var body struct {
+			ToolResources struct {
+				FileSearch struct {
+					VectorStoreIDs []string `json:"vector_store_ids"`
+				} `json:"file_search"`
+			} `json:"tool_resources"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		f.assistantVectorStore = strings.Join(body.ToolResources.FileSearch.VectorStoreIDs, ",")
+		io.WriteString(w, `{"id":"asst_1","object":"assistant"}`)
+	case r.Method == "POST" && r.URL.Path == "/threads/runs":
+		json.NewDecoder(r.Body).Decode(&f.run)
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "event: thread.run.created\n"+runEvent("queued"))
+		io.WriteString(w, deltaEvent("Центр работает "))
+		io.WriteString(w, deltaEvent("с 9 до 18."))
+		io.WriteString(w, `data: {"object":"thread.message","status":"completed","content":[]}`+"\n\n")
+		io.WriteString(w, runEvent("completed"))
+		io.WriteString(w, "data: [DONE]\n\n")
+	default:
+		f.t.Errorf("Неожиданный запрос %s %s", r.Method, r.URL.Path)
+		http.NotFound(w, r)
+	}
+}
+
+// Полный путь от создания ассистента до ответа: ID, возвращённые API, передаются в следующие запросы
+func TestAssistantFlow(t *testing.T) {
+	api := &fakeAssistantsAPI{t: t, files: map[string]string{}}
+	client := newTestClient(t, api.ServeHTTP)
+	ctx := context.Background()
+
+	assistantID, err := client.CreateAssistant(ctx, "Консультант", "Отвечай по документам", "gpt-4o", []Tool{{Type: "file_search"}})
+	if err != nil || assistantID != "asst_1" {
+		t.Fatalf("CreateAssistant = %q, %v", assistantID, err)
+	}
+
+	var fileIDs []string
+	for _, name := range []string{"about.txt", "contacts.txt"} {
+		fileID, err := client.UploadFile(ctx, name, strings.NewReader("содержимое "+name))
+		if err != nil {
+			t.Fatalf("UploadFile(%s): %v", name, err)
+		}
+		fileIDs = append(fileIDs, fileID)
+	}
+
+	vectorStoreID, err := client.CreateVectorStore(ctx)
+	if err != nil || vectorStoreID != "vs_1" {
+		t.Fatalf("CreateVectorStore = %q, %v", vectorStoreID, err)
+	}
+	for _, fileID := range fileIDs {
+		if err := client.AddFileToVectorStore(ctx, vectorStoreID, fileID); err != nil {
+			t.Fatalf("AddFileToVectorStore(%s): %v", fileID, err)
+		}
+	}
+	if err := client.UpdateAssistant(ctx, assistantID, vectorStoreID, nil); err != nil {
+		t.Fatalf("UpdateAssistant: %v", err)
+	}
+
+	result, err := client.CreateThreadRun(ctx, RunRequest{
+		AssistantID:   assistantID,
+		VectorStoreID: vectorStoreID,
+		Messages:      []map[string]interface{}{{"role": "user", "content": "Когда работает центр?"}},
+		Temperature:   0.5,
+	}, nil)
+	if err != nil {
+		t.Fatalf("CreateThreadRun: %v", err)
+	}
+
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	if want := map[string]string{"file-1": "about.txt:содержимое about.txt", "file-2": "contacts.txt:содержимое contacts.txt"}; !maps.Equal(api.files, want) {
+		t.Errorf("Загружены файлы %q, want %q", api.files, want)
+	}
+	if !slices.Equal(api.vectorStoreFiles, fileIDs) {
+		t.Errorf("В Vector Store зарегистрированы %q, want %q", api.vectorStoreFiles, fileIDs)
+	}
+	if api.assistantVectorStore != "vs_1" {
+		t.Errorf("К ассистенту подключён Vector Store %q, want vs_1", api.assistantVectorStore)
+	}
+	if api.run["assistant_id"] != "asst_1" || api.run["stream"] != true {
+		t.Errorf("Запрос запуска: assistant_id %v, stream %v", api.run["assistant_id"], api.run["stream"])
+	}
+	if resources, _ := json.Marshal(api.run["tool_resources"]); string(resources) != `{"file_search":{"vector_store_ids":["vs_1"]}}` {
+		t.Errorf("tool_resources запуска = %s", resources)
+	}
+	if result.Text != "Центр работает с 9 до 18." || result.RunID != "run_1" || result.ThreadID != "thread_1" {
+		t.Errorf("Результат запуска: %q, run %q, thread %q", result.Text, result.RunID, result.ThreadID)
+	}
+}
+
+// Ошибка загрузки возвращается как APIError с кодом и сообщением ответа
+func TestUploadFileError(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"error":{"message":"Invalid file format","type":"invalid_request_error","code":"unsupported_file"}}`)
+	})
+
+	_, err := client.UploadFile(context.Background(), "image.bmp", strings.NewReader("BM"))
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("err = %v, want *APIError", err)
+	}
+	if apiErr.StatusCode != http.StatusBadRequest || apiErr.ErrorCode != "unsupported_file" || apiErr.Message != "Invalid file format" {
+		t.Errorf("APIError = %+v", *apiErr)
+	}
+}
@@ -0,0 +1,115 @@
+package openai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// Синтезирует речь через audio/speech и возвращает аудио в формате OGG/Opus
+func (c *Client) SynthesizeSpeech(ctx context.Context, model, voice, text string) ([]byte, error) {
+	requestBody := map[string]interface{}{
+		"model":           model,
+		"voice":           voice,
+		"input":           text,
+		"response_format": "opus",
+	}
+
+	reqBody, err := json.Marshal(requestBody)
+	if err != nil {
+		return nil, fmt.Errorf("Ошибка создания тела запроса: %v", err)
+	}
+
+	req, err := c.newRequest(ctx, "POST", c.deploymentEndpoint(model, "audio/speech"), bytes.NewBuffer(reqBody))
+	if err != nil {
+		return nil, err
+	}
+
+	c.logger(ctx).Debug("Синтез речи", "chars", utf8.RuneCountInString(text))
+
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		c.logger(ctx).Error("Ошибка синтеза речи", "status_code", resp.StatusCode, "body", string(body))
+		return nil, newAPIError(resp.StatusCode, body)
+	}
+	return body, nil
+}
+
+// Отправляет аудиофайл на распознавание по адресу url и возвращает текст
+func (c *Client) TranscribeAudio(ctx context.Context, url, model, filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+
+	fw, err := w.CreateFormFile("file", filepath.Base(filePath))
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(fw, file); err != nil {
+		return "", err
+	}
+	if err := w.WriteField("model", model); err != nil {
+		return "", err
+	}
+	w.Close()
+
+	req, err := c.newRequestURL(ctx, "POST", url, &body)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", w.FormDataContentType())
+
+	c.logger(ctx).Debug("Распознавание голосового сообщения", "url", req.URL)
+
+	resp, err := c.do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		c.logger(ctx).Error("Ошибка распознавания голосового сообщения", "status_code", resp.StatusCode, "body", string(respBody))
+		return "", newAPIError(resp.StatusCode, respBody)
+	}
+
+	var result struct {
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return "", err
+	}
+
+	text := strings.TrimSpace(result.Text)
+	if text == "" {
+		return "", fmt.Errorf("Пустой результат распознавания")
+	}
+	return text, nil
+}
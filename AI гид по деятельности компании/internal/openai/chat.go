@@ -0,0 +1,74 @@
+package openai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Выполняет запрос chat/completions с ответом в формате JSON и возвращает содержимое ответа модели
+func (c *Client) ChatCompletionJSON(ctx context.Context, model, system, user string) (string, error) {
+	return c.chatCompletion(ctx, model, system, user, true)
+}
+
+// Выполняет запрос chat/completions и возвращает текст ответа модели
+func (c *Client) ChatCompletion(ctx context.Context, model, system, user string) (string, error) {
+	return c.chatCompletion(ctx, model, system, user, false)
+}
+
+func (c *Client) chatCompletion(ctx context.Context, model, system, user string, jsonMode bool) (string, error) {
+	requestBody := map[string]interface{}{
+		"model": model,
+		"messages": []map[string]interface{}{
+			{"role": "system", "content": system},
+			{"role": "user", "content": user},
+		},
+	}
+	if jsonMode {
+		requestBody["response_format"] = map[string]interface{}{"type": "json_object"}
+	}
+
+	reqBody, err := json.Marshal(requestBody)
+	if err != nil {
+		return "", fmt.Errorf("Ошибка создания тела запроса: %v", err)
+	}
+
+	req, err := c.newRequest(ctx, "POST", c.deploymentEndpoint(model, "chat/completions"), bytes.NewBuffer(reqBody))
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		c.logger(ctx).Error("Ошибка запроса chat/completions", "status_code", resp.StatusCode, "body", string(body))
+		return "", newAPIError(resp.StatusCode, body)
+	}
+
+	var completion struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if err := json.Unmarshal(body, &completion); err != nil {
+		return "", err
+	}
+	if len(completion.Choices) == 0 {
+		return "", fmt.Errorf("Пустой ответ chat/completions")
+	}
+	return completion.Choices[0].Message.Content, nil
+}
@@ -0,0 +1,205 @@
+// Пакет openai — клиент API ассистентов, совместимого с OpenAI (Assistants API v2).
+// Клиент не зависит от конфигурации бота: адрес, ключ и ограничения передаются при создании.
+package openai
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Поставщики API
+const (
+	ProviderOpenAI = "openai"
+	ProviderAzure  = "azure"
+)
+
+// Client — клиент API ассистентов. Хранит адрес, ключ и HTTP-клиент,
+// поэтому может быть направлен на любой совместимый сервер.
+type Client struct {
+	BaseURL    string
+	APIKey     string
+	HTTPClient *http.Client
+	// Ограничения размера тела ответа и собранного из потока ответа ассистента в байтах. 0 — без ограничения.
+	MaxResponseBytes int64
+	MaxAnswerBytes   int
+	// Ограничение общей длительности потока ответа ассистента. 0 — без ограничения.
+	StreamTimeout time.Duration
+	Logger        *slog.Logger
+	// Поставщик API: ProviderOpenAI (по умолчанию) или ProviderAzure. Azure OpenAI принимает ключ
+	// в заголовке api-key, требует параметр api-version и адресует модели по имени развёртывания.
+	Provider        string
+	AzureAPIVersion string
+	// Развёртывание, используемое вместо модели ассистента и для запросов без указания модели
+	AzureDeployment string
+}
+
+// Проверка на этапе компиляции, что Client реализует AssistantAPI
+var _ AssistantAPI = (*Client)(nil)
+
+func New(baseURL, apiKey string, logger *slog.Logger) *Client {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &Client{
+		BaseURL:    baseURL,
+		APIKey:     apiKey,
+		HTTPClient: &http.Client{},
+		Logger:     logger,
+	}
+}
+
+// Соединяет адрес и сегменты пути ровно одним "/" между ними, независимо от того, есть ли "/"
+// в начале или конце сегментов. Пустые сегменты пропускаются. Так адрес API может содержать
+// путь шлюза (https://gateway/llm/openai/v1) как с завершающим "/", так и без него.
+func BuildURL(parts ...string) string {
+	segments := make([]string, 0, len(parts))
+	for i, part := range parts {
+		if i == 0 {
+			part = strings.TrimRight(part, "/")
+		} else {
+			part = strings.Trim(part, "/")
+		}
+		if part != "" {
+			segments = append(segments, part)
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// Создаёт запрос к API с заголовками авторизации и версии Assistants API
+func (c *Client) newRequest(ctx context.Context, method, endpoint string, body io.Reader) (*http.Request, error) {
+	return c.newRequestURL(ctx, method, BuildURL(c.BaseURL, endpoint), body)
+}
+
+// Возвращает путь запроса к модели. В Azure OpenAI chat/completions и audio/* доступны
+// только по пути развёртывания: имя модели в настройках считается именем развёртывания,
+// а при его отсутствии используется AzureDeployment.
+func (c *Client) deploymentEndpoint(model, endpoint string) string {
+	if c.Provider != ProviderAzure {
+		return endpoint
+	}
+	if model == "" {
+		model = c.AzureDeployment
+	}
+	return BuildURL("deployments", model, endpoint)
+}
+
+// Возвращает модель ассистента: в Azure OpenAI вместо неё указывается развёртывание
+func (c *Client) assistantModel(model string) string {
+	if c.Provider == ProviderAzure && c.AzureDeployment != "" {
+		return c.AzureDeployment
+	}
+	return model
+}
+
+// Создаёт запрос с заголовками API по полному адресу. ID запроса из ctx передаётся
+// в заголовке X-Client-Request-Id, чтобы запрос можно было найти в журналах провайдера.
+func (c *Client) newRequestURL(ctx context.Context, method, url string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Provider == ProviderAzure {
+		query := req.URL.Query()
+		query.Set("api-version", c.AzureAPIVersion)
+		req.URL.RawQuery = query.Encode()
+		req.Header.Set("api-key", c.APIKey)
+	} else {
+		req.Header.Set("Authorization", "Bearer "+c.APIKey)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("OpenAI-Beta", "assistants=v2")
+	if id := RequestID(ctx); id != "" {
+		req.Header.Set("X-Client-Request-Id", id)
+	}
+	return req, nil
+}
+
+// Журнал клиента с ID запроса из ctx
+func (c *Client) logger(ctx context.Context) *slog.Logger {
+	if id := RequestID(ctx); id != "" {
+		return c.Logger.With("request_id", id)
+	}
+	return c.Logger
+}
+
+// Выполняет запрос к API. Тело ответа ограничивается MaxResponseBytes, чтобы неисправный
+// сервер не мог исчерпать память.
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if c.MaxResponseBytes > 0 {
+		resp.Body = &limitedBody{ReadCloser: resp.Body, remaining: c.MaxResponseBytes}
+	}
+	return resp, nil
+}
+
+// limitedBody возвращает ErrResponseTooLarge при попытке прочитать больше remaining байт
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.remaining <= 0 {
+		// Лимит исчерпан: ошибка возвращается, только если в теле действительно остались данные
+		var probe [1]byte
+		for {
+			n, err := b.ReadCloser.Read(probe[:])
+			if n > 0 {
+				return 0, ErrResponseTooLarge
+			}
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	if int64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+	return n, err
+}
+
+// Вспомогательные функции для получения значений
+// getString извлекает строковое значение из map по заданному ключу.
+// Возвращает строку и bool значение, указывающее, удалось ли получить строку.
+func getString(m map[string]interface{}, key string) (string, bool) {
+	if val, ok := m[key]; ok {
+		if str, ok := val.(string); ok {
+			return str, true
+		}
+	}
+	return "", false
+}
+
+// getMap извлекает значение типа map[string]interface{} из map по заданному ключу.
+// Возвращает карту и bool значение, указывающее, удалось ли получить карту.
+func getMap(m map[string]interface{}, key string) (map[string]interface{}, bool) {
+	if val, ok := m[key]; ok {
+		if mp, ok := val.(map[string]interface{}); ok {
+			return mp, true
+		}
+	}
+	return nil, false
+}
+
+// getArray извлекает срез значений типа interface{} из map по заданному ключу.
+// Возвращает срез и bool значение, указывающее, удалось ли получить срез.
+func getArray(m map[string]interface{}, key string) ([]interface{}, bool) {
+	if val, ok := m[key]; ok {
+		if arr, ok := val.([]interface{}); ok {
+			return arr, true
+		}
+	}
+	return nil, false
+}
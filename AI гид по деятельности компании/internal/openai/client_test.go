@@ -0,0 +1,572 @@
+package openai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Проверка одного метода клиента: обработчик сервера проверяет запрос и отвечает,
+// call вызывает метод, want — ожидаемый результат
+type clientCase struct {
+	name    string
+	method  string
+	path    string
+	reply   string
+	check   func(t *testing.T, r *http.Request)
+	call    func(c *Client) (interface{}, error)
+	want    interface{}
+	noParse bool // метод не разбирает тело успешного ответа
+}
+
+// Тело запроса в формате JSON
+func requestJSON(t *testing.T, r *http.Request) map[string]interface{} {
+	t.Helper()
+	var body map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		t.Errorf("Тело запроса не JSON: %v", err)
+	}
+	return body
+}
+
+// Проверки всех методов AssistantAPI, кроме CreateThreadRun, у которого свои проверки в runs_test.go
+func clientCases(t *testing.T) []clientCase {
+	audioPath := filepath.Join(t.TempDir(), "voice.ogg")
+	if err := os.WriteFile(audioPath, []byte("OggS"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	return []clientCase{
+		{
+			name: "CreateAssistant", method: "POST", path: "/assistants",
+			reply: `{"id":"asst_1"}`,
+			check: func(t *testing.T, r *http.Request) {
+				body := requestJSON(t, r)
+				if body["model"] != "gpt-4o" || body["name"] != "Консультант" {
+					t.Errorf("Тело запроса %v", body)
+				}
+			},
+			call: func(c *Client) (interface{}, error) {
+				return c.CreateAssistant(ctx, "Консультант", "Отвечай по документам", "gpt-4o", nil)
+			},
+			want: "asst_1",
+		},
+		{
+			name: "UpdateAssistant", method: "POST", path: "/assistants/asst_1",
+			reply: `{"id":"asst_1"}`, noParse: true,
+			call: func(c *Client) (interface{}, error) { return nil, c.UpdateAssistant(ctx, "asst_1", "vs_1", nil) },
+		},
+		{
+			name: "ModifyAssistant", method: "POST", path: "/assistants/asst_1",
+			reply: `{"id":"asst_1"}`, noParse: true,
+			check: func(t *testing.T, r *http.Request) {
+				// Незаданные поля не отправляются
+				if body := requestJSON(t, r); !reflect.DeepEqual(body, map[string]interface{}{"instructions": "Новые инструкции"}) {
+					t.Errorf("Тело запроса %v", body)
+				}
+			},
+			call: func(c *Client) (interface{}, error) {
+				return nil, c.ModifyAssistant(ctx, "asst_1", AssistantUpdate{Instructions: "Новые инструкции"})
+			},
+		},
+		{
+			name: "ListAssistants", method: "GET", path: "/assistants",
+			reply: `{"data":[{"id":"asst_1","name":"Консультант","model":"gpt-4o","created_at":1700000000}],"has_more":false}`,
+			call:  func(c *Client) (interface{}, error) { return c.ListAssistants(ctx) },
+			want:  []AssistantInfo{{ID: "asst_1", Name: "Консультант", Model: "gpt-4o", CreatedAt: 1700000000}},
+		},
+		{
+			name: "DeleteAssistant", method: "DELETE", path: "/assistants/asst_1",
+			reply: `{"id":"asst_1","deleted":true}`, noParse: true,
+			call: func(c *Client) (interface{}, error) { return nil, c.DeleteAssistant(ctx, "asst_1") },
+		},
+		{
+			name: "UploadFile", method: "POST", path: "/files",
+			reply: `{"id":"file-1"}`,
+			check: func(t *testing.T, r *http.Request) {
+				if r.Header.Get("Idempotency-Key") == "" {
+					t.Error("Нет заголовка Idempotency-Key")
+				}
+			},
+			call: func(c *Client) (interface{}, error) {
+				return c.UploadFile(ctx, "about.txt", strings.NewReader("содержимое"))
+			},
+			want: "file-1",
+		},
+		{
+			name: "DeleteFile", method: "DELETE", path: "/files/file-1",
+			reply: `{"id":"file-1","deleted":true}`, noParse: true,
+			call: func(c *Client) (interface{}, error) { return nil, c.DeleteFile(ctx, "file-1") },
+		},
+		{
+			name: "GetFile", method: "GET", path: "/files/file-1",
+			reply: `{"id":"file-1","filename":"about.txt","bytes":20,"created_at":1700000000}`,
+			call:  func(c *Client) (interface{}, error) { return c.GetFile(ctx, "file-1") },
+			want:  FileInfo{ID: "file-1", Filename: "about.txt", Bytes: 20, CreatedAt: 1700000000},
+		},
+		{
+			name: "DownloadFile", method: "GET", path: "/files/file-1/content",
+			reply: "a,b\n1,2\n", noParse: true,
+			call: func(c *Client) (interface{}, error) {
+				var buf bytes.Buffer
+				err := c.DownloadFile(ctx, "file-1", &buf, 0)
+				return buf.String(), err
+			},
+			want: "a,b\n1,2\n",
+		},
+		{
+			name: "CreateVectorStore", method: "POST", path: "/vector_stores",
+			reply: `{"id":"vs_1"}`,
+			call:  func(c *Client) (interface{}, error) { return c.CreateVectorStore(ctx) },
+			want:  "vs_1",
+		},
+		{
+			name: "AddFileToVectorStore", method: "POST", path: "/vector_stores/vs_1/files",
+			reply: `{"id":"file-1"}`, noParse: true,
+			check: func(t *testing.T, r *http.Request) {
+				if body := requestJSON(t, r); body["file_id"] != "file-1" {
+					t.Errorf("Тело запроса %v", body)
+				}
+			},
+			call: func(c *Client) (interface{}, error) { return nil, c.AddFileToVectorStore(ctx, "vs_1", "file-1") },
+		},
+		{
+			name: "ListVectorStoreFiles", method: "GET", path: "/vector_stores/vs_1/files",
+			reply: `{"data":[{"id":"file-1","status":"completed","usage_bytes":100},{"id":"file-2","status":"failed","last_error":{"code":"unsupported_file","message":"Bad file"}}]}`,
+			call:  func(c *Client) (interface{}, error) { return c.ListVectorStoreFiles(ctx, "vs_1") },
+			want: []VectorStoreFile{
+				{ID: "file-1", Status: "completed", UsageBytes: 100},
+				{ID: "file-2", Status: "failed", LastError: &FileError{Code: "unsupported_file", Message: "Bad file"}},
+			},
+		},
+		{
+			name: "RemoveFileFromVectorStore", method: "DELETE", path: "/vector_stores/vs_1/files/file-1",
+			reply: `{"id":"file-1","deleted":true}`, noParse: true,
+			call: func(c *Client) (interface{}, error) { return nil, c.RemoveFileFromVectorStore(ctx, "vs_1", "file-1") },
+		},
+		{
+			name: "CreateThread", method: "POST", path: "/threads",
+			reply: `{"id":"thread_1"}`,
+			check: func(t *testing.T, r *http.Request) {
+				body := requestJSON(t, r)
+				if resources, _ := json.Marshal(body["tool_resources"]); string(resources) != `{"file_search":{"vector_store_ids":["vs_1"]}}` {
+					t.Errorf("tool_resources = %s", resources)
+				}
+			},
+			call: func(c *Client) (interface{}, error) {
+				return c.CreateThread(ctx, []map[string]interface{}{{"role": "user", "content": "вопрос"}}, "vs_1")
+			},
+			want: "thread_1",
+		},
+		{
+			name: "AddThreadMessage", method: "POST", path: "/threads/thread_1/messages",
+			reply: `{"id":"msg_1"}`, noParse: true,
+			check: func(t *testing.T, r *http.Request) {
+				if body := requestJSON(t, r); body["role"] != "user" || body["content"] != "вопрос" || body["attachments"] == nil {
+					t.Errorf("Тело запроса %v", body)
+				}
+			},
+			call: func(c *Client) (interface{}, error) {
+				return nil, c.AddThreadMessage(ctx, "thread_1", "user", "вопрос", []Attachment{FileSearchAttachment("file-1")})
+			},
+		},
+		{
+			name: "ListThreadMessages", method: "GET", path: "/threads/thread_1/messages",
+			reply: `{"data":[{"id":"msg_1","role":"user","created_at":1,"content":[{"type":"text","text":{"value":"вопрос"}}]},` +
+				`{"id":"msg_2","role":"assistant","created_at":2,"content":[{"type":"text","text":{"value":"ответ"}},{"type":"image_file"},{"type":"text","text":{"value":"ещё"}}]}]}`,
+			call: func(c *Client) (interface{}, error) { return c.ListThreadMessages(ctx, "thread_1") },
+			want: []ThreadMessage{
+				{ID: "msg_1", Role: "user", CreatedAt: 1, Text: "вопрос"},
+				{ID: "msg_2", Role: "assistant", CreatedAt: 2, Text: "ответ\n\nещё"},
+			},
+		},
+		{
+			name: "DeleteThread", method: "DELETE", path: "/threads/thread_1",
+			reply: `{"id":"thread_1","deleted":true}`, noParse: true,
+			call: func(c *Client) (interface{}, error) { return nil, c.DeleteThread(ctx, "thread_1") },
+		},
+		{
+			name: "CancelRun", method: "POST", path: "/threads/thread_1/runs/run_1/cancel",
+			reply: `{"id":"run_1","status":"cancelling"}`, noParse: true,
+			call: func(c *Client) (interface{}, error) { return nil, c.CancelRun(ctx, "thread_1", "run_1") },
+		},
+		{
+			name: "ChatCompletion", method: "POST", path: "/chat/completions",
+			reply: `{"choices":[{"message":{"content":"Здравствуйте!"}}]}`,
+			check: func(t *testing.T, r *http.Request) {
+				if body := requestJSON(t, r); body["model"] != "gpt-4o-mini" || body["response_format"] != nil {
+					t.Errorf("Тело запроса %v", body)
+				}
+			},
+			call: func(c *Client) (interface{}, error) {
+				return c.ChatCompletion(ctx, "gpt-4o-mini", "система", "привет")
+			},
+			want: "Здравствуйте!",
+		},
+		{
+			name: "ChatCompletionJSON", method: "POST", path: "/chat/completions",
+			reply: `{"choices":[{"message":{"content":"{\"action\":\"assistant\"}"}}]}`,
+			check: func(t *testing.T, r *http.Request) {
+				if format, _ := json.Marshal(requestJSON(t, r)["response_format"]); string(format) != `{"type":"json_object"}` {
+					t.Errorf("response_format = %s", format)
+				}
+			},
+			call: func(c *Client) (interface{}, error) {
+				return c.ChatCompletionJSON(ctx, "gpt-4o-mini", "система", "привет")
+			},
+			want: `{"action":"assistant"}`,
+		},
+		{
+			name: "Moderate", method: "POST", path: "/moderations",
+			reply: `{"results":[{"flagged":true,"category_scores":{"harassment":0.9}}]}`,
+			call:  func(c *Client) (interface{}, error) { return c.Moderate(ctx, "", "текст") },
+			want:  &ModerationResult{Flagged: true, CategoryScores: map[string]float64{"harassment": 0.9}},
+		},
+		{
+			name: "SynthesizeSpeech", method: "POST", path: "/audio/speech",
+			reply: "OggS-opus", noParse: true,
+			check: func(t *testing.T, r *http.Request) {
+				if body := requestJSON(t, r); body["voice"] != "alloy" || body["response_format"] != "opus" {
+					t.Errorf("Тело запроса %v", body)
+				}
+			},
+			call: func(c *Client) (interface{}, error) {
+				audio, err := c.SynthesizeSpeech(ctx, "tts-1", "alloy", "текст")
+				return string(audio), err
+			},
+			want: "OggS-opus",
+		},
+		{
+			name: "TranscribeAudio", method: "POST", path: "/audio/transcriptions",
+			reply: `{"text":" Когда работает центр? "}`,
+			check: func(t *testing.T, r *http.Request) {
+				if _, header, err := r.FormFile("file"); err != nil || header.Filename != "voice.ogg" || r.FormValue("model") != "whisper-1" {
+					t.Errorf("Файл %v, model %q", err, r.FormValue("model"))
+				}
+			},
+			call: func(c *Client) (interface{}, error) {
+				return c.TranscribeAudio(ctx, BuildURL(c.BaseURL, "audio/transcriptions"), "whisper-1", audioPath)
+			},
+			want: "Когда работает центр?",
+		},
+		{
+			name: "ListModels", method: "GET", path: "/models",
+			reply: `{"data":[{"id":"gpt-4o"},{"id":"gpt-4o-mini"}]}`,
+			call:  func(c *Client) (interface{}, error) { return c.ListModels(ctx) },
+			want:  []string{"gpt-4o", "gpt-4o-mini"},
+		},
+	}
+}
+
+// Каждый метод отправляет запрос с заголовками API по своему адресу и разбирает ответ
+func TestClientMethods(t *testing.T) {
+	for _, tt := range clientCases(t) {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != tt.method || r.URL.Path != tt.path {
+					t.Errorf("Запрос %s %s, want %s %s", r.Method, r.URL.Path, tt.method, tt.path)
+				}
+				if r.Header.Get("Authorization") != "Bearer test-key" || r.Header.Get("OpenAI-Beta") != "assistants=v2" {
+					t.Errorf("Заголовки Authorization %q, OpenAI-Beta %q", r.Header.Get("Authorization"), r.Header.Get("OpenAI-Beta"))
+				}
+				if tt.check != nil {
+					tt.check(t, r)
+				}
+				io.WriteString(w, tt.reply)
+			})
+
+			got, err := tt.call(client)
+			if err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+			if tt.want != nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%s = %#v, want %#v", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+// Неуспешный ответ любого метода возвращается как APIError с кодом ответа
+func TestClientMethodsAPIError(t *testing.T) {
+	for _, tt := range clientCases(t) {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusInternalServerError)
+				io.WriteString(w, `{"error":{"message":"The server had an error","type":"server_error"}}`)
+			})
+
+			_, err := tt.call(client)
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("err = %v, want *APIError", err)
+			}
+			if apiErr.StatusCode != http.StatusInternalServerError || apiErr.ErrorCode != "server_error" {
+				t.Errorf("APIError = %+v", *apiErr)
+			}
+		})
+	}
+}
+
+// Успешный ответ, который не удаётся разобрать, и недоступный сервер возвращают ошибку
+func TestClientMethodsBrokenResponse(t *testing.T) {
+	for _, tt := range clientCases(t) {
+		if tt.noParse {
+			continue
+		}
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				io.WriteString(w, `<html>Bad Gateway</html>`)
+			})
+			if _, err := tt.call(client); err == nil {
+				t.Error("Ответ не в формате JSON принят без ошибки")
+			}
+		})
+	}
+
+	for _, tt := range clientCases(t) {
+		t.Run(tt.name+" без сервера", func(t *testing.T) {
+			client := newTestClient(t, nil)
+			client.BaseURL = "http://127.0.0.1:1"
+			if _, err := tt.call(client); err == nil {
+				t.Error("Запрос к недоступному серверу выполнен без ошибки")
+			}
+		})
+	}
+}
+
+// Списки загружаются по страницам, пока has_more не станет false
+func TestListPagination(t *testing.T) {
+	var afters []string
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		after := r.URL.Query().Get("after")
+		afters = append(afters, after)
+		if r.URL.Query().Get("limit") != "100" {
+			t.Errorf("limit = %q, want 100", r.URL.Query().Get("limit"))
+		}
+		switch after {
+		case "":
+			io.WriteString(w, `{"data":[{"id":"asst_1"},{"id":"asst_2"}],"has_more":true,"last_id":"asst_2"}`)
+		case "asst_2":
+			io.WriteString(w, `{"data":[{"id":"asst_3"}],"has_more":false,"last_id":"asst_3"}`)
+		default:
+			t.Errorf("Неожиданный after=%q", after)
+		}
+	})
+
+	assistants, err := client.ListAssistants(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, a := range assistants {
+		ids = append(ids, a.ID)
+	}
+	if !reflect.DeepEqual(ids, []string{"asst_1", "asst_2", "asst_3"}) || !reflect.DeepEqual(afters, []string{"", "asst_2"}) {
+		t.Errorf("Ассистенты %q, запрошены страницы после %q", ids, afters)
+	}
+}
+
+// Файл больше maxBytes не скачивается до конца
+func TestDownloadFileTooLarge(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, strings.Repeat("x", 100))
+	})
+	var buf bytes.Buffer
+	if err := client.DownloadFile(context.Background(), "file-1", &buf, 10); !errors.Is(err, ErrFileTooLarge) {
+		t.Errorf("err = %v, want ErrFileTooLarge", err)
+	}
+}
+
+// Повторная загрузка того же файла идёт с тем же Idempotency-Key, а другое имя или содержимое меняет ключ
+func TestUploadFileIdempotencyKey(t *testing.T) {
+	var keys []string
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		keys = append(keys, r.Header.Get("Idempotency-Key"))
+		io.WriteString(w, `{"id":"file-1"}`)
+	})
+	for _, file := range [][2]string{{"about.txt", "текст"}, {"about.txt", "текст"}, {"about.txt", "другой текст"}, {"copy.txt", "текст"}} {
+		if _, err := client.UploadFile(context.Background(), file[0], strings.NewReader(file[1])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !strings.HasPrefix(keys[0], "upload-") || keys[0] != keys[1] {
+		t.Errorf("Ключи повторной загрузки %q и %q", keys[0], keys[1])
+	}
+	if keys[2] == keys[0] || keys[3] == keys[0] || keys[2] == keys[3] {
+		t.Errorf("Ключи разных файлов совпадают: %q", keys)
+	}
+}
+
+// Тело ответа больше MaxResponseBytes не читается целиком
+func TestMaxResponseBytes(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"id":"asst_1","instructions":"`+strings.Repeat("x", 1000)+`"}`)
+	})
+	client.MaxResponseBytes = 100
+	if _, err := client.CreateAssistant(context.Background(), "a", "b", "gpt-4o", nil); !errors.Is(err, ErrResponseTooLarge) {
+		t.Errorf("err = %v, want ErrResponseTooLarge", err)
+	}
+}
+
+// Запросы поставщиков к каждому адресу API: у OpenAI ключ в заголовке Authorization,
+// у Azure OpenAI — в заголовке api-key с параметром api-version, а запросы к модели
+// идут по пути развёртывания
+func TestProviderRequests(t *testing.T) {
+	// Адреса, которые в Azure OpenAI отличаются от адресов OpenAI
+	azurePaths := map[string]string{
+		"ChatCompletion":     "/deployments/gpt-4o-mini/chat/completions",
+		"ChatCompletionJSON": "/deployments/gpt-4o-mini/chat/completions",
+		"SynthesizeSpeech":   "/deployments/tts-1/audio/speech",
+	}
+	// Списки, загружаемые по страницам
+	paginated := map[string]bool{"ListAssistants": true, "ListVectorStoreFiles": true, "ListThreadMessages": true}
+	run := clientCase{
+		name: "CreateThreadRun", method: "POST", path: "/threads/runs",
+		call: func(c *Client) (interface{}, error) {
+			result, err := c.CreateThreadRun(context.Background(), RunRequest{AssistantID: "asst_1"}, nil)
+			return result.Text, err
+		},
+		want: "ответ",
+	}
+
+	for _, provider := range []string{ProviderOpenAI, ProviderAzure} {
+		for _, tt := range append(clientCases(t), run) {
+			t.Run(provider+"/"+tt.name, func(t *testing.T) {
+				wantPath := tt.path
+				if provider == ProviderAzure && azurePaths[tt.name] != "" {
+					wantPath = azurePaths[tt.name]
+				}
+				client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+					if r.Method != tt.method || r.URL.Path != wantPath {
+						t.Errorf("Запрос %s %s, want %s %s", r.Method, r.URL.Path, tt.method, wantPath)
+					}
+					query := r.URL.Query()
+					if provider == ProviderAzure {
+						if r.Header.Get("api-key") != "test-key" || r.Header.Get("Authorization") != "" || query.Get("api-version") != "2024-05-01-preview" {
+							t.Errorf("api-key %q, Authorization %q, api-version %q", r.Header.Get("api-key"), r.Header.Get("Authorization"), query.Get("api-version"))
+						}
+					} else if r.Header.Get("Authorization") != "Bearer test-key" || r.Header.Get("api-key") != "" || query.Has("api-version") {
+						t.Errorf("Authorization %q, api-key %q, запрос %q", r.Header.Get("Authorization"), r.Header.Get("api-key"), r.URL.RawQuery)
+					}
+					// Параметры постраничной загрузки не теряются при добавлении api-version
+					if paginated[tt.name] && query.Get("limit") != "100" {
+						t.Errorf("limit = %q, want 100", query.Get("limit"))
+					}
+					if tt.name == run.name {
+						sseHandler(deltaEvent("ответ"), runEvent("completed"))(w, r)
+						return
+					}
+					io.WriteString(w, tt.reply)
+				})
+				client.Provider = provider
+				if provider == ProviderAzure {
+					client.AzureAPIVersion = "2024-05-01-preview"
+				}
+
+				got, err := tt.call(client)
+				if err != nil {
+					t.Fatalf("%s: %v", tt.name, err)
+				}
+				if tt.want != nil && !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("%s = %#v, want %#v", tt.name, got, tt.want)
+				}
+			})
+		}
+	}
+}
+
+// В Azure OpenAI вместо модели ассистента указывается развёртывание, а запросы без модели
+// идут к развёртыванию по умолчанию
+func TestAzureDeployment(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/assistants", "/assistants/asst_1":
+			if body := requestJSON(t, r); body["model"] != "my-deployment" {
+				t.Errorf("model = %v, want my-deployment", body["model"])
+			}
+			io.WriteString(w, `{"id":"asst_1"}`)
+		case "/deployments/my-deployment/chat/completions":
+			io.WriteString(w, `{"choices":[{"message":{"content":"ok"}}]}`)
+		default:
+			t.Errorf("Неожиданный путь %s", r.URL.Path)
+		}
+	})
+	client.Provider = ProviderAzure
+	client.AzureAPIVersion = "2024-05-01-preview"
+	client.AzureDeployment = "my-deployment"
+	ctx := context.Background()
+
+	if _, err := client.CreateAssistant(ctx, "a", "b", "gpt-4o", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.ModifyAssistant(ctx, "asst_1", AssistantUpdate{Model: "gpt-4o-mini"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.ChatCompletion(ctx, "", "система", "привет"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBuildURL(t *testing.T) {
+	tests := []struct {
+		parts []string
+		want  string
+	}{
+		{[]string{"https://api.openai.com/v1", "assistants"}, "https://api.openai.com/v1/assistants"},
+		{[]string{"https://api.openai.com/v1/", "/assistants"}, "https://api.openai.com/v1/assistants"},
+		{[]string{"https://gateway/llm/openai/v1/", "threads", "", "runs/"}, "https://gateway/llm/openai/v1/threads/runs"},
+		{[]string{"threads", "thread_1", "messages"}, "threads/thread_1/messages"},
+		{[]string{"https://api.openai.com/v1//", "//assistants//"}, "https://api.openai.com/v1/assistants"},
+		{[]string{"https://gateway/llm/openai/v1", "vector_stores/vs_1/files"}, "https://gateway/llm/openai/v1/vector_stores/vs_1/files"},
+		{[]string{"https://api.openai.com/v1/"}, "https://api.openai.com/v1"},
+		{[]string{"https://api.openai.com", "", "/"}, "https://api.openai.com"},
+		{[]string{"/v1/", "models"}, "/v1/models"},
+		{nil, ""},
+	}
+	for _, tt := range tests {
+		if got := BuildURL(tt.parts...); got != tt.want {
+			t.Errorf("BuildURL(%q) = %q, want %q", tt.parts, got, tt.want)
+		}
+	}
+}
+
+// Путь шлюза в адресе API сохраняется при любом числе "/" в конце адреса
+func TestClientBasePath(t *testing.T) {
+	for _, suffix := range []string{"/llm/openai/v1", "/llm/openai/v1/", "/llm/openai/v1//"} {
+		t.Run(suffix, func(t *testing.T) {
+			var paths []string
+			client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				paths = append(paths, r.URL.Path)
+				if r.URL.Path == "/llm/openai/v1/threads/runs" {
+					sseHandler(deltaEvent("ответ"), runEvent("completed"))(w, r)
+					return
+				}
+				io.WriteString(w, `{"data":[],"has_more":false}`)
+			})
+			client.BaseURL += suffix
+
+			if _, err := client.ListModels(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := client.ListThreadMessages(context.Background(), "thread_1"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := client.CreateThreadRun(context.Background(), RunRequest{AssistantID: "asst_1"}, nil); err != nil {
+				t.Fatal(err)
+			}
+			want := []string{"/llm/openai/v1/models", "/llm/openai/v1/threads/thread_1/messages", "/llm/openai/v1/threads/runs"}
+			if !reflect.DeepEqual(paths, want) {
+				t.Errorf("Запрошены пути %q, want %q", paths, want)
+			}
+		})
+	}
+}
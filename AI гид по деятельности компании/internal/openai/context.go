@@ -0,0 +1,16 @@
+package openai
+
+import "context"
+
+type requestIDKey struct{}
+
+// Возвращает контекст с ID запроса, которым помечаются журнал и запросы к API
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// Возвращает ID запроса из контекста или пустую строку
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
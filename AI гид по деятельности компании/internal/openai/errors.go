@@ -0,0 +1,112 @@
+package openai
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// APIError — ошибка, возвращённая API с кодом ответа, отличным от успешного
+type APIError struct {
+	StatusCode int
+	// Код из поля error.code (или error.type) ответа, например insufficient_quota. Пустой, если тело не в формате API
+	ErrorCode string
+	// Текст из поля error.message, а если тело не удалось разобрать — всё тело ответа
+	Message string
+	// Параметр запроса, к которому относится ошибка (поле error.param), например model
+	Param string
+}
+
+func (e *APIError) Error() string {
+	if e.ErrorCode != "" {
+		return fmt.Sprintf("Ошибка API (%d, %s): %s", e.StatusCode, e.ErrorCode, e.Message)
+	}
+	return fmt.Sprintf("Ошибка API (%d): %s", e.StatusCode, e.Message)
+}
+
+// Формирует APIError из кода и тела неуспешного ответа
+func newAPIError(statusCode int, body []byte) *APIError {
+	apiErr := &APIError{StatusCode: statusCode, Message: string(body)}
+
+	var payload struct {
+		Error struct {
+			Code    interface{} `json:"code"`
+			Type    string      `json:"type"`
+			Message string      `json:"message"`
+			Param   string      `json:"param"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return apiErr
+	}
+
+	// Некоторые совместимые серверы передают код числом или только в поле type
+	switch code := payload.Error.Code.(type) {
+	case string:
+		apiErr.ErrorCode = code
+	case float64:
+		apiErr.ErrorCode = fmt.Sprint(code)
+	}
+	if apiErr.ErrorCode == "" {
+		apiErr.ErrorCode = payload.Error.Type
+	}
+	if payload.Error.Message != "" {
+		apiErr.Message = payload.Error.Message
+	}
+	apiErr.Param = payload.Error.Param
+	return apiErr
+}
+
+// RunError — ошибка, с которой запуск ассистента завершился внутри потока SSE
+// (объект запуска со статусом failed или событие error)
+type RunError struct {
+	Code    string
+	Message string
+}
+
+func (e *RunError) Error() string {
+	return fmt.Sprintf("Ошибка выполнения запуска (%s): %s", e.Code, e.Message)
+}
+
+// InterruptedError — поток ответа оборвался до завершения запуска: соединение разорвано,
+// истекло время ожидания или сервер закрыл поток без завершающего события.
+// errors.Is(err, ErrStreamInterrupted) выполняется для любой такой ошибки.
+type InterruptedError struct {
+	// Текст ответа, полученный до обрыва. Пустой — не пришло ни одного фрагмента
+	Text string
+	Err  error
+}
+
+func (e *InterruptedError) Error() string {
+	return fmt.Sprintf("Поток ответа оборвался (получено символов: %d): %v", len([]rune(e.Text)), e.Err)
+}
+
+func (e *InterruptedError) Unwrap() error { return e.Err }
+
+func (e *InterruptedError) Is(target error) bool { return target == ErrStreamInterrupted }
+
+// Код ошибки API, означающий исчерпание квоты или баланса ключа
+const QuotaErrorCode = "insufficient_quota"
+
+var (
+	// Ассистент завершил запуск, не вернув текста
+	ErrEmptyResponse = errors.New("Пустой ответ от ассистента")
+	// Поток ответа оборвался до завершения запуска. Полученный текст — в InterruptedError
+	ErrStreamInterrupted = errors.New("Поток ответа оборвался")
+	// Запуск ждёт результатов функций, которые бот не выполняет. Запуск отменяется
+	ErrToolCallsUnsupported = errors.New("Ассистент вызвал функцию, которую бот не выполняет")
+	// Ответ API превышает MaxResponseBytes
+	ErrResponseTooLarge = errors.New("Ответ API превышает допустимый размер")
+	// Скачиваемый файл больше допустимого размера
+	ErrFileTooLarge = errors.New("Файл превышает допустимый размер")
+)
+
+// Формирует ошибку запуска из объекта error или last_error
+func parseRunError(m map[string]interface{}) error {
+	code, _ := getString(m, "code")
+	if code == "" {
+		code, _ = getString(m, "type")
+	}
+	message, _ := getString(m, "message")
+	return &RunError{Code: code, Message: message}
+}
@@ -0,0 +1,105 @@
+package openai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+)
+
+func TestNewAPIError(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want APIError
+	}{
+		{
+			name: "ответ API",
+			body: `{"error":{"message":"Invalid model","type":"invalid_request_error","param":"model","code":"model_not_found"}}`,
+			want: APIError{StatusCode: 404, ErrorCode: "model_not_found", Message: "Invalid model", Param: "model"},
+		},
+		{
+			name: "код только в поле type",
+			body: `{"error":{"message":"Rate limit","type":"rate_limit_exceeded","code":null}}`,
+			want: APIError{StatusCode: 404, ErrorCode: "rate_limit_exceeded", Message: "Rate limit"},
+		},
+		{
+			name: "числовой код",
+			body: `{"error":{"message":"Not found","code":404}}`,
+			want: APIError{StatusCode: 404, ErrorCode: "404", Message: "Not found"},
+		},
+		{
+			name: "тело не в формате API",
+			body: `Bad Gateway`,
+			want: APIError{StatusCode: 404, Message: "Bad Gateway"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := newAPIError(404, []byte(tt.body)); *got != tt.want {
+				t.Errorf("newAPIError = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+// Типичные ответы API с ошибкой приходят вызывающему коду как *APIError, в том числе в обёртке
+func TestAPIErrorPayloads(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   APIError
+	}{
+		{
+			name:   "неверный ключ",
+			status: http.StatusUnauthorized,
+			body:   `{"error":{"message":"Incorrect API key provided: sk-test.","type":"invalid_request_error","param":null,"code":"invalid_api_key"}}`,
+			want:   APIError{StatusCode: 401, ErrorCode: "invalid_api_key", Message: "Incorrect API key provided: sk-test."},
+		},
+		{
+			name:   "исчерпана квота",
+			status: http.StatusTooManyRequests,
+			body:   `{"error":{"message":"You exceeded your current quota, please check your plan and billing details.","type":"insufficient_quota","param":null,"code":"insufficient_quota"}}`,
+			want:   APIError{StatusCode: 429, ErrorCode: QuotaErrorCode, Message: "You exceeded your current quota, please check your plan and billing details."},
+		},
+		{
+			name:   "ограничение частоты",
+			status: http.StatusTooManyRequests,
+			body:   `{"error":{"message":"Rate limit reached for gpt-4o on requests per min (RPM): Limit 500.","type":"requests","param":null,"code":"rate_limit_exceeded"}}`,
+			want:   APIError{StatusCode: 429, ErrorCode: "rate_limit_exceeded", Message: "Rate limit reached for gpt-4o on requests per min (RPM): Limit 500."},
+		},
+		{
+			name:   "неподдерживаемый параметр",
+			status: http.StatusBadRequest,
+			body:   `{"error":{"message":"Unsupported parameter: 'temperature' is not supported with this model.","type":"invalid_request_error","param":"temperature","code":"unsupported_parameter"}}`,
+			want:   APIError{StatusCode: 400, ErrorCode: "unsupported_parameter", Message: "Unsupported parameter: 'temperature' is not supported with this model.", Param: "temperature"},
+		},
+		{
+			name:   "сбой сервера без JSON",
+			status: http.StatusInternalServerError,
+			body:   `<html><body>Internal Server Error</body></html>`,
+			want:   APIError{StatusCode: 500, Message: `<html><body>Internal Server Error</body></html>`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				io.WriteString(w, tt.body)
+			})
+
+			_, err := client.CreateThreadRun(context.Background(), RunRequest{AssistantID: "asst_1"}, nil)
+			err = fmt.Errorf("запуск ассистента: %w", err)
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("err = %v, want *APIError", err)
+			}
+			if *apiErr != tt.want {
+				t.Errorf("APIError = %+v, want %+v", *apiErr, tt.want)
+			}
+		})
+	}
+}
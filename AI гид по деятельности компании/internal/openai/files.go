@@ -0,0 +1,186 @@
+package openai
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+)
+
+// Загружает содержимое r под именем fileName с назначением assistants и возвращает ID файла.
+// Запрос передаётся с заголовком Idempotency-Key из хэша имени и содержимого: повтор после
+// обрыва соединения не создаёт второй файл у провайдеров, которые поддерживают этот заголовок.
+func (c *Client) UploadFile(ctx context.Context, fileName string, r io.Reader) (string, error) {
+	var b bytes.Buffer
+	w := multipart.NewWriter(&b)
+
+	// Добавление файла в запрос
+	fw, err := w.CreateFormFile("file", fileName)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	h.Write([]byte(fileName + "\x00"))
+	_, err = io.Copy(io.MultiWriter(fw, h), r)
+	if err != nil {
+		return "", err
+	}
+
+	// Добавление 'purpose' в запрос
+	err = w.WriteField("purpose", "assistants")
+	if err != nil {
+		return "", err
+	}
+
+	w.Close()
+
+	req, err := c.newRequest(ctx, "POST", "files", &b)
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	req.Header.Set("Idempotency-Key", "upload-"+hex.EncodeToString(h.Sum(nil)))
+
+	c.logger(ctx).Debug("Загрузка файла", "url", req.URL, "file_name", fileName)
+
+	resp, err := c.do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		c.logger(ctx).Error("Ошибка загрузки файла", "status_code", resp.StatusCode, "body", string(body))
+		return "", newAPIError(resp.StatusCode, body)
+	}
+
+	c.logger(ctx).Debug("Файл успешно загружен", "file_name", fileName)
+
+	// Получение file_id
+	var response map[string]interface{}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return "", err
+	}
+
+	fileID, ok := response["id"].(string)
+	if !ok {
+		c.logger(ctx).Error("Не удалось получить file_id для файла", "body", string(body))
+		return "", fmt.Errorf("Не удалось получить file_id для файла %s", fileName)
+	}
+
+	return fileID, nil
+}
+
+// Удаляет загруженный файл
+func (c *Client) DeleteFile(ctx context.Context, fileID string) error {
+	req, err := c.newRequest(ctx, "DELETE", BuildURL("files", fileID), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		c.logger(ctx).Error("Ошибка удаления файла", "file_id", fileID, "status_code", resp.StatusCode, "body", string(body))
+		return newAPIError(resp.StatusCode, body)
+	}
+
+	c.logger(ctx).Debug("Файл удалён", "file_id", fileID)
+	return nil
+}
+
+// Сведения о загруженном файле
+type FileInfo struct {
+	ID        string `json:"id"`
+	Filename  string `json:"filename"`
+	Bytes     int64  `json:"bytes"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// Возвращает сведения о загруженном файле
+func (c *Client) GetFile(ctx context.Context, fileID string) (FileInfo, error) {
+	req, err := c.newRequest(ctx, "GET", BuildURL("files", fileID), nil)
+	if err != nil {
+		return FileInfo{}, err
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return FileInfo{}, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return FileInfo{}, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		c.logger(ctx).Error("Ошибка получения сведений о файле", "file_id", fileID, "status_code", resp.StatusCode, "body", string(body))
+		return FileInfo{}, newAPIError(resp.StatusCode, body)
+	}
+
+	var info FileInfo
+	if err := json.Unmarshal(body, &info); err != nil {
+		return FileInfo{}, err
+	}
+	return info, nil
+}
+
+// Скачивает содержимое файла в w, например файла, созданного инструментом code_interpreter.
+// Файл больше maxBytes не скачивается до конца, возвращается ErrFileTooLarge.
+// 0 — без ограничения, кроме MaxResponseBytes.
+func (c *Client) DownloadFile(ctx context.Context, fileID string, w io.Writer, maxBytes int64) error {
+	req, err := c.newRequest(ctx, "GET", BuildURL("files", fileID, "content"), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		c.logger(ctx).Error("Ошибка скачивания файла", "file_id", fileID, "status_code", resp.StatusCode)
+		return newAPIError(resp.StatusCode, body)
+	}
+	if maxBytes > 0 && resp.ContentLength > maxBytes {
+		return ErrFileTooLarge
+	}
+
+	var body io.Reader = resp.Body
+	if maxBytes > 0 {
+		body = io.LimitReader(resp.Body, maxBytes+1)
+	}
+	n, err := io.Copy(w, body)
+	if err != nil {
+		return err
+	}
+	if maxBytes > 0 && n > maxBytes {
+		return ErrFileTooLarge
+	}
+	return nil
+}
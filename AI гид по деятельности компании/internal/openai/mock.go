@@ -0,0 +1,217 @@
+package openai
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// Метод Mock вызван без заданной функции
+var ErrNotMocked = errors.New("Метод не задан в Mock")
+
+// Mock — реализация AssistantAPI для проверки кода бота без обращения к API.
+// Каждый метод вызывает одноимённую функцию, а если она не задана, возвращает ErrNotMocked.
+type Mock struct {
+	CreateAssistantFunc           func(ctx context.Context, name, instructions, model string, tools []Tool) (string, error)
+	UpdateAssistantFunc           func(ctx context.Context, assistantID, vectorStoreID string, tools []Tool) error
+	ModifyAssistantFunc           func(ctx context.Context, assistantID string, update AssistantUpdate) error
+	ListAssistantsFunc            func(ctx context.Context) ([]AssistantInfo, error)
+	DeleteAssistantFunc           func(ctx context.Context, assistantID string) error
+	UploadFileFunc                func(ctx context.Context, fileName string, r io.Reader) (string, error)
+	DeleteFileFunc                func(ctx context.Context, fileID string) error
+	GetFileFunc                   func(ctx context.Context, fileID string) (FileInfo, error)
+	DownloadFileFunc              func(ctx context.Context, fileID string, w io.Writer, maxBytes int64) error
+	CreateVectorStoreFunc         func(ctx context.Context) (string, error)
+	AddFileToVectorStoreFunc      func(ctx context.Context, vectorStoreID, fileID string) error
+	ListVectorStoreFilesFunc      func(ctx context.Context, vectorStoreID string) ([]VectorStoreFile, error)
+	RemoveFileFromVectorStoreFunc func(ctx context.Context, vectorStoreID, fileID string) error
+	CreateThreadFunc              func(ctx context.Context, messages []map[string]interface{}, vectorStoreID string) (string, error)
+	AddThreadMessageFunc          func(ctx context.Context, threadID, role string, content interface{}, attachments []Attachment) error
+	ListThreadMessagesFunc        func(ctx context.Context, threadID string) ([]ThreadMessage, error)
+	DeleteThreadFunc              func(ctx context.Context, threadID string) error
+	CreateThreadRunFunc           func(ctx context.Context, req RunRequest, observer RunObserver) (RunResult, error)
+	CancelRunFunc                 func(ctx context.Context, threadID, runID string) error
+	ChatCompletionFunc            func(ctx context.Context, model, system, user string) (string, error)
+	ChatCompletionJSONFunc        func(ctx context.Context, model, system, user string) (string, error)
+	ModerateFunc                  func(ctx context.Context, model, text string) (*ModerationResult, error)
+	SynthesizeSpeechFunc          func(ctx context.Context, model, voice, text string) ([]byte, error)
+	TranscribeAudioFunc           func(ctx context.Context, url, model, filePath string) (string, error)
+	ListModelsFunc                func(ctx context.Context) ([]string, error)
+}
+
+var _ AssistantAPI = (*Mock)(nil)
+
+func (m *Mock) CreateAssistant(ctx context.Context, name, instructions, model string, tools []Tool) (string, error) {
+	if m.CreateAssistantFunc == nil {
+		return "", ErrNotMocked
+	}
+	return m.CreateAssistantFunc(ctx, name, instructions, model, tools)
+}
+
+func (m *Mock) UpdateAssistant(ctx context.Context, assistantID, vectorStoreID string, tools []Tool) error {
+	if m.UpdateAssistantFunc == nil {
+		return ErrNotMocked
+	}
+	return m.UpdateAssistantFunc(ctx, assistantID, vectorStoreID, tools)
+}
+
+func (m *Mock) ModifyAssistant(ctx context.Context, assistantID string, update AssistantUpdate) error {
+	if m.ModifyAssistantFunc == nil {
+		return ErrNotMocked
+	}
+	return m.ModifyAssistantFunc(ctx, assistantID, update)
+}
+
+func (m *Mock) ListAssistants(ctx context.Context) ([]AssistantInfo, error) {
+	if m.ListAssistantsFunc == nil {
+		return nil, ErrNotMocked
+	}
+	return m.ListAssistantsFunc(ctx)
+}
+
+func (m *Mock) DeleteAssistant(ctx context.Context, assistantID string) error {
+	if m.DeleteAssistantFunc == nil {
+		return ErrNotMocked
+	}
+	return m.DeleteAssistantFunc(ctx, assistantID)
+}
+
+func (m *Mock) UploadFile(ctx context.Context, fileName string, r io.Reader) (string, error) {
+	if m.UploadFileFunc == nil {
+		return "", ErrNotMocked
+	}
+	return m.UploadFileFunc(ctx, fileName, r)
+}
+
+func (m *Mock) DeleteFile(ctx context.Context, fileID string) error {
+	if m.DeleteFileFunc == nil {
+		return ErrNotMocked
+	}
+	return m.DeleteFileFunc(ctx, fileID)
+}
+
+func (m *Mock) GetFile(ctx context.Context, fileID string) (FileInfo, error) {
+	if m.GetFileFunc == nil {
+		return FileInfo{}, ErrNotMocked
+	}
+	return m.GetFileFunc(ctx, fileID)
+}
+
+func (m *Mock) DownloadFile(ctx context.Context, fileID string, w io.Writer, maxBytes int64) error {
+	if m.DownloadFileFunc == nil {
+		return ErrNotMocked
+	}
+	return m.DownloadFileFunc(ctx, fileID, w, maxBytes)
+}
+
+func (m *Mock) CreateVectorStore(ctx context.Context) (string, error) {
+	if m.CreateVectorStoreFunc == nil {
+		return "", ErrNotMocked
+	}
+	return m.CreateVectorStoreFunc(ctx)
+}
+
+func (m *Mock) AddFileToVectorStore(ctx context.Context, vectorStoreID, fileID string) error {
+	if m.AddFileToVectorStoreFunc == nil {
+		return ErrNotMocked
+	}
+	return m.AddFileToVectorStoreFunc(ctx, vectorStoreID, fileID)
+}
+
+func (m *Mock) ListVectorStoreFiles(ctx context.Context, vectorStoreID string) ([]VectorStoreFile, error) {
+	if m.ListVectorStoreFilesFunc == nil {
+		return nil, ErrNotMocked
+	}
+	return m.ListVectorStoreFilesFunc(ctx, vectorStoreID)
+}
+
+func (m *Mock) RemoveFileFromVectorStore(ctx context.Context, vectorStoreID, fileID string) error {
+	if m.RemoveFileFromVectorStoreFunc == nil {
+		return ErrNotMocked
+	}
+	return m.RemoveFileFromVectorStoreFunc(ctx, vectorStoreID, fileID)
+}
+
+func (m *Mock) CreateThread(ctx context.Context, messages []map[string]interface{}, vectorStoreID string) (string, error) {
+	if m.CreateThreadFunc == nil {
+		return "", ErrNotMocked
+	}
+	return m.CreateThreadFunc(ctx, messages, vectorStoreID)
+}
+
+func (m *Mock) AddThreadMessage(ctx context.Context, threadID, role string, content interface{}, attachments []Attachment) error {
+	if m.AddThreadMessageFunc == nil {
+		return ErrNotMocked
+	}
+	return m.AddThreadMessageFunc(ctx, threadID, role, content, attachments)
+}
+
+func (m *Mock) ListThreadMessages(ctx context.Context, threadID string) ([]ThreadMessage, error) {
+	if m.ListThreadMessagesFunc == nil {
+		return nil, ErrNotMocked
+	}
+	return m.ListThreadMessagesFunc(ctx, threadID)
+}
+
+func (m *Mock) DeleteThread(ctx context.Context, threadID string) error {
+	if m.DeleteThreadFunc == nil {
+		return ErrNotMocked
+	}
+	return m.DeleteThreadFunc(ctx, threadID)
+}
+
+func (m *Mock) CreateThreadRun(ctx context.Context, req RunRequest, observer RunObserver) (RunResult, error) {
+	if m.CreateThreadRunFunc == nil {
+		return RunResult{}, ErrNotMocked
+	}
+	return m.CreateThreadRunFunc(ctx, req, observer)
+}
+
+func (m *Mock) CancelRun(ctx context.Context, threadID, runID string) error {
+	if m.CancelRunFunc == nil {
+		return ErrNotMocked
+	}
+	return m.CancelRunFunc(ctx, threadID, runID)
+}
+
+func (m *Mock) ChatCompletion(ctx context.Context, model, system, user string) (string, error) {
+	if m.ChatCompletionFunc == nil {
+		return "", ErrNotMocked
+	}
+	return m.ChatCompletionFunc(ctx, model, system, user)
+}
+
+func (m *Mock) ChatCompletionJSON(ctx context.Context, model, system, user string) (string, error) {
+	if m.ChatCompletionJSONFunc == nil {
+		return "", ErrNotMocked
+	}
+	return m.ChatCompletionJSONFunc(ctx, model, system, user)
+}
+
+func (m *Mock) Moderate(ctx context.Context, model, text string) (*ModerationResult, error) {
+	if m.ModerateFunc == nil {
+		return nil, ErrNotMocked
+	}
+	return m.ModerateFunc(ctx, model, text)
+}
+
+func (m *Mock) SynthesizeSpeech(ctx context.Context, model, voice, text string) ([]byte, error) {
+	if m.SynthesizeSpeechFunc == nil {
+		return nil, ErrNotMocked
+	}
+	return m.SynthesizeSpeechFunc(ctx, model, voice, text)
+}
+
+func (m *Mock) TranscribeAudio(ctx context.Context, url, model, filePath string) (string, error) {
+	if m.TranscribeAudioFunc == nil {
+		return "", ErrNotMocked
+	}
+	return m.TranscribeAudioFunc(ctx, url, model, filePath)
+}
+
+func (m *Mock) ListModels(ctx context.Context) ([]string, error) {
+	if m.ListModelsFunc == nil {
+		return nil, ErrNotMocked
+	}
+	return m.ListModelsFunc(ctx)
+}
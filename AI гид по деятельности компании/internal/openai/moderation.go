@@ -0,0 +1,77 @@
+package openai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Результат проверки текста через moderations
+type ModerationResult struct {
+	Flagged        bool               `json:"flagged"`
+	CategoryScores map[string]float64 `json:"category_scores"`
+}
+
+// Отправляет текст на модерацию. Пустая модель — используется модель API по умолчанию.
+func (c *Client) Moderate(ctx context.Context, model, text string) (*ModerationResult, error) {
+	requestBody := map[string]interface{}{
+		"input": text,
+	}
+	if model != "" {
+		requestBody["model"] = model
+	}
+
+	reqBody, err := json.Marshal(requestBody)
+	if err != nil {
+		return nil, fmt.Errorf("Ошибка создания тела запроса: %v", err)
+	}
+
+	req, err := c.newRequest(ctx, "POST", "moderations", bytes.NewBuffer(reqBody))
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError(resp.StatusCode, body)
+	}
+
+	var result struct {
+		Results []ModerationResult `json:"results"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, err
+	}
+	if len(result.Results) == 0 {
+		return nil, fmt.Errorf("Пустой ответ модерации")
+	}
+	return &result.Results[0], nil
+}
+
+// Проверяет, превышает ли результат модерации пороги. Если пороги не заданы,
+// используется решение API (flagged). Возвращает категории, превысившие порог.
+func (r *ModerationResult) Exceeds(thresholds map[string]float64) (bool, []string) {
+	if len(thresholds) == 0 {
+		return r.Flagged, nil
+	}
+	var categories []string
+	for category, threshold := range thresholds {
+		if r.CategoryScores[category] >= threshold {
+			categories = append(categories, category)
+		}
+	}
+	return len(categories) > 0, categories
+}
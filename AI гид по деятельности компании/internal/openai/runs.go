@@ -0,0 +1,416 @@
+package openai
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// Параметры запуска ассистента
+type RunRequest struct {
+	AssistantID         string
+	VectorStoreID       string
+	Messages            []map[string]interface{}
+	Temperature         float64
+	MaxCompletionTokens int
+	// Ограничение токенов контекста запуска: история потока обрезается, чтобы в него уложиться
+	MaxPromptTokens int
+	// Какие сообщения потока попадают в контекст запуска. nil — решает API
+	TruncationStrategy *TruncationStrategy
+	// Поток, в котором выполняется запуск. Пустой — создаётся новый поток из Messages
+	ThreadID string
+	// Модель для запуска. Пустая — используется модель ассистента
+	Model string
+	// Дополнительные указания к инструкциям ассистента
+	AdditionalInstructions string
+	// Инструменты запуска. Пустой список — используются инструменты ассистента
+	Tools []Tool
+	// Формат ответа, например JSON по схеме. nil — формат ассистента
+	ResponseFormat *ResponseFormat
+	// Модель рассуждающая (o1, o3): temperature и top_p не передаются, их такие модели отклоняют
+	Reasoning bool
+	// Усилие рассуждения: "low", "medium" или "high". Пустое — по умолчанию модели
+	ReasoningEffort string
+	// Длительность потока ответа для этого запуска. 0 — StreamTimeout клиента
+	StreamTimeout time.Duration
+}
+
+// Вызов функции, результата которого ждёт запуск в статусе requires_action
+type ToolCall struct {
+	ID   string
+	Name string
+	// Аргументы функции строкой JSON
+	Arguments string
+}
+
+// Формат ответа запуска: "text", "json_object" или "json_schema" со схемой в JSONSchema
+type ResponseFormat struct {
+	Type       string      `json:"type"`
+	JSONSchema *JSONSchema `json:"json_schema,omitempty"`
+}
+
+// JSON Schema ответа. При Strict модель обязана вернуть JSON, соответствующий схеме
+type JSONSchema struct {
+	Name   string          `json:"name"`
+	Schema json.RawMessage `json:"schema"`
+	Strict bool            `json:"strict,omitempty"`
+}
+
+// Расход токенов одного запуска ассистента
+type Usage struct {
+	PromptTokens     int64 `json:"prompt_tokens"`
+	CompletionTokens int64 `json:"completion_tokens"`
+	TotalTokens      int64 `json:"total_tokens"`
+}
+
+// Стратегия обрезки потока: "auto" или "last_messages" с числом последних сообщений
+type TruncationStrategy struct {
+	Type         string `json:"type" yaml:"type"`
+	LastMessages int    `json:"last_messages,omitempty" yaml:"last_messages"`
+}
+
+// Результат запуска ассистента
+type RunResult struct {
+	Text  string
+	Usage Usage
+	// ID запуска в API, по которому можно найти его в журналах и отзывах
+	RunID string
+	// ID потока запуска. Для запуска без потока — поток, созданный API для этого запуска
+	ThreadID string
+	// Ответ обрезан по лимиту токенов или по MaxAnswerBytes
+	Truncated bool
+	// Время до первого фрагмента ответа. 0 — текст не получен
+	FirstToken time.Duration
+	// Файлы и изображения, созданные инструментом code_interpreter
+	Files []GeneratedFile
+	// Вывод кода, выполненного инструментом code_interpreter
+	CodeOutputs []string
+}
+
+// Файл, созданный ассистентом. Содержимое скачивается методом DownloadFile.
+type GeneratedFile struct {
+	FileID string
+	// Имя файла в песочнице code_interpreter. Пустое у изображений
+	Name  string
+	Image bool
+}
+
+// Добавляет файл к результату, если его там ещё нет: одно изображение приходит
+// и в выводе кода, и в сообщении ассистента
+func (r *RunResult) addFile(file GeneratedFile) {
+	for _, f := range r.Files {
+		if f.FileID == file.FileID {
+			return
+		}
+	}
+	r.Files = append(r.Files, file)
+}
+
+// RunObserver получает сведения о запуске для отладки
+type RunObserver interface {
+	// Тело запроса запуска без заголовков
+	OnRequestBody(body []byte)
+	// Тип очередного события SSE
+	OnEvent(event string)
+}
+
+// DeltaObserver — необязательное расширение RunObserver: получает фрагменты текста ответа
+// по мере их поступления, например для вывода ответа в терминал без ожидания конца потока
+type DeltaObserver interface {
+	OnDelta(text string)
+}
+
+// Извлекает расход токенов из поля usage объекта запуска
+func parseUsage(m map[string]interface{}) Usage {
+	var u Usage
+	if v, ok := m["prompt_tokens"].(float64); ok {
+		u.PromptTokens = int64(v)
+	}
+	if v, ok := m["completion_tokens"].(float64); ok {
+		u.CompletionTokens = int64(v)
+	}
+	if v, ok := m["total_tokens"].(float64); ok {
+		u.TotalTokens = int64(v)
+	}
+	return u
+}
+
+// Запускает ассистента с обработкой SSE. Если у запроса есть поток, запуск выполняется
+// в нём, иначе создаётся новый поток со всей историей сообщений.
+func (c *Client) CreateThreadRun(ctx context.Context, run RunRequest, observer RunObserver) (RunResult, error) {
+	// Зависший сервер не должен бесконечно удерживать соединение и горутину
+	timeout := c.StreamTimeout
+	if run.StreamTimeout > 0 {
+		timeout = run.StreamTimeout
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	requestBody := map[string]interface{}{
+		"assistant_id": run.AssistantID,
+		"stream":       true, // Активация потока
+	}
+	if run.Reasoning {
+		if run.ReasoningEffort != "" {
+			requestBody["reasoning_effort"] = run.ReasoningEffort
+		}
+	} else {
+		requestBody["temperature"] = run.Temperature
+		requestBody["top_p"] = 1.0
+	}
+	endpoint := "threads/runs"
+	if run.ThreadID != "" {
+		endpoint = BuildURL("threads", run.ThreadID, "runs")
+	} else {
+		requestBody["thread"] = map[string]interface{}{
+			"messages": run.Messages,
+		}
+		if run.VectorStoreID != "" {
+			requestBody["tool_resources"] = fileSearchResources(run.VectorStoreID)
+		}
+	}
+	if run.MaxCompletionTokens > 0 {
+		requestBody["max_completion_tokens"] = run.MaxCompletionTokens
+	}
+	if run.MaxPromptTokens > 0 {
+		requestBody["max_prompt_tokens"] = run.MaxPromptTokens
+	}
+	if run.TruncationStrategy != nil {
+		requestBody["truncation_strategy"] = run.TruncationStrategy
+	}
+	// Модель запуска переопределяет модель ассистента
+	if run.Model != "" {
+		requestBody["model"] = run.Model
+	}
+	// Дополнительные указания добавляются к инструкциям ассистента только для этого запуска
+	if run.AdditionalInstructions != "" {
+		requestBody["additional_instructions"] = run.AdditionalInstructions
+	}
+
+	if len(run.Tools) > 0 {
+		requestBody["tools"] = run.Tools
+	}
+	if run.ResponseFormat != nil {
+		requestBody["response_format"] = run.ResponseFormat
+	}
+
+	reqBody, err := json.Marshal(requestBody)
+	if err != nil {
+		return RunResult{}, fmt.Errorf("Ошибка создания тела запроса: %v", err)
+	}
+	if observer != nil {
+		observer.OnRequestBody(reqBody)
+	}
+
+	req, err := c.newRequest(ctx, "POST", endpoint, bytes.NewBuffer(reqBody))
+	if err != nil {
+		return RunResult{}, fmt.Errorf("Ошибка создания HTTP-запроса: %v", err)
+	}
+
+	c.logger(ctx).Debug("Отправка запроса к ассистенту", "assistant_id", run.AssistantID, "thread_id", run.ThreadID)
+
+	resp, err := c.do(req)
+	if err != nil {
+		return RunResult{}, fmt.Errorf("Ошибка выполнения HTTP-запроса: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		c.logger(ctx).Error("Ошибка запуска ассистента", "status_code", resp.StatusCode, "body", string(body))
+		return RunResult{}, newAPIError(resp.StatusCode, body)
+	}
+
+	stream := &runStream{client: c, ctx: ctx, start: time.Now(), observer: observer, unknown: make(map[string]int)}
+	stream.deltas, _ = observer.(DeltaObserver)
+	defer stream.logUnknown()
+
+	result, err := c.readRunStream(ctx, resp, stream)
+	if err != nil || stream.toolCalls == nil {
+		return result, err
+	}
+
+	// Бот не выполняет функции. Запуск, ждущий их результатов, отменяется: иначе он ждал бы
+	// до истечения срока, и в поток нельзя было бы добавить сообщение
+	names := make([]string, 0, len(stream.toolCalls))
+	for _, call := range stream.toolCalls {
+		names = append(names, call.Name)
+	}
+	if cancelErr := c.CancelRun(context.WithoutCancel(ctx), result.ThreadID, result.RunID); cancelErr != nil {
+		c.logger(ctx).Warn("Ошибка отмены запуска, ожидающего результатов функций", "run_id", result.RunID, "error", cancelErr)
+	}
+	return RunResult{Usage: result.Usage, ThreadID: result.ThreadID, RunID: result.RunID},
+		fmt.Errorf("%w: %s", ErrToolCallsUnsupported, strings.Join(names, ", "))
+}
+
+// Читает события SSE и собирает ответ ассистента. Событие обрабатывается обработчиком
+// из streamHandlers по типу объекта, события без обработчика только подсчитываются.
+// Если запуск ждёт результатов функций, вызовы сохраняются в stream.toolCalls.
+func (c *Client) readRunStream(ctx context.Context, resp *http.Response, stream *runStream) (RunResult, error) {
+	defer resp.Body.Close()
+
+	reader := bufio.NewReader(resp.Body)
+	observer := stream.observer
+	result := &stream.result
+
+	// Обрыв потока возвращает текст, полученный до него: его можно отправить с пометкой о неполноте
+	interrupted := func(cause error) (RunResult, error) {
+		return RunResult{Usage: result.Usage, ThreadID: result.ThreadID, RunID: result.RunID}, &InterruptedError{Text: result.Text, Err: cause}
+	}
+	done := false
+
+	for {
+		// При отмене или истечении времени чтение прерывается, а тело закрывается через defer
+		if err := ctx.Err(); err != nil {
+			return interrupted(fmt.Errorf("Поток ответа прерван: %w", err))
+		}
+
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return interrupted(fmt.Errorf("Поток ответа прерван: %w", ctxErr))
+			}
+			if err == io.EOF {
+				break
+			}
+			return interrupted(fmt.Errorf("Ошибка чтения события: %v", err))
+		}
+
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "event: ") {
+			if observer != nil {
+				observer.OnEvent(line[7:])
+			}
+			continue
+		}
+		if len(line) == 0 || !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+
+		eventData := line[6:]
+
+		if eventData == "[DONE]" {
+			c.logger(ctx).Debug("Ответ полностью получен")
+			done = true
+			break
+		}
+
+		var event map[string]interface{}
+		if err := json.Unmarshal([]byte(eventData), &event); err != nil {
+			c.logger(ctx).Error("Ошибка разбора события", "error", err)
+			continue
+		}
+
+		// Событие error содержит только объект ошибки
+		if apiErr, ok := getMap(event, "error"); ok {
+			return RunResult{Usage: result.Usage, ThreadID: result.ThreadID, RunID: result.RunID}, parseRunError(apiErr)
+		}
+
+		obj, ok := getString(event, "object")
+		if !ok {
+			continue
+		}
+		if err := stream.dispatch(obj, event); err != nil {
+			return RunResult{Usage: result.Usage, ThreadID: result.ThreadID, RunID: result.RunID}, err
+		}
+	}
+
+	// Запуск приостановлен до получения результатов функций
+	if stream.toolCalls != nil {
+		return *result, nil
+	}
+
+	// Сервер закрыл соединение, не отправив [DONE] и итоговый статус запуска
+	if !done && !stream.finished {
+		return interrupted(io.ErrUnexpectedEOF)
+	}
+
+	c.logger(ctx).Debug("Собранное сообщение от ассистента", "message", result.Text)
+
+	// Ответ может состоять только из созданных файлов
+	if result.Text == "" && len(result.Files) == 0 {
+		return *result, ErrEmptyResponse
+	}
+
+	return *result, nil
+}
+
+// Собирает изображения и файлы из завершённого сообщения ассистента: части image_file
+// и аннотации file_path со ссылками вида sandbox:/mnt/data/имя
+func collectMessageFiles(result *RunResult, message map[string]interface{}) {
+	content, _ := getArray(message, "content")
+	for _, item := range content {
+		part, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if image, ok := getMap(part, "image_file"); ok {
+			if id, ok := getString(image, "file_id"); ok {
+				result.addFile(GeneratedFile{FileID: id, Image: true})
+			}
+			continue
+		}
+		text, ok := getMap(part, "text")
+		if !ok {
+			continue
+		}
+		annotations, _ := getArray(text, "annotations")
+		for _, a := range annotations {
+			annotation, ok := a.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			filePath, ok := getMap(annotation, "file_path")
+			if !ok {
+				continue
+			}
+			id, ok := getString(filePath, "file_id")
+			if !ok {
+				continue
+			}
+			link, _ := getString(annotation, "text")
+			result.addFile(GeneratedFile{FileID: id, Name: path.Base(strings.TrimPrefix(link, "sandbox:"))})
+		}
+	}
+}
+
+// Собирает вывод и изображения вызовов code_interpreter из завершённого шага запуска
+func collectCodeOutputs(result *RunResult, step map[string]interface{}) {
+	details, _ := getMap(step, "step_details")
+	calls, _ := getArray(details, "tool_calls")
+	for _, c := range calls {
+		call, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		interpreter, ok := getMap(call, "code_interpreter")
+		if !ok {
+			continue
+		}
+		outputs, _ := getArray(interpreter, "outputs")
+		for _, o := range outputs {
+			output, ok := o.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if logs, ok := getString(output, "logs"); ok && strings.TrimSpace(logs) != "" {
+				result.CodeOutputs = append(result.CodeOutputs, logs)
+			}
+			if image, ok := getMap(output, "image"); ok {
+				if id, ok := getString(image, "file_id"); ok {
+					result.addFile(GeneratedFile{FileID: id, Image: true})
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,405 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Клиент, обращающийся к тестовому серверу с обработчиком handler
+func newTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return New(server.URL, "test-key", slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+// Событие SSE с фрагментом текста ответа
+func deltaEvent(text string) string {
+	return fmt.Sprintf(`data: {"object":"thread.message.delta","delta":{"content":[{"type":"text","text":{"value":%q}}]}}`+"\n\n", text)
+}
+
+// Событие SSE с объектом запуска в статусе status
+func runEvent(status string) string {
+	return fmt.Sprintf(`data: {"object":"thread.run","id":"run_1","thread_id":"thread_1","status":%q,"usage":{"prompt_tokens":10,"completion_tokens":5,"total_tokens":15}}`+"\n\n", status)
+}
+
+// Сервер, отправляющий события потока и завершающий ответ
+func sseHandler(events ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, event := range events {
+			io.WriteString(w, event)
+		}
+	}
+}
+
+func TestCreateThreadRunCompleted(t *testing.T) {
+	client := newTestClient(t, sseHandler(deltaEvent("Привет"), deltaEvent(", мир"), runEvent("completed"), "data: [DONE]\n\n"))
+
+	result, err := client.CreateThreadRun(context.Background(), RunRequest{AssistantID: "asst_1"}, nil)
+	if err != nil {
+		t.Fatalf("CreateThreadRun: %v", err)
+	}
+	if result.Text != "Привет, мир" {
+		t.Errorf("Text = %q, want %q", result.Text, "Привет, мир")
+	}
+	if result.RunID != "run_1" || result.ThreadID != "thread_1" {
+		t.Errorf("RunID, ThreadID = %q, %q", result.RunID, result.ThreadID)
+	}
+	if result.Usage.TotalTokens != 15 {
+		t.Errorf("Usage.TotalTokens = %d, want 15", result.Usage.TotalTokens)
+	}
+}
+
+// Событие SSE о завершённом сообщении ассистента
+const messageCompletedEvent = `data: {"object":"thread.message","status":"completed","content":[]}` + "\n\n"
+
+// Чтение не останавливается на первом thread.message.completed: сообщения запуска склеиваются
+func TestCreateThreadRunMultipleMessages(t *testing.T) {
+	tests := []struct {
+		name   string
+		events []string
+		want   string
+	}{
+		{
+			name:   "одно сообщение",
+			events: []string{deltaEvent("Ответ"), messageCompletedEvent, runEvent("completed"), "data: [DONE]\n\n"},
+			want:   "Ответ",
+		},
+		{
+			name: "два сообщения",
+			events: []string{
+				deltaEvent("Сейчас поищу."), messageCompletedEvent,
+				deltaEvent("Центр работает "), deltaEvent("с 9 до 18."), messageCompletedEvent,
+				runEvent("completed"), "data: [DONE]\n\n",
+			},
+			want: "Сейчас поищу.\n\nЦентр работает с 9 до 18.",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient(t, sseHandler(tt.events...))
+
+			result, err := client.CreateThreadRun(context.Background(), RunRequest{AssistantID: "asst_1"}, nil)
+			if err != nil {
+				t.Fatalf("CreateThreadRun: %v", err)
+			}
+			if result.Text != tt.want {
+				t.Errorf("Text = %q, want %q", result.Text, tt.want)
+			}
+		})
+	}
+}
+
+// Запуск, завершившийся ошибкой внутри потока, возвращает RunError с кодом и сообщением
+func TestCreateThreadRunFailed(t *testing.T) {
+	tests := []struct {
+		name   string
+		events []string
+		want   RunError
+	}{
+		{
+			name: "статус failed",
+			events: []string{
+				deltaEvent("Начало"),
+				`data: {"object":"thread.run","id":"run_1","thread_id":"thread_1","status":"failed","last_error":{"code":"rate_limit_exceeded","message":"Rate limit reached"}}` + "\n\n",
+			},
+			want: RunError{Code: "rate_limit_exceeded", Message: "Rate limit reached"},
+		},
+		{
+			name: "событие error",
+			events: []string{
+				runEvent("in_progress"),
+				"event: error\n" + `data: {"error":{"type":"server_error","message":"Internal error"}}` + "\n\n",
+			},
+			want: RunError{Code: "server_error", Message: "Internal error"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient(t, sseHandler(tt.events...))
+
+			result, err := client.CreateThreadRun(context.Background(), RunRequest{AssistantID: "asst_1"}, nil)
+			var runErr *RunError
+			if !errors.As(err, &runErr) {
+				t.Fatalf("err = %v, want *RunError", err)
+			}
+			if *runErr != tt.want {
+				t.Errorf("RunError = %+v, want %+v", *runErr, tt.want)
+			}
+			// ID запуска нужны для журнала и отмены
+			if result.RunID != "run_1" || result.ThreadID != "thread_1" {
+				t.Errorf("RunID, ThreadID = %q, %q", result.RunID, result.ThreadID)
+			}
+		})
+	}
+}
+
+func TestCreateThreadRunInterrupted(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		want    string
+	}{
+		{
+			name:    "конец потока без [DONE]",
+			handler: sseHandler(deltaEvent("Первая часть"), deltaEvent(" ответа")),
+			want:    "Первая часть ответа",
+		},
+		{
+			name:    "обрыв до первого фрагмента",
+			handler: sseHandler(runEvent("in_progress")),
+			want:    "",
+		},
+		{
+			// Соединение закрывается посреди события, не завершив ответ
+			name: "обрыв соединения посреди сообщения",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/event-stream")
+				io.WriteString(w, deltaEvent("Начало"))
+				io.WriteString(w, `data: {"object":"thread.message.delta","delta":{"content":[{"type":"text","text":{"value":"оборв`)
+				w.(http.Flusher).Flush()
+				conn, _, err := w.(http.Hijacker).Hijack()
+				if err != nil {
+					t.Errorf("Hijack: %v", err)
+					return
+				}
+				conn.Close()
+			},
+			want: "Начало",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient(t, tt.handler)
+
+			result, err := client.CreateThreadRun(context.Background(), RunRequest{AssistantID: "asst_1"}, nil)
+			if !errors.Is(err, ErrStreamInterrupted) {
+				t.Fatalf("err = %v, want ErrStreamInterrupted", err)
+			}
+			var interrupted *InterruptedError
+			if !errors.As(err, &interrupted) {
+				t.Fatalf("err = %T, want *InterruptedError", err)
+			}
+			if interrupted.Text != tt.want {
+				t.Errorf("Text = %q, want %q", interrupted.Text, tt.want)
+			}
+			if result.Text != "" {
+				t.Errorf("result.Text = %q, want empty: частичный ответ возвращается только в ошибке", result.Text)
+			}
+		})
+	}
+}
+
+// Наблюдатель, вызывающий onDelta на каждом фрагменте ответа
+type deltaFunc func(text string)
+
+func (f deltaFunc) OnRequestBody(body []byte) {}
+func (f deltaFunc) OnEvent(event string)      {}
+func (f deltaFunc) OnDelta(text string)       { f(text) }
+
+func TestCreateThreadRunCancelledContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, deltaEvent("Частичный"))
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	})
+
+	// Запрос отменяется после первого фрагмента, пока сервер держит поток открытым
+	_, err := client.CreateThreadRun(ctx, RunRequest{AssistantID: "asst_1"}, deltaFunc(func(string) { cancel() }))
+	if !errors.Is(err, ErrStreamInterrupted) {
+		t.Fatalf("err = %v, want ErrStreamInterrupted", err)
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled в цепочке", err)
+	}
+	var interrupted *InterruptedError
+	if errors.As(err, &interrupted) && interrupted.Text != "Частичный" {
+		t.Errorf("Text = %q, want %q", interrupted.Text, "Частичный")
+	}
+}
+
+// Событие SSE: запуск ждёт результата функции get_weather
+const requiresActionEvent = `data: {"object":"thread.run","id":"run_1","thread_id":"thread_1","status":"requires_action",` +
+	`"required_action":{"type":"submit_tool_outputs","submit_tool_outputs":{"tool_calls":[` +
+	`{"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Нижний Новгород\"}"}}]}}}` + "\n\n"
+
+// Запуск, ждущий результатов функций, отменяется: бот функции не выполняет
+func TestCreateThreadRunCancelsToolCalls(t *testing.T) {
+	var cancelled atomic.Bool
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/threads/runs":
+			sseHandler(requiresActionEvent, "data: [DONE]\n\n")(w, r)
+		case "/threads/thread_1/runs/run_1/cancel":
+			cancelled.Store(true)
+			io.WriteString(w, `{"id":"run_1","status":"cancelling"}`)
+		default:
+			t.Errorf("Неожиданный запрос %s %s", r.Method, r.URL.Path)
+			http.NotFound(w, r)
+		}
+	})
+
+	result, err := client.CreateThreadRun(context.Background(), RunRequest{AssistantID: "asst_1"}, nil)
+	if !errors.Is(err, ErrToolCallsUnsupported) || !strings.Contains(err.Error(), "get_weather") {
+		t.Fatalf("err = %v, want ErrToolCallsUnsupported с именем функции", err)
+	}
+	if !cancelled.Load() {
+		t.Error("Запуск, ожидающий результатов функций, не отменён")
+	}
+	if result.RunID != "run_1" || result.ThreadID != "thread_1" {
+		t.Errorf("RunID, ThreadID = %q, %q", result.RunID, result.ThreadID)
+	}
+}
+
+// truncation_strategy передаётся в теле запуска только если задана
+func TestCreateThreadRunTruncationStrategy(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy *TruncationStrategy
+		want     string
+	}{
+		{"не задана", nil, "null"},
+		{"auto", &TruncationStrategy{Type: "auto"}, `{"type":"auto"}`},
+		{"last_messages", &TruncationStrategy{Type: "last_messages", LastMessages: 5}, `{"type":"last_messages","last_messages":5}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got json.RawMessage
+			client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				var body struct {
+					TruncationStrategy json.RawMessage `json:"truncation_strategy"`
+				}
+				json.NewDecoder(r.Body).Decode(&body)
+				got = body.TruncationStrategy
+				sseHandler(deltaEvent("ответ"), runEvent("completed"))(w, r)
+			})
+
+			run := RunRequest{AssistantID: "asst_1", ThreadID: "thread_1", TruncationStrategy: tt.strategy}
+			if _, err := client.CreateThreadRun(context.Background(), run, nil); err != nil {
+				t.Fatal(err)
+			}
+			if got == nil {
+				got = json.RawMessage("null")
+			}
+			if string(got) != tt.want {
+				t.Errorf("truncation_strategy = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// Изображения и файлы code_interpreter собираются из шагов запуска и завершённых сообщений
+// без повторов, вывод кода — из шагов
+func TestCreateThreadRunGeneratedFiles(t *testing.T) {
+	step := `data: {"object":"thread.run.step","status":"completed","step_details":{"type":"tool_calls","tool_calls":[` +
+		`{"type":"code_interpreter","code_interpreter":{"input":"print(1)","outputs":[{"type":"logs","logs":"1\n"},{"type":"image","image":{"file_id":"file-img"}}]}}]}}` + "\n\n"
+	message := `data: {"object":"thread.message","status":"completed","content":[` +
+		`{"type":"image_file","image_file":{"file_id":"file-img"}},` +
+		`{"type":"text","text":{"value":"График и отчёт готовы","annotations":[{"type":"file_path","text":"sandbox:/mnt/data/report.csv","file_path":{"file_id":"file-csv"}}]}}]}` + "\n\n"
+
+	tests := []struct {
+		name     string
+		events   []string
+		wantText string
+	}{
+		{"с текстом", []string{step, deltaEvent("График и отчёт готовы"), message, runEvent("completed")}, "График и отчёт готовы"},
+		// Ответ из одних файлов не считается пустым
+		{"без текста", []string{step, message, runEvent("completed")}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient(t, sseHandler(tt.events...))
+
+			result, err := client.CreateThreadRun(context.Background(), RunRequest{AssistantID: "asst_1"}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			wantFiles := []GeneratedFile{{FileID: "file-img", Image: true}, {FileID: "file-csv", Name: "report.csv"}}
+			if result.Text != tt.wantText || !reflect.DeepEqual(result.Files, wantFiles) {
+				t.Errorf("Текст %q, файлы %+v; want %q, %+v", result.Text, result.Files, tt.wantText, wantFiles)
+			}
+			if !reflect.DeepEqual(result.CodeOutputs, []string{"1\n"}) {
+				t.Errorf("Вывод кода %q", result.CodeOutputs)
+			}
+		})
+	}
+}
+
+// Рассуждающим моделям не передаются temperature и top_p, а reasoning_effort — только если задан
+func TestCreateThreadRunReasoning(t *testing.T) {
+	tests := []struct {
+		name string
+		run  RunRequest
+		want map[string]interface{}
+	}{
+		{
+			name: "обычная модель",
+			run:  RunRequest{AssistantID: "asst_1", Temperature: 0.3, ReasoningEffort: "high"},
+			want: map[string]interface{}{"assistant_id": "asst_1", "stream": true, "temperature": 0.3, "top_p": 1.0},
+		},
+		{
+			name: "рассуждающая модель",
+			run:  RunRequest{AssistantID: "asst_1", Temperature: 0.3, Reasoning: true, ReasoningEffort: "high"},
+			want: map[string]interface{}{"assistant_id": "asst_1", "stream": true, "reasoning_effort": "high"},
+		},
+		{
+			name: "рассуждающая модель без reasoning_effort",
+			run:  RunRequest{AssistantID: "asst_1", Temperature: 0.3, Reasoning: true},
+			want: map[string]interface{}{"assistant_id": "asst_1", "stream": true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body map[string]interface{}
+			client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				json.NewDecoder(r.Body).Decode(&body)
+				sseHandler(deltaEvent("ответ"), runEvent("completed"))(w, r)
+			})
+
+			if _, err := client.CreateThreadRun(context.Background(), tt.run, nil); err != nil {
+				t.Fatal(err)
+			}
+			// Поток создаётся из сообщений, они не относятся к параметрам модели
+			delete(body, "thread")
+			if !reflect.DeepEqual(body, tt.want) {
+				t.Errorf("Тело запроса %v, want %v", body, tt.want)
+			}
+		})
+	}
+}
+
+// Длительность потока запуска заменяет StreamTimeout клиента
+func TestCreateThreadRunStreamTimeout(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, deltaEvent("Начало"))
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	})
+	client.StreamTimeout = time.Hour
+
+	start := time.Now()
+	_, err := client.CreateThreadRun(context.Background(), RunRequest{AssistantID: "asst_1", StreamTimeout: 50 * time.Millisecond}, nil)
+	var interrupted *InterruptedError
+	if !errors.As(err, &interrupted) || !errors.Is(err, context.DeadlineExceeded) || interrupted.Text != "Начало" {
+		t.Fatalf("err = %v, ожидается обрыв по времени с текстом Начало", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Запуск прерван через %v", elapsed)
+	}
+}
@@ -0,0 +1,186 @@
+package openai
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// runStream — состояние разбора потока SSE одного запуска
+type runStream struct {
+	client   *Client
+	ctx      context.Context
+	start    time.Time
+	observer RunObserver
+	deltas   DeltaObserver
+	result   RunResult
+	// Запуск может содержать несколько сообщений ассистента (например, при работе с инструментами).
+	// Они не обрываются на первом thread.message.completed, а склеиваются через пустую строку.
+	messageCompleted bool
+	answerTooLarge   bool
+	// Получен итоговый статус запуска: поток завершён, даже если за ним не пришло [DONE]
+	finished bool
+	// Вызовы функций, результатов которых ждёт запуск (статус requires_action)
+	toolCalls []ToolCall
+	// Количество событий без обработчика по типу объекта
+	unknown map[string]int
+}
+
+// streamHandler обрабатывает событие потока. Ошибка прерывает чтение потока и возвращается
+// как ошибка запуска.
+type streamHandler func(s *runStream, event map[string]interface{}) error
+
+// Обработчики событий потока по типу объекта. Новый тип события поддерживается добавлением
+// обработчика сюда, без изменения цикла чтения потока.
+var streamHandlers = map[string]streamHandler{
+	"thread.message.delta": handleMessageDelta,
+	"thread.message":       handleMessage,
+	"thread.run.step":      handleRunStep,
+	"thread.run":           handleRun,
+}
+
+// Передаёт событие обработчику его типа. Событие без обработчика подсчитывается.
+func (s *runStream) dispatch(object string, event map[string]interface{}) error {
+	handler, ok := streamHandlers[object]
+	if !ok {
+		s.unknown[object]++
+		return nil
+	}
+	return handler(s, event)
+}
+
+// Записывает в журнал, сколько событий каких типов пропущено без обработки
+func (s *runStream) logUnknown() {
+	for object, count := range s.unknown {
+		s.client.logger(s.ctx).Debug("Пропущены события без обработчика", "object", object, "count", count)
+	}
+}
+
+// Фрагмент текста сообщения ассистента
+func handleMessageDelta(s *runStream, event map[string]interface{}) error {
+	delta, ok := getMap(event, "delta")
+	if !ok {
+		return nil
+	}
+	content, ok := getArray(delta, "content")
+	if !ok {
+		return nil
+	}
+	c, result := s.client, &s.result
+	for _, part := range content {
+		textPart, ok := part.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		text, ok := getMap(textPart, "text")
+		if !ok {
+			continue
+		}
+		value, ok := getString(text, "value")
+		if !ok {
+			continue
+		}
+		if result.FirstToken == 0 {
+			result.FirstToken = time.Since(s.start)
+		}
+		if s.answerTooLarge {
+			continue
+		}
+		if s.messageCompleted && result.Text != "" {
+			value = "\n\n" + value
+		}
+		s.messageCompleted = false
+		result.Text += value
+		if s.deltas != nil {
+			s.deltas.OnDelta(value)
+		}
+
+		// Остаток потока дочитывается, чтобы получить итоговый объект запуска, но текст больше не копится
+		if c.MaxAnswerBytes > 0 && len(result.Text) > c.MaxAnswerBytes {
+			c.logger(s.ctx).Warn("Ответ ассистента превысил допустимый размер и будет обрезан", "max_answer_bytes", c.MaxAnswerBytes)
+			result.Text = strings.ToValidUTF8(result.Text[:c.MaxAnswerBytes], "")
+			s.answerTooLarge = true
+			result.Truncated = true
+		}
+	}
+	return nil
+}
+
+// Завершённое сообщение содержит изображения и ссылки на созданные файлы целиком
+func handleMessage(s *runStream, event map[string]interface{}) error {
+	if status, _ := getString(event, "status"); status != "completed" {
+		return nil
+	}
+	s.client.logger(s.ctx).Debug("Сообщение ассистента завершено")
+	s.messageCompleted = true
+	collectMessageFiles(&s.result, event)
+	return nil
+}
+
+// Завершённый шаг запуска содержит вывод code_interpreter
+func handleRunStep(s *runStream, event map[string]interface{}) error {
+	if status, _ := getString(event, "status"); status == "completed" {
+		collectCodeOutputs(&s.result, event)
+	}
+	return nil
+}
+
+// Объект запуска: ID, расход токенов и итоговый статус
+func handleRun(s *runStream, event map[string]interface{}) error {
+	result := &s.result
+	if id, ok := getString(event, "id"); ok {
+		result.RunID = id
+	}
+	if id, ok := getString(event, "thread_id"); ok {
+		result.ThreadID = id
+	}
+	// Итоговый объект запуска содержит расход токенов
+	if u, ok := getMap(event, "usage"); ok {
+		result.Usage = parseUsage(u)
+	}
+
+	status, _ := getString(event, "status")
+	switch status {
+	case "completed", "incomplete", "failed", "cancelled", "expired":
+		s.finished = true
+	}
+	if status == "failed" {
+		lastError, _ := getMap(event, "last_error")
+		return parseRunError(lastError)
+	}
+	if status == "requires_action" {
+		s.toolCalls = parseToolCalls(event)
+		return nil
+	}
+	if status != "incomplete" {
+		return nil
+	}
+	details, _ := getMap(event, "incomplete_details")
+	reason, _ := getString(details, "reason")
+	s.client.logger(s.ctx).Warn("Запуск ассистента завершён не полностью", "reason", reason)
+	// Лимит контекста тоже может оборвать ответ: модели не хватает места для продолжения
+	if reason == "max_completion_tokens" || reason == "max_prompt_tokens" {
+		result.Truncated = true
+	}
+	return nil
+}
+
+// Извлекает вызовы функций из поля required_action объекта запуска
+func parseToolCalls(event map[string]interface{}) []ToolCall {
+	action, _ := getMap(event, "required_action")
+	submit, _ := getMap(action, "submit_tool_outputs")
+	items, _ := getArray(submit, "tool_calls")
+	calls := make([]ToolCall, 0, len(items))
+	for _, item := range items {
+		call, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		id, _ := getString(call, "id")
+		function, _ := getMap(call, "function")
+		name, _ := getString(function, "name")
+		arguments, _ := getString(function, "arguments")
+		calls = append(calls, ToolCall{ID: id, Name: name, Arguments: arguments})
+	}
+	return calls
+}
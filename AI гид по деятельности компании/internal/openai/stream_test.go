@@ -0,0 +1,181 @@
+package openai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Состояние разбора потока без HTTP-запроса. Журнал пишется в log, если он задан
+func newRunStream(t *testing.T, log io.Writer) *runStream {
+	t.Helper()
+	if log == nil {
+		log = io.Discard
+	}
+	client := New("", "", slog.New(slog.NewTextHandler(log, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	return &runStream{client: client, ctx: context.Background(), start: time.Now(), unknown: make(map[string]int)}
+}
+
+// Разбирает событие потока из JSON
+func parseEvent(t *testing.T, data string) map[string]interface{} {
+	t.Helper()
+	var event map[string]interface{}
+	if err := json.Unmarshal([]byte(data), &event); err != nil {
+		t.Fatalf("Событие %s: %v", data, err)
+	}
+	return event
+}
+
+// Фрагменты, переданные DeltaObserver
+type deltaRecorder struct{ deltas []string }
+
+func (r *deltaRecorder) OnDelta(text string) { r.deltas = append(r.deltas, text) }
+
+// Фрагменты текста склеиваются, а текст следующего сообщения отделяется пустой строкой
+func TestHandleMessageDelta(t *testing.T) {
+	s := newRunStream(t, nil)
+	recorder := &deltaRecorder{}
+	s.deltas = recorder
+
+	for _, data := range []string{
+		`{"delta":{"content":[{"type":"text","text":{"value":"Сейчас "}}]}}`,
+		`{"delta":{"content":[{"type":"text","text":{"value":"поищу."}}]}}`,
+		// Фрагменты без текста пропускаются
+		`{"delta":{"content":[{"type":"image_file","image_file":{"file_id":"file-1"}}]}}`,
+		`{"delta":{}}`,
+	} {
+		if err := handleMessageDelta(s, parseEvent(t, data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.messageCompleted = true
+	handleMessageDelta(s, parseEvent(t, `{"delta":{"content":[{"type":"text","text":{"value":"Ответ"}}]}}`))
+
+	if want := "Сейчас поищу.\n\nОтвет"; s.result.Text != want {
+		t.Errorf("Текст %q, want %q", s.result.Text, want)
+	}
+	if want := []string{"Сейчас ", "поищу.", "\n\nОтвет"}; !reflect.DeepEqual(recorder.deltas, want) {
+		t.Errorf("Фрагменты %q, want %q", recorder.deltas, want)
+	}
+	if s.result.FirstToken == 0 {
+		t.Error("Время до первого фрагмента не записано")
+	}
+}
+
+// Текст сверх MaxAnswerBytes отбрасывается без разрыва символа, а ответ помечается обрезанным
+func TestHandleMessageDeltaMaxAnswerBytes(t *testing.T) {
+	s := newRunStream(t, nil)
+	s.client.MaxAnswerBytes = 5
+
+	for _, value := range []string{"абв", "где"} {
+		handleMessageDelta(s, parseEvent(t, `{"delta":{"content":[{"type":"text","text":{"value":"`+value+`"}}]}}`))
+	}
+	if s.result.Text != "аб" || !s.result.Truncated {
+		t.Errorf("Текст %q, обрезан %v; want \"аб\", true", s.result.Text, s.result.Truncated)
+	}
+}
+
+// Только завершённое сообщение отмечает конец сообщения и передаёт его файлы
+func TestHandleMessage(t *testing.T) {
+	s := newRunStream(t, nil)
+	content := `"content":[{"type":"image_file","image_file":{"file_id":"file-img"}}]`
+
+	handleMessage(s, parseEvent(t, `{"status":"in_progress",`+content+`}`))
+	if s.messageCompleted || len(s.result.Files) != 0 {
+		t.Fatalf("Незавершённое сообщение обработано: %+v", s.result.Files)
+	}
+	handleMessage(s, parseEvent(t, `{"status":"completed",`+content+`}`))
+	if !s.messageCompleted || !reflect.DeepEqual(s.result.Files, []GeneratedFile{{FileID: "file-img", Image: true}}) {
+		t.Errorf("messageCompleted %v, файлы %+v", s.messageCompleted, s.result.Files)
+	}
+}
+
+// Вывод кода берётся только из завершённого шага
+func TestHandleRunStep(t *testing.T) {
+	s := newRunStream(t, nil)
+	details := `"step_details":{"tool_calls":[{"code_interpreter":{"outputs":[{"type":"logs","logs":"42"}]}}]}`
+
+	handleRunStep(s, parseEvent(t, `{"status":"in_progress",`+details+`}`))
+	handleRunStep(s, parseEvent(t, `{"status":"completed",`+details+`}`))
+	if !reflect.DeepEqual(s.result.CodeOutputs, []string{"42"}) {
+		t.Errorf("Вывод кода %q, want [42]", s.result.CodeOutputs)
+	}
+}
+
+func TestHandleRun(t *testing.T) {
+	tests := []struct {
+		name          string
+		event         string
+		wantFinished  bool
+		wantTruncated bool
+		wantErr       bool
+		wantToolCalls []ToolCall
+	}{
+		{name: "выполняется", event: `{"status":"in_progress"}`},
+		{name: "завершён", event: `{"status":"completed"}`, wantFinished: true},
+		{name: "лимит токенов ответа", event: `{"status":"incomplete","incomplete_details":{"reason":"max_completion_tokens"}}`, wantFinished: true, wantTruncated: true},
+		{name: "фильтр содержимого", event: `{"status":"incomplete","incomplete_details":{"reason":"content_filter"}}`, wantFinished: true},
+		{name: "ошибка", event: `{"status":"failed","last_error":{"code":"server_error","message":"Сбой"}}`, wantFinished: true, wantErr: true},
+		{name: "отменён", event: `{"status":"cancelled"}`, wantFinished: true},
+		{
+			name:          "ждёт результатов функций",
+			event:         `{"status":"requires_action","required_action":{"submit_tool_outputs":{"tool_calls":[{"id":"call_1","function":{"name":"get_time","arguments":"{}"}}]}}}`,
+			wantToolCalls: []ToolCall{{ID: "call_1", Name: "get_time", Arguments: "{}"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newRunStream(t, nil)
+			event := parseEvent(t, tt.event)
+			event["id"], event["thread_id"] = "run_1", "thread_1"
+			event["usage"] = map[string]interface{}{"prompt_tokens": 10.0, "completion_tokens": 5.0, "total_tokens": 15.0}
+
+			err := handleRun(s, event)
+			var runErr *RunError
+			if tt.wantErr != errors.As(err, &runErr) {
+				t.Fatalf("err = %v, ожидается RunError: %v", err, tt.wantErr)
+			}
+			if s.finished != tt.wantFinished || s.result.Truncated != tt.wantTruncated || !reflect.DeepEqual(s.toolCalls, tt.wantToolCalls) {
+				t.Errorf("finished %v, truncated %v, toolCalls %+v", s.finished, s.result.Truncated, s.toolCalls)
+			}
+			if s.result.RunID != "run_1" || s.result.ThreadID != "thread_1" || s.result.Usage.TotalTokens != 15 {
+				t.Errorf("Результат %+v", s.result)
+			}
+		})
+	}
+}
+
+// События без обработчика не прерывают поток, а подсчитываются и пишутся в отладочный журнал
+func TestDispatchUnknownEvents(t *testing.T) {
+	var log bytes.Buffer
+	s := newRunStream(t, &log)
+
+	for _, object := range []string{"thread.run.step.delta", "thread.run.step.delta", "thread.created"} {
+		if err := s.dispatch(object, map[string]interface{}{"object": object}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.dispatch("thread.message.delta", parseEvent(t, `{"delta":{"content":[{"type":"text","text":{"value":"ответ"}}]}}`))
+
+	if want := map[string]int{"thread.run.step.delta": 2, "thread.created": 1}; !reflect.DeepEqual(s.unknown, want) {
+		t.Errorf("Пропущенные события %v, want %v", s.unknown, want)
+	}
+	if s.result.Text != "ответ" {
+		t.Errorf("Текст %q, want ответ", s.result.Text)
+	}
+
+	s.logUnknown()
+	output := log.String()
+	for _, want := range []string{"level=DEBUG", "object=thread.run.step.delta count=2", "object=thread.created count=1"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("В журнале нет %q:\n%s", want, output)
+		}
+	}
+}
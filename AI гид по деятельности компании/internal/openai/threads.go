@@ -0,0 +1,238 @@
+package openai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Создаёт поток с начальными сообщениями и подключённым хранилищем файлов
+func (c *Client) CreateThread(ctx context.Context, messages []map[string]interface{}, vectorStoreID string) (string, error) {
+	requestBody := map[string]interface{}{
+		"messages": messages,
+	}
+	if vectorStoreID != "" {
+		requestBody["tool_resources"] = fileSearchResources(vectorStoreID)
+	}
+
+	reqBody, err := json.Marshal(requestBody)
+	if err != nil {
+		return "", fmt.Errorf("Ошибка создания тела запроса: %v", err)
+	}
+
+	req, err := c.newRequest(ctx, "POST", "threads", bytes.NewBuffer(reqBody))
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		c.logger(ctx).Error("Ошибка создания потока", "status_code", resp.StatusCode, "body", string(body))
+		return "", newAPIError(resp.StatusCode, body)
+	}
+
+	var result map[string]interface{}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", err
+	}
+
+	threadID, ok := getString(result, "id")
+	if !ok {
+		return "", fmt.Errorf("Не удалось получить ID потока")
+	}
+
+	c.logger(ctx).Debug("Поток создан", "thread_id", threadID)
+	return threadID, nil
+}
+
+// Файл, приложенный к одному сообщению, и инструменты, которым он доступен.
+// В отличие от файлов Vector Store ассистента, он виден только в потоке этого сообщения.
+type Attachment struct {
+	FileID string `json:"file_id"`
+	Tools  []Tool `json:"tools"`
+}
+
+// Возвращает вложение, по которому ассистент может искать инструментом file_search
+func FileSearchAttachment(fileID string) Attachment {
+	return Attachment{FileID: fileID, Tools: []Tool{{Type: "file_search"}}}
+}
+
+// Добавляет сообщение в существующий поток
+// content — строка или массив частей сообщения (текст и изображения), attachments — файлы сообщения
+func (c *Client) AddThreadMessage(ctx context.Context, threadID, role string, content interface{}, attachments []Attachment) error {
+	message := map[string]interface{}{
+		"role":    role,
+		"content": content,
+	}
+	if len(attachments) > 0 {
+		message["attachments"] = attachments
+	}
+	reqBody, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("Ошибка создания тела запроса: %v", err)
+	}
+
+	req, err := c.newRequest(ctx, "POST", BuildURL("threads", threadID, "messages"), bytes.NewBuffer(reqBody))
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		c.logger(ctx).Error("Ошибка добавления сообщения в поток", "thread_id", threadID, "status_code", resp.StatusCode, "body", string(body))
+		return newAPIError(resp.StatusCode, body)
+	}
+	return nil
+}
+
+// Сообщение потока
+type ThreadMessage struct {
+	ID        string
+	Role      string
+	CreatedAt int64
+	// Текстовые части сообщения, соединённые в одну строку
+	Text string
+}
+
+// Возвращает все сообщения потока от первого к последнему, запрашивая их страницами
+func (c *Client) ListThreadMessages(ctx context.Context, threadID string) ([]ThreadMessage, error) {
+	var messages []ThreadMessage
+	after := ""
+	for {
+		req, err := c.newRequest(ctx, "GET", BuildURL("threads", threadID, "messages"), nil)
+		if err != nil {
+			return nil, err
+		}
+		query := req.URL.Query()
+		query.Set("limit", "100")
+		query.Set("order", "asc")
+		if after != "" {
+			query.Set("after", after)
+		}
+		req.URL.RawQuery = query.Encode()
+
+		resp, err := c.do(req)
+		if err != nil {
+			return nil, err
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			c.logger(ctx).Error("Ошибка получения сообщений потока", "thread_id", threadID, "status_code", resp.StatusCode, "body", string(body))
+			return nil, newAPIError(resp.StatusCode, body)
+		}
+
+		var page struct {
+			Data []struct {
+				ID        string `json:"id"`
+				Role      string `json:"role"`
+				CreatedAt int64  `json:"created_at"`
+				Content   []struct {
+					Type string `json:"type"`
+					Text struct {
+						Value string `json:"value"`
+					} `json:"text"`
+				} `json:"content"`
+			} `json:"data"`
+			HasMore bool   `json:"has_more"`
+			LastID  string `json:"last_id"`
+		}
+		if err := json.Unmarshal(body, &page); err != nil {
+			return nil, err
+		}
+		for _, m := range page.Data {
+			var parts []string
+			for _, part := range m.Content {
+				if part.Type == "text" {
+					parts = append(parts, part.Text.Value)
+				}
+			}
+			messages = append(messages, ThreadMessage{ID: m.ID, Role: m.Role, CreatedAt: m.CreatedAt, Text: strings.Join(parts, "\n\n")})
+		}
+
+		if !page.HasMore || page.LastID == "" {
+			return messages, nil
+		}
+		after = page.LastID
+	}
+}
+
+// Удаляет поток вместе с его сообщениями
+func (c *Client) DeleteThread(ctx context.Context, threadID string) error {
+	req, err := c.newRequest(ctx, "DELETE", BuildURL("threads", threadID), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return newAPIError(resp.StatusCode, body)
+	}
+
+	c.logger(ctx).Debug("Поток удалён", "thread_id", threadID)
+	return nil
+}
+
+// Отменяет запуск ассистента на стороне API. Запуск, который уже завершился, отменить нельзя,
+// API отвечает на это ошибкой 400
+func (c *Client) CancelRun(ctx context.Context, threadID, runID string) error {
+	req, err := c.newRequest(ctx, "POST", BuildURL("threads", threadID, "runs", runID, "cancel"), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return newAPIError(resp.StatusCode, body)
+	}
+
+	c.logger(ctx).Debug("Запуск отменён", "thread_id", threadID, "run_id", runID)
+	return nil
+}
@@ -0,0 +1,177 @@
+package openai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+type VectorStoreCreateResponse struct {
+	ID string `json:"id"`
+}
+
+// Создаёт пустой Vector Store и возвращает его ID
+func (c *Client) CreateVectorStore(ctx context.Context) (string, error) {
+	req, err := c.newRequest(ctx, "POST", "vector_stores", nil)
+	if err != nil {
+		return "", err
+	}
+
+	c.logger(ctx).Debug("Создание Vector Store", "url", req.URL)
+
+	resp, err := c.do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	c.logger(ctx).Debug("Получен ответ при создании Vector Store", "body", string(body))
+
+	if resp.StatusCode != http.StatusOK {
+		return "", newAPIError(resp.StatusCode, body)
+	}
+
+	var vectorStoreResponse VectorStoreCreateResponse
+	if err := json.Unmarshal(body, &vectorStoreResponse); err != nil {
+		return "", err
+	}
+
+	c.logger(ctx).Info("Vector Store создан", "vector_store_id", vectorStoreResponse.ID)
+	return vectorStoreResponse.ID, nil
+}
+
+// Регистрирует загруженный файл в Vector Store
+func (c *Client) AddFileToVectorStore(ctx context.Context, vectorStoreID, fileID string) error {
+	requestBody := map[string]string{
+		"file_id": fileID,
+	}
+
+	reqBody, err := json.Marshal(requestBody)
+	if err != nil {
+		return fmt.Errorf("Ошибка формирования тела запроса для регистрации файла: %v", err)
+	}
+
+	req, err := c.newRequest(ctx, "POST", BuildURL("vector_stores", vectorStoreID, "files"), bytes.NewBuffer(reqBody))
+	if err != nil {
+		return err
+	}
+
+	c.logger(ctx).Debug("Регистрация файла в Vector Store", "vector_store_id", vectorStoreID, "file_id", fileID)
+
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		c.logger(ctx).Error("Ошибка регистрации файла", "status_code", resp.StatusCode, "body", string(body))
+		return newAPIError(resp.StatusCode, body)
+	}
+
+	c.logger(ctx).Info("Файл успешно зарегистрирован в Vector Store", "file_id", fileID)
+	return nil
+}
+
+// Файл Vector Store и состояние его обработки
+type VectorStoreFile struct {
+	ID string `json:"id"`
+	// in_progress, completed, cancelled или failed
+	Status     string `json:"status"`
+	UsageBytes int64  `json:"usage_bytes"`
+	CreatedAt  int64  `json:"created_at"`
+	// Причина ошибки обработки для файлов со статусом failed
+	LastError *FileError `json:"last_error"`
+}
+
+// Ошибка обработки файла
+type FileError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Возвращает все файлы Vector Store, запрашивая их страницами
+func (c *Client) ListVectorStoreFiles(ctx context.Context, vectorStoreID string) ([]VectorStoreFile, error) {
+	var files []VectorStoreFile
+	after := ""
+	for {
+		req, err := c.newRequest(ctx, "GET", BuildURL("vector_stores", vectorStoreID, "files"), nil)
+		if err != nil {
+			return nil, err
+		}
+		query := req.URL.Query()
+		query.Set("limit", "100")
+		if after != "" {
+			query.Set("after", after)
+		}
+		req.URL.RawQuery = query.Encode()
+
+		resp, err := c.do(req)
+		if err != nil {
+			return nil, err
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			c.logger(ctx).Error("Ошибка получения списка файлов Vector Store", "vector_store_id", vectorStoreID, "status_code", resp.StatusCode, "body", string(body))
+			return nil, newAPIError(resp.StatusCode, body)
+		}
+
+		var page struct {
+			Data    []VectorStoreFile `json:"data"`
+			HasMore bool              `json:"has_more"`
+			LastID  string            `json:"last_id"`
+		}
+		if err := json.Unmarshal(body, &page); err != nil {
+			return nil, err
+		}
+		files = append(files, page.Data...)
+
+		if !page.HasMore || page.LastID == "" {
+			return files, nil
+		}
+		after = page.LastID
+	}
+}
+
+// Убирает файл из Vector Store. Сам загруженный файл при этом не удаляется.
+func (c *Client) RemoveFileFromVectorStore(ctx context.Context, vectorStoreID, fileID string) error {
+	req, err := c.newRequest(ctx, "DELETE", BuildURL("vector_stores", vectorStoreID, "files", fileID), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		c.logger(ctx).Error("Ошибка удаления файла из Vector Store", "vector_store_id", vectorStoreID, "file_id", fileID, "status_code", resp.StatusCode, "body", string(body))
+		return newAPIError(resp.StatusCode, body)
+	}
+
+	c.logger(ctx).Info("Файл удалён из Vector Store", "vector_store_id", vectorStoreID, "file_id", fileID)
+	return nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Флаг /kb_remove, при котором файл убирается из Vector Store, но остаётся в хранилище файлов API
+const kbRemoveKeepFlag = "--keep-file"
+
+// /kb_remove <имя файла> [--keep-file] — удаляет файл базы знаний по имени без выбора из списка.
+// ID файла берётся из списка загруженных из источника файлов, а если его там нет — из Vector Store.
+// Файл, который остался в источнике, вернётся при следующей синхронизации базы знаний.
+func handleKBRemoveCommand(b *botInstance, message *tgbotapi.Message) {
+	lang := userLanguage(b, message.From)
+	if !isAdmin(message.From.ID) {
+		sendMessage(b, tgbotapi.NewMessage(message.Chat.ID, t(lang, "common.admin_only")))
+		return
+	}
+	if b.vectorStoreID == "" {
+		sendMessage(b, tgbotapi.NewMessage(message.Chat.ID, t(lang, "list_files.no_store")))
+		return
+	}
+
+	name := commandArgs(message)
+	name, keepFile := strings.CutSuffix(name, kbRemoveKeepFlag)
+	name = strings.TrimSpace(name)
+	if name == "" {
+		sendMessage(b, tgbotapi.NewMessage(message.Chat.ID, t(lang, "kb_remove.usage")))
+		return
+	}
+
+	ctx := newRequestContext()
+	log := requestLog(ctx, b.log)
+	var fileIDs []string
+	if fileID, ok := b.kbSync.idByName(name); ok {
+		fileIDs = append(fileIDs, fileID)
+	} else {
+		files, err := loadKnowledgeFiles(ctx, b)
+		if err != nil {
+			log.Error("Ошибка получения списка файлов базы знаний", "error", err)
+			sendMessage(b, tgbotapi.NewMessage(message.Chat.ID, t(lang, "list_files.failed")))
+			return
+		}
+		for _, file := range files {
+			if file.Name == name {
+				fileIDs = append(fileIDs, file.ID)
+			}
+		}
+	}
+	if len(fileIDs) == 0 {
+		sendMessage(b, tgbotapi.NewMessage(message.Chat.ID, t(lang, "kb_remove.not_found", name)))
+		return
+	}
+
+	for _, fileID := range fileIDs {
+		// Файл, который сейчас удаляется через /delete_file, второй раз не удаляется
+		if !b.kbFiles.beginDelete(fileID) {
+			continue
+		}
+		err := removeKnowledgeFile(ctx, b, fileID, !keepFile)
+		b.kbFiles.endDelete(fileID, err == nil)
+		if err != nil {
+			log.Error("Ошибка удаления файла базы знаний", "admin_id", message.From.ID, "file_id", fileID, "error", err)
+			sendMessage(b, tgbotapi.NewMessage(message.Chat.ID, t(lang, "delete_file.failed")))
+			return
+		}
+		log.Info("Файл удалён из базы знаний", "admin_id", message.From.ID, "file_id", fileID, "file_name", name, "keep_file", keepFile)
+	}
+
+	reply := t(lang, "delete_file.done", name)
+	if keepFile {
+		reply = t(lang, "kb_remove.done_kept", name)
+	}
+	sendMessage(b, tgbotapi.NewMessage(message.Chat.ID, reply))
+}
+
+// Возвращает ID файла, загруженного из источника под этим именем
+func (k *knowledgeSync) idByName(name string) (string, bool) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	file, ok := k.files[name]
+	return file.ID, ok
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Расписание из resync_schedule. nil — синхронизация по расписанию выключена
+var resyncSchedule schedule
+
+// Синхронизация уже выполняется, повторный запуск пропущен
+var errSyncInProgress = errors.New("синхронизация базы знаний уже выполняется")
+
+// Файл базы знаний, загруженный из источника
+type syncedFile struct {
+	ID string `json:"id"`
+	// SHA-256 содержимого: файл загружается заново, только если оно изменилось
+	Hash string `json:"hash"`
+	// Версия из источника, с которой файл загружен
+	Version string `json:"version,omitempty"`
+}
+
+// knowledgeSync — файлы источника, загруженные в Vector Store бота, по имени в источнике.
+// Каждое изменение сохраняется в файле состояния, поэтому после перезапуска загружаются
+// только файлы, изменённые в источнике.
+type knowledgeSync struct {
+	mu sync.Mutex
+	// Имя бота, под которым список сохраняется в state.Knowledge
+	bot           string
+	vectorStoreID string
+	files         map[string]syncedFile
+	running       atomic.Bool
+}
+
+// Заменяет Vector Store и список загруженных в него файлов, например после загрузки при запуске
+func (k *knowledgeSync) reset(vectorStoreID string, files map[string]syncedFile) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.vectorStoreID, k.files = vectorStoreID, files
+	return k.saveLocked()
+}
+
+// Убирает файл, удалённый из Vector Store, чтобы следующая синхронизация загрузила его снова
+func (k *knowledgeSync) forget(fileID string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	found := false
+	for name, file := range k.files {
+		if file.ID == fileID {
+			delete(k.files, name)
+			found = true
+		}
+	}
+	if !found {
+		return nil
+	}
+	return k.saveLocked()
+}
+
+func (k *knowledgeSync) snapshot() map[string]syncedFile {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return maps.Clone(k.files)
+}
+
+func (k *knowledgeSync) set(name string, file syncedFile) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.files == nil {
+		k.files = make(map[string]syncedFile)
+	}
+	k.files[name] = file
+	return k.saveLocked()
+}
+
+func (k *knowledgeSync) remove(name string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	delete(k.files, name)
+	return k.saveLocked()
+}
+
+// Сохраняет Vector Store и список файлов в файле состояния
+func (k *knowledgeSync) saveLocked() error {
+	return saveKnowledge(k.bot, savedKnowledge{VectorStoreID: k.vectorStoreID, Files: maps.Clone(k.files)})
+}
+
+// Итог синхронизации базы знаний
+type syncReport struct {
+	Added, Updated, Removed, Unchanged int
+	Failed                             []fileUploadError
+}
+
+func (r syncReport) String() string {
+	s := fmt.Sprintf("добавлено %d, обновлено %d, удалено %d, без изменений %d", r.Added, r.Updated, r.Removed, r.Unchanged)
+	if len(r.Failed) == 0 {
+		return s
+	}
+	return fmt.Sprintf("%s, с ошибкой: %s", s, failedNames(r.Failed))
+}
+
+func failedNames(failed []fileUploadError) string {
+	names := make([]string, len(failed))
+	for i, f := range failed {
+		names[i] = f.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+// Приводит Vector Store бота в соответствие с источником файлов: загружает новые и изменённые
+// файлы и удаляет файлы, которых в источнике больше нет. Неизменённые файлы только читаются
+// для подсчёта хэша, а файлы с прежней версией из источника не читаются вовсе. Ошибка отдельного файла не прерывает синхронизацию, прежняя версия
+// такого файла остаётся в базе знаний.
+func syncKnowledgeBase(ctx context.Context, b *botInstance) (report syncReport, err error) {
+	if b.vectorStoreID == "" {
+		return report, fmt.Errorf("У бота нет Vector Store: база знаний при запуске была пуста, для загрузки файлов бота нужно перезапустить")
+	}
+	if !b.kbSync.running.CompareAndSwap(false, true) {
+		return report, errSyncInProgress
+	}
+	defer b.kbSync.running.Store(false)
+	b.setResyncing(true)
+	defer b.setResyncing(false)
+
+	files, err := b.source.List(ctx)
+	if err != nil {
+		return report, fmt.Errorf("Ошибка получения списка файлов: %v", err)
+	}
+
+	synced := b.kbSync.snapshot()
+	listed := make(map[string]bool, len(files))
+	for _, file := range files {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		listed[file.Name] = true
+		old, exists := synced[file.Name]
+		if exists && file.Version != "" && old.Version == file.Version {
+			report.Unchanged++
+			continue
+		}
+
+		hash, err := hashSourceFile(ctx, b.source, file.Name)
+		if err != nil {
+			report.Failed = append(report.Failed, fileUploadError{Name: file.Name, Err: err})
+			continue
+		}
+		if exists && old.Hash == hash {
+			report.Unchanged++
+			// Версия запоминается, чтобы в следующий раз файл не читался
+			if old.Version != file.Version {
+				old.Version = file.Version
+				if err := b.kbSync.set(file.Name, old); err != nil {
+					b.log.Warn("Не удалось сохранить базу знаний в файле состояния", "file_name", file.Name, "error", err)
+				}
+			}
+			continue
+		}
+
+		fileID, hash, err := uploadSourceFile(ctx, b.api, b.log, b.source, file.Name, hash)
+		if err == nil {
+			err = b.api.AddFileToVectorStore(ctx, b.vectorStoreID, fileID)
+			if err != nil {
+				b.api.DeleteFile(ctx, fileID)
+				forgetUpload(fileID)
+			}
+		}
+		if err != nil {
+			b.log.Error("Ошибка загрузки файла при синхронизации", "file_name", file.Name, "error", err)
+			report.Failed = append(report.Failed, fileUploadError{Name: file.Name, Err: err})
+			continue
+		}
+		if err := b.kbSync.set(file.Name, syncedFile{ID: fileID, Hash: hash, Version: file.Version}); err != nil {
+			b.log.Warn("Не удалось сохранить базу знаний в файле состояния", "file_name", file.Name, "error", err)
+		}
+
+		if !exists {
+			report.Added++
+			continue
+		}
+		report.Updated++
+		if err := deleteKnowledgeFile(ctx, b, old.ID); err != nil {
+			b.log.Warn("Не удалось удалить прежнюю версию файла", "file_name", file.Name, "file_id", old.ID, "error", err)
+		}
+	}
+
+	for name, old := range synced {
+		if listed[name] {
+			continue
+		}
+		if err := deleteKnowledgeFile(ctx, b, old.ID); err != nil {
+			b.log.Error("Ошибка удаления файла при синхронизации", "file_name", name, "error", err)
+			report.Failed = append(report.Failed, fileUploadError{Name: name, Err: err})
+			continue
+		}
+		if err := b.kbSync.remove(name); err != nil {
+			b.log.Warn("Не удалось сохранить базу знаний в файле состояния", "file_name", name, "error", err)
+		}
+		report.Removed++
+	}
+
+	// Список /list_files запрашивается заново
+	b.kbFiles.mu.Lock()
+	b.kbFiles.fetchedAt = time.Time{}
+	b.kbFiles.mu.Unlock()
+	return report, nil
+}
+
+// Переиспользует Vector Store бота, сохранённый в файле состояния: загружаются только файлы,
+// изменённые в источнике с прошлого запуска. Возвращает false, если сохранённого Vector Store
+// нет или он удалён на стороне API, — тогда создаётся новый.
+func reuseKnowledgeBase(ctx context.Context, b *botInstance) (report uploadReport, ok bool, err error) {
+	saved, exists := savedKnowledgeFor(b.cfg.Name)
+	if !exists || saved.VectorStoreID == "" {
+		return report, false, nil
+	}
+	storeFiles, err := b.api.ListVectorStoreFiles(ctx, saved.VectorStoreID)
+	if isNotFound(err) {
+		b.log.Warn("Сохранённый Vector Store не найден, будет создан новый", "vector_store_id", saved.VectorStoreID)
+		return report, false, nil
+	}
+	if err != nil {
+		return report, false, fmt.Errorf("Ошибка получения файлов сохранённого Vector Store: %v", err)
+	}
+
+	// Файлы, которых в Vector Store уже нет, синхронизация загрузит заново
+	present := make(map[string]bool, len(storeFiles))
+	for _, file := range storeFiles {
+		present[file.ID] = true
+	}
+	files := make(map[string]syncedFile, len(saved.Files))
+	for name, file := range saved.Files {
+		if present[file.ID] {
+			files[name] = file
+		}
+	}
+	b.vectorStoreID = saved.VectorStoreID
+	if err := b.kbSync.reset(saved.VectorStoreID, files); err != nil {
+		b.log.Warn("Не удалось сохранить базу знаний в файле состояния", "error", err)
+	}
+
+	synced, err := syncKnowledgeBase(ctx, b)
+	if err != nil {
+		return report, false, err
+	}
+	b.log.Info("Используется сохранённый Vector Store: "+synced.String(), "vector_store_id", saved.VectorStoreID)
+
+	report.Files = b.kbSync.snapshot()
+	report.Uploaded = len(report.Files)
+	report.Total = report.Uploaded
+	for _, failed := range synced.Failed {
+		report.Failed = append(report.Failed, failed)
+		// Прежняя версия файла с ошибкой остаётся в базе знаний и уже посчитана
+		if _, ok := report.Files[failed.Name]; !ok {
+			report.Total++
+		}
+	}
+	return report, true, nil
+}
+
+// Возвращает хэш SHA-256 содержимого файла источника
+func hashSourceFile(ctx context.Context, source FileSource, name string) (string, error) {
+	r, err := source.Open(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Запускает синхронизацию базы знаний по расписанию resync_schedule. Запуск пропускается,
+// если предыдущая синхронизация ещё не завершилась. Возвращает функцию остановки, которая
+// прерывает текущую синхронизацию и дожидается её завершения.
+func startKnowledgeResync(b *botInstance, sched schedule) func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			next := sched.Next(time.Now())
+			if next.IsZero() {
+				b.log.Warn("Расписание синхронизации базы знаний не содержит будущих запусков")
+				return
+			}
+			b.log.Info("Следующая синхронизация базы знаний", "at", next.Format(time.DateTime))
+
+			timer := time.NewTimer(time.Until(next))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				runScheduledResync(ctx, b)
+			}()
+		}
+	}()
+
+	return func() {
+		cancel()
+		wg.Wait()
+	}
+}
+
+// Выполняет синхронизацию по расписанию и сообщает итог в resync_report_chat_id
+func runScheduledResync(ctx context.Context, b *botInstance) {
+	start := time.Now()
+	report, err := syncKnowledgeBase(ctx, b)
+	lang := config.DefaultLanguage
+
+	var text string
+	switch {
+	case errors.Is(err, errSyncInProgress):
+		b.log.Warn("Синхронизация базы знаний пропущена: предыдущая ещё выполняется")
+		return
+	case ctx.Err() != nil:
+		b.log.Info("Синхронизация базы знаний прервана при остановке")
+		return
+	case err != nil:
+		b.log.Error("Ошибка синхронизации базы знаний", "error", err)
+		text = t(lang, "resync.failed", err)
+	default:
+		b.log.Info("База знаний синхронизирована: "+report.String(), "duration", time.Since(start).Round(time.Millisecond))
+		text = t(lang, "resync.done", report.Added, report.Updated, report.Removed, report.Unchanged)
+		if len(report.Failed) > 0 {
+			text += "\n" + t(lang, "resync.failed_files", failedNames(report.Failed))
+		}
+	}
+
+	if config.ResyncReportChatID != 0 {
+		if err := sendMessage(b, tgbotapi.NewMessage(config.ResyncReportChatID, text)); err != nil {
+			b.log.Error("Ошибка отправки итога синхронизации", "chat_id", config.ResyncReportChatID, "error", err)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	// Данные кнопок листания списка файлов: префикс и номер страницы
+	listFilesCallbackPrefix = "files:"
+	listFilesPageSize       = 10
+	// Сведения о файлах переиспользуются при листании, чтобы не запрашивать их для каждой страницы
+	listFilesCacheTTL = time.Minute
+)
+
+// Файл базы знаний для /list_files
+type knowledgeFile struct {
+	ID        string
+	Name      string
+	Size      int64
+	Status    string
+	CreatedAt time.Time
+	// Причина ошибки обработки файла со статусом failed
+	LastError string
+}
+
+// Недавно полученный список файлов Vector Store бота
+type knowledgeFilesCache struct {
+	mu            sync.Mutex
+	vectorStoreID string
+	files         []knowledgeFile
+	fetchedAt     time.Time
+	// Файлы, которые удаляются сейчас командой /delete_file
+	deleting map[string]bool
+}
+
+// Возвращает файлы Vector Store бота с именами, отсортированные по имени.
+// Имя каждого файла запрашивается отдельно, поэтому список кэшируется на listFilesCacheTTL.
+func loadKnowledgeFiles(ctx context.Context, b *botInstance) ([]knowledgeFile, error) {
+	cache := &b.kbFiles
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if cache.vectorStoreID == b.vectorStoreID && time.Since(cache.fetchedAt) < listFilesCacheTTL {
+		return cache.files, nil
+	}
+
+	storeFiles, err := b.api.ListVectorStoreFiles(ctx, b.vectorStoreID)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]knowledgeFile, 0, len(storeFiles))
+	for _, f := range storeFiles {
+		file := knowledgeFile{
+			ID:        f.ID,
+			Name:      f.ID,
+			Size:      f.UsageBytes,
+			Status:    f.Status,
+			CreatedAt: time.Unix(f.CreatedAt, 0),
+		}
+		if f.LastError != nil {
+			file.LastError = f.LastError.Message
+		}
+		// Без имени файл всё равно показывается, по его ID
+		if info, err := b.api.GetFile(ctx, f.ID); err != nil {
+			requestLog(ctx, b.log).Warn("Не удалось получить имя файла", "file_id", f.ID, "error", err)
+		} else {
+			file.Name = info.Filename
+			if file.Size == 0 {
+				file.Size = info.Bytes
+			}
+		}
+		files = append(files, file)
+	}
+	slices.SortFunc(files, func(a, b knowledgeFile) int { return strings.Compare(a.Name, b.Name) })
+
+	cache.vectorStoreID = b.vectorStoreID
+	cache.files = files
+	cache.fetchedAt = time.Now()
+	return files, nil
+}
+
+// Формирует страницу списка файлов. page начинается с 0 и ограничивается количеством страниц.
+// Возвращает текст страницы, показанные на ней файлы и кнопки перехода к соседним страницам
+// с данными вида prefix и номер страницы.
+func knowledgeFilesPage(lang string, files []knowledgeFile, page int, prefix string) (string, []knowledgeFile, []tgbotapi.InlineKeyboardButton) {
+	pages := max(1, (len(files)+listFilesPageSize-1)/listFilesPageSize)
+	page = max(0, min(page, pages-1))
+
+	failed := 0
+	for _, file := range files {
+		if file.Status == "failed" {
+			failed++
+		}
+	}
+
+	var text strings.Builder
+	text.WriteString(t(lang, "list_files.header", len(files), failed, page+1, pages))
+	start := page * listFilesPageSize
+	shown := files[start:min(start+listFilesPageSize, len(files))]
+	for i, file := range shown {
+		mark := ""
+		if file.Status == "failed" {
+			mark = "⚠️ "
+		}
+		fmt.Fprintf(&text, "\n\n%s%d. %s\n%s, %s, %s", mark, start+i+1, file.Name,
+			formatFileSize(lang, file.Size), knowledgeFileStatus(lang, file.Status), file.CreatedAt.Format("02.01.2006 15:04"))
+		if file.LastError != "" {
+			text.WriteString("\n" + t(lang, "list_files.last_error", file.LastError))
+		}
+	}
+
+	var nav []tgbotapi.InlineKeyboardButton
+	if page > 0 {
+		nav = append(nav, tgbotapi.NewInlineKeyboardButtonData("◀", prefix+strconv.Itoa(page-1)))
+	}
+	if page < pages-1 {
+		nav = append(nav, tgbotapi.NewInlineKeyboardButtonData("▶", prefix+strconv.Itoa(page+1)))
+	}
+	return text.String(), shown, nav
+}
+
+// Возвращает название состояния обработки файла на языке пользователя
+func knowledgeFileStatus(lang, status string) string {
+	switch status {
+	case "completed", "in_progress", "failed", "cancelled":
+		return t(lang, "list_files.status_"+status)
+	}
+	return status
+}
+
+// Возвращает размер файла в байтах, КБ или МБ на языке пользователя
+func formatFileSize(lang string, size int64) string {
+	switch {
+	case size >= 1<<20:
+		return t(lang, "list_files.size_mb", float64(size)/(1<<20))
+	case size >= 1<<10:
+		return t(lang, "list_files.size_kb", float64(size)/(1<<10))
+	}
+	return t(lang, "list_files.size_bytes", size)
+}
+
+// /list_files — показывает администратору файлы Vector Store бота с их состоянием
+func handleListFilesCommand(b *botInstance, message *tgbotapi.Message) {
+	lang := userLanguage(b, message.From)
+	if !isAdmin(message.From.ID) {
+		sendMessage(b, tgbotapi.NewMessage(message.Chat.ID, t(lang, "common.admin_only")))
+		return
+	}
+	if b.vectorStoreID == "" {
+		sendMessage(b, tgbotapi.NewMessage(message.Chat.ID, t(lang, "list_files.no_store")))
+		return
+	}
+
+	ctx := newRequestContext()
+	files, err := loadKnowledgeFiles(ctx, b)
+	if err != nil {
+		requestLog(ctx, b.log).Error("Ошибка получения списка файлов базы знаний", "error", err)
+		sendMessage(b, tgbotapi.NewMessage(message.Chat.ID, t(lang, "list_files.failed")))
+		return
+	}
+	if len(files) == 0 {
+		sendMessage(b, tgbotapi.NewMessage(message.Chat.ID, t(lang, "list_files.empty")))
+		return
+	}
+
+	text, _, nav := knowledgeFilesPage(lang, files, 0, listFilesCallbackPrefix)
+	msg := tgbotapi.NewMessage(message.Chat.ID, text)
+	if len(nav) > 0 {
+		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(nav)
+	}
+	sendMessage(b, msg)
+}
+
+// Обрабатывает кнопки листания списка файлов
+func handleListFilesCallback(b *botInstance, query *tgbotapi.CallbackQuery) {
+	lang := userLanguage(b, query.From)
+	page, err := strconv.Atoi(strings.TrimPrefix(query.Data, listFilesCallbackPrefix))
+	if err != nil || !isAdmin(query.From.ID) || b.vectorStoreID == "" {
+		b.sender.Request(tgbotapi.NewCallback(query.ID, ""))
+		return
+	}
+
+	ctx := newRequestContext()
+	files, err := loadKnowledgeFiles(ctx, b)
+	if err != nil || len(files) == 0 {
+		if err != nil {
+			requestLog(ctx, b.log).Error("Ошибка получения списка файлов базы знаний", "error", err)
+		}
+		b.sender.Request(tgbotapi.NewCallback(query.ID, t(lang, "list_files.failed")))
+		return
+	}
+
+	b.sender.Request(tgbotapi.NewCallback(query.ID, ""))
+	text, _, nav := knowledgeFilesPage(lang, files, page, listFilesCallbackPrefix)
+	edit := tgbotapi.NewEditMessageText(query.Message.Chat.ID, query.Message.MessageID, text)
+	if len(nav) > 0 {
+		markup := tgbotapi.NewInlineKeyboardMarkup(nav)
+		edit.ReplyMarkup = &markup
+	}
+	b.sender.Request(edit)
+}
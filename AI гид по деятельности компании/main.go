@@ -1,47 +1,290 @@
 package main
 
 import (
-	"bufio"
-	"bytes"
-	"encoding/json"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
-	"mime/multipart"
-	"net/http"
+	"math"
 	"os"
-	"path/filepath"
+	"os/signal"
+	"slices"
 	"strings"
-	"sync"
+	"syscall"
+	"time"
+	"unicode/utf8"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	yaml "gopkg.in/yaml.v2"
 
 	"log/slog"
+
+	"proxyapi-bot/internal/openai"
 )
 
 // Структура для хранения настроек из config.yaml
 type Config struct {
-	ApiURL             string   `yaml:"api_url"`
-	APIKey             string   `yaml:"api_key"`
-	TelegramBotToken   string   `yaml:"telegram_bot_token"`
-	FilesPath          string   `yaml:"files_path"`
+	ApiURL           string `yaml:"api_url"`
+	APIKey           string `yaml:"api_key"`
+	TelegramBotToken string `yaml:"telegram_bot_token"`
+	FilesPath        string `yaml:"files_path"`
+	// Поставщик API: openai (по умолчанию) или azure. Для Azure OpenAI api_url указывает на
+	// https://<ресурс>.openai.azure.com/openai/, а вместо модели ассистента используется azure_deployment.
+	Provider        string `yaml:"provider"`
+	AzureAPIVersion string `yaml:"azure_api_version"`
+	AzureDeployment string `yaml:"azure_deployment"`
+	// Запускать бота, даже если ни один файл базы знаний не загружен: бот работает без поиска
+	// по документам и предупреждает об этом в журнале. По умолчанию запуск прерывается
+	AllowEmptyKnowledgeBase bool `yaml:"allow_empty_knowledge_base"`
+	// Источник файлов базы знаний вместо files_path: file://, http(s):// или s3://
+	FilesSource string `yaml:"files_source"`
+	// Адреса отдельных файлов базы знаний, которые скачиваются вдобавок к файлам источника.
+	// Скачивание ограничено по размеру и времени, у ответа проверяется тип содержимого.
+	FileURLs        []string      `yaml:"file_urls"`
+	FileURLMaxBytes int64         `yaml:"file_url_max_bytes"`
+	FileURLTimeout  time.Duration `yaml:"file_url_timeout"`
+	// Ограничение размера архива .zip и общего размера распакованных из него файлов
+	ArchiveMaxExtractedBytes int64 `yaml:"archive_max_extracted_bytes"`
+	// Расписание повторной синхронизации базы знаний с источником: интервал ("6h") или
+	// выражение cron ("0 3 * * *"). Пусто — файлы загружаются только при запуске.
+	ResyncSchedule string `yaml:"resync_schedule"`
+	// Чат, в который отправляется итог синхронизации по расписанию. 0 — только в журнал
+	ResyncReportChatID int64 `yaml:"resync_report_chat_id"`
+	// Адрес хранилища для files_source вида s3://. Пусто — Amazon S3
+	S3Endpoint string `yaml:"s3_endpoint"`
+	// Ключи доступа к бакету. Пусто — ключи из AWS_ACCESS_KEY_ID и AWS_SECRET_ACCESS_KEY,
+	// а без них анонимный доступ
+	S3Region           string   `yaml:"s3_region"`
+	S3AccessKeyID      string   `yaml:"s3_access_key_id"`
+	S3SecretAccessKey  string   `yaml:"s3_secret_access_key"`
 	Name               string   `yaml:"name"`
 	Instructions       string   `yaml:"instructions"`
 	Model              string   `yaml:"model"`
 	Tools              []string `yaml:"tools"`
 	MaxContextMessages int      `yaml:"max_context_messages"`
+	// Количество фрагментов, которые file_search возвращает модели (1–50). 0 — значение API по умолчанию.
+	// Больше фрагментов — полнее контекст, но дороже и дольше запуск.
+	FileSearchMaxResults int `yaml:"file_search_max_results"`
+	// Функции для инструмента function: имя, описание и JSON Schema аргументов
+	Functions []FunctionConfig `yaml:"functions"`
+	// Ограничение длины ответа в токенах. 0 — без ограничения.
+	// Модель может оборвать ответ при достижении лимита.
+	MaxCompletionTokens int `yaml:"max_completion_tokens"`
+	// Ограничение токенов контекста запуска. 0 — без ограничения, иначе не меньше 256 (минимум API).
+	MaxPromptTokens int `yaml:"max_prompt_tokens"`
+	// Какие сообщения потока попадают в контекст запуска: type "auto" или "last_messages"
+	// с last_messages. nil — решает API. В режиме потоков last_messages заменяет max_context_messages.
+	TruncationStrategy *openai.TruncationStrategy `yaml:"truncation_strategy"`
+	// Удалять потоки, которые больше не понадобятся: созданные API для запуска без потока
+	// и потоки, контекст которых сброшен командой /reset
+	DeleteUnusedThreads bool `yaml:"delete_unused_threads"`
+	// Пометка в конце обрезанного ответа. Пусто — текст из файлов локализации
+	TruncatedNotice string `yaml:"truncated_notice"`
+	// Температура генерации (0–2), по умолчанию 1.0
+	Temperature *float64 `yaml:"temperature"`
+	// Модели, которые можно выбрать командой /model, по псевдониму: fast: gpt-4o-mini.
+	// Администраторам и пользователям из model_switch_user_ids доступны все модели,
+	// остальным — псевдонимы из allowed_user_models. Модели из allowed_models доступны под
+	// собственным именем. Пусто — команда выключена.
+	Models             map[string]string `yaml:"models"`
+	AllowedUserModels  []string          `yaml:"allowed_user_models"`
+	AllowedModels      []string          `yaml:"allowed_models"`
+	ModelSwitchUserIDs []int64           `yaml:"model_switch_user_ids"`
+	// Ограничение частоты запросов одного пользователя, например "10/1m". Пусто — без ограничения.
+	UserRateLimit string `yaml:"user_rate_limit"`
+	// Время неактивности, после которого сессия пользователя удаляется
+	SessionTTL time.Duration `yaml:"session_ttl"`
+	// Способ получения обновлений Telegram: polling (по умолчанию) или webhook
+	UpdateMode         string `yaml:"update_mode"`
+	WebhookURL         string `yaml:"webhook_url"`
+	WebhookListenAddr  string `yaml:"webhook_listen_addr"`
+	WebhookCertFile    string `yaml:"webhook_cert_file"`
+	WebhookKeyFile     string `yaml:"webhook_key_file"`
+	WebhookSecretToken string `yaml:"webhook_secret_token"`
+	// Время ожидания новых обновлений одним запросом getUpdates в режиме polling
+	PollingTimeoutSeconds int `yaml:"polling_timeout_seconds"`
+	// Файл с ID последних обработанных обновлений. После перезапуска получение обновлений
+	// продолжается со следующего, пусто — с первого неподтверждённого самим Telegram
+	UpdateOffsetFile string `yaml:"update_offset_file"`
+	// Файл блокировки, не позволяющий запустить второй экземпляр бота на этой машине. Пусто — без блокировки.
+	LockFile string `yaml:"lock_file"`
+	// Управление доступом: пустые списки разрешённых означают доступ для всех
+	AllowedUserIDs      []int64 `yaml:"allowed_user_ids"`
+	BlockedUserIDs      []int64 `yaml:"blocked_user_ids"`
+	AllowedChatIDs      []int64 `yaml:"allowed_chat_ids"`
+	AccessDeniedMessage string  `yaml:"access_denied_message"` // Пусто — текст из файлов локализации
+	AdminIDs            []int64 `yaml:"admin_ids"`
+	// Контекст диалога в группах: "user" — свой у каждого участника, "shared" — общий на группу.
+	// При group_require_mention бот отвечает в группе только на упоминание, ответ на его сообщение и команды.
+	GroupContextMode    string `yaml:"group_context_mode"`
+	GroupRequireMention bool   `yaml:"group_require_mention"`
+	// Приветствие пользователю, который пишет боту впервые. Отправляется один раз до ответа на
+	// первое сообщение; в тексте подставляются {bot_name}, {first_name}, {username} и {date}.
+	SendWelcome    bool   `yaml:"send_welcome"`
+	WelcomeMessage string `yaml:"welcome_message"` // Пусто — текст из файлов локализации
+	// Чат операторов поддержки, которому /operator передаёт диалог пользователя. 0 — передача выключена.
+	// Вместе с запросом пересылаются последние handoff_transcript_messages сообщений диалога.
+	SupportChatID             int64 `yaml:"support_chat_id"`
+	HandoffTranscriptMessages int   `yaml:"handoff_transcript_messages"`
+	// Дневные лимиты: запусков и токенов на пользователя и токенов на всех ботов. 0 — без ограничения.
+	// Лимиты обнуляются в полночь по quota_timezone, администраторы им не подчиняются.
+	UserDailyRuns     int    `yaml:"user_daily_runs"`
+	UserDailyTokens   int64  `yaml:"user_daily_tokens"`
+	GlobalDailyTokens int64  `yaml:"global_daily_tokens"`
+	QuotaTimezone     string `yaml:"quota_timezone"`
+	// Цены моделей за 1000 токенов для оценки расхода. Дополняют и заменяют цены по умолчанию
+	ModelPrices   map[string]ModelPrice `yaml:"model_prices"`
+	SpendCurrency string                `yaml:"spend_currency"`
+	// Окна контекста моделей в токенах. Дополняют и заменяют встроенные значения
+	ModelContextLimits map[string]int `yaml:"model_context_limits"`
+	// Чат, в который после полуночи по quota_timezone отправляется расход за прошедший день. 0 — не отправляется
+	SpendReportChatID int64 `yaml:"spend_report_chat_id"`
+	// Тексты для всех языков при исчерпании лимита пользователя и общего бюджета. Пусто — из файлов локализации
+	QuotaExceededMessage string `yaml:"quota_exceeded_message"`
+	MaintenanceMessage   string `yaml:"maintenance_message"`
+	// Файл, в котором сохраняется состояние бота между перезапусками
+	StateFile string `yaml:"state_file"`
+	// Скорость рассылки /broadcast, сообщений в секунду
+	BroadcastRate int `yaml:"broadcast_rate"`
+	// Тексты ошибок, которые видит пользователь
+	Errors ErrorMessages `yaml:"errors"`
+	// Ответы длиннее этого количества символов отправляются документом. 0 — всегда текстом.
+	AnswerAsFileThreshold int `yaml:"answer_as_file_threshold"`
+	// Вывод кода code_interpreter не длиннее этого количества символов отправляется после ответа. 0 — не отправляется.
+	CodeOutputMaxChars int `yaml:"code_output_max_chars"`
+	// Наибольший размер файла code_interpreter, который скачивается и отправляется пользователю
+	CodeFileMaxBytes int64 `yaml:"code_file_max_bytes"`
+	// Журнал переписки в формате JSON Lines. Пусто — журнал не ведётся.
+	TranscriptPath     string `yaml:"transcript_path"`
+	TranscriptMaxBytes int64  `yaml:"transcript_max_bytes"`
+	// Адрес служебного HTTP-сервера с метриками Prometheus (/metrics) и проверками /healthz и /readyz.
+	// Пусто — сервер не запускается.
+	MetricsListenAddr string `yaml:"metrics_listen_addr"`
+	// Токен API администратора (/api/...) на служебном HTTP-сервере. Пусто — API выключено.
+	AdminAPIToken string `yaml:"admin_api_token"`
+	// Бот не готов, если getMe не выполнялся успешно дольше readiness_telegram_max_age или
+	// проверка связи с Telegram не удалась readiness_max_telegram_failures раз подряд.
+	// readiness_strict_resync делает бота неготовым на время синхронизации базы знаний.
+	ReadinessTelegramMaxAge      time.Duration `yaml:"readiness_telegram_max_age"`
+	ReadinessMaxTelegramFailures int           `yaml:"readiness_max_telegram_failures"`
+	ReadinessStrictResync        bool          `yaml:"readiness_strict_resync"`
+	// Журнал диалогов для аналитики: по строке JSON на каждый ответ, новый файл каждый день.
+	// Если задана соль, вместо ID пользователя записывается его хеш.
+	ConversationLogPath string `yaml:"conversation_log_path"`
+	ConversationLogSalt string `yaml:"conversation_log_salt"`
+	// Журнал оценок ответов командами /good и /bad. Пустой — оценки не собираются
+	FeedbackPath string `yaml:"feedback_path"`
+	// Пользователи, для которых потоки OpenAI создаются при запуске бота
+	PreloadUserIDs []int64 `yaml:"preload_user_ids"`
+	// Кэш ответов в начале диалога: время жизни записи в часах (0 — кэш отключён),
+	// максимальное количество записей и файл для сохранения между перезапусками
+	CacheTTLHours   int    `yaml:"cache_ttl_hours"`
+	CacheMaxEntries int    `yaml:"cache_max_entries"`
+	CachePath       string `yaml:"cache_path"`
+	// Сколько сообщений диалога может предшествовать вопросу, ответ на который кэшируется.
+	// 0 — кэшируются только ответы на первый вопрос
+	CacheContextMessages int `yaml:"cache_context_messages"`
+	// Автоматический выключатель: после breaker_threshold ошибок подряд за breaker_window
+	// запросы к ассистенту отклоняются на breaker_cooldown
+	BreakerThreshold int           `yaml:"breaker_threshold"`
+	BreakerWindow    time.Duration `yaml:"breaker_window"`
+	BreakerCooldown  time.Duration `yaml:"breaker_cooldown"`
+	// При исчерпании квоты ключа API сразу размыкать выключатель
+	QuotaOpenBreaker bool `yaml:"quota_open_breaker"`
+	// Голосовые ответы: off, voice_only или both (голос и текст)
+	TTSMode     string `yaml:"tts_mode"`
+	TTSModel    string `yaml:"tts_model"`
+	TTSVoice    string `yaml:"tts_voice"`
+	TTSMaxChars int    `yaml:"tts_max_chars"`
+	// Распознавание голосовых сообщений (API, совместимый с OpenAI Whisper).
+	// Пустой transcription_url означает api_url + "audio/transcriptions".
+	TranscriptionURL       string `yaml:"transcription_url"`
+	TranscriptionModel     string `yaml:"transcription_model"`
+	VoiceMaxDuration       int    `yaml:"voice_max_duration"`
+	VoiceMaxBytes          int64  `yaml:"voice_max_bytes"`
+	VoiceShowTranscription bool   `yaml:"voice_show_transcription"`
+	// Передавать ассистенту фотографии пользователей. Нужна модель с поддержкой изображений.
+	VisionEnabled bool  `yaml:"vision_enabled"`
+	PhotoMaxBytes int64 `yaml:"photo_max_bytes"`
+	// Отвечать на вопросы по документу, присланному с подписью /ask. Документ прикладывается
+	// только к этому вопросу и не добавляется в общую базу знаний.
+	DocumentQAEnabled bool  `yaml:"document_qa_enabled"`
+	DocumentMaxBytes  int64 `yaml:"document_max_bytes"`
+	// Одинаковые вопросы, пришедшие в пределах этого интервала, не обрабатываются повторно
+	DuplicateWindow time.Duration `yaml:"duplicate_window"`
+	// Максимальная длина вопроса в символах. Более длинный вопрос отклоняется до запросов к API
+	MaxInputChars int `yaml:"max_input_chars"`
+	// Количество одновременных запусков ассистента для всех ботов и длина очереди ожидающих запросов.
+	// При заполненной очереди пользователь получает сообщение errors.busy.
+	MaxConcurrentRuns int `yaml:"max_concurrent_runs"`
+	MaxQueuedRuns     int `yaml:"max_queued_runs"`
+	// Предлагать после ответа до трёх следующих вопросов кнопками.
+	// Варианты получает отдельный запрос к модели followup_model.
+	SuggestFollowups bool   `yaml:"suggest_followups"`
+	FollowupModel    string `yaml:"followup_model"`
+	// Маршрутизация вопросов: модель routing_model относит вопрос к одной из routing_categories,
+	// и на него отвечает она сама, ассистент или сообщение handoff_message о связи с сотрудником
+	RoutingEnabled    bool            `yaml:"routing_enabled"`
+	RoutingModel      string          `yaml:"routing_model"`
+	RoutingCategories []RouteCategory `yaml:"routing_categories"`
+	HandoffMessage    string          `yaml:"handoff_message"`
+	// Ограничения размера тела ответа API и ответа ассистента, собранного из потока, в байтах
+	MaxResponseBytes int64 `yaml:"max_response_bytes"`
+	MaxAnswerBytes   int   `yaml:"max_answer_bytes"`
+	// Максимальная длительность потока ответа ассистента в секундах
+	StreamTimeoutSeconds int `yaml:"stream_timeout_seconds"`
+	// Рассуждающие модели по префиксу имени: им не передаются temperature и top_p, можно задать
+	// reasoning_effort, а поток ответа ждётся до reasoning_stream_timeout_seconds
+	ReasoningModelPrefixes        []string `yaml:"reasoning_model_prefixes"`
+	ReasoningEffort               string   `yaml:"reasoning_effort"`
+	ReasoningStreamTimeoutSeconds int      `yaml:"reasoning_stream_timeout_seconds"`
+	// Дополнительные указания ко всем запускам ассистента. Пользователь может добавить свои командой /instruct
+	// длиной не более max_instructions_chars символов.
+	AdditionalInstructions string `yaml:"additional_instructions"`
+	MaxInstructionsChars   int    `yaml:"max_instructions_chars"`
+	// Сколько раз повторять запуск, если ассистент вернул пустой ответ
+	EmptyResponseRetries int `yaml:"empty_response_retries"`
+	// Повторять запуск один раз с указанием опираться на документы, если ответ пустой или
+	// совпадает с одним из refusal_patterns (регулярные выражения). Пустой список — шаблоны по умолчанию
+	RetryOnEmpty    bool     `yaml:"retry_on_empty"`
+	RefusalPatterns []string `yaml:"refusal_patterns"`
+	// Резервная модель для повтора запроса, если основная модель недоступна. Пусто — без повтора.
+	// fallback_notice добавляет к такому ответу пометку для пользователя.
+	FallbackModel  string `yaml:"fallback_model"`
+	FallbackNotice bool   `yaml:"fallback_notice"`
+	// Проверка вопросов через moderations до запуска ассистента. moderation_thresholds задаёт
+	// пороги оценок по категориям; если они не заданы, используется решение API.
+	ModerationEnabled    bool               `yaml:"moderation_enabled"`
+	ModerationModel      string             `yaml:"moderation_model"`
+	ModerationThresholds map[string]float64 `yaml:"moderation_thresholds"`
+	// Рассылка большему числу получателей требует подтверждения кнопкой
+	BroadcastConfirmThreshold int `yaml:"broadcast_confirm_threshold"`
+	// Язык сообщений по умолчанию и каталог с файлами локализации <язык>.yaml
+	DefaultLanguage string `yaml:"default_language"`
+	LocalesPath     string `yaml:"locales_path"`
+	// Несколько ботов в одном процессе. Если список пуст, используется единственный бот
+	// с настройками верхнего уровня (telegram_bot_token, name, instructions и т.д.)
+	Bots []BotConfig `yaml:"bots"`
 }
 
-type UserSession struct {
-	mu       sync.Mutex
-	Messages []map[string]interface{}
-}
+var config Config
 
-var (
-	config       Config
-	userSessions = make(map[int64]*UserSession)
-	sessionsMu   sync.RWMutex
-)
+// Наибольшее значение max_num_results, которое допускает API
+const maxFileSearchResults = 50
+
+// Наименьшее значение max_prompt_tokens, которое допускает API
+const minPromptTokens = 256
+
+// Проверяет max_prompt_tokens: 0 — без ограничения, иначе не меньше minPromptTokens
+func validateMaxPromptTokens(n int) error {
+	if n < 0 || (n > 0 && n < minPromptTokens) {
+		return fmt.Errorf("max_prompt_tokens должно быть 0 или не меньше %d, получено %d", minPromptTokens, n)
+	}
+	return nil
+}
 
 // Функция для чтения конфигурационного файла
 func loadConfig(configPath string) error {
@@ -50,7 +293,10 @@ func loadConfig(configPath string) error {
 		return fmt.Errorf("Ошибка чтения файла конфигурации: %v", err)
 	}
 
-	err = yaml.Unmarshal(data, &config)
+	// Конфигурация разбирается заново, без значений от предыдущей загрузки. Неизвестные поля
+	// считаются ошибкой, чтобы опечатка в названии не приводила к молчаливому значению по умолчанию
+	config = Config{}
+	err = yaml.UnmarshalStrict(data, &config)
 	if err != nil {
 		return fmt.Errorf("Ошибка разбора файла конфигурации: %v", err)
 	}
@@ -59,520 +305,1224 @@ func loadConfig(configPath string) error {
 		config.MaxContextMessages = 10 // Значение по умолчанию, если не задано или неверно
 	}
 
-	return nil
-}
-
-type AssistantCreateRequest struct {
-	Name         string `json:"name"`
-	Instructions string `json:"instructions"`
-	Model        string `json:"model"`
-	Tools        []Tool `json:"tools"`
-}
-
-type Tool struct {
-	Type string `json:"type"`
-}
+	switch config.Provider {
+	case "":
+		config.Provider = openai.ProviderOpenAI
+	case openai.ProviderOpenAI:
+	case openai.ProviderAzure:
+		if config.AzureAPIVersion == "" {
+			config.AzureAPIVersion = "2024-05-01-preview"
+		}
+	default:
+		return fmt.Errorf("Неизвестный поставщик provider: %s", config.Provider)
+	}
 
-type AssistantCreateResponse struct {
-	ID string `json:"id"`
-}
+	if config.MaxCompletionTokens < 0 {
+		return fmt.Errorf("Некорректное значение max_completion_tokens: %d", config.MaxCompletionTokens)
+	}
+	if err := validateMaxPromptTokens(config.MaxPromptTokens); err != nil {
+		return err
+	}
 
-type VectorStoreCreateResponse struct {
-	ID string `json:"id"`
-}
+	for _, model := range config.AllowedModels {
+		if config.Models == nil {
+			config.Models = make(map[string]string)
+		}
+		if _, exists := config.Models[model]; !exists {
+			config.Models[model] = model
+		}
+	}
+	for alias, model := range config.Models {
+		if alias == "" || model == "" {
+			return fmt.Errorf("В models псевдоним и модель не могут быть пустыми: %q: %q", alias, model)
+		}
+	}
+	for _, alias := range config.AllowedUserModels {
+		if _, ok := config.Models[alias]; !ok {
+			return fmt.Errorf("Модель %s из allowed_user_models не описана в models", alias)
+		}
+	}
+	if ts := config.TruncationStrategy; ts != nil {
+		switch ts.Type {
+		case "auto":
+			if ts.LastMessages != 0 {
+				return fmt.Errorf("truncation_strategy.last_messages задаётся только для type: last_messages")
+			}
+		case "last_messages":
+			if ts.LastMessages < 1 {
+				return fmt.Errorf("truncation_strategy.last_messages должно быть не меньше 1, получено %d", ts.LastMessages)
+			}
+		default:
+			return fmt.Errorf("Неизвестный тип truncation_strategy: %q (допустимы auto и last_messages)", ts.Type)
+		}
+	}
 
-// Функция для создания ассистента с поддержкой File Search
-func createAssistant() (string, error) {
-	// Преобразование инструментов в нужный формат
-	tools := []Tool{}
-	for _, toolType := range config.Tools {
-		tools = append(tools, Tool{Type: toolType})
+	if config.Temperature == nil {
+		temperature := 1.0
+		config.Temperature = &temperature
+	}
+	if err := validateTemperature(*config.Temperature); err != nil {
+		return err
 	}
 
-	requestBody := AssistantCreateRequest{
-		Name:         config.Name,
-		Instructions: config.Instructions,
-		Model:        config.Model,
-		Tools:        tools,
+	if config.SessionTTL <= 0 {
+		config.SessionTTL = 24 * time.Hour
 	}
 
-	reqBody, err := json.Marshal(requestBody)
-	if err != nil {
-		return "", err
+	if config.StateFile == "" {
+		config.StateFile = "state.json"
 	}
 
-	req, err := http.NewRequest("POST", config.ApiURL+"assistants", bytes.NewBuffer(reqBody))
-	if err != nil {
-		return "", err
+	if config.BreakerThreshold <= 0 {
+		config.BreakerThreshold = 5
+	}
+	if config.BreakerWindow <= 0 {
+		config.BreakerWindow = time.Minute
+	}
+	if config.BreakerCooldown <= 0 {
+		config.BreakerCooldown = 30 * time.Second
 	}
 
-	req.Header.Set("Authorization", "Bearer "+config.APIKey)
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("OpenAI-Beta", "assistants=v2")
+	switch config.TTSMode {
+	case "":
+		config.TTSMode = ttsModeOff
+	case ttsModeOff, ttsModeVoiceOnly, ttsModeBoth:
+	default:
+		return fmt.Errorf("Неизвестный режим tts_mode: %s", config.TTSMode)
+	}
+	if config.TTSModel == "" {
+		config.TTSModel = "tts-1"
+	}
+	if config.TTSVoice == "" {
+		config.TTSVoice = "alloy"
+	}
+	if config.TTSMaxChars <= 0 {
+		config.TTSMaxChars = 1000
+	}
 
-	// Логирование запроса
-	slog.Debug("Создание ассистента: отправка запроса", "url", req.URL)
+	if config.TranscriptionModel == "" {
+		config.TranscriptionModel = "whisper-1"
+	}
+	if config.TranscriptionURL == "" {
+		config.TranscriptionURL = openai.BuildURL(config.ApiURL, "audio/transcriptions")
+		// В Azure OpenAI распознавание доступно по пути развёртывания модели
+		if config.Provider == openai.ProviderAzure {
+			config.TranscriptionURL = openai.BuildURL(config.ApiURL, "deployments", config.TranscriptionModel, "audio/transcriptions")
+		}
+	}
+	if config.VoiceMaxDuration <= 0 {
+		config.VoiceMaxDuration = 120
+	}
+	if config.VoiceMaxBytes <= 0 {
+		config.VoiceMaxBytes = 5 << 20
+	}
+	if config.FileURLMaxBytes <= 0 {
+		config.FileURLMaxBytes = 50 << 20
+	}
+	if config.FileURLTimeout <= 0 {
+		config.FileURLTimeout = time.Minute
+	}
+	if config.ArchiveMaxExtractedBytes <= 0 {
+		config.ArchiveMaxExtractedBytes = 200 << 20
+	}
+	resyncSchedule = nil
+	if config.ResyncSchedule != "" {
+		resyncSchedule, err = parseSchedule(config.ResyncSchedule)
+		if err != nil {
+			return fmt.Errorf("Ошибка разбора resync_schedule: %v", err)
+		}
+		if resyncSchedule.Next(time.Now()).IsZero() {
+			return fmt.Errorf("Расписание resync_schedule %q никогда не наступит", config.ResyncSchedule)
+		}
+	}
+	// Telegram позволяет ботам скачивать файлы размером до 20 МБ
+	if config.DocumentMaxBytes <= 0 {
+		config.DocumentMaxBytes = 20 << 20
+	}
+	if config.PhotoMaxBytes <= 0 {
+		config.PhotoMaxBytes = 10 << 20
+	}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", err
+	if config.CacheTTLHours < 0 {
+		return fmt.Errorf("Некорректное значение cache_ttl_hours: %d", config.CacheTTLHours)
+	}
+	if config.CacheMaxEntries <= 0 {
+		config.CacheMaxEntries = 1000
+	}
+	if config.CacheContextMessages < 0 {
+		return fmt.Errorf("Некорректное значение cache_context_messages: %d", config.CacheContextMessages)
+	}
+	if config.DuplicateWindow <= 0 {
+		config.DuplicateWindow = time.Minute
+	}
+	if config.MaxInputChars <= 0 {
+		config.MaxInputChars = 4000
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", err
+	if config.MaxConcurrentRuns <= 0 {
+		config.MaxConcurrentRuns = 10
+	}
+	if config.MaxQueuedRuns < 0 {
+		return fmt.Errorf("Некорректное значение max_queued_runs: %d", config.MaxQueuedRuns)
 	}
-	slog.Debug("Получен ответ при создании ассистента", "body", string(body))
 
-	var assistantResponse AssistantCreateResponse
-	if err := json.Unmarshal(body, &assistantResponse); err != nil {
-		return "", err
+	if config.StreamTimeoutSeconds <= 0 {
+		config.StreamTimeoutSeconds = 300
+	}
+	if config.ReasoningModelPrefixes == nil {
+		config.ReasoningModelPrefixes = []string{"o1", "o3", "o4"}
+	}
+	switch config.ReasoningEffort {
+	case "", "low", "medium", "high":
+	default:
+		return fmt.Errorf("Некорректное значение reasoning_effort: %s (допустимо low, medium или high)", config.ReasoningEffort)
+	}
+	if config.ReasoningStreamTimeoutSeconds <= 0 {
+		config.ReasoningStreamTimeoutSeconds = 900
+	}
+	if config.MaxResponseBytes <= 0 {
+		config.MaxResponseBytes = 10 << 20
+	}
+	if config.MaxAnswerBytes <= 0 {
+		config.MaxAnswerBytes = 256 << 10
 	}
 
-	slog.Info("Ассистент создан", "assistant_id", assistantResponse.ID)
-	return assistantResponse.ID, nil
-}
+	if config.ReadinessTelegramMaxAge <= 0 {
+		config.ReadinessTelegramMaxAge = 5 * time.Minute
+	}
+	if config.ReadinessMaxTelegramFailures <= 0 {
+		config.ReadinessMaxTelegramFailures = 3
+	}
 
-// Функция для загрузки файла
-func uploadFile(filePath string) (string, error) {
-	// Логирование чтения файла
-	slog.Debug("Чтение файла для загрузки", "file_path", filePath)
+	if config.FileSearchMaxResults < 0 || config.FileSearchMaxResults > maxFileSearchResults {
+		return fmt.Errorf("file_search_max_results должно быть в диапазоне от 1 до %d, получено %d", maxFileSearchResults, config.FileSearchMaxResults)
+	}
 
-	file, err := os.Open(filePath)
-	if err != nil {
-		return "", err
+	if config.UserDailyRuns < 0 || config.UserDailyTokens < 0 || config.GlobalDailyTokens < 0 {
+		return fmt.Errorf("Дневные лимиты не могут быть отрицательными")
+	}
+	if config.QuotaTimezone != "" {
+		quotaLocation, err = time.LoadLocation(config.QuotaTimezone)
+		if err != nil {
+			return fmt.Errorf("Неизвестный часовой пояс quota_timezone %s: %v", config.QuotaTimezone, err)
+		}
 	}
-	defer file.Close()
 
-	var b bytes.Buffer
-	w := multipart.NewWriter(&b)
+	for model, price := range config.ModelPrices {
+		if price.Prompt < 0 || price.Completion < 0 {
+			return fmt.Errorf("Цена модели %s в model_prices не может быть отрицательной", model)
+		}
+	}
+	if config.SpendCurrency == "" {
+		config.SpendCurrency = "USD"
+	}
+	for model, limit := range config.ModelContextLimits {
+		if limit <= 0 {
+			return fmt.Errorf("Окно контекста модели %s в model_context_limits должно быть больше 0", model)
+		}
+	}
 
-	// Добавление файла в запрос
-	fw, err := w.CreateFormFile("file", filepath.Base(filePath))
-	if err != nil {
-		return "", err
+	if config.EmptyResponseRetries < 0 {
+		return fmt.Errorf("Некорректное значение empty_response_retries: %d", config.EmptyResponseRetries)
 	}
-	_, err = io.Copy(fw, file)
-	if err != nil {
-		return "", err
+	if len(config.RefusalPatterns) == 0 {
+		config.RefusalPatterns = defaultRefusalPatterns
+	}
+	if err := compileRefusalPatterns(config.RefusalPatterns); err != nil {
+		return err
 	}
 
-	// Добавление 'purpose' в запрос
-	err = w.WriteField("purpose", "assistants")
-	if err != nil {
-		return "", err
+	if config.MaxInstructionsChars <= 0 {
+		config.MaxInstructionsChars = 1000
 	}
 
-	w.Close()
+	// Вывод кода отправляется одним сообщением вместе с заголовком
+	if config.CodeOutputMaxChars < 0 || config.CodeOutputMaxChars > codeOutputLimit {
+		return fmt.Errorf("code_output_max_chars должно быть от 0 до %d, получено %d", codeOutputLimit, config.CodeOutputMaxChars)
+	}
+	// Больше 50 МБ Telegram не принимает от ботов
+	if config.CodeFileMaxBytes <= 0 || config.CodeFileMaxBytes > 50<<20 {
+		config.CodeFileMaxBytes = 20 << 20
+	}
 
-	req, err := http.NewRequest("POST", config.ApiURL+"files", &b)
-	if err != nil {
-		return "", err
+	if config.FollowupModel == "" {
+		config.FollowupModel = "gpt-4o-mini"
+	}
+	if config.HandoffTranscriptMessages <= 0 {
+		config.HandoffTranscriptMessages = 10
 	}
 
-	req.Header.Set("Authorization", "Bearer "+config.APIKey)
-	req.Header.Set("Content-Type", w.FormDataContentType())
-	req.Header.Set("OpenAI-Beta", "assistants=v2")
+	switch config.GroupContextMode {
+	case "":
+		config.GroupContextMode = groupContextUser
+	case groupContextUser, groupContextShared:
+	default:
+		return fmt.Errorf("Некорректное значение group_context_mode: %s (допустимо user или shared)", config.GroupContextMode)
+	}
 
-	slog.Debug("Загрузка файла", "url", req.URL, "file_name", filepath.Base(filePath))
+	if config.RoutingModel == "" {
+		config.RoutingModel = "gpt-4o-mini"
+	}
+	if len(config.RoutingCategories) == 0 {
+		config.RoutingCategories = defaultRouteCategories
+	}
+	if err := validateRouteCategories(config.RoutingCategories); err != nil {
+		return err
+	}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", err
+	if config.TranscriptMaxBytes <= 0 {
+		config.TranscriptMaxBytes = 10 << 20
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", err
+	if config.BroadcastRate <= 0 {
+		config.BroadcastRate = 25
+	}
+	if config.BroadcastRate > maxBroadcastRate {
+		config.BroadcastRate = maxBroadcastRate
+	}
+	if config.BroadcastConfirmThreshold <= 0 {
+		config.BroadcastConfirmThreshold = 50
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		slog.Error("Ошибка загрузки файла", "status_code", resp.StatusCode, "body", string(body))
-		return "", fmt.Errorf("Ошибка загрузки файла: %s", string(body))
+	if config.PollingTimeoutSeconds <= 0 {
+		config.PollingTimeoutSeconds = 60
 	}
 
-	slog.Debug("Файл успешно загружен", "file_name", filepath.Base(filePath))
+	switch config.UpdateMode {
+	case "":
+		config.UpdateMode = updateModePolling
+	case updateModePolling:
+	case updateModeWebhook:
+		if config.WebhookURL == "" {
+			return fmt.Errorf("Для режима webhook необходимо указать webhook_url")
+		}
+		if config.WebhookListenAddr == "" {
+			config.WebhookListenAddr = ":8443"
+		}
+	default:
+		return fmt.Errorf("Неизвестный режим update_mode: %s", config.UpdateMode)
+	}
 
-	// Получение file_id
-	var response map[string]interface{}
-	if err := json.Unmarshal(body, &response); err != nil {
-		return "", err
+	if config.DefaultLanguage == "" {
+		config.DefaultLanguage = "ru"
+	}
+	if config.LocalesPath == "" {
+		config.LocalesPath = "locales"
+	}
+	if err := loadLocales(config.LocalesPath, config.DefaultLanguage); err != nil {
+		return err
 	}
 
-	fileID, ok := response["id"].(string)
-	if !ok {
-		slog.Error("Не удалось получить file_id для файла", "body", string(body))
-		return "", fmt.Errorf("Не удалось получить file_id для файла %s", filePath)
+	if err := config.normalizeBots(); err != nil {
+		return err
+	}
+	if config.UpdateMode == updateModeWebhook && len(config.Bots) > 1 {
+		return fmt.Errorf("Режим webhook поддерживается только для одного бота")
 	}
 
-	return fileID, nil
+	return nil
 }
 
-// Функция для создания Vector Store и загрузки файлов
-func createVectorStoreAndUploadFiles() (string, error) {
-	// Создание Vector Store
-	req, err := http.NewRequest("POST", config.ApiURL+"vector_stores", nil)
-	if err != nil {
-		return "", err
+// Проверяет, что температура находится в допустимом диапазоне
+func validateTemperature(t float64) error {
+	if t < 0 || t > 2 {
+		return fmt.Errorf("Температура должна быть в диапазоне от 0 до 2, получено %v", t)
 	}
+	return nil
+}
 
-	req.Header.Set("Authorization", "Bearer "+config.APIKey)
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("OpenAI-Beta", "assistants=v2")
+// Ошибка загрузки одного файла базы знаний
+type fileUploadError struct {
+	Name string
+	Err  error
+}
 
-	slog.Debug("Создание Vector Store", "url", req.URL)
+// Итог загрузки файлов базы знаний
+type uploadReport struct {
+	Total    int
+	Uploaded int
+	Failed   []fileUploadError
+	// Загруженные файлы по имени, от них отсчитывается повторная синхронизация
+	Files map[string]syncedFile
+}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", err
+// Описание итога для журнала, например «загружено 42/45 файлов (3 с ошибкой: a.pdf, b.docx, c.txt)»
+func (r uploadReport) String() string {
+	s := fmt.Sprintf("загружено %d/%d файлов", r.Uploaded, r.Total)
+	if len(r.Failed) == 0 {
+		return s
 	}
-	defer resp.Body.Close()
+	return fmt.Sprintf("%s (%d с ошибкой: %s)", s, len(r.Failed), failedNames(r.Failed))
+}
 
-	body, err := io.ReadAll(resp.Body)
+// Создаёт Vector Store и загружает в него файлы из источника. Ошибки отдельных файлов
+// не прерывают загрузку и возвращаются в итоге вместе с количеством загруженных файлов.
+func createVectorStoreAndUploadFiles(ctx context.Context, api openai.AssistantAPI, log *slog.Logger, source FileSource) (vectorStoreID string, report uploadReport, err error) {
+	vectorStoreID, err = api.CreateVectorStore(ctx)
 	if err != nil {
-		return "", err
+		return "", report, err
 	}
-	slog.Debug("Получен ответ при создании Vector Store", "body", string(body))
 
-	var vectorStoreResponse VectorStoreCreateResponse
-	if err := json.Unmarshal(body, &vectorStoreResponse); err != nil {
-		return "", err
-	}
-
-	vectorStoreID := vectorStoreResponse.ID
-	slog.Info("Vector Store создан", "vector_store_id", vectorStoreID)
-
-	// Загрузка файлов из директории, указанной в конфиге
-	files, err := os.ReadDir(config.FilesPath)
+	// Получение списка файлов источника
+	files, err := source.List(ctx)
 	if err != nil {
-		return "", err
+		return "", report, err
 	}
+	report.Total = len(files)
+	report.Files = make(map[string]syncedFile, len(files))
 
 	for _, file := range files {
-		if !file.IsDir() {
-			filePath := filepath.Join(config.FilesPath, file.Name())
+		// Запуск отменён, например из-за ошибки создания ассистента
+		if err := ctx.Err(); err != nil {
+			return "", report, err
+		}
 
-			// Получение file_id
-			fileID, err := uploadFile(filePath)
-			if err != nil {
-				slog.Error("Ошибка загрузки файла", "file_name", file.Name(), "error", err)
-				continue
-			}
+		// Получение file_id
+		fileID, hash, err := uploadSourceFile(ctx, api, log, source, file.Name, "")
+		if err != nil {
+			log.Error("Ошибка загрузки файла", "file_name", file.Name, "error", err)
+			report.Failed = append(report.Failed, fileUploadError{Name: file.Name, Err: err})
+			continue
+		}
 
-			// Регистрация файла в Vector Store
-			if err := registerFileInVectorStore(vectorStoreID, fileID); err != nil {
-				slog.Error("Ошибка регистрации файла в Vector Store", "file_name", file.Name(), "error", err)
-				continue
-			}
+		// Регистрация файла в Vector Store
+		if err := api.AddFileToVectorStore(ctx, vectorStoreID, fileID); err != nil {
+			log.Error("Ошибка регистрации файла в Vector Store", "file_name", file.Name, "error", err)
+			report.Failed = append(report.Failed, fileUploadError{Name: file.Name, Err: err})
+			continue
 		}
+		report.Uploaded++
+		report.Files[file.Name] = syncedFile{ID: fileID, Hash: hash, Version: file.Version}
 	}
 
-	return vectorStoreID, nil
-}
-
-// Функция для регистрации файла в Vector Store
-func registerFileInVectorStore(vectorStoreID, fileID string) error {
-	requestBody := map[string]string{
-		"file_id": fileID,
+	if len(report.Failed) > 0 {
+		log.Warn("Файлы базы знаний загружены не полностью: " + report.String())
+	} else {
+		log.Info("Файлы базы знаний загружены: " + report.String())
 	}
+	return vectorStoreID, report, nil
+}
 
-	reqBody, err := json.Marshal(requestBody)
-	if err != nil {
-		return fmt.Errorf("Ошибка формирования тела запроса для регистрации файла: %v", err)
+// Загружает файл источника в API, читая его потоком. Возвращает ID файла и хэш SHA-256 содержимого.
+// hash — уже посчитанный хэш файла или пустая строка, тогда хэш считается при загрузке.
+// Файл с тем же содержимым и именем, загруженный раньше и ещё существующий в API, переиспользуется:
+// так повторный запуск после сбоя не создаёт копий уже загруженных файлов.
+func uploadSourceFile(ctx context.Context, api openai.AssistantAPI, log *slog.Logger, source FileSource, name, hash string) (string, string, error) {
+	// Хэш до загрузки нужен, только если файл с таким именем уже загружался
+	if hash == "" && hasSavedUpload(name) {
+		var err error
+		if hash, err = hashSourceFile(ctx, source, name); err != nil {
+			return "", "", err
+		}
 	}
-
-	req, err := http.NewRequest("POST", config.ApiURL+"vector_stores/"+vectorStoreID+"/files", bytes.NewBuffer(reqBody))
-	if err != nil {
-		return err
+	if hash != "" {
+		if fileID, ok := reusableUpload(ctx, api, log, hash, name); ok {
+			log.Info("Файл уже загружен, используется прежний", "file_name", name, "file_id", fileID)
+			return fileID, hash, nil
+		}
 	}
 
-	req.Header.Set("Authorization", "Bearer "+config.APIKey)
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("OpenAI-Beta", "assistants=v2")
-
-	slog.Debug("Регистрация файла в Vector Store", "vector_store_id", vectorStoreID, "file_id", fileID)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	r, err := source.Open(ctx, name)
 	if err != nil {
-		return err
+		return "", "", err
 	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
+	defer r.Close()
+	h := sha256.New()
+	fileID, err := api.UploadFile(ctx, name, io.TeeReader(r, h))
 	if err != nil {
-		return err
+		return "", "", err
 	}
-
-	if resp.StatusCode != http.StatusOK {
-		slog.Error("Ошибка регистрации файла", "status_code", resp.StatusCode, "body", string(body))
-		return fmt.Errorf("Ошибка регистрации файла: %s", string(body))
+	// Хэш загруженного содержимого: файл мог измениться после подсчёта переданного хэша
+	hash = hex.EncodeToString(h.Sum(nil))
+	if err := saveUpload(hash, name, fileID); err != nil {
+		log.Warn("Не удалось сохранить загруженный файл в файле состояния", "file_name", name, "file_id", fileID, "error", err)
 	}
-
-	slog.Info("Файл успешно зарегистрирован в Vector Store", "file_id", fileID)
-	return nil
+	return fileID, hash, nil
 }
 
-// Функция для обновления ассистента с Vector Store
-func updateAssistantWithVectorStore(assistantID, vectorStoreID string) error {
-	updateBody := map[string]interface{}{
-		"tool_resources": map[string]interface{}{
-			"file_search": map[string]interface{}{
-				"vector_store_ids": []string{vectorStoreID},
-			},
-		},
+// Ищет ранее загруженный файл с тем же содержимым и именем и проверяет, что он ещё есть в API.
+// Удалённый файл забывается. При ошибке проверки файл загружается заново.
+func reusableUpload(ctx context.Context, api openai.AssistantAPI, log *slog.Logger, hash, name string) (string, bool) {
+	upload, ok := savedUploadFor(hash, name)
+	if !ok {
+		return "", false
 	}
-
-	reqBody, err := json.Marshal(updateBody)
+	info, err := api.GetFile(ctx, upload.ID)
 	if err != nil {
-		return err
+		if isNotFound(err) {
+			forgetStaleUpload(log, upload.ID)
+		}
+		return "", false
+	}
+	if info.Filename != name {
+		forgetStaleUpload(log, upload.ID)
+		return "", false
 	}
+	return upload.ID, true
+}
 
-	req, err := http.NewRequest("POST", config.ApiURL+"assistants/"+assistantID, bytes.NewBuffer(reqBody))
-	if err != nil {
-		return err
+// Забывает запомненный файл, которого больше нет в API
+func forgetStaleUpload(log *slog.Logger, fileID string) {
+	if err := forgetUpload(fileID); err != nil {
+		log.Warn("Не удалось обновить файл состояния после проверки загруженного файла", "file_id", fileID, "error", err)
 	}
+}
 
-	req.Header.Set("Authorization", "Bearer "+config.APIKey)
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("OpenAI-Beta", "assistants=v2")
+// Запускает ассистента через API и учитывает запуск в метриках. Если ответ обрезан,
+// к нему добавляется пометка на языке пользователя.
+func runAssistant(ctx context.Context, b *botInstance, run runRequest) (result openai.RunResult, err error) {
+	metrics.runsInFlight.Add(1)
+	promRunsStarted.Inc("")
+	start := time.Now()
+	defer func() {
+		metrics.runsInFlight.Add(-1)
+		metrics.ObserveRunLatency(time.Since(start))
+		promRunLatency.Observe(time.Since(start))
+		if err != nil {
+			promRunsFailed.Inc(classifyError(err))
+		} else {
+			promRunsCompleted.Inc("")
+		}
+	}()
 
-	slog.Debug("Обновление ассистента", "assistant_id", assistantID)
+	model := run.Model
+	if model == "" {
+		model = b.cfg.Model
+	}
+	if isReasoningModel(model) {
+		run.Reasoning = true
+		run.ReasoningEffort = config.ReasoningEffort
+		run.StreamTimeout = time.Duration(config.ReasoningStreamTimeoutSeconds) * time.Second
+	}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return err
+	var observer openai.RunObserver
+	switch {
+	case b.onDelta != nil:
+		// runDebug допускает нулевой указатель, поэтому отладка может быть выключена
+		observer = streamObserver{runDebug: run.Debug, onDelta: b.onDelta}
+	case run.Debug != nil:
+		observer = run.Debug
 	}
-	defer resp.Body.Close()
+	result, err = b.api.CreateThreadRun(ctx, run.RunRequest, observer)
 
-	body, err := io.ReadAll(resp.Body)
+	if result.FirstToken > 0 {
+		promFirstToken.Observe(result.FirstToken)
+	}
+	metrics.tokensToday.Add(result.Usage.TotalTokens)
+	promTokens.Add("prompt", result.Usage.PromptTokens)
+	promTokens.Add("completion", result.Usage.CompletionTokens)
+	recordSpend(b.log, model, result.Usage)
+	// Запуск, ответ которого больше не нужен, останавливается и на стороне API
+	if errors.Is(err, context.Canceled) && result.RunID != "" {
+		threadID := run.ThreadID
+		if threadID == "" {
+			threadID = result.ThreadID
+		}
+		if threadID != "" {
+			cancelRunLater(b, threadID, result.RunID)
+		}
+	}
+	// Поток, который API создало для запуска без потока, больше не понадобится
+	if run.ThreadID == "" && result.ThreadID != "" && config.DeleteUnusedThreads {
+		deleteThreadLater(b, result.ThreadID)
+	}
 	if err != nil {
-		return err
+		return openai.RunResult{Usage: result.Usage, RunID: result.RunID}, err
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		slog.Error("Ошибка обновления ассистента", "status_code", resp.StatusCode, "body", string(body))
-		return fmt.Errorf("Ошибка обновления ассистента: %s", string(body))
+	if result.Truncated {
+		notice := config.TruncatedNotice
+		if notice == "" {
+			notice = t(run.Language, "answer.truncated")
+		}
+		result.Text += "\n\n" + notice
 	}
-
-	slog.Info("Ассистент успешно обновлен", "assistant_id", assistantID)
-	return nil
+	return result, nil
 }
 
-func listenToSSEStream(resp *http.Response) (string, error) {
-	defer resp.Body.Close()
+// Обрабатывает запросы Telegram и передает их ассистенту
+func handleTelegramUpdates(b *botInstance, updates tgbotapi.UpdatesChannel) {
+	for update := range updates {
+		if update.CallbackQuery != nil {
+			query := update.CallbackQuery
+			if query.Message == nil || !isAccessAllowed(query.From.ID, query.Message.Chat.ID) {
+				continue
+			}
+			switch {
+			case query.Data == retryCallbackData:
+				handleRetryCallback(b, query)
+			case query.Data == operatorCallbackData:
+				handleOperatorCallback(b, query)
+			case strings.HasPrefix(query.Data, followupCallbackPrefix):
+				handleFollowupCallback(b, query)
+			case strings.HasPrefix(query.Data, languageCallbackPrefix):
+				handleLanguageCallback(b, query)
+			case strings.HasPrefix(query.Data, modelCallbackPrefix):
+				handleModelCallback(b, query)
+			case strings.HasPrefix(query.Data, broadcastCallbackPrefix):
+				handleBroadcastCallback(b, query)
+			case strings.HasPrefix(query.Data, listFilesCallbackPrefix):
+				handleListFilesCallback(b, query)
+			case strings.HasPrefix(query.Data, deleteFileCallbackPrefix):
+				handleDeleteFileCallback(b, query)
+			}
+			continue
+		}
+
+		if update.EditedMessage != nil {
+			handleEditedMessage(b, update.EditedMessage)
+			continue
+		}
 
-	reader := bufio.NewReader(resp.Body)
-	var finalMessage string
+		if update.Message == nil || (update.Message.Text == "" && update.Message.Voice == nil && !isVisionMessage(update.Message) && !isAskDocumentMessage(update.Message)) {
+			continue
+		}
 
-	for {
-		line, err := reader.ReadString('\n')
-		if err != nil {
-			if err == io.EOF {
-				break
+		message := update.Message
+		userID := message.From.ID
+		// Чат поддержки читается только ради ответов операторов пользователям
+		if config.SupportChatID != 0 && message.Chat.ID == config.SupportChatID {
+			handleSupportMessage(b, message)
+			continue
+		}
+		// В группе сообщения, обращённые не к боту, пропускаются без ответа
+		if !message.Chat.IsPrivate() && config.GroupRequireMention && !addressedToBot(b, message) {
+			continue
+		}
+		promMessagesReceived.Inc(b.cfg.Name)
+
+		// Проверка доступа выполняется до любой работы с сессией и ассистентом, поэтому язык
+		// отказа берётся только из Telegram
+		if !isAccessAllowed(userID, message.Chat.ID) {
+			b.log.Warn("Попытка доступа без разрешения", "user_id", userID, "username", message.From.UserName)
+			text := config.AccessDeniedMessage
+			if text == "" {
+				text = t(detectLanguage(message.From.LanguageCode), "access.denied")
+			}
+			sendMessage(b, tgbotapi.NewMessage(message.Chat.ID, text))
+			continue
+		}
+
+		// Пользователь, написавший боту, больше не блокирует его
+		b.sessions.Unblock(userID)
+		lang := userLanguage(b, message.From)
+
+		// Рассылка и приветствие отправляются только в личный чат: в группе их увидят все
+		if message.Chat.IsPrivate() {
+			if err := rememberUser(b.cfg.Name, userID); err != nil {
+				b.log.Error("Ошибка сохранения состояния", "error", err)
+			}
+			if config.SendWelcome {
+				sendWelcome(b, message, lang)
 			}
-			return "", fmt.Errorf("Ошибка чтения события: %v", err)
 		}
 
-		line = strings.TrimSpace(line)
-		if len(line) == 0 || !strings.HasPrefix(line, "data: ") {
+		// Пока диалогом занимается оператор, сообщения пользователя получает он, а не ассистент
+		if relayToOperator(b, message) {
 			continue
 		}
 
-		eventData := line[6:]
+		// Каждое сообщение получает свой ID запроса для поиска связанных с ним записей журнала
+		ctx := newRequestContext()
+		log := requestLog(ctx, b.log)
+
+		// Голосовое сообщение распознаётся в отдельной горутине, чтобы не задерживать остальных пользователей
+		if message.Voice != nil {
+			log.Info("Получено голосовое сообщение от пользователя", "user_id", userID, "duration", message.Voice.Duration)
+			if !checkVoice(ctx, b, message, lang) {
+				continue
+			}
+			go func(message *tgbotapi.Message) {
+				query, err := transcribeVoice(ctx, b, message.Voice)
+				if err != nil {
+					log.Error("Ошибка распознавания голосового сообщения", "user_id", message.From.ID, "error", err)
+					sendMessage(b, tgbotapi.NewMessage(message.Chat.ID, voiceErrorMessage(lang, err)))
+					return
+				}
+				if config.VoiceShowTranscription {
+					sendMessage(b, tgbotapi.NewMessage(message.Chat.ID, t(lang, "voice.transcription", query)))
+				}
+				handleUserQuery(ctx, b, message, query, "", "", false, true)
+			}(message)
+			continue
+		}
 
-		if eventData == "[DONE]" {
-			slog.Debug("Ответ полностью получен")
-			break
+		// Документ с подписью /ask скачивается и загружается в API, поэтому тоже обрабатывается в отдельной горутине
+		if question, ok := askDocumentQuestion(message); ok {
+			log.Info("Получен документ с вопросом от пользователя", "user_id", userID, "file_name", message.Document.FileName)
+			go handleDocumentMessage(ctx, b, message, question, lang)
+			continue
 		}
 
-		var event map[string]interface{}
-		if err := json.Unmarshal([]byte(eventData), &event); err != nil {
-			slog.Error("Ошибка разбора события", "error", err)
+		// Получение адреса фотографии — запрос к Telegram, поэтому он тоже выполняется в отдельной горутине
+		if isVisionMessage(message) {
+			log.Info("Получена фотография от пользователя", "user_id", userID)
+			go handlePhotoMessage(ctx, b, message, lang)
 			continue
 		}
 
-		obj, ok := getString(event, "object")
-		if !ok {
+		query := message.Text
+		log.Info("Получен запрос от пользователя", "user_id", userID, "query", query)
+
+		cmd, isCommand := parseCommand(b, message)
+		// Команду другому боту в группе этот бот не обрабатывает и не передаёт ассистенту
+		if message.IsCommand() && !isCommand {
+			continue
+		}
+		if isCommand && handleCommand(b, message, cmd) {
 			continue
 		}
 
-		switch obj {
-		case "thread.message.delta":
-			delta, ok := getMap(event, "delta")
-			if !ok {
+		// Префикс /file просит прислать ответ документом, /nocache — ответить без кэша ответов
+		asFile := false
+		switch cmd.Name {
+		case "file":
+			asFile = true
+			query = cmd.Args
+			if query == "" {
+				sendMessage(b, tgbotapi.NewMessage(message.Chat.ID, t(lang, "file.usage")))
 				continue
 			}
-			content, ok := getArray(delta, "content")
-			if !ok {
+		case "nocache":
+			query = cmd.Args
+			if query == "" {
+				sendMessage(b, tgbotapi.NewMessage(message.Chat.ID, t(lang, "nocache.usage")))
 				continue
 			}
-			for _, part := range content {
-				textPart, ok := part.(map[string]interface{})
-				if !ok {
-					continue
-				}
-				text, ok := getMap(textPart, "text")
-				if !ok {
-					continue
-				}
-				value, ok := getString(text, "value")
-				if !ok {
-					continue
-				}
-				finalMessage += value
+		}
+
+		// Модерация выполняет запрос к API, поэтому не должна задерживать обработку остальных обновлений
+		if config.ModerationEnabled {
+			go handleUserQuery(ctx, b, message, query, "", "", asFile, false)
+			continue
+		}
+		handleUserQuery(ctx, b, message, query, "", "", asFile, false)
+	}
+}
+
+// Добавляет вопрос пользователя в историю и запускает ассистента.
+// Признак voice означает, что вопрос был задан голосом, imageURL — адрес приложенной фотографии,
+// documentFileID — ID документа, приложенного только к этому вопросу.
+// Возвращает false, если вопрос отклонён и ассистент не запущен.
+func handleUserQuery(ctx context.Context, b *botInstance, message *tgbotapi.Message, query, imageURL, documentFileID string, asFile, voice bool) bool {
+	log := requestLog(ctx, b.log)
+	userID := message.From.ID
+	lang := userLanguage(b, message.From)
+
+	if !checkQuery(ctx, b, message, query, lang) {
+		return false
+	}
+
+	// Обновление истории сообщений с пользователем
+	session := b.sessions.GetOrCreate(chatSession(message.Chat, userID))
+
+	metrics.messagesToday.Add(1)
+
+	// Добавление пользователя в историю с блокировкой
+	session.mu.Lock()
+	session.LastActivity = time.Now()
+
+	// Повтор того же вопроса, пока на него готовится или только что отправлен ответ, не запускает новый run
+	normalized := normalizeQuery(query)
+	if imageURL != "" {
+		normalized += " " + imageURL
+	}
+	if documentFileID != "" {
+		normalized += " " + documentFileID
+	}
+	if normalized == session.lastQuery && time.Since(session.lastQueryAt) < config.DuplicateWindow {
+		session.mu.Unlock()
+		log.Info("Повторный вопрос подавлен", "user_id", userID)
+		metrics.duplicatesSuppressed.Add(1)
+		sendMessage(b, tgbotapi.NewMessage(message.Chat.ID, t(lang, "query.duplicate")))
+		return false
+	}
+
+	// Проверка ограничения частоты запросов
+	if b.rateLimit.Enabled() {
+		allowed, wait, warn := session.limiter.allow(b.rateLimit, time.Now())
+		if !allowed {
+			session.mu.Unlock()
+			log.Warn("Превышено ограничение частоты запросов", "user_id", userID)
+			if warn {
+				seconds := int(math.Ceil(wait.Seconds()))
+				msg := tgbotapi.NewMessage(message.Chat.ID, t(lang, "query.rate_limited", seconds))
+				sendMessage(b, msg)
 			}
-		case "thread.message.completed":
-			slog.Debug("Сообщение ассистента завершено")
-			break
+			return false
 		}
 	}
 
-	slog.Debug("Собранное сообщение от ассистента", "message", finalMessage)
+	if !fitsContextWindowLocked(log, b, session, userID, query) {
+		session.mu.Unlock()
+		sendMessage(b, tgbotapi.NewMessage(message.Chat.ID, t(lang, "query.too_long")))
+		return false
+	}
 
-	if finalMessage == "" {
-		return "", fmt.Errorf("Пустой ответ от ассистента")
+	session.lastQuery = normalized
+	session.lastQueryAt = time.Now()
+
+	// Ответ зависит от всего контекста, поэтому ключ кэша строится по всей истории диалога, и
+	// кэшируются только ответы в начале диалога: не длиннее cache_context_messages сообщений и
+	// без сообщений, отброшенных по max_context_messages. Собственные указания пользователя,
+	// выбранная им модель, изображение и документ тоже меняют ответ.
+	var cacheKey string
+	if answerCache != nil && len(session.Messages) <= config.CacheContextMessages &&
+		len(session.Messages) < contextLimit(b, session) && imageURL == "" && documentFileID == "" &&
+		session.AdditionalInstructions == "" && session.Model == "" {
+		cacheKey = answerCacheKey(b.cfg.Name, session.Messages, query)
 	}
 
-	return finalMessage, nil
+	userMessage := map[string]interface{}{
+		"role":    "user",
+		"content": userContent(query, imageURL),
+	}
+	if documentFileID != "" {
+		userMessage["attachments"] = documentAttachments(documentFileID)
+	}
+	session.Messages = append(session.Messages, userMessage)
+	transcript.Write(userID, "user", query)
+
+	// Установка ограничения количества сообщений в истории и её размера по окну контекста модели
+	trimHistory(b, session)
+
+	// История копируется под той же блокировкой: иначе между добавлением вопроса и копированием
+	// её могли бы изменить /reset, правка сообщения или завершившийся запуск
+	run := runRequest{
+		RunRequest: openai.RunRequest{
+			AssistantID:         b.assistantID,
+			VectorStoreID:       b.vectorStoreID,
+			Messages:            make([]map[string]interface{}, len(session.Messages)),
+			Temperature:         *config.Temperature,
+			MaxCompletionTokens: b.cfg.MaxCompletionTokens,
+			MaxPromptTokens:     b.cfg.MaxPromptTokens,
+			TruncationStrategy:  config.TruncationStrategy,
+		},
+		Question:       query,
+		ImageURL:       imageURL,
+		DocumentFileID: documentFileID,
+		AsFile:         asFile,
+		Language:       lang,
+		CacheKey:       cacheKey,
+		RefreshCache:   strings.EqualFold(message.Command(), "nocache"),
+	}
+	copy(run.Messages, session.Messages)
+	if session.Temperature != nil {
+		run.Temperature = *session.Temperature
+	}
+	run.Model = session.Model
+	run.Voice = voice || session.VoiceReplies
+	run.AdditionalInstructions = joinInstructions(config.AdditionalInstructions, session.AdditionalInstructions)
+	if session.Debug {
+		run.Debug = &runDebug{}
+	}
+	if config.FileSearchMaxResults > 0 {
+		run.Tools = assistantTools(b.cfg.Tools)
+	}
+	// Поиск по приложенному документу нужен и боту без базы знаний
+	if documentFileID != "" && !slices.Contains(b.cfg.Tools, "file_search") {
+		run.Tools = assistantTools(append(slices.Clone(b.cfg.Tools), "file_search"))
+	}
+	// Правка сообщения заменяет вопрос, пока на него не отправлен ответ
+	ctx = trackPendingLocked(ctx, session, message.MessageID, &run, len(session.Messages)-1)
+	session.mu.Unlock()
+
+	// Запросы разных пользователей обрабатываются параллельно, а одного пользователя — по очереди,
+	// чтобы ответы пришли в порядке вопросов
+	b.queues.Submit(chatSession(message.Chat, userID).queueID(), func() { processRun(ctx, b, message.Chat.ID, userID, session, run) })
+	return true
 }
 
-// Создаёт поток и запускает ассистента с обработкой SSE
-func createAndRunAssistantWithStreaming(assistantID string, messages []map[string]interface{}, vectorStoreID string) (string, error) {
-	requestBody := map[string]interface{}{
-		"assistant_id": assistantID,
-		"thread": map[string]interface{}{
-			"messages": messages,
-		},
-		"tool_resources": map[string]interface{}{
-			"file_search": map[string]interface{}{
-				"vector_store_ids": []string{vectorStoreID},
-			},
-		},
-		"temperature": 1.0,
-		"top_p":       1.0,
-		"stream":      true, // Активация потока
+// Проверяет вопрос до добавления в историю: длину, дневные лимиты и модерацию. Об отказе
+// сообщает пользователю и возвращает false
+func checkQuery(ctx context.Context, b *botInstance, message *tgbotapi.Message, query, lang string) bool {
+	// Слишком длинный вопрос отклоняется до модерации и добавления в историю
+	if n := utf8.RuneCountInString(query); n > config.MaxInputChars {
+		requestLog(ctx, b.log).Warn("Вопрос длиннее max_input_chars", "user_id", message.From.ID, "chars", n, "max_input_chars", config.MaxInputChars)
+		sendMessage(b, tgbotapi.NewMessage(message.Chat.ID, t(lang, "query.input_too_long", n, config.MaxInputChars)))
+		return false
 	}
 
-	reqBody, err := json.Marshal(requestBody)
-	if err != nil {
-		return "", fmt.Errorf("Ошибка создания тела запроса: %v", err)
+	// Исчерпание дневного лимита проверяется до любых запросов к API
+	if !checkQuota(b, message, lang) {
+		return false
 	}
 
-	req, err := http.NewRequest("POST", config.ApiURL+"threads/runs", bytes.NewBuffer(reqBody))
-	if err != nil {
-		return "", fmt.Errorf("Ошибка создания HTTP-запроса: %v", err)
+	// Отклонённый модерацией вопрос не попадает в историю и не запускает ассистента
+	return !config.ModerationEnabled || passesModeration(ctx, b, message, query, lang)
+}
+
+// Проверяет, что вопрос один помещается в окно контекста модели сессии: иначе API всё равно
+// отклонит запуск. Вызывается под session.mu
+func fitsContextWindowLocked(log *slog.Logger, b *botInstance, session *UserSession, userID int64, query string) bool {
+	budget := historyTokenBudget(b, sessionModel(b, session))
+	if budget == 0 || estimateTokens(query) <= budget {
+		return true
+	}
+	log.Warn("Вопрос не помещается в окно контекста модели", "user_id", userID, "model", sessionModel(b, session),
+		"estimated_tokens", estimateTokens(query), "budget", budget)
+	return false
+}
+
+// Параметры запуска ассистента. Сохраняются в сессии, чтобы повторить неудавшийся запрос без изменений.
+type runRequest struct {
+	openai.RunRequest
+	// Вопрос пользователя и признак отправки ответа документом
+	Question string
+	AsFile   bool
+	// Адрес фотографии, приложенной к вопросу. Пустой — вопрос без изображения
+	ImageURL string
+	// ID документа, приложенного только к этому вопросу (/ask). Пустой — вопрос без документа
+	DocumentFileID string
+	// Ответить голосовым сообщением
+	Voice bool
+	// Язык сообщений пользователю
+	Language string
+	// Сбор отладочных сведений для команды /debug. nil — отладка выключена
+	Debug *runDebug
+	// Вопрос уже добавлен в поток пользователя (чтобы не добавлять его повторно при повторе)
+	ThreadMessageAdded bool
+	// Ключ кэша ответов. Пустой — вопрос зависит от контекста и ответ не кэшируется
+	CacheKey string
+	// Ответ не берётся из кэша, а новый ответ заменяет в нём прежний (/nocache)
+	RefreshCache bool
+	// Решение маршрутизации для журнала диалогов. Пустое — маршрутизация выключена
+	Route string
+	// Вопрос, который пользователь может исправить правкой сообщения. nil — повтор или вопрос без сообщения
+	Pending *pendingQuestion
+}
+
+// Данные кнопки повтора неудавшегося запроса
+const retryCallbackData = "retry"
+
+// Запускает ассистента и отправляет пользователю ответ или сообщение об ошибке
+func processRun(ctx context.Context, b *botInstance, chatID, userID int64, session *UserSession, run runRequest) {
+	log := requestLog(ctx, b.log)
+	// Вопрос, заменённый правкой до начала запуска, уже поставлен в очередь заново
+	if !startPending(session, &run) {
+		return
+	}
+	defer dropPending(session, run.Pending)
+	access := newAccessEntry(chatID, userID, run.Question)
+	defer access.write(log)
+
+	// На вопрос без контекста может найтись готовый ответ, тогда ассистент не запускается
+	if run.CacheKey != "" && !run.RefreshCache {
+		if answer, ok := answerCache.Get(run.CacheKey); ok {
+			access.cached = true
+			if deliverCachedAnswer(ctx, b, chatID, userID, session, run, answer) {
+				access.answered(answer)
+			} else {
+				access.failed(errorCategorySend)
+			}
+			return
+		}
+	}
+
+	// Приветствия и просьбы связаться с сотрудником обходятся без ассистента и базы знаний
+	if config.RoutingEnabled {
+		decision := routeQuestion(ctx, b, userID, run)
+		run.Route = decision.String()
+		if decision.Action != routeActionAssistant {
+			if !finishPending(session, run.Pending) {
+				access.failed("cancelled")
+				return
+			}
+			deliverRoutedAnswer(ctx, b, chatID, userID, session, run, decision, access)
+			return
+		}
 	}
 
-	req.Header.Set("Authorization", "Bearer "+config.APIKey)
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("OpenAI-Beta", "assistants=v2")
+	// При всплеске нагрузки ограничиваем количество одновременных соединений с API
+	if !runSlots.Acquire() {
+		log.Warn("Запрос отклонён: превышен лимит одновременных запусков", "user_id", userID)
+		session.mu.Lock()
+		session.lastQuery = ""
+		session.mu.Unlock()
+		access.failed(userErrorBusy)
+		sendMessage(b, tgbotapi.NewMessage(chatID, config.Errors.forCategory(run.Language, userErrorBusy)))
+		return
+	}
 
-	slog.Debug("Отправка запроса к ассистенту", "assistant_id", assistantID)
+	// Во время сбоя у провайдера не ждём таймаута, а сразу сообщаем о недоступности
+	if !runBreaker.Allow() {
+		log.Warn("Запрос отклонён автоматическим выключателем", "user_id", userID)
+		runSlots.Release()
+		access.failed(userErrorUnavailable)
+		sendMessage(b, tgbotapi.NewMessage(chatID, config.Errors.forCategory(run.Language, userErrorUnavailable)))
+		return
+	}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	var result openai.RunResult
+	start := time.Now()
+	err := prepareThread(ctx, b, userID, session, &run)
+	if err == nil {
+		result, err = runAssistant(ctx, b, run)
+		if err != nil && config.FallbackModel != "" && run.Model == "" && isModelUnavailable(err) {
+			access.retries++
+			// Каждая попытка учитывается в лимитах: расход отброшенной — здесь, итоговой — вместе с ответом
+			recordUsage(b, userID, result.Usage.TotalTokens)
+			result, err = runWithFallbackModel(ctx, b, userID, run, err)
+		}
+		// Пустой ответ часто бывает случайным, поэтому запуск повторяется с теми же сообщениями.
+		// Вопрос уже добавлен в историю (и в поток), поэтому повторно он не добавляется.
+		for attempt := 1; attempt <= config.EmptyResponseRetries && errors.Is(err, openai.ErrEmptyResponse); attempt++ {
+			log.Warn("Пустой ответ ассистента, повтор запуска", "user_id", userID, "attempt", attempt)
+			access.retries++
+			recordUsage(b, userID, result.Usage.TotalTokens)
+			result, err = runAssistant(ctx, b, run)
+		}
+		// Пустой ответ или отказ после этого повторяется ещё раз с указанием опираться на документы
+		result, err = retryWithNudge(ctx, b, userID, session, run, result, err, access)
+		// Пустой ответ не говорит о недоступности API и обрабатывается ниже отдельно
+		if errors.Is(err, openai.ErrEmptyResponse) {
+			err = nil
+		}
+	}
+	latency := time.Since(start)
+	access.runLatency = latency
+	responseContent, usage := result.Text, result.Usage
+	recordUsage(b, userID, usage.TotalTokens)
+	// Отладочные сведения отправляются последними, после ответа или сообщения об ошибке
+	defer sendRunDebug(b, chatID, run.Debug)
+	runSlots.Release()
+	// Вопрос исправлен во время запуска или запуск остановлен командой /stop: ответ не нужен
+	if !finishPending(session, run.Pending) {
+		log.Info("Запуск отменён правкой вопроса или командой /stop", "user_id", userID)
+		// Отмена не говорит о сбое API, но пробный запуск должен освободить выключатель
+		runBreaker.Release()
+		access.failed("cancelled")
+		return
+	}
+	// Модель без поддержки изображений отвечает ошибкой запроса, а не сбоем провайдера
+	if run.ImageURL != "" && isImageUnsupported(err) {
+		runBreaker.Record(nil)
+		access.failed("image_unsupported")
+		handleImageUnsupported(ctx, b, chatID, userID, session, run)
+		return
+	}
+	runBreaker.Record(err)
+	// Если поток оборвался после начала ответа, полученная часть полезнее сообщения об ошибке:
+	// она отправляется с пометкой о неполноте. Общее сообщение об ошибке — только если текста нет
+	partial := false
+	var interrupted *openai.InterruptedError
+	if errors.As(err, &interrupted) && interrupted.Text != "" {
+		log.Warn("Поток ответа оборвался, пользователю отправляется полученная часть ответа", "user_id", userID, "error", err)
+		responseContent = interrupted.Text + "\n\n" + t(run.Language, "answer.partial")
+		partial = true
+		err = nil
+	}
 	if err != nil {
-		return "", fmt.Errorf("Ошибка выполнения HTTP-запроса: %v", err)
+		category := classifyError(err)
+		access.failed(category)
+		log.Error("Ошибка выполнения запроса ассистентом", "user_id", userID, "error", err, "category", category)
+		metrics.IncError(errorCategoryRun)
+		if category == userErrorQuota {
+			handleQuotaExceeded(b, err)
+		}
+		if category == userErrorParameter {
+			log.Error("Модель отклонила параметры запуска: если это рассуждающая модель, добавьте её в reasoning_model_prefixes",
+				"model", run.Model, "bot_model", b.cfg.Model)
+		}
+		conversationLog.Write(b.cfg.Name, userID, run.Question, "", latency, usage, category, run.Route)
+
+		session.mu.Lock()
+		session.lastFailedRun = &run
+		// После ошибки пользователь может сразу задать тот же вопрос ещё раз
+		session.lastQuery = ""
+		session.mu.Unlock()
+
+		// Код ошибки позволяет поддержке найти записи журнала об этом запросе
+		text := config.Errors.forCategory(run.Language, category) + "\n\n" + t(run.Language, "error.code", openai.RequestID(ctx))
+		msg := tgbotapi.NewMessage(chatID, text)
+		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+			tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(t(run.Language, "retry.button"), retryCallbackData)),
+		)
+		sendMessage(b, msg)
+		return
+	}
+
+	if responseContent == "" && len(result.Files) == 0 {
+		log.Error("Получен пустой ответ от ассистента", "user_id", userID)
+		access.failed(errorCategoryEmpty)
+		metrics.IncError(errorCategoryEmpty)
+		conversationLog.Write(b.cfg.Name, userID, run.Question, "", latency, usage, errorCategoryEmpty, run.Route)
+		msg := tgbotapi.NewMessage(chatID, t(run.Language, "answer.empty"))
+		sendMessage(b, msg)
+		return
 	}
 
-	return listenToSSEStream(resp)
+	transcript.Write(userID, "assistant", responseContent)
+	conversationLog.Write(b.cfg.Name, userID, run.Question, responseContent, latency, usage, "", run.Route)
+
+	// Ответ может состоять только из файлов, созданных code_interpreter. Короткий ответ
+	// с файлами отправляется подписью к первому из них
+	var caption string
+	if captionAnswer(b, run, responseContent, result) {
+		caption = responseContent
+	} else if responseContent != "" && !deliverAnswer(ctx, b, chatID, userID, run, responseContent) {
+		access.failed(errorCategorySend)
+		return
+	}
+	access.answered(responseContent)
+	sendRunOutputs(ctx, b, chatID, run.Language, result, caption)
+	// Обрезанный или оборвавшийся ответ не кэшируется, чтобы следующий пользователь получил полный.
+	// Ответ с файлами тоже: файлы в кэш не попадают.
+	if run.CacheKey != "" && !result.Truncated && !partial && len(result.Files) == 0 {
+		answerCache.Put(run.CacheKey, b.cfg.Name, responseContent)
+	}
+	completeAnswer(ctx, b, chatID, userID, session, run, result.RunID, responseContent)
 }
 
-// Обрабатывает запросы Telegram и передает их ассистенту
-func handleTelegramUpdates(bot *tgbotapi.BotAPI, assistantID, vectorStoreID string) {
-	u := tgbotapi.NewUpdate(0)
-	u.Timeout = 60
+// Добавляет доставленный ответ в историю и предлагает вопросы для продолжения
+func completeAnswer(ctx context.Context, b *botInstance, chatID, userID int64, session *UserSession, run runRequest, runID, responseContent string) {
+	// В историю попадает только ответ, который пользователь действительно получил
+	session.mu.Lock()
+	session.lastFailedRun = nil
+	session.Messages = append(session.Messages, map[string]interface{}{
+		"role":    "assistant",
+		"content": responseContent,
+	})
+	trimHistory(b, session)
+	session.mu.Unlock()
+	rememberAnswer(session, runID, run.Question)
 
-	updates := bot.GetUpdatesChan(u)
+	if run.DocumentFileID != "" {
+		removeDocument(ctx, b, session, run.DocumentFileID)
+	}
 
-	for update := range updates {
-		if update.Message != nil && update.Message.Text != "" {
-			userID := update.Message.From.ID
-			query := update.Message.Text
-			slog.Info("Получен запрос от пользователя", "user_id", userID, "query", query)
-
-			// Обновление истории сообщений с пользователем
-			sessionsMu.RLock()
-			session, exists := userSessions[userID]
-			sessionsMu.RUnlock()
-
-			if !exists {
-				session = &UserSession{Messages: []map[string]interface{}{}}
-				sessionsMu.Lock()
-				userSessions[userID] = session
-				sessionsMu.Unlock()
-			}
+	if config.SuggestFollowups {
+		sendFollowups(ctx, b, chatID, userID, session, run.Language, run.Question, responseContent)
+	}
+}
 
-			// Добавление пользователя в историю с блокировкой
-			session.mu.Lock()
-			session.Messages = append(session.Messages, map[string]interface{}{
-				"role":    "user",
-				"content": query,
-			})
+// Сообщает оператору об исчерпании квоты ключа API. При quota_open_breaker размыкает
+// автоматический выключатель, чтобы не отправлять заведомо неудачные запросы.
+func handleQuotaExceeded(b *botInstance, err error) {
+	b.log.Error("ИСЧЕРПАНА КВОТА КЛЮЧА API: пополните баланс или замените api_key", "error", err)
+	if config.QuotaOpenBreaker {
+		runBreaker.Trip()
+	}
+}
 
-			// Установка ограничения количества сообщений в истории
-			if len(session.Messages) > config.MaxContextMessages {
-				session.Messages = session.Messages[len(session.Messages)-config.MaxContextMessages:]
-			}
-			session.mu.Unlock()
+// Повторяет запуск один раз с резервной моделью с теми же сообщениями, температурой и лимитом токенов.
+// Сохранённый для кнопки "Повторить" запрос не меняется, поэтому повтор снова начнётся с основной модели.
+func runWithFallbackModel(ctx context.Context, b *botInstance, userID int64, run runRequest, cause error) (openai.RunResult, error) {
+	log := requestLog(ctx, b.log)
+	log.Warn("Основная модель недоступна, запрос повторяется с резервной моделью",
+		"user_id", userID, "fallback_model", config.FallbackModel, "error", cause)
 
-			// Обработка каждого запроса в отдельной горутине (Горутина (goroutine) — это функция, выполняющаяся конкурентно с другими горутинами в том же адресном пространстве.)
-			go func(update tgbotapi.Update, userID int64, session *UserSession) {
-				// Копируем историю сообщений с блокировкой
-				session.mu.Lock()
-				messagesCopy := make([]map[string]interface{}, len(session.Messages))
-				copy(messagesCopy, session.Messages)
-				session.mu.Unlock()
+	run.Model = config.FallbackModel
+	result, err := runAssistant(ctx, b, run)
+	if err != nil {
+		return result, err
+	}
+	if config.FallbackNotice {
+		result.Text += "\n\n" + t(run.Language, "answer.fallback_model")
+	}
+	return result, nil
+}
 
-				responseContent, err := createAndRunAssistantWithStreaming(assistantID, messagesCopy, vectorStoreID)
-				if err != nil {
-					slog.Error("Ошибка выполнения запроса ассистентом", "error", err)
-					msg := tgbotapi.NewMessage(update.Message.Chat.ID, "Ошибка обработки запроса.")
-					bot.Send(msg)
-					return
-				}
+// Отправляет ответ голосом и/или текстом. Возвращает true, если ответ доставлен.
+func deliverAnswer(ctx context.Context, b *botInstance, chatID, userID int64, run runRequest, responseContent string) bool {
+	log := requestLog(ctx, b.log)
+	if run.Voice && config.TTSMode != ttsModeOff {
+		sendText, err := sendVoiceAnswer(ctx, b, chatID, run.Language, responseContent)
+		if err != nil {
+			log.Error("Ошибка голосового ответа, ответ будет отправлен текстом", "user_id", userID, "error", err)
+		}
+		if !sendText {
+			log.Info("Голосовой ответ отправлен пользователю", "user_id", userID)
+			return true
+		}
+	}
 
-				if responseContent == "" {
-					slog.Error("Получен пустой ответ от ассистента")
-					msg := tgbotapi.NewMessage(update.Message.Chat.ID, "Ассистент не смог предоставить ответ.")
-					bot.Send(msg)
-					return
-				}
+	if err := sendAnswer(b, chatID, run.Question, responseContent, run.AsFile); err != nil {
+		if isMessageTooLong(err) {
+			log.Error("Ответ ассистента слишком длинный для отправки", "user_id", userID, "category", userErrorTooLong)
+			sendMessage(b, tgbotapi.NewMessage(chatID, config.Errors.forCategory(run.Language, userErrorTooLong)))
+		}
+		return false
+	}
+	log.Info("Ответ отправлен пользователю", "user_id", userID)
+	return true
+}
 
-				// Добавление ответа ассистента в историю с блокировкой
-				session.mu.Lock()
-				session.Messages = append(session.Messages, map[string]interface{}{
-					"role":    "assistant",
-					"content": responseContent,
-				})
+// Обрабатывает нажатие кнопки "Повторить": повторно запускает последний неудавшийся запрос.
+// Повторное нажатие во время выполнения ничего не делает, так как запрос извлекается из сессии один раз.
+func handleRetryCallback(b *botInstance, query *tgbotapi.CallbackQuery) {
+	userID := query.From.ID
 
-				if len(session.Messages) > config.MaxContextMessages {
-					session.Messages = session.Messages[len(session.Messages)-config.MaxContextMessages:]
-				}
-				session.mu.Unlock()
+	session, exists := b.sessions.Get(chatSession(query.Message.Chat, userID))
 
-				msg := tgbotapi.NewMessage(update.Message.Chat.ID, responseContent)
-				bot.Send(msg)
-				slog.Info("Ответ отправлен пользователю", "user_id", userID)
+	var run *runRequest
+	if exists {
+		session.mu.Lock()
+		run = session.lastFailedRun
+		session.lastFailedRun = nil
+		session.mu.Unlock()
+	}
 
-			}(update, userID, session)
-		}
+	if run == nil {
+		b.sender.Request(tgbotapi.NewCallback(query.ID, t(userLanguage(b, query.From), "retry.nothing")))
+		return
+	}
+
+	b.sender.Request(tgbotapi.NewCallback(query.ID, t(run.Language, "retry.started")))
+	// Убираем кнопку, чтобы запрос нельзя было повторить ещё раз
+	b.sender.Request(tgbotapi.NewEditMessageReplyMarkup(query.Message.Chat.ID, query.Message.MessageID, tgbotapi.InlineKeyboardMarkup{InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{}}))
+
+	if run.Debug != nil {
+		run.Debug = &runDebug{}
 	}
+
+	ctx := newRequestContext()
+	requestLog(ctx, b.log).Info("Повтор запроса пользователя", "user_id", userID)
+	chatID, retried := query.Message.Chat.ID, *run
+	retried.Pending = nil
+	b.queues.Submit(chatSession(query.Message.Chat, userID).queueID(), func() { processRun(ctx, b, chatID, userID, session, retried) })
 }
 
 func main() {
-	// Настройка логгера
-	handler := slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
-		Level: slog.LevelInfo,
+	checkMode := flag.Bool("check", false, "Проверить настройки, ключ API, токены Telegram и файлы без запуска ботов")
+	cliMode := flag.Bool("cli", false, "Диалог с ассистентом первого бота в терминале без Telegram")
+	versionMode := flag.Bool("version", false, "Вывести версию сборки и завершить работу")
+	flag.Parse()
+
+	if *versionMode {
+		fmt.Println(currentBuild())
+		return
+	}
+
+	// Настройка логгера. Ключ API и токены ботов маскируются во всех записях.
+	// В режиме --cli терминал занят диалогом, поэтому в stderr выводятся только предупреждения и ошибки,
+	// а stdout подкоманд занят их результатом
+	logOutput, logLevel := os.Stdout, slog.LevelInfo
+	switch {
+	case *cliMode:
+		logOutput, logLevel = os.Stderr, slog.LevelWarn
+	case flag.NArg() > 0:
+		logOutput = os.Stderr
+	}
+	handler := slog.NewTextHandler(logOutput, &slog.HandlerOptions{
+		Level:       logLevel,
+		ReplaceAttr: redactAttr,
 	})
 	slog.SetDefault(slog.New(handler))
+	tgbotapi.SetLogger(botLogger{})
+
+	// Разовые операции (upload, ask, cleanup) выполняются без запуска ботов
+	if flag.NArg() > 0 {
+		os.Exit(runSubcommand(flag.Arg(0), flag.Args()[1:]))
+	}
+
+	// Режим проверки настроек: отчёт выводится в stdout, код завершения 0 или 1
+	if *checkMode {
+		if !runCheck(os.Stdout, "config.yaml") {
+			os.Exit(1)
+		}
+		return
+	}
 
 	// Установка конфигурации
 	err := loadConfig("config.yaml")
@@ -580,69 +1530,139 @@ func main() {
 		slog.Error("Ошибка загрузки конфигурации", "error", err)
 		os.Exit(1)
 	}
+	setRedactedSecrets(&config)
+	logStartupBanner()
+
+	// Защита от случайного повторного запуска: два экземпляра с одним токеном мешают друг другу
+	if config.LockFile != "" && !*cliMode {
+		if err := acquireInstanceLock(config.LockFile); err != nil {
+			slog.Error("Ошибка запуска", "error", err)
+			os.Exit(exitCodeConflict)
+		}
+	}
 
-	// Инициализация Telegram Bot
-	bot, err := tgbotapi.NewBotAPI(config.TelegramBotToken)
-	if err != nil {
-		slog.Error("Ошибка инициализации Telegram бота", "error", err)
+	runBreaker = newCircuitBreaker(config.BreakerThreshold, config.BreakerWindow, config.BreakerCooldown)
+	runSlots = newRunLimiter(config.MaxConcurrentRuns, config.MaxQueuedRuns)
+
+	// Загрузка сохранённого состояния
+	if err := loadState(config.StateFile); err != nil {
+		slog.Error("Ошибка загрузки состояния", "error", err)
 		os.Exit(1)
 	}
-	bot.Debug = false
-	slog.Info("Telegram бот авторизован", "username", bot.Self.UserName)
 
-	// Создание ассистента
-	assistantID, err := createAssistant()
-	if err != nil {
-		slog.Error("Ошибка создания ассистента", "error", err)
-		os.Exit(1)
+	// Журнал переписки
+	if config.TranscriptPath != "" {
+		transcript, err = openTranscript(config.TranscriptPath, config.TranscriptMaxBytes)
+		if err != nil {
+			slog.Error("Ошибка открытия журнала переписки", "error", err)
+			os.Exit(1)
+		}
 	}
 
-	// Создание Vector Store и загрузка файлов
-	vectorStoreID, err := createVectorStoreAndUploadFiles()
-	if err != nil {
-		slog.Error("Ошибка создания Vector Store и загрузки файлов", "error", err)
-		os.Exit(1)
+	// Журнал диалогов для аналитики
+	if config.ConversationLogPath != "" {
+		conversationLog, err = openConversationLog(config.ConversationLogPath, config.ConversationLogSalt)
+		if err != nil {
+			slog.Error("Ошибка открытия журнала диалогов", "error", err)
+			os.Exit(1)
+		}
 	}
 
-	// Привязка Vector Store к ассистенту
-	if err := updateAssistantWithVectorStore(assistantID, vectorStoreID); err != nil {
-		slog.Error("Ошибка обновления ассистента", "error", err)
-		os.Exit(1)
+	// Журнал оценок ответов
+	if config.FeedbackPath != "" {
+		feedbackLog, err = openFeedbackLog(config.FeedbackPath)
+		if err != nil {
+			slog.Error("Ошибка открытия журнала отзывов", "error", err)
+			os.Exit(1)
+		}
 	}
 
-	slog.Info("Ассистент готов к работе", "assistant_id", assistantID)
+	// Смещения обновлений, с которых продолжается long polling после перезапуска
+	if config.UpdateOffsetFile != "" && !*cliMode {
+		updateOffsets, err = openUpdateOffsets(config.UpdateOffsetFile)
+		if err != nil {
+			slog.Error("Ошибка загрузки смещений обновлений", "error", err)
+			os.Exit(1)
+		}
+	}
 
-	// Обработка запросов от Telegram пользователей
-	handleTelegramUpdates(bot, assistantID, vectorStoreID)
-}
+	// Кэш ответов на повторяющиеся вопросы
+	if config.CacheTTLHours > 0 {
+		answerCache, err = openAnswerCache(time.Duration(config.CacheTTLHours)*time.Hour, config.CacheMaxEntries, config.CachePath)
+		if err != nil {
+			slog.Error("Ошибка открытия кэша ответов", "error", err)
+			os.Exit(1)
+		}
+	}
 
-// Вспомогательные функции для получения значений
-// getString извлекает строковое значение из map по заданному ключу.
-// Возвращает строку и bool значение, указывающее, удалось ли получить строку.
-func getString(m map[string]interface{}, key string) (string, bool) {
-	if val, ok := m[key]; ok {
-		str, ok := val.(string)
-		return str, ok
+	if *cliMode {
+		os.Exit(runCLI(os.Stdin, os.Stdout))
 	}
-	return "", false
-}
 
-// getMap извлекает значение типа map[string]interface{} из map по заданному ключу.
-// Возвращает карту и bool значение, указывающее, удалось ли получить карту.
-func getMap(m map[string]interface{}, key string) (map[string]interface{}, bool) {
-	if val, ok := m[key]; ok {
-		m2, ok := val.(map[string]interface{})
-		return m2, ok
+	// Запуск всех ботов из конфигурации
+	startupBegan := time.Now()
+	var bots []*botInstance
+	var stops []func()
+	for _, cfg := range config.Bots {
+		b, err := startBot(cfg)
+		if err != nil {
+			slog.Error("Ошибка запуска бота", "bot", cfg.Name, "error", err)
+			os.Exit(1)
+		}
+
+		// Получение обновлений через long polling или вебхук
+		updates, stop, err := getUpdatesChannel(b)
+		if err != nil {
+			b.log.Error("Ошибка запуска получения обновлений Telegram", "error", err)
+			os.Exit(1)
+		}
+
+		// Потоки для пользователей, чей первый ответ должен прийти без задержки
+		go preloadThreads(b, config.PreloadUserIDs)
+
+		// Очистка неактивных сессий
+		go b.sessions.runJanitor(time.Minute, config.SessionTTL, b.log)
+		go b.runTelegramProbe()
+
+		// Синхронизация базы знаний по расписанию
+		if resyncSchedule != nil {
+			stops = append(stops, startKnowledgeResync(b, resyncSchedule))
+		}
+
+		bots = append(bots, b)
+		stops = append(stops, stop)
+
+		// Обработка запросов от Telegram пользователей
+		go handleTelegramUpdates(b, updates)
 	}
-	return nil, false
-}
+	slog.Info("Боты запущены", "bots", len(bots), "ready_in", time.Since(startupBegan).Round(time.Millisecond))
+
+	// Метрики Prometheus и проверки состояния для оркестратора
+	if config.MetricsListenAddr != "" {
+		registerHealthHandlers(bots)
+		if config.AdminAPIToken != "" {
+			registerAdminAPI(metricsMux, bots)
+		}
+		stops = append(stops, startMetricsServer(config.MetricsListenAddr, bots))
+	}
+
+	// Ежедневный итог расхода отправляется от имени первого бота
+	if config.SpendReportChatID != 0 {
+		stops = append(stops, startSpendReport(bots[0]))
+	}
+
+	// Завершение работы по сигналу: все боты останавливаются вместе
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	sig := <-signals
+	slog.Info("Получен сигнал завершения, остановка ботов", "signal", sig.String(), "bots", len(bots))
 
-// getArray извлекает срез значений типа interface{} из map по заданному ключу.
-// Возвращает срез и bool значение, указывающее, удалось ли получить срез.
-func getArray(m map[string]interface{}, key string) ([]interface{}, bool) {
-	if val, ok := m[key]; ok {
-		arr, ok := val.([]interface{})
-		return arr, ok
+	for _, stop := range stops {
+		stop()
 	}
-	return nil, false
+	transcript.Flush()
+	conversationLog.Flush()
+	answerCache.Save()
+	releaseInstanceLock()
+	slog.Info("Работа завершена")
 }
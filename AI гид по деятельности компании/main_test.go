@@ -0,0 +1,435 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"proxyapi-bot/internal/openai"
+)
+
+// fakeSender — BotSender, который сохраняет отправленные сообщения вместо отправки в Telegram
+type fakeSender struct {
+	mu     sync.Mutex
+	sent   []tgbotapi.Chattable
+	nextID int
+	// Ошибки отправки сообщений по ID чата
+	errors map[int64]error
+	// Отправленные фотографии и документы с содержимым
+	files []sentFile
+	// Адрес, от которого GetFileDirectURL строит ссылки на файлы. Пустой — https://files.example.com
+	fileURL string
+}
+
+// Файл, отправленный фотографией или документом
+type sentFile struct {
+	Name    string
+	Caption string
+	Photo   bool
+	Data    string
+}
+
+func (s *fakeSender) Send(c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if m, ok := c.(tgbotapi.MessageConfig); ok && s.errors[m.ChatID] != nil {
+		return tgbotapi.Message{}, s.errors[m.ChatID]
+	}
+	// Содержимое файла читается сразу: после отправки бот закрывает и удаляет его
+	switch m := c.(type) {
+	case tgbotapi.PhotoConfig:
+		s.files = append(s.files, readSentFile(m.File, m.Caption, true))
+	case tgbotapi.DocumentConfig:
+		s.files = append(s.files, readSentFile(m.File, m.Caption, false))
+	}
+	s.sent = append(s.sent, c)
+	s.nextID++
+	return tgbotapi.Message{MessageID: s.nextID}, nil
+}
+
+func (s *fakeSender) Request(c tgbotapi.Chattable) (*tgbotapi.APIResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sent = append(s.sent, c)
+	return &tgbotapi.APIResponse{Ok: true, Result: json.RawMessage("true")}, nil
+}
+
+func (s *fakeSender) GetFileDirectURL(fileID string) (string, error) {
+	if s.fileURL != "" {
+		return s.fileURL + "/" + fileID, nil
+	}
+	return "https://files.example.com/" + fileID, nil
+}
+
+func readSentFile(file tgbotapi.RequestFileData, caption string, photo bool) sentFile {
+	sent := sentFile{Caption: caption, Photo: photo}
+	if r, ok := file.(tgbotapi.FileReader); ok {
+		data, _ := io.ReadAll(r.Reader)
+		sent.Name, sent.Data = r.Name, string(data)
+	}
+	return sent
+}
+
+// Отправленные фотографии и документы по порядку
+func (s *fakeSender) sentFiles() []sentFile {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.files)
+}
+
+// Тексты отправленных и изменённых сообщений по порядку
+func (s *fakeSender) texts() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var texts []string
+	for _, c := range s.sent {
+		switch m := c.(type) {
+		case tgbotapi.MessageConfig:
+			texts = append(texts, m.Text)
+		case tgbotapi.EditMessageTextConfig:
+			texts = append(texts, m.Text)
+		}
+	}
+	return texts
+}
+
+// Ждёт отправки сообщения с текстом text
+func (s *fakeSender) waitText(t *testing.T, text string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !slices.Contains(s.texts(), text) {
+		if time.Now().After(deadline) {
+			t.Fatalf("Сообщение %q не отправлено, отправлено %q", text, s.texts())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// Минимальная конфигурация бота для проверок. files_path и state_file указывают во временный каталог
+const testConfigYAML = `
+api_url: https://api.example.com/v1
+api_key: sk-test-secret
+telegram_bot_token: "123456:test-token"
+name: test
+model: gpt-4o
+tools:
+  - file_search
+`
+
+// Загружает конфигурацию testConfigYAML с дополнительными строками extra и готовит глобальное
+// состояние бота. После проверки прежнее состояние восстанавливается
+func useTestConfig(t *testing.T, extra string) {
+	t.Helper()
+	savedConfig, savedState, savedBreaker, savedSlots := config, state, runBreaker, runSlots
+	t.Cleanup(func() {
+		config, state, runBreaker, runSlots = savedConfig, savedState, savedBreaker, savedSlots
+	})
+
+	dir := t.TempDir()
+	data := testConfigYAML + "files_path: " + filepath.Join(dir, "files") + "\nstate_file: " + filepath.Join(dir, "state.json") + "\n" + extra
+	path := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadConfig(path); err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	state = &BotState{}
+	runBreaker = newCircuitBreaker(config.BreakerThreshold, config.BreakerWindow, config.BreakerCooldown)
+	runSlots = newRunLimiter(config.MaxConcurrentRuns, config.MaxQueuedRuns)
+}
+
+// Бот первой конфигурации с подменой Telegram. API — клиент по адресу api_url из конфигурации
+func newSenderBot(t *testing.T) (*botInstance, *fakeSender) {
+	t.Helper()
+	b := newBotInstance(config.Bots[0])
+	b.log = slog.New(slog.NewTextHandler(io.Discard, nil))
+	sender := &fakeSender{}
+	b.sender = sender
+	return b, sender
+}
+
+// Бот первой конфигурации с подменой API и Telegram, готовый отвечать без запуска setupAssistant
+func newTestBot(t *testing.T, api *openai.Mock) (*botInstance, *fakeSender) {
+	t.Helper()
+	b, sender := newSenderBot(t)
+	b.api = api
+	b.assistantID = "asst_test"
+	b.vectorStoreID = "vs_test"
+	return b, sender
+}
+
+// Ждёт, пока не опустеют очереди запусков бота
+func waitQueues(t *testing.T, b *botInstance) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for b.queues.Active() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Очереди запусков не опустели")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// Личное текстовое сообщение пользователя userID
+func privateMessage(userID int64, messageID int, text string) *tgbotapi.Message {
+	return &tgbotapi.Message{
+		MessageID: messageID,
+		From:      &tgbotapi.User{ID: userID, LanguageCode: "ru"},
+		Chat:      &tgbotapi.Chat{ID: userID, Type: "private"},
+		Text:      text,
+	}
+}
+
+// Ответ ассистента с текстом text без потока
+func answerRun(text string) func(ctx context.Context, req openai.RunRequest, observer openai.RunObserver) (openai.RunResult, error) {
+	return func(ctx context.Context, req openai.RunRequest, observer openai.RunObserver) (openai.RunResult, error) {
+		return openai.RunResult{Text: text, RunID: "run_test", Usage: openai.Usage{TotalTokens: 10}}, nil
+	}
+}
+
+// Текст сообщения на языке lang: внутри проверок имя t занято *testing.T
+var translate = t
+
+// Каждая попытка запуска, в том числе отброшенная, учитывается в дневном расходе пользователя
+func TestProcessRunRecordsUsageOfEveryAttempt(t *testing.T) {
+	tests := []struct {
+		name  string
+		extra string
+		// Результаты попыток по порядку
+		attempts []error
+	}{
+		{"повтор пустого ответа", "empty_response_retries: 2\n", []error{openai.ErrEmptyResponse, openai.ErrEmptyResponse, nil}},
+		{"резервная модель", "fallback_model: gpt-4o-mini\n", []error{&openai.APIError{StatusCode: 404, ErrorCode: "model_not_found"}, nil}},
+		{"повтор с указанием", "retry_on_empty: true\n", []error{openai.ErrEmptyResponse, nil}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestConfig(t, tt.extra)
+			calls := 0
+			b, sender := newTestBot(t, &openai.Mock{
+				CreateThreadRunFunc: func(ctx context.Context, req openai.RunRequest, observer openai.RunObserver) (openai.RunResult, error) {
+					err := tt.attempts[calls]
+					calls++
+					result := openai.RunResult{Usage: openai.Usage{TotalTokens: 10}}
+					if err == nil {
+						result.Text = "ответ"
+					}
+					return result, err
+				},
+			})
+			const userID = 100
+
+			handleUserQuery(context.Background(), b, privateMessage(userID, 1, "вопрос"), "вопрос", "", "", false, false)
+			waitQueues(t, b)
+
+			if calls != len(tt.attempts) {
+				t.Fatalf("Попыток %d, want %d", calls, len(tt.attempts))
+			}
+			if got := sender.texts(); !slices.Contains(got, "ответ") {
+				t.Errorf("Отправлено %q, ожидается ответ", got)
+			}
+			usage := b.sessions.Usage(userID)
+			if want := int64(10 * len(tt.attempts)); usage.Tokens != want || usage.Runs != len(tt.attempts) {
+				t.Errorf("Расход = %d токенов за %d запусков, want %d за %d", usage.Tokens, usage.Runs, want, len(tt.attempts))
+			}
+		})
+	}
+}
+
+// Записывает конфигурацию во временный файл и возвращает его путь
+func writeTestConfig(t *testing.T, data string) string {
+	t.Helper()
+	dir := t.TempDir()
+	data += "\nfiles_path: " + filepath.Join(dir, "files") + "\n"
+	path := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	saved := config
+	t.Cleanup(func() { config = saved })
+
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+		check   func(t *testing.T)
+	}{
+		{
+			name: "допустимая конфигурация",
+			data: testConfigYAML + "max_context_messages: 7\ntemperature: 0.3\n",
+			check: func(t *testing.T) {
+				if config.APIKey != "sk-test-secret" || config.Model != "gpt-4o" {
+					t.Errorf("api_key, model = %q, %q", config.APIKey, config.Model)
+				}
+				if config.MaxContextMessages != 7 || *config.Temperature != 0.3 {
+					t.Errorf("max_context_messages, temperature = %d, %v", config.MaxContextMessages, *config.Temperature)
+				}
+				if config.Provider != "openai" || config.SessionTTL != 24*time.Hour || config.MaxInputChars != 4000 {
+					t.Errorf("Значения по умолчанию: provider %q, session_ttl %v, max_input_chars %d", config.Provider, config.SessionTTL, config.MaxInputChars)
+				}
+				// Единственный бот получает настройки верхнего уровня
+				if len(config.Bots) != 1 || config.Bots[0].Name != "test" || config.Bots[0].Model != "gpt-4o" || config.Bots[0].MaxContextMessages != 7 {
+					t.Errorf("bots = %+v", config.Bots)
+				}
+			},
+		},
+		{
+			name:  "max_context_messages не задано",
+			data:  testConfigYAML,
+			check: func(t *testing.T) { checkMaxContextMessages(t, 10) },
+		},
+		{
+			name:  "max_context_messages равно нулю",
+			data:  testConfigYAML + "max_context_messages: 0\n",
+			check: func(t *testing.T) { checkMaxContextMessages(t, 10) },
+		},
+		{
+			name:  "max_context_messages отрицательно",
+			data:  testConfigYAML + "max_context_messages: -5\n",
+			check: func(t *testing.T) { checkMaxContextMessages(t, 10) },
+		},
+		{
+			name: "бот со своим max_context_messages",
+			data: testConfigYAML + "max_context_messages: 5\nbots:\n  - name: first\n  - name: second\n    max_context_messages: 20\n",
+			check: func(t *testing.T) {
+				if config.Bots[0].MaxContextMessages != 5 || config.Bots[1].MaxContextMessages != 20 {
+					t.Errorf("max_context_messages ботов = %d, %d, want 5, 20", config.Bots[0].MaxContextMessages, config.Bots[1].MaxContextMessages)
+				}
+			},
+		},
+		{
+			name:    "некорректный YAML",
+			data:    testConfigYAML + "tools: [file_search\n",
+			wantErr: "Ошибка разбора файла конфигурации",
+		},
+		{
+			name:    "неизвестный ключ",
+			data:    testConfigYAML + "max_context_mesages: 5\n",
+			wantErr: "max_context_mesages",
+		},
+		{
+			name:    "повтор имени бота",
+			data:    testConfigYAML + "bots:\n  - name: same\n  - name: same\n",
+			wantErr: "используется несколько раз",
+		},
+		{
+			name: "api_url с путём шлюза и / в конце",
+			data: strings.Replace(testConfigYAML, "https://api.example.com/v1", "https://gateway.example.com/llm/v1/", 1),
+			check: func(t *testing.T) {
+				if want := "https://gateway.example.com/llm/v1/audio/transcriptions"; config.TranscriptionURL != want {
+					t.Errorf("transcription_url = %q, want %q", config.TranscriptionURL, want)
+				}
+			},
+		},
+		{
+			name: "Azure OpenAI",
+			data: testConfigYAML + "provider: azure\nazure_deployment: my-gpt\n",
+			check: func(t *testing.T) {
+				if config.Provider != "azure" || config.AzureDeployment != "my-gpt" || config.AzureAPIVersion != "2024-05-01-preview" {
+					t.Errorf("provider %q, azure_deployment %q, azure_api_version %q", config.Provider, config.AzureDeployment, config.AzureAPIVersion)
+				}
+				// Распознавание речи доступно по пути развёртывания модели
+				if want := "https://api.example.com/v1/deployments/whisper-1/audio/transcriptions"; config.TranscriptionURL != want {
+					t.Errorf("transcription_url = %q, want %q", config.TranscriptionURL, want)
+				}
+			},
+		},
+		{
+			name: "truncation_strategy last_messages",
+			data: testConfigYAML + "truncation_strategy:\n  type: last_messages\n  last_messages: 6\n",
+			check: func(t *testing.T) {
+				if ts := config.TruncationStrategy; ts == nil || ts.Type != "last_messages" || ts.LastMessages != 6 {
+					t.Errorf("truncation_strategy = %+v", ts)
+				}
+			},
+		},
+		{
+			name:    "truncation_strategy last_messages меньше 1",
+			data:    testConfigYAML + "truncation_strategy:\n  type: last_messages\n  last_messages: 0\n",
+			wantErr: "не меньше 1",
+		},
+		{
+			name:    "truncation_strategy auto с last_messages",
+			data:    testConfigYAML + "truncation_strategy:\n  type: auto\n  last_messages: 5\n",
+			wantErr: "только для type: last_messages",
+		},
+		{
+			name:    "неизвестный тип truncation_strategy",
+			data:    testConfigYAML + "truncation_strategy:\n  type: first_messages\n",
+			wantErr: "Неизвестный тип truncation_strategy",
+		},
+		{
+			name:    "неизвестный поставщик",
+			data:    testConfigYAML + "provider: anthropic\n",
+			wantErr: "Неизвестный поставщик",
+		},
+		{
+			name:    "температура вне диапазона",
+			data:    testConfigYAML + "temperature: 3\n",
+			wantErr: "Температура",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := loadConfig(writeTestConfig(t, tt.data))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("loadConfig = %v, want ошибку с %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("loadConfig: %v", err)
+			}
+			tt.check(t)
+		})
+	}
+}
+
+func TestLoadConfigMissingFile(t *testing.T) {
+	saved := config
+	t.Cleanup(func() { config = saved })
+
+	err := loadConfig(filepath.Join(t.TempDir(), "config.yaml"))
+	if err == nil || !strings.Contains(err.Error(), "Ошибка чтения файла конфигурации") {
+		t.Fatalf("loadConfig = %v, want ошибку чтения файла", err)
+	}
+}
+
+// Значения предыдущей загрузки не переносятся в новую
+func TestLoadConfigResetsPreviousValues(t *testing.T) {
+	saved := config
+	t.Cleanup(func() { config = saved })
+
+	if err := loadConfig(writeTestConfig(t, testConfigYAML+"fallback_model: gpt-4o-mini\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadConfig(writeTestConfig(t, testConfigYAML)); err != nil {
+		t.Fatal(err)
+	}
+	if config.FallbackModel != "" {
+		t.Errorf("fallback_model = %q после загрузки конфигурации без него", config.FallbackModel)
+	}
+}
+
+func checkMaxContextMessages(t *testing.T, want int) {
+	t.Helper()
+	if config.MaxContextMessages != want || config.Bots[0].MaxContextMessages != want {
+		t.Errorf("max_context_messages = %d, у бота %d, want %d", config.MaxContextMessages, config.Bots[0].MaxContextMessages, want)
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const latencyWindow = 100
+
+// dailyCounter — счётчик, который обнуляется с началом нового дня
+type dailyCounter struct {
+	mu    sync.Mutex
+	day   string
+	value int64
+}
+
+func (c *dailyCounter) Add(n int64) {
+	today := time.Now().Format(time.DateOnly)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.day != today {
+		c.day = today
+		c.value = 0
+	}
+	c.value += n
+}
+
+func (c *dailyCounter) Value() int64 {
+	today := time.Now().Format(time.DateOnly)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.day != today {
+		return 0
+	}
+	return c.value
+}
+
+// Metrics — сборщик метрик работы бота для команды /stats
+type Metrics struct {
+	startTime     time.Time
+	messagesToday dailyCounter
+	tokensToday   dailyCounter
+	runsInFlight  atomic.Int64
+	// Количество подавленных повторных вопросов
+	duplicatesSuppressed atomic.Int64
+	// Количество сообщений, отклонённых модерацией
+	moderationFlagged atomic.Int64
+	// Количество ответов, взятых из кэша без запуска ассистента
+	cacheHits atomic.Int64
+	// Количество повторов с указанием опираться на документы после пустого ответа или отказа
+	nudgeRetries atomic.Int64
+
+	latMu     sync.Mutex
+	latencies [latencyWindow]time.Duration
+	latIdx    int
+	latCount  int
+
+	errMu  sync.Mutex
+	errors map[string]int64
+}
+
+var metrics = &Metrics{
+	startTime: time.Now(),
+	errors:    make(map[string]int64),
+}
+
+// Категории ошибок для статистики
+const (
+	errorCategoryRun   = "run"
+	errorCategoryEmpty = "empty_response"
+	errorCategorySend  = "send"
+)
+
+// Запоминает длительность запуска ассистента в кольцевом буфере
+func (m *Metrics) ObserveRunLatency(d time.Duration) {
+	m.latMu.Lock()
+	defer m.latMu.Unlock()
+
+	m.latencies[m.latIdx] = d
+	m.latIdx = (m.latIdx + 1) % latencyWindow
+	if m.latCount < latencyWindow {
+		m.latCount++
+	}
+}
+
+// Средняя длительность последних запусков ассистента
+func (m *Metrics) AverageRunLatency() time.Duration {
+	m.latMu.Lock()
+	defer m.latMu.Unlock()
+
+	if m.latCount == 0 {
+		return 0
+	}
+	var total time.Duration
+	for i := 0; i < m.latCount; i++ {
+		total += m.latencies[i]
+	}
+	return total / time.Duration(m.latCount)
+}
+
+func (m *Metrics) IncError(category string) {
+	m.errMu.Lock()
+	m.errors[category]++
+	m.errMu.Unlock()
+}
+
+// Формирует текст для команды /stats
+func (m *Metrics) Report(activeSessions int) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Версия:                %s\n", currentBuild())
+	fmt.Fprintf(&b, "Время работы:          %s\n", time.Since(m.startTime).Truncate(time.Second))
+	fmt.Fprintf(&b, "Активных сессий:       %d\n", activeSessions)
+	fmt.Fprintf(&b, "Сообщений за сегодня:  %d\n", m.messagesToday.Value())
+	fmt.Fprintf(&b, "Запусков в работе:     %d\n", m.runsInFlight.Load())
+	fmt.Fprintf(&b, "Средняя длительность:  %s\n", m.AverageRunLatency().Truncate(time.Millisecond))
+	fmt.Fprintf(&b, "Токенов за сегодня:    %d\n", m.tokensToday.Value())
+	fmt.Fprintf(&b, "Подавлено повторов:    %d\n", m.duplicatesSuppressed.Load())
+	fmt.Fprintf(&b, "Отклонено модерацией:  %d\n", m.moderationFlagged.Load())
+	fmt.Fprintf(&b, "Ответов из кэша:       %d\n", m.cacheHits.Load())
+	fmt.Fprintf(&b, "Повторов с указанием:  %d\n", m.nudgeRetries.Load())
+
+	m.errMu.Lock()
+	categories := make([]string, 0, len(m.errors))
+	for category := range m.errors {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+	b.WriteString("Ошибки:\n")
+	if len(categories) == 0 {
+		b.WriteString("  нет\n")
+	}
+	for _, category := range categories {
+		fmt.Fprintf(&b, "  %-20s %d\n", category, m.errors[category])
+	}
+	m.errMu.Unlock()
+
+	return b.String()
+}
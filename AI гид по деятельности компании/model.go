@@ -0,0 +1,124 @@
+package main
+
+import (
+	"maps"
+	"slices"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Данные кнопок /model: model:<псевдоним> — выбор модели, model: — модель по умолчанию
+const modelCallbackPrefix = "model:"
+
+// Возвращает псевдонимы моделей, доступные пользователю. Администраторам и пользователям
+// из model_switch_user_ids доступны все модели из models, остальным — из allowed_user_models.
+func availableModels(userID int64) []string {
+	if isAdmin(userID) || slices.Contains(config.ModelSwitchUserIDs, userID) {
+		return slices.Sorted(maps.Keys(config.Models))
+	}
+	return config.AllowedUserModels
+}
+
+// Возвращает псевдоним модели для показа пользователю. Модель не из models показывается как есть.
+func modelAlias(model string) string {
+	for alias, name := range config.Models {
+		if name == model {
+			return alias
+		}
+	}
+	return model
+}
+
+// Формирует кнопки выбора модели. Текущая модель отмечена галочкой.
+func modelKeyboard(lang string, aliases []string, current string) tgbotapi.InlineKeyboardMarkup {
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, alias := range aliases {
+		label := alias + " — " + config.Models[alias]
+		if config.Models[alias] == current {
+			label = "✓ " + label
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(label, modelCallbackPrefix+alias)))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(t(lang, "model.default_button"), modelCallbackPrefix)))
+	return tgbotapi.InlineKeyboardMarkup{InlineKeyboard: rows}
+}
+
+// /model <псевдоним> — выбирает модель для ответов пользователю из models,
+// /model reset — возвращает модель ассистента, /model без аргументов — показывает текущую
+// модель и кнопки выбора
+func handleModelCommand(b *botInstance, message *tgbotapi.Message) {
+	lang := userLanguage(b, message.From)
+	aliases := availableModels(message.From.ID)
+	if len(aliases) == 0 {
+		sendMessage(b, tgbotapi.NewMessage(message.Chat.ID, t(lang, "model.disabled")))
+		return
+	}
+
+	session := b.sessions.GetOrCreate(chatSession(message.Chat, message.From.ID))
+	args := commandArgs(message)
+
+	session.mu.Lock()
+	current := session.Model
+	session.mu.Unlock()
+
+	var reply string
+	switch {
+	case args == "":
+		shown := b.cfg.Model
+		if current != "" {
+			shown = modelAlias(current)
+		}
+		msg := tgbotapi.NewMessage(message.Chat.ID, t(lang, "model.current", shown))
+		msg.ReplyMarkup = modelKeyboard(lang, aliases, current)
+		sendMessage(b, msg)
+		return
+	case args == "reset":
+		reply = setUserModel(b, message.From.ID, session, "", lang)
+	case !slices.Contains(aliases, args):
+		reply = t(lang, "model.not_allowed", args, strings.Join(aliases, ", "))
+	default:
+		reply = setUserModel(b, message.From.ID, session, args, lang)
+	}
+	sendMessage(b, tgbotapi.NewMessage(message.Chat.ID, reply))
+}
+
+// Обрабатывает выбор модели кнопкой /model
+func handleModelCallback(b *botInstance, query *tgbotapi.CallbackQuery) {
+	lang := userLanguage(b, query.From)
+	alias := strings.TrimPrefix(query.Data, modelCallbackPrefix)
+	// Список доступных моделей мог измениться после отправки кнопок
+	if alias != "" && !slices.Contains(availableModels(query.From.ID), alias) {
+		b.sender.Request(tgbotapi.NewCallback(query.ID, t(lang, "model.not_allowed", alias, strings.Join(availableModels(query.From.ID), ", "))))
+		return
+	}
+
+	reply := setUserModel(b, query.From.ID, b.sessions.GetOrCreate(chatSession(query.Message.Chat, query.From.ID)), alias, lang)
+	b.sender.Request(tgbotapi.NewCallback(query.ID, ""))
+	b.sender.Request(tgbotapi.NewEditMessageText(query.Message.Chat.ID, query.Message.MessageID, reply))
+}
+
+// Запоминает модель пользователя по псевдониму. Пустой псевдоним возвращает модель ассистента.
+// Возвращает ответ пользователю.
+func setUserModel(b *botInstance, userID int64, session *UserSession, alias, lang string) string {
+	session.mu.Lock()
+	session.Model = config.Models[alias]
+	session.mu.Unlock()
+
+	b.log.Info("Пользователь выбрал модель", "user_id", userID, "alias", alias, "model", config.Models[alias])
+	if alias == "" {
+		return t(lang, "model.reset", b.cfg.Model)
+	}
+	return t(lang, "model.set", alias+" ("+config.Models[alias]+")")
+}
+
+// Проверяет, что модель рассуждающая (o1, o3) по префиксам из reasoning_model_prefixes:
+// имя совпадает с префиксом или продолжается после него через дефис (o1-mini, o3-2025-04-16)
+func isReasoningModel(model string) bool {
+	for _, prefix := range config.ReasoningModelPrefixes {
+		if model == prefix || strings.HasPrefix(model, prefix+"-") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"proxyapi-bot/internal/openai"
+)
+
+func TestIsReasoningModel(t *testing.T) {
+	tests := []struct {
+		extra string
+		model string
+		want  bool
+	}{
+		{"", "o1", true},
+		{"", "o1-mini", true},
+		{"", "o3-2025-04-16", true},
+		{"", "o4-mini", true},
+		{"", "gpt-4o", false},
+		{"", "o10", false},
+		{"", "gpt-o1", false},
+		{"reasoning_model_prefixes: [deepseek-r1]\n", "deepseek-r1-distill", true},
+		{"reasoning_model_prefixes: [deepseek-r1]\n", "o1-mini", false},
+	}
+	for _, tt := range tests {
+		useTestConfig(t, tt.extra)
+		if got := isReasoningModel(tt.model); got != tt.want {
+			t.Errorf("isReasoningModel(%q) при %q = %v, want %v", tt.model, tt.extra, got, tt.want)
+		}
+	}
+}
+
+// Запуск рассуждающей модели — бота или выбранной пользователем — получает reasoning_effort
+// и увеличенную длительность потока, запуск обычной модели — нет
+func TestReasoningRunRequest(t *testing.T) {
+	tests := []struct {
+		name      string
+		botModel  string
+		userModel string
+		want      bool
+	}{
+		{"обычная модель", "gpt-4o", "", false},
+		{"рассуждающая модель бота", "o3-mini", "", true},
+		{"рассуждающая модель пользователя", "gpt-4o", "o1", true},
+		{"обычная модель пользователя", "o3-mini", "gpt-4o-mini", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestConfig(t, "reasoning_effort: low\nreasoning_stream_timeout_seconds: 600\n")
+			var got openai.RunRequest
+			b, _ := newTestBot(t, &openai.Mock{
+				CreateThreadRunFunc: func(ctx context.Context, req openai.RunRequest, observer openai.RunObserver) (openai.RunResult, error) {
+					got = req
+					return openai.RunResult{Text: "ответ"}, nil
+				},
+			})
+			b.cfg.Model = tt.botModel
+
+			run := runRequest{RunRequest: openai.RunRequest{AssistantID: b.assistantID, Model: tt.userModel, Temperature: 1}}
+			if _, err := runAssistant(context.Background(), b, run); err != nil {
+				t.Fatal(err)
+			}
+			if tt.want {
+				if !got.Reasoning || got.ReasoningEffort != "low" || got.StreamTimeout != 600*time.Second {
+					t.Errorf("Reasoning %v, ReasoningEffort %q, StreamTimeout %v", got.Reasoning, got.ReasoningEffort, got.StreamTimeout)
+				}
+			} else if got.Reasoning || got.ReasoningEffort != "" || got.StreamTimeout != 0 {
+				t.Errorf("Обычная модель: Reasoning %v, ReasoningEffort %q, StreamTimeout %v", got.Reasoning, got.ReasoningEffort, got.StreamTimeout)
+			}
+		})
+	}
+}
+
+// Отклонённый моделью параметр запуска сообщается пользователю отдельным текстом
+func TestUnsupportedParameterReply(t *testing.T) {
+	useTestConfig(t, "")
+	b, sender := newTestBot(t, &openai.Mock{
+		CreateThreadRunFunc: func(ctx context.Context, req openai.RunRequest, observer openai.RunObserver) (openai.RunResult, error) {
+			return openai.RunResult{}, &openai.APIError{StatusCode: 400, ErrorCode: "unsupported_parameter", Param: "temperature",
+				Message: "Unsupported parameter: 'temperature' is not supported with this model."}
+		},
+	})
+
+	ctx := openai.WithRequestID(context.Background(), "req_1")
+	handleUserQuery(ctx, b, privateMessage(100, 1, "вопрос"), "вопрос", "", "", false, false)
+	waitQueues(t, b)
+
+	want := translate("ru", "error.unsupported_parameter") + "\n\n" + translate("ru", "error.code", "req_1")
+	if !slices.Contains(sender.texts(), want) {
+		t.Errorf("Отправлено %q, ожидается %q", sender.texts(), want)
+	}
+}
+
+func TestLoadConfigReasoning(t *testing.T) {
+	saved := config
+	t.Cleanup(func() { config = saved })
+
+	if err := loadConfig(writeTestConfig(t, testConfigYAML)); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(config.ReasoningModelPrefixes, []string{"o1", "o3", "o4"}) || config.ReasoningStreamTimeoutSeconds != 900 {
+		t.Errorf("По умолчанию reasoning_model_prefixes %q, reasoning_stream_timeout_seconds %d", config.ReasoningModelPrefixes, config.ReasoningStreamTimeoutSeconds)
+	}
+	if err := loadConfig(writeTestConfig(t, testConfigYAML+"reasoning_effort: maximum\n")); err == nil {
+		t.Error("Недопустимый reasoning_effort принят")
+	}
+}
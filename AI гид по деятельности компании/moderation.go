@@ -0,0 +1,27 @@
+package main
+
+import (
+	"context"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Проверяет вопрос пользователя до запуска ассистента. При отклонении отправляет пользователю
+// вежливый отказ и возвращает false. Если модерация недоступна, вопрос пропускается.
+func passesModeration(ctx context.Context, b *botInstance, message *tgbotapi.Message, query, lang string) bool {
+	log := requestLog(ctx, b.log)
+	result, err := b.api.Moderate(ctx, config.ModerationModel, query)
+	if err != nil {
+		log.Warn("Ошибка модерации, сообщение обрабатывается без проверки", "user_id", message.From.ID, "error", err)
+		return true
+	}
+
+	flagged, categories := result.Exceeds(config.ModerationThresholds)
+	if !flagged {
+		return true
+	}
+
+	log.Warn("Сообщение отклонено модерацией", "user_id", message.From.ID, "categories", categories, "scores", result.CategoryScores, "query", query)
+	metrics.moderationFlagged.Add(1)
+	sendMessage(b, tgbotapi.NewMessage(message.Chat.ID, t(lang, "moderation.refused")))
+	return false
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+	"unicode/utf8"
+
+	"proxyapi-bot/internal/openai"
+)
+
+// Указание для повтора запуска после пустого ответа или отказа
+const nudgeInstructions = "Ответь, используя загруженные документы; если информации нет, скажи об этом явно."
+
+// Отказом считается только короткий ответ: развёрнутый ответ с оговоркой полезен и без повтора
+const refusalMaxChars = 300
+
+// Шаблоны отказа по умолчанию, если refusal_patterns не заданы
+var defaultRefusalPatterns = []string{
+	`(?i)^[\s\p{P}]*(извините|простите|к сожалению).*(не (могу|смог|нашёл|нашел|удалось|располагаю)|нет (информации|сведений|данных))`,
+	`(?i)^[\s\p{P}]*(я )?не (могу|смог) (ответить|помочь|найти)`,
+	`(?i)^[\s\p{P}]*(i'?m sorry|sorry|unfortunately)\b.*\b(can(no|')t|could ?n[o']t|unable|don'?t have)`,
+}
+
+// Скомпилированные refusal_patterns
+var refusalPatterns []*regexp.Regexp
+
+// Компилирует шаблоны отказа из настроек
+func compileRefusalPatterns(patterns []string) error {
+	refusalPatterns = refusalPatterns[:0]
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return fmt.Errorf("Некорректный шаблон %q в refusal_patterns: %v", p, err)
+		}
+		refusalPatterns = append(refusalPatterns, re)
+	}
+	return nil
+}
+
+// Проверяет, что ответ — короткий отказ по одному из refusal_patterns
+func isRefusal(text string) bool {
+	if utf8.RuneCountInString(text) > refusalMaxChars {
+		return false
+	}
+	for _, re := range refusalPatterns {
+		if re.MatchString(text) {
+			return true
+		}
+	}
+	return false
+}
+
+// При retry_on_empty повторяет запуск один раз с указанием опираться на загруженные документы,
+// если ассистент вернул пустой ответ или отказ. Ошибка API не повторяется. Повтор расходует
+// ограничение частоты запросов пользователя: без свободного запроса возвращается прежний результат.
+func retryWithNudge(ctx context.Context, b *botInstance, userID int64, session *UserSession, run runRequest, result openai.RunResult, err error, access *accessEntry) (openai.RunResult, error) {
+	if !config.RetryOnEmpty {
+		return result, err
+	}
+	var reason string
+	switch {
+	case errors.Is(err, openai.ErrEmptyResponse):
+		reason = "empty"
+	case err == nil && len(result.Files) == 0 && isRefusal(result.Text):
+		reason = "refusal"
+	default:
+		return result, err
+	}
+
+	log := requestLog(ctx, b.log)
+	if b.rateLimit.Enabled() {
+		session.mu.Lock()
+		allowed, _, _ := session.limiter.allow(b.rateLimit, time.Now())
+		session.mu.Unlock()
+		if !allowed {
+			log.Info("Повтор с указанием не выполнен: превышено ограничение частоты запросов", "user_id", userID, "reason", reason)
+			return result, err
+		}
+	}
+
+	log.Warn("Ассистент не ответил по документам, повтор запуска с указанием", "user_id", userID, "reason", reason)
+	metrics.nudgeRetries.Add(1)
+	promNudgeRetries.Inc(reason)
+	access.retries++
+	// Расход первой попытки учитывается здесь, расход повтора — вместе с ответом
+	recordUsage(b, userID, result.Usage.TotalTokens)
+
+	run.AdditionalInstructions = joinInstructions(run.AdditionalInstructions, nudgeInstructions)
+	return runAssistant(ctx, b, run)
+}
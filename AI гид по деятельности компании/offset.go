@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// updateOffsetStore хранит ID последнего обработанного обновления каждого бота.
+// Нулевой указатель означает, что смещения не сохраняются.
+type updateOffsetStore struct {
+	mu      sync.Mutex
+	path    string
+	offsets map[string]int
+}
+
+var updateOffsets *updateOffsetStore
+
+// Загружает сохранённые смещения. Отсутствие файла не является ошибкой.
+func openUpdateOffsets(path string) (*updateOffsetStore, error) {
+	s := &updateOffsetStore{path: path, offsets: make(map[string]int)}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, fmt.Errorf("Ошибка чтения файла смещений обновлений: %v", err)
+	}
+	if err := json.Unmarshal(data, &s.offsets); err != nil {
+		return nil, fmt.Errorf("Ошибка разбора файла смещений обновлений: %v", err)
+	}
+	return s, nil
+}
+
+// Возвращает смещение, с которого бот продолжает получать обновления, или 0,
+// если обработанные обновления не сохранены
+func (s *updateOffsetStore) Next(bot string) int {
+	if s == nil {
+		return 0
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if last, ok := s.offsets[bot]; ok {
+		return last + 1
+	}
+	return 0
+}
+
+// Сохраняет ID обработанного обновления. Файл записывается атомарно, чтобы сбой
+// во время записи не привёл к повторной обработке всех неподтверждённых обновлений.
+func (s *updateOffsetStore) Save(bot string, updateID int) error {
+	if s == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if updateID <= s.offsets[bot] {
+		return nil
+	}
+	s.offsets[bot] = updateID
+
+	data, err := json.Marshal(s.offsets)
+	if err != nil {
+		return fmt.Errorf("Ошибка формирования файла смещений обновлений: %v", err)
+	}
+	return writeFileAtomic(s.path, data)
+}
+
+// Передаёт обновления обработчику и сохраняет ID каждого принятого им обновления.
+// Канал без буфера, поэтому обновление считается обработанным, когда обработчик его
+// принял: к этому моменту он закончил с предыдущим, а ответ ассистента готовится отдельно.
+func trackUpdateOffsets(b *botInstance, updates tgbotapi.UpdatesChannel) tgbotapi.UpdatesChannel {
+	if updateOffsets == nil {
+		return updates
+	}
+
+	tracked := make(chan tgbotapi.Update)
+	go func() {
+		defer close(tracked)
+		for update := range updates {
+			tracked <- update
+			if err := updateOffsets.Save(b.cfg.Name, update.UpdateID); err != nil {
+				b.log.Error("Ошибка сохранения смещения обновлений", "update_id", update.UpdateID, "error", err)
+			}
+		}
+	}()
+	return tracked
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Код завершения, когда обновления с тем же токеном получает другой экземпляр бота.
+// Отличается от кода 1 (ошибка запуска), чтобы супервизор не перезапускал бота бесконечно.
+const exitCodeConflict = 3
+
+// Пауза перед первым повтором getUpdates после ошибки. Каждая следующая ошибка подряд
+// удваивает паузу до pollingMaxRetryDelay
+const (
+	pollingRetryDelay    = 3 * time.Second
+	pollingMaxRetryDelay = 2 * time.Minute
+)
+
+// Запас сверх polling_timeout_seconds, после которого запрос getUpdates считается зависшим:
+// соединение, разорванное без уведомления, иначе держало бы его бесконечно
+const pollingStallGrace = 30 * time.Second
+
+// Получает обновления long polling. В отличие от GetUpdatesChan, который бесконечно повторяет
+// любую ошибку, при конфликте с другим экземпляром бота (ответ 409) программа завершается.
+// Зависший запрос прерывается по времени, а после ошибок соединение восстанавливается
+// с экспоненциально растущей паузой, чтобы бот не перестал получать обновления незаметно.
+// Возвращает канал обновлений и функцию, которая прекращает получение и закрывает канал.
+func pollUpdates(b *botInstance, u tgbotapi.UpdateConfig) (tgbotapi.UpdatesChannel, func()) {
+	updates := make(chan tgbotapi.Update, b.tg.Buffer)
+	done := make(chan struct{})
+
+	// Отдельный клиент с ограничением времени запроса только для getUpdates: у клиента бота
+	// ограничения нет, и отправка больших файлов не должна прерываться
+	poller := *b.tg
+	poller.Client = &http.Client{Timeout: time.Duration(u.Timeout)*time.Second + pollingStallGrace}
+
+	go func() {
+		defer close(updates)
+		failures := 0
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+
+			batch, err := poller.GetUpdates(u)
+			// Ошибки получения обновлений видны в /readyz, не дожидаясь очередной проверки getMe
+			b.recordTelegramResult(err)
+			if err != nil {
+				if isUpdatesConflict(err) {
+					exitOnUpdatesConflict(b, err)
+				}
+				failures++
+				delay := pollingBackoff(failures)
+				b.log.Warn("Ошибка получения обновлений, повторное подключение к Telegram", "attempt", failures, "retry_in", delay, "error", err)
+				select {
+				case <-done:
+					return
+				case <-time.After(delay):
+				}
+				continue
+			}
+			if failures > 0 {
+				b.log.Info("Получение обновлений восстановлено", "failed_attempts", failures)
+				failures = 0
+			}
+
+			for _, update := range batch {
+				if update.UpdateID < u.Offset {
+					continue
+				}
+				u.Offset = update.UpdateID + 1
+				select {
+				case updates <- update:
+				case <-done:
+					return
+				}
+			}
+		}
+	}()
+
+	var once sync.Once
+	return updates, func() { once.Do(func() { close(done) }) }
+}
+
+// Пауза перед повтором после failures ошибок подряд: pollingRetryDelay, удвоенная за каждую
+// ошибку после первой, не больше pollingMaxRetryDelay
+func pollingBackoff(failures int) time.Duration {
+	delay := pollingRetryDelay
+	for i := 1; i < failures && delay < pollingMaxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, pollingMaxRetryDelay)
+}
+
+// Проверяет, что Telegram отказал в getUpdates из-за другого экземпляра бота: он получает
+// обновления сам или установил вебхук
+func isUpdatesConflict(err error) bool {
+	var tgErr *tgbotapi.Error
+	return errors.As(err, &tgErr) && tgErr.Code == http.StatusConflict
+}
+
+// Завершает программу с кодом exitCodeConflict: пока работают оба экземпляра, каждый
+// получает только часть обновлений
+func exitOnUpdatesConflict(b *botInstance, err error) {
+	b.log.Error("ДРУГОЙ ЭКЗЕМПЛЯР БОТА ПОЛУЧАЕТ ОБНОВЛЕНИЯ С ЭТИМ ТОКЕНОМ: остановите его или используйте другой telegram_bot_token",
+		"error", err, "exit_code", exitCodeConflict)
+	releaseInstanceLock()
+	os.Exit(exitCodeConflict)
+}
+
+// Файл блокировки, захваченный этим экземпляром. Пусто — блокировка не используется.
+var instanceLockPath string
+
+// Захватывает файл блокировки, чтобы на одной машине нельзя было случайно запустить
+// второй экземпляр бота. В файл записывается PID. Файл, оставшийся от завершившегося
+// процесса, захватывается заново.
+func acquireInstanceLock(path string) error {
+	for attempt := 0; attempt < 2; attempt++ {
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err == nil {
+			_, err = fmt.Fprintf(file, "%d\n", os.Getpid())
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				os.Remove(path)
+				return fmt.Errorf("Ошибка записи файла блокировки: %v", err)
+			}
+			instanceLockPath = path
+			return nil
+		}
+		if !os.IsExist(err) {
+			return fmt.Errorf("Ошибка создания файла блокировки: %v", err)
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("Ошибка чтения файла блокировки: %v", err)
+		}
+		pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+		if err == nil && processAlive(pid) {
+			return fmt.Errorf("Бот уже запущен (PID %d, файл блокировки %s)", pid, path)
+		}
+		// Процесс, захвативший файл, завершился без его удаления
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("Ошибка удаления устаревшего файла блокировки: %v", err)
+		}
+	}
+	return fmt.Errorf("Не удалось захватить файл блокировки %s", path)
+}
+
+// Удаляет файл блокировки, захваченный этим экземпляром
+func releaseInstanceLock() {
+	if instanceLockPath == "" {
+		return
+	}
+	if err := os.Remove(instanceLockPath); err != nil && !os.IsNotExist(err) {
+		slog.Error("Ошибка удаления файла блокировки", "error", err)
+	}
+	instanceLockPath = ""
+}
+
+// Проверяет, что процесс с этим PID существует
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	return process.Signal(syscall.Signal(0)) == nil
+}
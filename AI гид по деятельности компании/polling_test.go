@@ -0,0 +1,99 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Бот, подключённый к тестовому серверу Telegram. getUpdates отвечает ошибкой, пока failing истинно
+func newPollingBot(t *testing.T, failing *atomic.Bool) *botInstance {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/getMe"):
+			io.WriteString(w, `{"ok":true,"result":{"id":1,"is_bot":true,"username":"test_bot"}}`)
+		case failing.Load():
+			io.WriteString(w, `{"ok":false,"error_code":502,"description":"Bad Gateway"}`)
+		default:
+			time.Sleep(10 * time.Millisecond)
+			io.WriteString(w, `{"ok":true,"result":[]}`)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	tg, err := tgbotapi.NewBotAPIWithAPIEndpoint("123:test", server.URL+"/bot%s/%s")
+	if err != nil {
+		t.Fatalf("NewBotAPIWithAPIEndpoint: %v", err)
+	}
+	return &botInstance{tg: tg, log: slog.New(slog.NewTextHandler(io.Discard, nil))}
+}
+
+// Ждёт, пока число неудачных запросов к Telegram не станет равным want
+func waitTelegramFailures(t *testing.T, b *botInstance, want int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		b.health.mu.Lock()
+		failures := b.health.telegramFailures
+		b.health.mu.Unlock()
+		if failures == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("telegramFailures = %d, want %d", failures, want)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestPollUpdatesRecordsFailure(t *testing.T) {
+	var failing atomic.Bool
+	failing.Store(true)
+	b := newPollingBot(t, &failing)
+
+	_, stop := pollUpdates(b, tgbotapi.UpdateConfig{})
+	defer stop()
+	// Повтор будет только через pollingRetryDelay, поэтому ошибка учитывается ровно один раз
+	waitTelegramFailures(t, b, 1)
+}
+
+func TestPollUpdatesRecordsRecovery(t *testing.T) {
+	var failing atomic.Bool
+	b := newPollingBot(t, &failing)
+	b.health.telegramFailures = 5
+
+	_, stop := pollUpdates(b, tgbotapi.UpdateConfig{})
+	defer stop()
+	waitTelegramFailures(t, b, 0)
+
+	b.health.mu.Lock()
+	defer b.health.mu.Unlock()
+	if time.Since(b.health.telegramOK) > time.Second {
+		t.Errorf("telegramOK = %v, ожидается время успешного getUpdates", b.health.telegramOK)
+	}
+}
+
+func TestPollingBackoff(t *testing.T) {
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{1, pollingRetryDelay},
+		{2, 2 * pollingRetryDelay},
+		{3, 4 * pollingRetryDelay},
+		{100, pollingMaxRetryDelay},
+	}
+	for _, tt := range tests {
+		if got := pollingBackoff(tt.failures); got != tt.want {
+			t.Errorf("pollingBackoff(%d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
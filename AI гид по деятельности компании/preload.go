@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Количество потоков, создаваемых одновременно при предварительной загрузке
+const preloadParallelism = 5
+
+// Заранее создаёт потоки OpenAI для пользователей из preload_user_ids, чтобы их первое
+// сообщение не ждало создания потока. Поток не заменяет тот, что пользователь успел создать сам.
+func preloadThreads(b *botInstance, userIDs []int64) {
+	if len(userIDs) == 0 {
+		return
+	}
+
+	start := time.Now()
+	ctx := context.Background()
+	slots := make(chan struct{}, preloadParallelism)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	created, failed := 0, 0
+
+	for _, userID := range userIDs {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(userID int64) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			threadID, err := b.api.CreateThread(ctx, []map[string]interface{}{}, b.vectorStoreID)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				failed++
+				b.log.Warn("Не удалось заранее создать поток пользователя", "user_id", userID, "error", err)
+				return
+			}
+			created++
+
+			session := b.sessions.GetOrCreate(privateSession(userID))
+			session.mu.Lock()
+			if session.ThreadID == "" && len(session.Messages) == 0 {
+				session.ThreadID = threadID
+			}
+			session.mu.Unlock()
+		}(userID)
+	}
+	wg.Wait()
+
+	b.log.Info("Потоки пользователей созданы заранее", "created", created, "failed", failed,
+		"duration", time.Since(start).Round(time.Millisecond))
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// promCounterVec — счётчик Prometheus с одной меткой. Пустое имя метки означает счётчик без меток.
+type promCounterVec struct {
+	name, help, label string
+
+	mu     sync.Mutex
+	values map[string]int64
+}
+
+func newPromCounterVec(name, help, label string) *promCounterVec {
+	return &promCounterVec{name: name, help: help, label: label, values: make(map[string]int64)}
+}
+
+func (c *promCounterVec) Add(labelValue string, n int64) {
+	c.mu.Lock()
+	c.values[labelValue] += n
+	c.mu.Unlock()
+}
+
+func (c *promCounterVec) Inc(labelValue string) {
+	c.Add(labelValue, 1)
+}
+
+func (c *promCounterVec) writeTo(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+	if c.label == "" {
+		fmt.Fprintf(w, "%s %d\n", c.name, c.values[""])
+		return
+	}
+
+	keys := make([]string, 0, len(c.values))
+	for k := range c.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s{%s=\"%s\"} %d\n", c.name, c.label, escapeLabelValue(k), c.values[k])
+	}
+}
+
+// promHistogram — гистограмма Prometheus со значениями в секундах
+type promHistogram struct {
+	name, help string
+	buckets    []float64
+
+	mu     sync.Mutex
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func newPromHistogram(name, help string, buckets []float64) *promHistogram {
+	return &promHistogram{name: name, help: help, buckets: buckets, counts: make([]uint64, len(buckets))}
+}
+
+func (h *promHistogram) Observe(d time.Duration) {
+	v := d.Seconds()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, bound := range h.buckets {
+		if v <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+func (h *promHistogram) writeTo(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	for i, bound := range h.buckets {
+		fmt.Fprintf(w, "%s_bucket{le=\"%g\"} %d\n", h.name, bound, h.counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", h.name, h.count)
+	fmt.Fprintf(w, "%s_sum %g\n", h.name, h.sum)
+	fmt.Fprintf(w, "%s_count %d\n", h.name, h.count)
+}
+
+func escapeLabelValue(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+// Границы корзин гистограмм длительности, в секундах
+var runLatencyBuckets = []float64{0.5, 1, 2, 5, 10, 20, 30, 60, 120}
+
+// Метрики для Prometheus. Счётчики защищены собственными мьютексами, поэтому безопасны
+// при обработке каждого запроса в отдельной горутине.
+var (
+	promMessagesReceived = newPromCounterVec("telegram_messages_received_total", "Сообщения, полученные от пользователей Telegram.", "bot")
+	promRunsStarted      = newPromCounterVec("assistant_runs_started_total", "Запущенные запросы к ассистенту.", "")
+	promRunsCompleted    = newPromCounterVec("assistant_runs_completed_total", "Успешно завершённые запросы к ассистенту.", "")
+	promRunsFailed       = newPromCounterVec("assistant_runs_failed_total", "Неудавшиеся запросы к ассистенту по типу ошибки.", "error_type")
+	promTokens           = newPromCounterVec("assistant_tokens_total", "Израсходованные токены.", "type")
+	promRunLatency       = newPromHistogram("assistant_run_duration_seconds", "Длительность запроса к ассистенту.", runLatencyBuckets)
+	promCacheHits        = newPromCounterVec("answer_cache_hits_total", "Ответы, взятые из кэша без запуска ассистента.", "bot")
+	promNudgeRetries     = newPromCounterVec("assistant_nudge_retries_total", "Повторы запуска с указанием опираться на документы по причине: empty или refusal.", "reason")
+	promFirstToken       = newPromHistogram("assistant_time_to_first_token_seconds", "Время от начала потока SSE до первого фрагмента ответа.", runLatencyBuckets)
+)
+
+// Обработчики HTTP-сервера метрик. Другие служебные адреса регистрируются здесь же.
+var metricsMux = http.NewServeMux()
+
+// Запускает HTTP-сервер с метриками Prometheus по адресу /metrics. Возвращает функцию остановки.
+func startMetricsServer(addr string, bots []*botInstance) func() {
+	metricsMux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		writePromMetrics(w, bots)
+	})
+
+	server := &http.Server{Addr: addr, Handler: metricsMux}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			slog.Error("Ошибка HTTP-сервера метрик", "error", err)
+		}
+	}()
+	slog.Info("HTTP-сервер метрик запущен", "addr", addr)
+
+	return func() {
+		if err := server.Shutdown(context.Background()); err != nil {
+			slog.Error("Ошибка остановки HTTP-сервера метрик", "error", err)
+		}
+	}
+}
+
+func writePromMetrics(w io.Writer, bots []*botInstance) {
+	promMessagesReceived.writeTo(w)
+	promRunsStarted.writeTo(w)
+	promRunsCompleted.writeTo(w)
+	promRunsFailed.writeTo(w)
+	promTokens.writeTo(w)
+	promRunLatency.writeTo(w)
+	promFirstToken.writeTo(w)
+	promCacheHits.writeTo(w)
+	promNudgeRetries.writeTo(w)
+	writeSpendMetrics(w)
+
+	fmt.Fprint(w, "# HELP assistant_runs_in_flight Выполняющиеся запросы к ассистенту.\n# TYPE assistant_runs_in_flight gauge\n")
+	fmt.Fprintf(w, "assistant_runs_in_flight %d\n", metrics.runsInFlight.Load())
+
+	fmt.Fprint(w, "# HELP bot_active_sessions Активные сессии пользователей.\n# TYPE bot_active_sessions gauge\n")
+	for _, b := range bots {
+		fmt.Fprintf(w, "bot_active_sessions{bot=\"%s\"} %d\n", escapeLabelValue(b.cfg.Name), b.sessions.Len())
+	}
+
+	fmt.Fprint(w, "# HELP bot_user_queues Пользователи с вопросами в очереди или в работе.\n# TYPE bot_user_queues gauge\n")
+	for _, b := range bots {
+		fmt.Fprintf(w, "bot_user_queues{bot=\"%s\"} %d\n", escapeLabelValue(b.cfg.Name), b.queues.Active())
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Часовой пояс, в полночь которого обнуляются дневные лимиты. Задаётся quota_timezone.
+var quotaLocation = time.Local
+
+// Текущий день для дневных лимитов
+func quotaDay() string {
+	return time.Now().In(quotaLocation).Format(time.DateOnly)
+}
+
+// Расход пользователя за день
+type userUsage struct {
+	Day    string
+	Runs   int
+	Tokens int64
+}
+
+// Общий расход токенов всеми ботами за день
+type globalUsage struct {
+	mu     sync.Mutex
+	day    string
+	tokens int64
+	// Превышение бюджета уже записано в журнал сегодня
+	alerted bool
+}
+
+var globalQuota = &globalUsage{}
+
+// Добавляет токены к общему расходу. Возвращает true, если этим добавлением бюджет исчерпан впервые за день.
+func (g *globalUsage) add(tokens int64) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.resetLocked()
+	g.tokens += tokens
+	if config.GlobalDailyTokens > 0 && g.tokens >= config.GlobalDailyTokens && !g.alerted {
+		g.alerted = true
+		return true
+	}
+	return false
+}
+
+// Проверяет, исчерпан ли общий дневной бюджет токенов
+func (g *globalUsage) exhausted() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.resetLocked()
+	return config.GlobalDailyTokens > 0 && g.tokens >= config.GlobalDailyTokens
+}
+
+func (g *globalUsage) used() int64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.resetLocked()
+	return g.tokens
+}
+
+func (g *globalUsage) resetLocked() {
+	if day := quotaDay(); g.day != day {
+		g.day = day
+		g.tokens = 0
+		g.alerted = false
+	}
+}
+
+// Возвращает расход пользователя за текущий день
+func (s *SessionStore) Usage(userID int64) userUsage {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	u := s.usage[userID]
+	if u.Day != quotaDay() {
+		return userUsage{Day: quotaDay()}
+	}
+	return u
+}
+
+// Учитывает запуск ассистента и израсходованные им токены
+func (s *SessionStore) AddUsage(userID int64, tokens int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u := s.usage[userID]
+	if day := quotaDay(); u.Day != day {
+		u = userUsage{Day: day}
+	}
+	u.Runs++
+	u.Tokens += tokens
+	s.usage[userID] = u
+}
+
+// Проверяет дневные лимиты перед запуском ассистента. Если лимит исчерпан, сообщает об этом
+// пользователю и возвращает false. Администраторы лимитами не ограничены.
+func checkQuota(b *botInstance, message *tgbotapi.Message, lang string) bool {
+	userID := message.From.ID
+	if isAdmin(userID) {
+		return true
+	}
+
+	if globalQuota.exhausted() {
+		b.log.Warn("Запрос отклонён: исчерпан общий дневной бюджет токенов", "user_id", userID)
+		text := config.MaintenanceMessage
+		if text == "" {
+			text = t(lang, "quota.maintenance")
+		}
+		sendMessage(b, tgbotapi.NewMessage(message.Chat.ID, text))
+		return false
+	}
+
+	usage := b.sessions.Usage(userID)
+	if (config.UserDailyRuns > 0 && usage.Runs >= config.UserDailyRuns) ||
+		(config.UserDailyTokens > 0 && usage.Tokens >= config.UserDailyTokens) {
+		b.log.Warn("Запрос отклонён: исчерпан дневной лимит пользователя", "user_id", userID, "runs", usage.Runs, "tokens", usage.Tokens)
+		text := config.QuotaExceededMessage
+		if text == "" {
+			text = t(lang, "quota.exceeded")
+		}
+		sendMessage(b, tgbotapi.NewMessage(message.Chat.ID, text))
+		return false
+	}
+	return true
+}
+
+// Учитывает расход запуска в лимитах пользователя и общем бюджете
+func recordUsage(b *botInstance, userID int64, tokens int64) {
+	b.sessions.AddUsage(userID, tokens)
+	if globalQuota.add(tokens) {
+		b.log.Error("ИСЧЕРПАН ДНЕВНОЙ БЮДЖЕТ ТОКЕНОВ: запросы пользователей отклоняются до полуночи",
+			"global_daily_tokens", config.GlobalDailyTokens, "timezone", quotaLocation.String())
+	}
+}
+
+// Формирует раздел /stats об остатке дневных лимитов
+func quotaReport() string {
+	var b strings.Builder
+	used := globalQuota.used()
+	if config.GlobalDailyTokens > 0 {
+		fmt.Fprintf(&b, "Бюджет токенов:        %d из %d (осталось %d)\n", used, config.GlobalDailyTokens, max(config.GlobalDailyTokens-used, 0))
+	} else {
+		fmt.Fprintf(&b, "Бюджет токенов:        %d, без ограничения\n", used)
+	}
+	if config.UserDailyRuns > 0 || config.UserDailyTokens > 0 {
+		fmt.Fprintf(&b, "Лимит пользователя:    %d запусков, %d токенов в день (0 — без ограничения)\n", config.UserDailyRuns, config.UserDailyTokens)
+	}
+	return b.String()
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RateLimit описывает ограничение вида "10/1m": не более Requests запросов за Period
+type RateLimit struct {
+	Requests int
+	Period   time.Duration
+}
+
+// parseRateLimit разбирает строку ограничения из конфигурации.
+// Пустая строка означает отсутствие ограничения.
+func parseRateLimit(s string) (RateLimit, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return RateLimit{}, nil
+	}
+
+	parts := strings.SplitN(s, "/", 2)
+	if len(parts) != 2 {
+		return RateLimit{}, fmt.Errorf("Неверный формат ограничения %q, ожидается вид 10/1m", s)
+	}
+
+	requests, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil || requests <= 0 {
+		return RateLimit{}, fmt.Errorf("Неверное количество запросов в ограничении %q", s)
+	}
+
+	period, err := time.ParseDuration(strings.TrimSpace(parts[1]))
+	if err != nil || period <= 0 {
+		return RateLimit{}, fmt.Errorf("Неверный период в ограничении %q", s)
+	}
+
+	return RateLimit{Requests: requests, Period: period}, nil
+}
+
+// Enabled сообщает, задано ли ограничение
+func (l RateLimit) Enabled() bool {
+	return l.Requests > 0 && l.Period > 0
+}
+
+// tokenBucket — корзина токенов для ограничения частоты запросов одного пользователя.
+// Не потокобезопасна: доступ защищается мьютексом сессии.
+type tokenBucket struct {
+	tokens      float64
+	last        time.Time
+	warnedUntil time.Time
+}
+
+// refill пополняет корзину пропорционально прошедшему времени
+func (b *tokenBucket) refill(limit RateLimit, now time.Time) {
+	capacity := float64(limit.Requests)
+	if b.last.IsZero() {
+		b.tokens = capacity
+		b.last = now
+		return
+	}
+
+	elapsed := now.Sub(b.last)
+	if elapsed > 0 {
+		rate := capacity / float64(limit.Period)
+		b.tokens = math.Min(capacity, b.tokens+float64(elapsed)*rate)
+		b.last = now
+	}
+}
+
+// allow списывает один токен, если он есть.
+// При превышении возвращает время ожидания до появления следующего токена
+// и признак того, нужно ли предупредить пользователя (один раз за окно ожидания).
+func (b *tokenBucket) allow(limit RateLimit, now time.Time) (ok bool, wait time.Duration, warn bool) {
+	b.refill(limit, now)
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0, false
+	}
+
+	rate := float64(limit.Requests) / float64(limit.Period)
+	wait = time.Duration((1 - b.tokens) / rate)
+
+	if now.Before(b.warnedUntil) {
+		return false, wait, false
+	}
+	b.warnedUntil = now.Add(wait)
+	return false, wait, true
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"proxyapi-bot/internal/openai"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    RateLimit
+		wantErr bool
+	}{
+		{"", RateLimit{}, false},
+		{"10/1m", RateLimit{Requests: 10, Period: time.Minute}, false},
+		{" 3 / 30s ", RateLimit{Requests: 3, Period: 30 * time.Second}, false},
+		{"10", RateLimit{}, true},
+		{"0/1m", RateLimit{}, true},
+		{"abc/1m", RateLimit{}, true},
+		{"10/minute", RateLimit{}, true},
+		{"10/-1m", RateLimit{}, true},
+	}
+	for _, tt := range tests {
+		got, err := parseRateLimit(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseRateLimit(%q) = %+v, %v; want %+v, ошибка %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+// Корзина полна в начале, а затем пополняется пропорционально прошедшему времени, не выше ёмкости
+func TestTokenBucketRefill(t *testing.T) {
+	limit := RateLimit{Requests: 6, Period: time.Minute} // токен каждые 10 секунд
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	var b tokenBucket
+
+	for i := range 6 {
+		if ok, _, _ := b.allow(limit, start); !ok {
+			t.Fatalf("Запрос %d из 6 отклонён", i+1)
+		}
+	}
+	ok, wait, _ := b.allow(limit, start)
+	if ok || wait != 10*time.Second {
+		t.Fatalf("Седьмой запрос: ok %v, ожидание %v, want отказ и 10s", ok, wait)
+	}
+
+	// Через 4 секунды накоплено 0.4 токена: ждать ещё 6 секунд
+	if ok, wait, _ := b.allow(limit, start.Add(4*time.Second)); ok || wait != 6*time.Second {
+		t.Errorf("Через 4s: ok %v, ожидание %v, want отказ и 6s", ok, wait)
+	}
+	if ok, _, _ := b.allow(limit, start.Add(10*time.Second)); !ok {
+		t.Error("Через 10s запрос отклонён, хотя накоплен токен")
+	}
+
+	// После долгого перерыва корзина заполняется только до ёмкости
+	b.refill(limit, start.Add(time.Hour))
+	if b.tokens != 6 {
+		t.Errorf("После часа простоя токенов %v, want 6", b.tokens)
+	}
+}
+
+// Предупреждение отправляется один раз за окно ожидания
+func TestTokenBucketWarnsOnce(t *testing.T) {
+	limit := RateLimit{Requests: 1, Period: 30 * time.Second}
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	var b tokenBucket
+	b.allow(limit, start)
+
+	steps := []struct {
+		after    time.Duration
+		wantOK   bool
+		wantWarn bool
+	}{
+		{0, false, true},
+		{time.Second, false, false},
+		{20 * time.Second, false, false},
+		// Окно первого предупреждения (30s) прошло, и накоплен токен
+		{30 * time.Second, true, false},
+		{31 * time.Second, false, true},
+		{40 * time.Second, false, false},
+	}
+	for _, step := range steps {
+		ok, _, warn := b.allow(limit, start.Add(step.after))
+		if ok != step.wantOK || warn != step.wantWarn {
+			t.Errorf("Через %v: ok %v, warn %v; want %v, %v", step.after, ok, warn, step.wantOK, step.wantWarn)
+		}
+	}
+}
+
+// Вопросы сверх user_rate_limit не запускают ассистента, а пользователь получает одно предупреждение
+func TestRateLimitedQueries(t *testing.T) {
+	useTestConfig(t, "user_rate_limit: 1/1m\n")
+	b, sender := newTestBot(t, &openai.Mock{CreateThreadRunFunc: answerRun("ответ")})
+	const userID = 100
+
+	for i, question := range []string{"первый", "второй", "третий"} {
+		handleUserQuery(context.Background(), b, privateMessage(userID, i+1, question), question, "", "", false, false)
+		waitQueues(t, b)
+	}
+
+	want := []string{"ответ", translate("ru", "query.rate_limited", 60)}
+	if got := sender.texts(); !slices.Equal(got, want) {
+		t.Errorf("Отправлено %q, want %q", got, want)
+	}
+}
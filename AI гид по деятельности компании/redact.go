@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// Токен бота в адресах Telegram Bot API вида api.telegram.org/bot<token>/...
+var telegramTokenPattern = regexp.MustCompile(`bot\d+:[A-Za-z0-9_-]+`)
+
+// Секреты из конфигурации, которые не должны попадать в журнал. Заполняется один раз
+// после загрузки конфигурации, до запуска ботов.
+var redactedSecrets []string
+
+// Запоминает ключ API, токены ботов и секрет вебхука для маскирования в журнале
+func setRedactedSecrets(c *Config) {
+	secrets := []string{c.APIKey, c.TelegramBotToken, c.WebhookSecretToken, c.S3SecretAccessKey, c.AdminAPIToken}
+	for _, bot := range c.Bots {
+		secrets = append(secrets, bot.TelegramBotToken)
+	}
+
+	redactedSecrets = nil
+	for _, secret := range secrets {
+		// Слишком короткое значение совпало бы с обычным текстом
+		if len(secret) >= 8 {
+			redactedSecrets = append(redactedSecrets, secret)
+		}
+	}
+}
+
+// Заменяет секреты и токены ботов в строке на ***
+func redact(s string) string {
+	for _, secret := range redactedSecrets {
+		s = strings.ReplaceAll(s, secret, "***")
+	}
+	return telegramTokenPattern.ReplaceAllString(s, "bot***")
+}
+
+// ReplaceAttr для обработчика slog: маскирует секреты в строках, ошибках и адресах
+func redactAttr(_ []string, a slog.Attr) slog.Attr {
+	switch a.Value.Kind() {
+	case slog.KindString:
+		a.Value = slog.StringValue(redact(a.Value.String()))
+	case slog.KindAny:
+		switch v := a.Value.Any().(type) {
+		case error:
+			a.Value = slog.StringValue(redact(v.Error()))
+		case fmt.Stringer:
+			a.Value = slog.StringValue(redact(v.String()))
+		}
+	}
+	return a
+}
+
+// botLogger направляет сообщения библиотеки Telegram в slog, чтобы они тоже маскировались
+type botLogger struct{}
+
+func (botLogger) Println(v ...interface{}) {
+	slog.Warn(strings.TrimSpace(fmt.Sprintln(v...)), "component", "telegram")
+}
+
+func (botLogger) Printf(format string, v ...interface{}) {
+	slog.Warn(strings.TrimSpace(fmt.Sprintf(format, v...)), "component", "telegram")
+}
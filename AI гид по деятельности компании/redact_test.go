@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// Журнал с маскированием секретов, записи которого попадают в буфер
+func newRedactingLogger(t *testing.T) (*slog.Logger, *bytes.Buffer) {
+	t.Helper()
+	t.Cleanup(func() { redactedSecrets = nil })
+	setRedactedSecrets(&config)
+
+	var buf bytes.Buffer
+	handler := slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug, ReplaceAttr: redactAttr})
+	return slog.New(handler), &buf
+}
+
+// Проверяет, что в журнале нет ни одного секрета из тестовой конфигурации
+func assertNoSecrets(t *testing.T, output string) {
+	t.Helper()
+	for _, secret := range []string{"sk-test-secret", "123456:test-token", "webhook-secret", "s3-secret-key", testAdminToken} {
+		if strings.Contains(output, secret) {
+			t.Errorf("Журнал содержит секрет %q:\n%s", secret, output)
+		}
+	}
+}
+
+const redactTestConfig = "webhook_secret_token: webhook-secret\ns3_secret_access_key: s3-secret-key\nadmin_api_token: " + testAdminToken + "\n"
+
+// Секреты маскируются в тексте записи, строках, ошибках и значениях с методом String
+func TestRedactLogOutput(t *testing.T) {
+	useTestConfig(t, redactTestConfig)
+	log, buf := newRedactingLogger(t)
+
+	tokenURL := &url.URL{Scheme: "https", Host: "api.telegram.org", Path: "/bot123456:test-token/getMe"}
+	log.Info("Ключ sk-test-secret в тексте записи",
+		"header", "Bearer sk-test-secret",
+		"webhook", "webhook-secret",
+		"s3", "s3-secret-key",
+		"admin", "Bearer "+testAdminToken,
+		"url", tokenURL,
+		"error", &url.Error{Op: "Post", URL: tokenURL.String(), Err: errors.New("connection refused")},
+	)
+	log.With("component", "telegram").WithGroup("request").Warn("Ошибка", "token", "123456:test-token")
+
+	output := buf.String()
+	assertNoSecrets(t, output)
+	if !strings.Contains(output, "api.telegram.org/bot***/getMe") {
+		t.Errorf("Адрес Telegram без маскированного токена:\n%s", output)
+	}
+}
+
+// Токен в адресе Telegram маскируется, даже если это токен не из конфигурации
+func TestRedactTelegramURL(t *testing.T) {
+	t.Cleanup(func() { redactedSecrets = nil })
+	redactedSecrets = nil
+
+	got := redact(`Post "https://api.telegram.org/bot987654:AAH-other_token/sendMessage": EOF`)
+	if want := `Post "https://api.telegram.org/bot***/sendMessage": EOF`; got != want {
+		t.Errorf("redact = %q, want %q", got, want)
+	}
+}
+
+// Короткие значения не считаются секретами, чтобы не маскировать обычный текст
+func TestRedactShortSecrets(t *testing.T) {
+	useTestConfig(t, "webhook_secret_token: abc\n")
+	t.Cleanup(func() { redactedSecrets = nil })
+	setRedactedSecrets(&config)
+
+	if got := redact("abc sk-test-secret"); got != "abc ***" {
+		t.Errorf("redact = %q, want %q", got, "abc ***")
+	}
+}
+
+// Сообщения библиотеки Telegram идут через slog и тоже маскируются
+func TestBotLoggerRedacted(t *testing.T) {
+	useTestConfig(t, redactTestConfig)
+	log, buf := newRedactingLogger(t)
+	saved := slog.Default()
+	slog.SetDefault(log)
+	t.Cleanup(func() { slog.SetDefault(saved) })
+
+	botLogger{}.Printf("Ошибка запроса %s", "https://api.telegram.org/bot123456:test-token/getUpdates")
+	botLogger{}.Println("Ответ", "123456:test-token")
+
+	assertNoSecrets(t, buf.String())
+}
+
+// Отладочный журнал клиента API пишет адреса и тела ответов; ключ в них не попадает,
+// даже если прокси вернул заголовок Authorization в теле ответа или соединение не удалось
+func TestRedactAPIClientLog(t *testing.T) {
+	useTestConfig(t, redactTestConfig)
+	log, buf := newRedactingLogger(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		io.WriteString(w, `{"error":{"message":"Invalid header: `+r.Header.Get("Authorization")+`"}}`)
+	}))
+	defer server.Close()
+	config.ApiURL = server.URL
+	api := newAPIClient(log)
+
+	_, err := api.CreateAssistant(context.Background(), "test", "", "gpt-4o", nil)
+	if err == nil {
+		t.Fatal("Ожидалась ошибка 401")
+	}
+	log.Error("Ошибка создания ассистента", "error", err)
+
+	// Ошибка соединения содержит адрес запроса, но не заголовки
+	server.Close()
+	_, err = api.CreateAssistant(context.Background(), "test", "", "gpt-4o", nil)
+	if err == nil {
+		t.Fatal("Ожидалась ошибка соединения")
+	}
+	if strings.Contains(err.Error(), "sk-test-secret") {
+		t.Errorf("Ошибка соединения содержит ключ API: %v", err)
+	}
+	log.Error("Ошибка соединения", "error", err)
+
+	assertNoSecrets(t, buf.String())
+}
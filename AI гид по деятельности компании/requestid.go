@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+
+	"proxyapi-bot/internal/openai"
+)
+
+// Возвращает короткий случайный ID запроса, например "ab12cd"
+func newRequestID() string {
+	var b [3]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// Создаёт контекст обработки одного сообщения пользователя с новым ID запроса.
+// ID попадает во все записи журнала, запросы к API и текст ошибки для пользователя.
+func newRequestContext() context.Context {
+	return openai.WithRequestID(context.Background(), newRequestID())
+}
+
+// Возвращает журнал с ID запроса из ctx
+func requestLog(ctx context.Context, log *slog.Logger) *slog.Logger {
+	if id := openai.RequestID(ctx); id != "" {
+		return log.With("request_id", id)
+	}
+	return log
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"proxyapi-bot/internal/openai"
+)
+
+// Действия для категорий вопросов routing_categories
+const (
+	// Ответ дешёвой моделью routing_model без базы знаний
+	routeActionChat = "chat"
+	// Ответ ассистентом с поиском по базе знаний
+	routeActionAssistant = "assistant"
+	// Сообщение о том, как связаться с сотрудником, без ответа модели
+	routeActionHandoff = "handoff"
+)
+
+// Категория вопросов для маршрутизации: описание помогает модели отнести к ней вопрос,
+// а действие определяет, кто на него отвечает
+type RouteCategory struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description"`
+	Action      string `yaml:"action"`
+}
+
+// Категории по умолчанию, если routing_categories не заданы
+var defaultRouteCategories = []RouteCategory{
+	{Name: "smalltalk", Description: "приветствие, благодарность, прощание или разговор не о компании", Action: routeActionChat},
+	{Name: "documents", Description: "вопрос о компании, её услугах, документах, контактах или любой другой вопрос", Action: routeActionAssistant},
+	{Name: "human", Description: "просьба связаться с живым сотрудником или оператором", Action: routeActionHandoff},
+}
+
+// Проверяет категории маршрутизации: имена уникальны, действия известны, и хотя бы одна
+// категория отправляет вопрос ассистенту — к ней относятся вопросы, которые модель не распознала
+func validateRouteCategories(categories []RouteCategory) error {
+	names := make(map[string]bool, len(categories))
+	hasAssistant := false
+	for _, c := range categories {
+		if c.Name == "" {
+			return fmt.Errorf("У категории в routing_categories не задано имя")
+		}
+		if names[c.Name] {
+			return fmt.Errorf("Категория %s в routing_categories задана дважды", c.Name)
+		}
+		names[c.Name] = true
+		switch c.Action {
+		case routeActionAssistant:
+			hasAssistant = true
+		case routeActionChat, routeActionHandoff:
+		default:
+			return fmt.Errorf("Неизвестное действие %q категории %s в routing_categories (допустимо chat, assistant или handoff)", c.Action, c.Name)
+		}
+	}
+	if !hasAssistant {
+		return fmt.Errorf("В routing_categories нужна хотя бы одна категория с действием assistant")
+	}
+	return nil
+}
+
+// Категория, в которую попадают нераспознанные вопросы: первая с действием assistant
+func fallbackRoute() RouteCategory {
+	for _, c := range config.RoutingCategories {
+		if c.Action == routeActionAssistant {
+			return c
+		}
+	}
+	return RouteCategory{Name: routeActionAssistant, Action: routeActionAssistant}
+}
+
+const routingPrompt = `Определи категорию сообщения пользователя. Категории:
+%s
+Верни только JSON вида {"category": "<имя категории>"}.`
+
+// Относит вопрос к одной из routing_categories запросом к routing_model. При ошибке запроса
+// или неизвестной категории вопрос достаётся ассистенту.
+func classifyQuestion(ctx context.Context, b *botInstance, question string) (RouteCategory, error) {
+	var list strings.Builder
+	for _, c := range config.RoutingCategories {
+		fmt.Fprintf(&list, "- %s: %s\n", c.Name, c.Description)
+	}
+	content, err := b.api.ChatCompletionJSON(ctx, config.RoutingModel, fmt.Sprintf(routingPrompt, list.String()), question)
+	if err != nil {
+		return fallbackRoute(), err
+	}
+
+	var result struct {
+		Category string `json:"category"`
+	}
+	if err := json.Unmarshal([]byte(content), &result); err != nil {
+		return fallbackRoute(), fmt.Errorf("Ошибка разбора категории вопроса: %v", err)
+	}
+	for _, c := range config.RoutingCategories {
+		if c.Name == result.Category {
+			return c, nil
+		}
+	}
+	return fallbackRoute(), fmt.Errorf("Модель вернула неизвестную категорию %q", result.Category)
+}
+
+// Ответ, которым дешёвая модель сообщает, что не может ответить без базы знаний
+const routeUnknownMarker = "UNKNOWN"
+
+const smallTalkPrompt = "Ты — вежливый помощник компании в Telegram. Коротко ответь на сообщение пользователя на его языке. " +
+	"Если для ответа нужны сведения о компании, её услугах или документах, либо ты не знаешь ответа, верни только слово " + routeUnknownMarker + "."
+
+// Отвечает на вопрос моделью routing_model без базы знаний. false — модель не знает ответа
+// или запрос не удался, и вопрос нужно передать ассистенту
+func answerSmallTalk(ctx context.Context, b *botInstance, question string) (string, bool) {
+	answer, err := b.api.ChatCompletion(ctx, config.RoutingModel, smallTalkPrompt, question)
+	if err != nil {
+		requestLog(ctx, b.log).Warn("Ошибка ответа модели маршрутизации, вопрос передаётся ассистенту", "error", err)
+		return "", false
+	}
+	answer = strings.TrimSpace(answer)
+	if answer == "" || strings.Contains(answer, routeUnknownMarker) {
+		return "", false
+	}
+	return answer, true
+}
+
+// Итог маршрутизации вопроса
+type routeDecision struct {
+	Category string
+	Action   string
+	// Ответ модели routing_model для действия chat
+	Answer string
+}
+
+// Выбирает, кто отвечает на вопрос. Вопрос с изображением или документом всегда достаётся
+// ассистенту. Если дешёвая модель не знает ответа, вопрос передаётся ассистенту.
+func routeQuestion(ctx context.Context, b *botInstance, userID int64, run runRequest) routeDecision {
+	log := requestLog(ctx, b.log)
+	if run.ImageURL != "" || run.DocumentFileID != "" {
+		return routeDecision{Category: fallbackRoute().Name, Action: routeActionAssistant}
+	}
+
+	category, err := classifyQuestion(ctx, b, run.Question)
+	if err != nil {
+		log.Warn("Не удалось определить категорию вопроса", "user_id", userID, "error", err)
+	}
+	decision := routeDecision{Category: category.Name, Action: category.Action}
+	if decision.Action == routeActionChat {
+		answer, ok := answerSmallTalk(ctx, b, run.Question)
+		if ok {
+			decision.Answer = answer
+		} else {
+			log.Info("Модель маршрутизации не знает ответа, вопрос передаётся ассистенту", "user_id", userID, "category", category.Name)
+			decision.Action = routeActionAssistant
+		}
+	}
+	log.Info("Маршрут вопроса", "user_id", userID, "category", decision.Category, "action", decision.Action)
+	return decision
+}
+
+// Возвращает метку маршрута для журнала диалогов: категория и действие, например smalltalk/chat
+func (d routeDecision) String() string {
+	if d.Category == "" {
+		return ""
+	}
+	return d.Category + "/" + d.Action
+}
+
+// Отправляет ответ, полученный без ассистента: ответ модели routing_model или сообщение
+// о связи с сотрудником. Ответ модели добавляется в историю диалога, как ответ ассистента.
+func deliverRoutedAnswer(ctx context.Context, b *botInstance, chatID, userID int64, session *UserSession, run runRequest, decision routeDecision, access *accessEntry) {
+	answer := decision.Answer
+	if decision.Action == routeActionHandoff {
+		answer = config.HandoffMessage
+		if answer == "" {
+			answer = t(run.Language, "route.handoff")
+		}
+		// С чатом поддержки пользователь сам решает, передать ли диалог оператору
+		if config.SupportChatID != 0 {
+			msg := tgbotapi.NewMessage(chatID, t(run.Language, "operator.offer"))
+			msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+				tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(t(run.Language, "operator.button"), operatorCallbackData)),
+			)
+			if err := sendMessage(b, msg); err != nil {
+				access.failed(errorCategorySend)
+				return
+			}
+			access.answered(msg.Text)
+			conversationLog.Write(b.cfg.Name, userID, run.Question, msg.Text, time.Since(access.start), openai.Usage{}, "", run.Route)
+			return
+		}
+	}
+
+	transcript.Write(userID, "assistant", answer)
+	if !deliverAnswer(ctx, b, chatID, userID, run, answer) {
+		access.failed(errorCategorySend)
+		return
+	}
+	access.answered(answer)
+	conversationLog.Write(b.cfg.Name, userID, run.Question, answer, time.Since(access.start), openai.Usage{}, "", run.Route)
+	if decision.Action == routeActionChat {
+		completeAnswer(ctx, b, chatID, userID, session, run, "", answer)
+	}
+}
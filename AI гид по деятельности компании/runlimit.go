@@ -0,0 +1,59 @@
+package main
+
+import "sync/atomic"
+
+// runLimiter ограничивает количество одновременных запусков ассистента.
+// Запросы сверх лимита ждут в очереди ограниченной длины, а при заполненной очереди отклоняются.
+type runLimiter struct {
+	slots     chan struct{}
+	queued    atomic.Int64
+	maxQueued int64
+}
+
+// Общий для всех ботов ограничитель, создаётся в main
+var runSlots *runLimiter
+
+func newRunLimiter(maxRuns, maxQueued int) *runLimiter {
+	return &runLimiter{
+		slots:     make(chan struct{}, maxRuns),
+		maxQueued: int64(maxQueued),
+	}
+}
+
+// Занимает слот для запуска, при необходимости ожидая в очереди.
+// Возвращает false, если все слоты заняты и очередь заполнена.
+func (l *runLimiter) Acquire() bool {
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	default:
+	}
+
+	if l.queued.Add(1) > l.maxQueued {
+		l.queued.Add(-1)
+		return false
+	}
+	l.slots <- struct{}{}
+	l.queued.Add(-1)
+	return true
+}
+
+// Освобождает слот после завершения запуска
+func (l *runLimiter) Release() {
+	<-l.slots
+}
+
+// Количество выполняющихся запусков
+func (l *runLimiter) InFlight() int {
+	return len(l.slots)
+}
+
+// Предельное количество одновременных запусков
+func (l *runLimiter) Capacity() int {
+	return cap(l.slots)
+}
+
+// Количество запросов, ожидающих свободного слота
+func (l *runLimiter) Queued() int64 {
+	return l.queued.Load()
+}
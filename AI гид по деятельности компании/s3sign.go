@@ -0,0 +1,141 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Тело запросов к S3 не подписывается: файлы базы знаний только читаются
+const s3UnsignedPayload = "UNSIGNED-PAYLOAD"
+
+// s3Credentials — ключи доступа к бакету S3. Пустой ключ — анонимные запросы.
+type s3Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	// Временный токен сессии, выданный вместе с ключами роли IAM
+	SessionToken string
+	Region       string
+}
+
+// Возвращает ключи из s3_access_key_id и s3_secret_access_key, а если они не заданы —
+// из переменных окружения AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY и AWS_SESSION_TOKEN,
+// в которые ключи роли IAM передают, например, ECS и Kubernetes
+func loadS3Credentials() s3Credentials {
+	creds := s3Credentials{
+		AccessKeyID:     config.S3AccessKeyID,
+		SecretAccessKey: config.S3SecretAccessKey,
+		Region:          config.S3Region,
+	}
+	if creds.AccessKeyID == "" {
+		creds.AccessKeyID = os.Getenv("AWS_ACCESS_KEY_ID")
+		creds.SecretAccessKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+		creds.SessionToken = os.Getenv("AWS_SESSION_TOKEN")
+	}
+	if creds.Region == "" {
+		creds.Region = os.Getenv("AWS_REGION")
+	}
+	if creds.Region == "" {
+		creds.Region = "us-east-1"
+	}
+	return creds
+}
+
+// Подписывает запрос по AWS Signature Version 4. Без ключа запрос остаётся анонимным.
+func (c s3Credentials) sign(req *http.Request, now time.Time) {
+	c.signPayload(req, now, s3UnsignedPayload)
+}
+
+// Подписывает запрос с хэшем тела payloadHash: SHA-256 в hex или UNSIGNED-PAYLOAD
+func (c s3Credentials) signPayload(req *http.Request, now time.Time, payloadHash string) {
+	if c.AccessKeyID == "" {
+		return
+	}
+
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if c.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.SessionToken)
+	}
+
+	headers := map[string]string{
+		"host":                 req.URL.Host,
+		"x-amz-content-sha256": payloadHash,
+		"x-amz-date":           amzDate,
+	}
+	if c.SessionToken != "" {
+		headers["x-amz-security-token"] = c.SessionToken
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		s3EscapePath(req.URL.Path),
+		s3CanonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := day + "/" + c.Region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := sigV4SigningKey(c.SecretAccessKey, day, c.Region, "s3")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+c.AccessKeyID+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+// Ключ подписи SigV4 для дня day (ГГГГММДД), региона и сервиса
+func sigV4SigningKey(secret, day, region, service string) []byte {
+	key := hmacSHA256([]byte("AWS4"+secret), day)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	return hmacSHA256(key, "aws4_request")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// Кодирует путь так, как его кодирует S3 при проверке подписи: все символы, кроме
+// A-Z a-z 0-9 - _ . ~ и /, заменяются на %XX
+func s3EscapePath(p string) string {
+	segments := strings.Split(p, "/")
+	for i, segment := range segments {
+		segments[i] = s3Escape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+func s3Escape(s string) string {
+	// QueryEscape оставляет без изменений те же символы, что и S3, кроме пробела
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+// Параметры запроса, отсортированные по имени и закодированные по правилам S3
+func s3CanonicalQuery(query url.Values) string {
+	return strings.ReplaceAll(query.Encode(), "+", "%20")
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Расписание фоновой задачи: интервал ("6h") или выражение cron ("0 3 * * *")
+type schedule interface {
+	// Время следующего запуска после after
+	Next(after time.Time) time.Time
+}
+
+// Разбирает расписание resync_schedule. Выражение cron состоит из пяти полей:
+// минута, час, день месяца, месяц, день недели (0 — воскресенье). В полях допускаются
+// *, числа, списки через запятую, диапазоны 1-5 и шаг */15 или 1-30/5.
+func parseSchedule(s string) (schedule, error) {
+	s = strings.TrimSpace(s)
+	if interval, err := time.ParseDuration(s); err == nil {
+		if interval < time.Minute {
+			return nil, fmt.Errorf("Интервал расписания должен быть не меньше минуты, получено %s", interval)
+		}
+		return intervalSchedule(interval), nil
+	}
+
+	fields := strings.Fields(s)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("Расписание %q не является ни интервалом, ни выражением cron из пяти полей", s)
+	}
+	limits := [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 6}}
+	var c cronSchedule
+	sets := []*[]bool{&c.minutes, &c.hours, &c.days, &c.months, &c.weekdays}
+	for i, field := range fields {
+		set, err := parseCronField(field, limits[i][0], limits[i][1])
+		if err != nil {
+			return nil, fmt.Errorf("Ошибка в поле %d расписания %q: %v", i+1, s, err)
+		}
+		*sets[i] = set
+	}
+	c.anyDay, c.anyWeekday = fields[2] == "*", fields[4] == "*"
+	return c, nil
+}
+
+// intervalSchedule — запуск через равные промежутки времени
+type intervalSchedule time.Duration
+
+func (s intervalSchedule) Next(after time.Time) time.Time {
+	return after.Add(time.Duration(s))
+}
+
+// cronSchedule — выражение cron в местном времени
+type cronSchedule struct {
+	minutes, hours, days, months, weekdays []bool
+	// Как в cron, если ограничены и день месяца, и день недели, подходит любой из них
+	anyDay, anyWeekday bool
+}
+
+func (c cronSchedule) Next(after time.Time) time.Time {
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	// Подходящая минута есть в пределах нескольких лет, кроме дат вроде 31 февраля
+	end := t.AddDate(5, 0, 0)
+	for t.Before(end) {
+		if !c.months[int(t.Month())] {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !c.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !c.hours[t.Hour()] {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if !c.minutes[t.Minute()] {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+func (c cronSchedule) dayMatches(t time.Time) bool {
+	day, weekday := c.days[t.Day()], c.weekdays[int(t.Weekday())]
+	switch {
+	case c.anyDay && c.anyWeekday:
+		return true
+	case c.anyDay:
+		return weekday
+	case c.anyWeekday:
+		return day
+	default:
+		return day || weekday
+	}
+}
+
+// Разбирает поле cron в набор допустимых значений от min до max
+func parseCronField(field string, min, max int) ([]bool, error) {
+	set := make([]bool, max+1)
+	for _, part := range strings.Split(field, ",") {
+		step, hasStep := 1, false
+		if rangePart, stepPart, ok := strings.Cut(part, "/"); ok {
+			n, err := strconv.Atoi(stepPart)
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("неверный шаг %q", stepPart)
+			}
+			part, step, hasStep = rangePart, n, true
+		}
+
+		from, to := min, max
+		if part != "*" {
+			first, last, isRange := strings.Cut(part, "-")
+			var err error
+			if from, err = strconv.Atoi(first); err != nil {
+				return nil, fmt.Errorf("неверное значение %q", part)
+			}
+			// 5/10 означает каждые 10 значений начиная с 5
+			if !hasStep {
+				to = from
+			}
+			if isRange {
+				if to, err = strconv.Atoi(last); err != nil {
+					return nil, fmt.Errorf("неверное значение %q", part)
+				}
+			}
+			if from < min || to > max || from > to {
+				return nil, fmt.Errorf("значение %q вне диапазона %d-%d", part, min, max)
+			}
+		}
+		for v := from; v <= to; v += step {
+			set[v] = true
+		}
+	}
+	return set, nil
+}
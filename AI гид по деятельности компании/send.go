@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	sendMaxAttempts = 3
+	sendBaseBackoff = time.Second
+)
+
+// Отправляет сообщение пользователю с повторными попытками при временных ошибках Telegram
+// (при 429 выдерживается пауза retry_after). Если пользователь заблокировал бота, он отмечается
+// в хранилище сессий, и дальнейшие сообщения ему не отправляются.
+// Возвращает nil, только если сообщение доставлено.
+func sendMessage(b *botInstance, msg tgbotapi.MessageConfig) error {
+	if b.sessions.IsBlocked(msg.ChatID) {
+		return errBlockedByUser
+	}
+
+	var err error
+	backoff := sendBaseBackoff
+
+	for attempt := 1; attempt <= sendMaxAttempts; attempt++ {
+		_, err = b.sender.Send(msg)
+		if err == nil {
+			return nil
+		}
+
+		if isBlockedByUser(err) {
+			b.log.Warn("Пользователь заблокировал бота", "chat_id", msg.ChatID)
+			b.sessions.MarkBlocked(msg.ChatID)
+			if err := forgetUser(b.cfg.Name, msg.ChatID); err != nil {
+				b.log.Error("Ошибка сохранения состояния", "error", err)
+			}
+			return err
+		}
+
+		if !isTransientSendError(err) || attempt == sendMaxAttempts {
+			break
+		}
+
+		wait := backoff
+		var tgErr *tgbotapi.Error
+		if errors.As(err, &tgErr) && tgErr.RetryAfter > 0 {
+			wait = time.Duration(tgErr.RetryAfter) * time.Second
+		}
+
+		b.log.Warn("Временная ошибка отправки сообщения, повтор", "chat_id", msg.ChatID, "attempt", attempt, "wait", wait, "error", err)
+		time.Sleep(wait)
+		backoff *= 2
+	}
+
+	metrics.IncError(errorCategorySend)
+	b.log.Error("Не удалось отправить сообщение", "chat_id", msg.ChatID, "message_length", utf8.RuneCountInString(msg.Text), "error", err)
+	return err
+}
+
+// Сообщение не отправлялось, так как пользователь ранее заблокировал бота
+var errBlockedByUser = errors.New("Пользователь заблокировал бота")
+
+// Проверяет, что ошибка означает блокировку бота пользователем
+func isBlockedByUser(err error) bool {
+	if errors.Is(err, errBlockedByUser) {
+		return true
+	}
+	var tgErr *tgbotapi.Error
+	if !errors.As(err, &tgErr) {
+		return false
+	}
+	return tgErr.Code == 403 && strings.Contains(tgErr.Message, "bot was blocked by the user")
+}
+
+// Временными считаются сетевые ошибки, превышение лимитов (429) и ошибки сервера Telegram
+func isTransientSendError(err error) bool {
+	var tgErr *tgbotapi.Error
+	if !errors.As(err, &tgErr) {
+		return true
+	}
+	return tgErr.Code == 429 || tgErr.Code >= 500
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+type UserSession struct {
+	mu           sync.Mutex
+	Messages     []map[string]interface{}
+	LastActivity time.Time
+	limiter      tokenBucket
+	// Температура, заданная пользователем командой /temp. nil — используется значение из конфигурации
+	Temperature *float64
+	// Модель, выбранная командой /model. Пустая — модель ассистента из конфигурации
+	Model string
+	// Последний неудавшийся запуск для повтора по кнопке
+	lastFailedRun *runRequest
+	// Пользователь включил голосовые ответы командой /voice_on
+	VoiceReplies bool
+	// Дополнительные указания ассистенту, заданные командой /instruct
+	AdditionalInstructions string
+	// Администратор включил отладочные сведения о запусках командой /debug
+	Debug bool
+	// Язык, выбранный командой /language. Пустой — определяется по профилю Telegram
+	Language string
+	// Последний нормализованный вопрос и время его получения для подавления повторов
+	lastQuery   string
+	lastQueryAt time.Time
+	// ID потока OpenAI, в котором хранится контекст диалога. Пустой — поток ещё не создан
+	ThreadID string
+	// Предложенные вопросы по ID из данных кнопки
+	followups      map[int]string
+	nextFollowupID int
+	// Текст рассылки, ожидающей подтверждения администратором
+	pendingBroadcast string
+	// Последний полученный ответ, который ещё не оценён командой /good или /bad
+	lastAnswer *answerRef
+	// Режим диалога: пустой — отвечает ассистент, sessionModeOperator — диалог передан оператору
+	Mode string
+	// Вопросы без отправленного ответа по ID сообщения пользователя, для обработки правок
+	pending map[int]*pendingQuestion
+	// Число сообщений, отброшенных из начала истории. Номер сообщения с начала диалога —
+	// dropped плюс его индекс в Messages — не меняется при обрезке истории
+	dropped int
+}
+
+// Приводит вопрос к виду для сравнения: без лишних пробелов и без учёта регистра
+func normalizeQuery(query string) string {
+	return strings.ToLower(strings.Join(strings.Fields(query), " "))
+}
+
+// Режимы контекста в группах, group_context_mode
+const (
+	// У каждого участника группы свой контекст, отдельный от личного чата с ботом
+	groupContextUser = "user"
+	// Один контекст на всю группу
+	groupContextShared = "shared"
+)
+
+// sessionKey — ключ сессии: чат и пользователь. В личном чате ID чата совпадает с ID
+// пользователя, в группе с общим контекстом UserID равен 0.
+type sessionKey struct {
+	ChatID, UserID int64
+}
+
+// Ключ сессии личного чата с пользователем. В ней же хранятся настройки пользователя, например язык
+func privateSession(userID int64) sessionKey {
+	return sessionKey{ChatID: userID, UserID: userID}
+}
+
+// Возвращает ключ сессии сообщения пользователя в чате по group_context_mode
+func chatSession(chat *tgbotapi.Chat, userID int64) sessionKey {
+	if chat == nil || chat.IsPrivate() {
+		return privateSession(userID)
+	}
+	if config.GroupContextMode == groupContextShared {
+		return sessionKey{ChatID: chat.ID}
+	}
+	return sessionKey{ChatID: chat.ID, UserID: userID}
+}
+
+// Сессия личного чата
+func (k sessionKey) private() bool {
+	return k.ChatID == k.UserID
+}
+
+// ID очереди запусков сессии: вопросы пользователя обрабатываются по порядку, а в группе
+// с общим контекстом — вопросы всех участников
+func (k sessionKey) queueID() int64 {
+	if k.UserID == 0 {
+		return k.ChatID
+	}
+	return k.UserID
+}
+
+// Число частей таблицы сессий. Каждая часть защищена своим мьютексом, поэтому обращения
+// к сессиям разных пользователей редко ждут друг друга
+const sessionShards = 32
+
+// Часть таблицы сессий
+type sessionShard struct {
+	mu       sync.RWMutex
+	sessions map[sessionKey]*UserSession
+}
+
+// SessionStore хранит сессии пользователей одного бота
+type SessionStore struct {
+	shards [sessionShards]sessionShard
+
+	mu sync.RWMutex
+	// Пользователи, заблокировавшие бота: им ничего не отправляется до их следующего сообщения
+	blocked map[int64]bool
+	// Расход пользователей за день. Хранится отдельно от сессий, чтобы лимит не сбрасывался
+	// при удалении неактивной сессии
+	usage map[int64]userUsage
+}
+
+func NewSessionStore() *SessionStore {
+	s := &SessionStore{
+		blocked: make(map[int64]bool),
+		usage:   make(map[int64]userUsage),
+	}
+	for i := range s.shards {
+		s.shards[i].sessions = make(map[sessionKey]*UserSession)
+	}
+	return s
+}
+
+// Возвращает часть таблицы, в которой хранится сессия
+func (s *SessionStore) shard(key sessionKey) *sessionShard {
+	h := uint64(key.ChatID)*0x9E3779B97F4A7C15 ^ uint64(key.UserID)
+	h ^= h >> 32
+	return &s.shards[h%sessionShards]
+}
+
+// Возвращает сессию, если она существует
+func (s *SessionStore) Get(key sessionKey) (*UserSession, bool) {
+	shard := s.shard(key)
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+	session, exists := shard.sessions[key]
+	return session, exists
+}
+
+// Возвращает сессию, создавая её при первом обращении. Наличие сессии проверяется повторно
+// под блокировкой записи: два одновременных первых сообщения получают одну и ту же сессию
+func (s *SessionStore) GetOrCreate(key sessionKey) *UserSession {
+	if session, exists := s.Get(key); exists {
+		return session
+	}
+
+	shard := s.shard(key)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	if session, exists := shard.sessions[key]; exists {
+		return session
+	}
+	session := &UserSession{Messages: []map[string]interface{}{}, LastActivity: time.Now()}
+	shard.sessions[key] = session
+	return session
+}
+
+// Удаляет сессию
+func (s *SessionStore) Delete(key sessionKey) {
+	shard := s.shard(key)
+	shard.mu.Lock()
+	delete(shard.sessions, key)
+	shard.mu.Unlock()
+}
+
+// Отмечает, что пользователь заблокировал бота, и удаляет сессию личного чата с ним
+func (s *SessionStore) MarkBlocked(userID int64) {
+	s.Delete(privateSession(userID))
+	s.mu.Lock()
+	s.blocked[userID] = true
+	s.mu.Unlock()
+}
+
+// Снимает отметку о блокировке бота пользователем
+func (s *SessionStore) Unblock(userID int64) {
+	s.mu.Lock()
+	delete(s.blocked, userID)
+	s.mu.Unlock()
+}
+
+// Проверяет, заблокировал ли пользователь бота
+func (s *SessionStore) IsBlocked(userID int64) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.blocked[userID]
+}
+
+// Возвращает ID всех пользователей, у которых есть сессия личного чата
+func (s *SessionStore) UserIDs() []int64 {
+	var ids []int64
+	for i := range s.shards {
+		shard := &s.shards[i]
+		shard.mu.RLock()
+		for key := range shard.sessions {
+			if key.private() {
+				ids = append(ids, key.UserID)
+			}
+		}
+		shard.mu.RUnlock()
+	}
+	return ids
+}
+
+// Количество активных сессий
+func (s *SessionStore) Len() int {
+	n := 0
+	for i := range s.shards {
+		shard := &s.shards[i]
+		shard.mu.RLock()
+		n += len(shard.sessions)
+		shard.mu.RUnlock()
+	}
+	return n
+}
+
+// Периодически удаляет сессии пользователей, неактивные дольше ttl.
+// Вместе с сессией удаляется и состояние ограничителя частоты запросов.
+func (s *SessionStore) runJanitor(interval, ttl time.Duration, log *slog.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		cutoff := time.Now().Add(-ttl)
+		today := quotaDay()
+
+		s.mu.Lock()
+		for userID, u := range s.usage {
+			if u.Day != today {
+				delete(s.usage, userID)
+			}
+		}
+		s.mu.Unlock()
+
+		// Части обходятся по одной, чтобы остальные сессии были доступны во время очистки
+		for i := range s.shards {
+			shard := &s.shards[i]
+			shard.mu.Lock()
+			for key, session := range shard.sessions {
+				session.mu.Lock()
+				idle := session.LastActivity.Before(cutoff)
+				session.mu.Unlock()
+				if idle {
+					delete(shard.sessions, key)
+					log.Debug("Сессия пользователя удалена по неактивности", "chat_id", key.ChatID, "user_id", key.UserID)
+				}
+			}
+			shard.mu.Unlock()
+		}
+	}
+}
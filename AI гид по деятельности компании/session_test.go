@@ -0,0 +1,102 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// Одновременные первые обращения к одной сессии получают один и тот же объект
+func TestGetOrCreateSameSession(t *testing.T) {
+	s := NewSessionStore()
+	key := privateSession(42)
+
+	const goroutines = 200
+	sessions := make([]*UserSession, goroutines)
+	var start, done sync.WaitGroup
+	start.Add(1)
+	for i := range goroutines {
+		done.Add(1)
+		go func() {
+			defer done.Done()
+			start.Wait()
+			sessions[i] = s.GetOrCreate(key)
+		}()
+	}
+	start.Done()
+	done.Wait()
+
+	for i, session := range sessions {
+		if session != sessions[0] {
+			t.Fatalf("Горутина %d получила другую сессию", i)
+		}
+	}
+	if s.Len() != 1 {
+		t.Errorf("Len() = %d, want 1", s.Len())
+	}
+}
+
+// Проверяет таблицу сессий под нагрузкой: запускать с -race
+func TestSessionStoreConcurrentAccess(t *testing.T) {
+	s := NewSessionStore()
+	const (
+		goroutines = 300
+		iterations = 200
+		users      = 50
+	)
+
+	var wg sync.WaitGroup
+	for g := range goroutines {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range iterations {
+				userID := int64((g + i) % users)
+				key := privateSession(userID)
+				if i%7 == 0 {
+					// Групповой чат: сессия не личная и не попадает в UserIDs
+					key = sessionKey{ChatID: -1000 - userID, UserID: userID}
+				}
+
+				switch i % 10 {
+				case 0:
+					s.Delete(key)
+				case 1:
+					for _, id := range s.UserIDs() {
+						if id < 0 || id >= users {
+							t.Errorf("UserIDs() вернул неизвестного пользователя %d", id)
+						}
+					}
+				case 2:
+					s.Len()
+				case 3:
+					s.MarkBlocked(userID)
+					s.Unblock(userID)
+				case 4:
+					s.AddUsage(userID, 1)
+					s.Usage(userID)
+				default:
+					session := s.GetOrCreate(key)
+					session.mu.Lock()
+					session.LastActivity = time.Now()
+					session.Messages = append(session.Messages, map[string]interface{}{"role": "user", "content": "вопрос"})
+					if len(session.Messages) > 10 {
+						session.Messages = session.Messages[len(session.Messages)-10:]
+					}
+					session.mu.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	// После нагрузки таблица согласована: каждая сессия находится по своему ключу
+	for _, id := range s.UserIDs() {
+		if _, ok := s.Get(privateSession(id)); !ok {
+			t.Errorf("Сессия пользователя %d есть в UserIDs(), но не находится Get", id)
+		}
+	}
+	if n := s.Len(); n > 2*users {
+		t.Errorf("Len() = %d, больше числа ключей %d", n, 2*users)
+	}
+}
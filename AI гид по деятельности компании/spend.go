@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"proxyapi-bot/internal/openai"
+)
+
+// Цена модели за 1000 токенов в валюте spend_currency
+type ModelPrice struct {
+	Prompt     float64 `yaml:"prompt"`
+	Completion float64 `yaml:"completion"`
+}
+
+// Цены OpenAI в долларах за 1000 токенов для распространённых моделей. Цены из model_prices
+// заменяют эти. Модели с датой в названии (gpt-4o-2024-08-06) получают цену базовой модели.
+var defaultModelPrices = map[string]ModelPrice{
+	"gpt-4o":        {Prompt: 0.0025, Completion: 0.01},
+	"gpt-4o-mini":   {Prompt: 0.00015, Completion: 0.0006},
+	"gpt-4.1":       {Prompt: 0.002, Completion: 0.008},
+	"gpt-4.1-mini":  {Prompt: 0.0004, Completion: 0.0016},
+	"gpt-4.1-nano":  {Prompt: 0.0001, Completion: 0.0004},
+	"gpt-4-turbo":   {Prompt: 0.01, Completion: 0.03},
+	"gpt-4":         {Prompt: 0.03, Completion: 0.06},
+	"gpt-3.5-turbo": {Prompt: 0.0005, Completion: 0.0015},
+	"o1":            {Prompt: 0.015, Completion: 0.06},
+	"o1-mini":       {Prompt: 0.0011, Completion: 0.0044},
+	"o3":            {Prompt: 0.002, Completion: 0.008},
+	"o3-mini":       {Prompt: 0.0011, Completion: 0.0044},
+	"o4-mini":       {Prompt: 0.0011, Completion: 0.0044},
+}
+
+// Сколько дней расхода хранится в файле состояния: хватает на текущий и прошлый месяц
+const spendKeepDays = 62
+
+// Расход за день. Хранится в файле состояния по дате в часовом поясе quota_timezone.
+type spendDay struct {
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	Cost             float64 `json:"cost"`
+	// Токены моделей без цены. Они не входят в Cost
+	UnpricedTokens int64 `json:"unpriced_tokens,omitempty"`
+}
+
+func (d *spendDay) add(other spendDay) {
+	d.PromptTokens += other.PromptTokens
+	d.CompletionTokens += other.CompletionTokens
+	d.Cost += other.Cost
+	d.UnpricedTokens += other.UnpricedTokens
+}
+
+// Модели без цены, о которых уже предупреждали в журнале
+var (
+	unpricedMu     sync.Mutex
+	unpricedWarned = make(map[string]bool)
+)
+
+// Возвращает цену модели. Модель с суффиксом (gpt-4o-2024-08-06) получает цену самой
+// длинной подходящей базовой модели. false — цены нет.
+func modelPrice(model string) (ModelPrice, bool) {
+	return lookupModel(model, config.ModelPrices, defaultModelPrices)
+}
+
+// Ищет значение для модели в таблицах: сначала по точному имени, затем по самой длинной
+// базовой модели, для которой модель — версия с суффиксом (gpt-4o-2024-08-06). Точное имя
+// в любой таблице важнее префикса, а при равных совпадениях выигрывает таблица, указанная раньше
+func lookupModel[V any](model string, tables ...map[string]V) (V, bool) {
+	for _, table := range tables {
+		if v, ok := table[model]; ok {
+			return v, true
+		}
+	}
+	var best V
+	bestName := ""
+	for _, table := range tables {
+		for name, v := range table {
+			if strings.HasPrefix(model, name+"-") && len(name) > len(bestName) {
+				best, bestName = v, name
+			}
+		}
+	}
+	return best, bestName != ""
+}
+
+// Учитывает токены запуска в расходе за день и сохраняет его в файле состояния.
+// Для модели без цены учитываются только токены, а в журнал один раз пишется предупреждение.
+func recordSpend(log *slog.Logger, model string, usage openai.Usage) {
+	if usage.TotalTokens == 0 {
+		return
+	}
+	spend := spendDay{PromptTokens: usage.PromptTokens, CompletionTokens: usage.CompletionTokens}
+	if price, ok := modelPrice(model); ok {
+		spend.Cost = (float64(usage.PromptTokens)*price.Prompt + float64(usage.CompletionTokens)*price.Completion) / 1000
+	} else {
+		spend.UnpricedTokens = usage.TotalTokens
+		unpricedMu.Lock()
+		if !unpricedWarned[model] {
+			unpricedWarned[model] = true
+			log.Warn("Для модели не задана цена в model_prices, расход учитывается только в токенах", "model", model)
+		}
+		unpricedMu.Unlock()
+	}
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	if state.Spend == nil {
+		state.Spend = make(map[string]spendDay)
+	}
+	day := quotaDay()
+	total := state.Spend[day]
+	total.add(spend)
+	state.Spend[day] = total
+
+	oldest := time.Now().In(quotaLocation).AddDate(0, 0, -spendKeepDays).Format(time.DateOnly)
+	for d := range state.Spend {
+		if d < oldest {
+			delete(state.Spend, d)
+		}
+	}
+	if err := state.saveLocked(); err != nil {
+		log.Error("Ошибка сохранения расхода в файле состояния", "error", err)
+	}
+}
+
+// Возвращает расход за день date и за месяц, в который он входит, по начало дня date включительно
+func spendTotals(date time.Time) (day, month spendDay) {
+	dayKey := date.Format(time.DateOnly)
+	monthPrefix := date.Format("2006-01-")
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	for d, spend := range state.Spend {
+		if strings.HasPrefix(d, monthPrefix) && d <= dayKey {
+			month.add(spend)
+		}
+	}
+	return state.Spend[dayKey], month
+}
+
+// Форматирует оценку расхода: сумма и, если были модели без цены, их токены
+func formatSpend(lang string, spend spendDay) string {
+	s := fmt.Sprintf("%.2f %s", spend.Cost, config.SpendCurrency)
+	if spend.UnpricedTokens > 0 {
+		s += " " + t(lang, "spend.unpriced", spend.UnpricedTokens)
+	}
+	return s
+}
+
+// Формирует раздел /stats об оценке расхода
+func spendReport() string {
+	day, month := spendTotals(time.Now().In(quotaLocation))
+	var b strings.Builder
+	fmt.Fprintf(&b, "Расход за сегодня:     %s (%d + %d токенов)\n", formatSpend("ru", day), day.PromptTokens, day.CompletionTokens)
+	fmt.Fprintf(&b, "Расход за месяц:       %s (%d + %d токенов)\n", formatSpend("ru", month), month.PromptTokens, month.CompletionTokens)
+	return b.String()
+}
+
+// Записывает оценку расхода в метрики Prometheus
+func writeSpendMetrics(w io.Writer) {
+	day, month := spendTotals(time.Now().In(quotaLocation))
+	fmt.Fprint(w, "# HELP openai_spend_estimate Оценка расхода на OpenAI по ценам model_prices в валюте spend_currency.\n# TYPE openai_spend_estimate gauge\n")
+	fmt.Fprintf(w, "openai_spend_estimate{period=\"day\"} %g\n", day.Cost)
+	fmt.Fprintf(w, "openai_spend_estimate{period=\"month\"} %g\n", month.Cost)
+	fmt.Fprint(w, "# HELP openai_unpriced_tokens Токены моделей без цены, не вошедшие в оценку расхода.\n# TYPE openai_unpriced_tokens gauge\n")
+	fmt.Fprintf(w, "openai_unpriced_tokens{period=\"day\"} %d\n", day.UnpricedTokens)
+	fmt.Fprintf(w, "openai_unpriced_tokens{period=\"month\"} %d\n", month.UnpricedTokens)
+}
+
+// Отправляет в spend_report_chat_id итог расхода за прошедший день после каждой полуночи
+// по quota_timezone. Возвращает функцию остановки.
+func startSpendReport(b *botInstance) func() {
+	done := make(chan struct{})
+	go func() {
+		for {
+			now := time.Now().In(quotaLocation)
+			midnight := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, quotaLocation)
+			timer := time.NewTimer(time.Until(midnight))
+			select {
+			case <-done:
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+			sendSpendReport(b, midnight.AddDate(0, 0, -1))
+		}
+	}()
+	return func() { close(done) }
+}
+
+func sendSpendReport(b *botInstance, date time.Time) {
+	day, month := spendTotals(date)
+	lang := config.DefaultLanguage
+	text := t(lang, "spend.daily", date.Format("02.01.2006"), formatSpend(lang, day), day.PromptTokens, day.CompletionTokens, formatSpend(lang, month))
+	b.log.Info("Расход за день", "date", date.Format(time.DateOnly), "cost", day.Cost,
+		"prompt_tokens", day.PromptTokens, "completion_tokens", day.CompletionTokens, "unpriced_tokens", day.UnpricedTokens)
+	if err := sendMessage(b, tgbotapi.NewMessage(config.SpendReportChatID, text)); err != nil {
+		b.log.Error("Ошибка отправки итога расхода", "chat_id", config.SpendReportChatID, "error", err)
+	}
+}
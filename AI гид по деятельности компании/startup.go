@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// startupSteps выполняет независимые шаги запуска бота параллельно, как errgroup.WithContext:
+// первая ошибка отменяет контекст остальных шагов, а Wait возвращает её с названием шага.
+// Длительность каждого шага записывается в журнал.
+type startupSteps struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	log    *slog.Logger
+
+	wg   sync.WaitGroup
+	once sync.Once
+	err  error
+}
+
+func newStartupSteps(ctx context.Context, log *slog.Logger) *startupSteps {
+	ctx, cancel := context.WithCancel(ctx)
+	return &startupSteps{ctx: ctx, cancel: cancel, log: log}
+}
+
+// Запускает шаг в отдельной горутине
+func (s *startupSteps) Go(name string, step func(ctx context.Context) error) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		if err := s.run(name, step); err != nil {
+			s.once.Do(func() {
+				s.err = err
+				s.cancel()
+			})
+		}
+	}()
+}
+
+// Ожидает завершения запущенных шагов и возвращает первую ошибку
+func (s *startupSteps) Wait() error {
+	s.wg.Wait()
+	return s.err
+}
+
+// Выполняет шаг, который зависит от результатов предыдущих, после Wait
+func (s *startupSteps) Run(name string, step func(ctx context.Context) error) error {
+	return s.run(name, step)
+}
+
+// Отменяет контекст шагов. Вызывается после завершения запуска.
+func (s *startupSteps) Close() {
+	s.cancel()
+}
+
+func (s *startupSteps) run(name string, step func(ctx context.Context) error) error {
+	start := time.Now()
+	if err := step(s.ctx); err != nil {
+		s.log.Error("Шаг запуска завершился ошибкой", "step", name, "duration", time.Since(start).Round(time.Millisecond), "error", err)
+		return fmt.Errorf("Шаг запуска \"%s\" не выполнен: %w", name, err)
+	}
+	s.log.Info("Шаг запуска выполнен", "step", name, "duration", time.Since(start).Round(time.Millisecond))
+	return nil
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+)
+
+// BotState — состояние бота, которое должно переживать перезапуск.
+// Хранится в JSON-файле, указанном в config.StateFile.
+type BotState struct {
+	mu             sync.Mutex
+	AllowedUserIDs []int64 `json:"allowed_user_ids,omitempty"`
+	// Пользователи, писавшие каждому из ботов, — получатели /broadcast после перезапуска
+	KnownUsers map[string][]int64 `json:"known_users,omitempty"`
+	// Пользователи, получившие приветствие send_welcome, по имени бота
+	Greeted map[string][]int64 `json:"greeted,omitempty"`
+	// Ассистенты ботов по имени бота: при перезапуске они переиспользуются, а не создаются заново
+	Assistants map[string]savedAssistant `json:"assistants,omitempty"`
+	// Оценка расхода на OpenAI по дням, чтобы итоги за день и месяц не обнулялись при перезапуске
+	Spend map[string]spendDay `json:"spend,omitempty"`
+	// Загруженные файлы по хэшу содержимого и имени: повторная загрузка после сбоя
+	// переиспользует файл, а не создаёт копию
+	Uploads map[string]savedUpload `json:"uploads,omitempty"`
+	// Базы знаний ботов по имени бота: при перезапуске Vector Store переиспользуется,
+	// и загружаются только файлы, изменённые в источнике
+	Knowledge map[string]savedKnowledge `json:"knowledge,omitempty"`
+}
+
+// Vector Store бота и загруженные в него файлы источника по имени в источнике
+type savedKnowledge struct {
+	VectorStoreID string                `json:"vector_store_id"`
+	Files         map[string]syncedFile `json:"files,omitempty"`
+}
+
+// Файл, загруженный в API
+type savedUpload struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// Ассистент, созданный ботом, и настройки, которые были ему переданы последними
+type savedAssistant struct {
+	ID           string   `json:"id"`
+	Name         string   `json:"name"`
+	Instructions string   `json:"instructions"`
+	Model        string   `json:"model"`
+	Tools        []string `json:"tools,omitempty"`
+	// Инструкции, заданные командой /set_instructions. Пока они заданы, инструкции из конфигурации не применяются
+	InstructionsOverride string `json:"instructions_override,omitempty"`
+}
+
+var state = &BotState{}
+
+// Загружает состояние из файла. Отсутствие файла не является ошибкой.
+func loadState(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("Ошибка чтения файла состояния: %v", err)
+	}
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	if err := json.Unmarshal(data, state); err != nil {
+		return fmt.Errorf("Ошибка разбора файла состояния: %v", err)
+	}
+	return nil
+}
+
+// Сохраняет состояние в файл. Вызывается с захваченным state.mu.
+// Запись выполняется через временный файл и переименование, чтобы файл не повредился при сбое.
+func (s *BotState) saveLocked() error {
+	if config.StateFile == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("Ошибка формирования файла состояния: %v", err)
+	}
+
+	return writeFileAtomic(config.StateFile, data)
+}
+
+// Атомарно записывает данные в файл
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// Запоминает пользователя бота для рассылок. Файл состояния перезаписывается только для новых пользователей.
+func rememberUser(botName string, userID int64) error {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	if slices.Contains(state.KnownUsers[botName], userID) {
+		return nil
+	}
+	if state.KnownUsers == nil {
+		state.KnownUsers = make(map[string][]int64)
+	}
+	state.KnownUsers[botName] = append(state.KnownUsers[botName], userID)
+	return state.saveLocked()
+}
+
+// Удаляет пользователя из получателей рассылок, например после блокировки бота
+func forgetUser(botName string, userID int64) error {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	users := state.KnownUsers[botName]
+	i := slices.Index(users, userID)
+	if i < 0 {
+		return nil
+	}
+	state.KnownUsers[botName] = slices.Delete(users, i, i+1)
+	return state.saveLocked()
+}
+
+// Возвращает сохранённых пользователей бота
+func knownUsers(botName string) []int64 {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	return slices.Clone(state.KnownUsers[botName])
+}
+
+// Возвращает сохранённого ассистента бота
+func savedAssistantFor(botName string) (savedAssistant, bool) {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	assistant, ok := state.Assistants[botName]
+	return assistant, ok
+}
+
+// Сохраняет ассистента бота в файле состояния
+func saveAssistant(botName string, assistant savedAssistant) error {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	if state.Assistants == nil {
+		state.Assistants = make(map[string]savedAssistant)
+	}
+	state.Assistants[botName] = assistant
+	return state.saveLocked()
+}
+
+// Возвращает сохранённую базу знаний бота
+func savedKnowledgeFor(botName string) (savedKnowledge, bool) {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	knowledge, ok := state.Knowledge[botName]
+	return knowledge, ok
+}
+
+// Сохраняет базу знаний бота в файле состояния
+func saveKnowledge(botName string, knowledge savedKnowledge) error {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	if state.Knowledge == nil {
+		state.Knowledge = make(map[string]savedKnowledge)
+	}
+	state.Knowledge[botName] = knowledge
+	return state.saveLocked()
+}
+
+// Отмечает, что пользователь бота получил приветствие. Возвращает false, если он уже был отмечен.
+// Ошибка сохранения не отменяет отметку: приветствие не повторяется до перезапуска.
+func markGreeted(botName string, userID int64) (bool, error) {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	if slices.Contains(state.Greeted[botName], userID) {
+		return false, nil
+	}
+	if state.Greeted == nil {
+		state.Greeted = make(map[string][]int64)
+	}
+	state.Greeted[botName] = append(state.Greeted[botName], userID)
+	return true, state.saveLocked()
+}
+
+// Ключ файла в state.Uploads
+func uploadKey(hash, name string) string {
+	return hash + "/" + name
+}
+
+// Возвращает ID ранее загруженного файла с тем же содержимым и именем
+func savedUploadFor(hash, name string) (savedUpload, bool) {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	upload, ok := state.Uploads[uploadKey(hash, name)]
+	return upload, ok
+}
+
+// Проверяет, запомнен ли загруженный файл с этим именем
+func hasSavedUpload(name string) bool {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	for _, upload := range state.Uploads {
+		if upload.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Запоминает загруженный файл. Вызывается сразу после загрузки, до регистрации в Vector Store,
+// чтобы файл нашёлся, если процесс завершится между этими шагами.
+func saveUpload(hash, name, fileID string) error {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	if state.Uploads == nil {
+		state.Uploads = make(map[string]savedUpload)
+	}
+	state.Uploads[uploadKey(hash, name)] = savedUpload{ID: fileID, Name: name}
+	return state.saveLocked()
+}
+
+// Забывает загруженный файл после его удаления
+func forgetUpload(fileID string) error {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	found := false
+	for key, upload := range state.Uploads {
+		if upload.ID == fileID {
+			delete(state.Uploads, key)
+			found = true
+		}
+	}
+	if !found {
+		return nil
+	}
+	return state.saveLocked()
+}
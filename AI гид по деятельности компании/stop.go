@@ -0,0 +1,35 @@
+package main
+
+import (
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// /stop — останавливает подготовку ответа на текущий вопрос. Вопросы, ждущие в очереди,
+// остаются в ней. Неполный ответ не отправляется и не попадает в историю.
+func handleStopCommand(b *botInstance, message *tgbotapi.Message) {
+	lang := userLanguage(b, message.From)
+	session, exists := b.sessions.Get(chatSession(message.Chat, message.From.ID))
+	if !exists || !stopActiveRun(session) {
+		sendMessage(b, tgbotapi.NewMessage(message.Chat.ID, t(lang, "stop.nothing")))
+		return
+	}
+	b.log.Info("Пользователь остановил запуск", "user_id", message.From.ID)
+	sendMessage(b, tgbotapi.NewMessage(message.Chat.ID, t(lang, "stop.stopped")))
+}
+
+// Отменяет контекст начатого запуска сессии. Запуск на стороне API отменяет runAssistant,
+// получив ошибку отмены. false — ответ сейчас не готовится.
+func stopActiveRun(session *UserSession) bool {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	for _, pending := range session.pending {
+		if pending.started && !pending.superseded {
+			pending.superseded = true
+			pending.cancel()
+			// Тот же вопрос можно сразу задать снова
+			session.lastQuery = ""
+			return true
+		}
+	}
+	return false
+}
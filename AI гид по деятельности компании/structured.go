@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"strings"
+	"unicode/utf8"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"proxyapi-bot/internal/openai"
+)
+
+// Указание для повторного запуска, если ответ не разобрался по схеме
+const structuredRetryInstructions = "Предыдущий ответ не соответствовал схеме. Верни только JSON, строго соответствующий заданной схеме, без пояснений и разметки."
+
+// Выполняет разовый запуск ассистента без истории диалога с ответом в формате JSON по схеме
+// и разбирает ответ в out. Ответ, который не разобрался, запрашивается ещё раз с указанием
+// соблюдать схему, и только вторая ошибка возвращается. Расход учитывается в лимитах пользователя.
+func runStructured(ctx context.Context, b *botInstance, userID int64, question, schemaName string, schema json.RawMessage, out interface{}) error {
+	run := runRequest{
+		RunRequest: openai.RunRequest{
+			AssistantID:         b.assistantID,
+			VectorStoreID:       b.vectorStoreID,
+			Messages:            []map[string]interface{}{{"role": "user", "content": question}},
+			Temperature:         *config.Temperature,
+			MaxCompletionTokens: b.cfg.MaxCompletionTokens,
+			MaxPromptTokens:     b.cfg.MaxPromptTokens,
+			ResponseFormat: &openai.ResponseFormat{
+				Type:       "json_schema",
+				JSONSchema: &openai.JSONSchema{Name: schemaName, Schema: schema, Strict: true},
+			},
+		},
+		Question: question,
+	}
+
+	var decodeErr error
+	for attempt := 0; attempt < 2; attempt++ {
+		if attempt > 0 {
+			requestLog(ctx, b.log).Warn("Ответ не соответствует схеме, повтор запуска", "user_id", userID, "schema", schemaName, "error", decodeErr)
+			run.AdditionalInstructions = structuredRetryInstructions
+		}
+		result, err := runAssistant(ctx, b, run)
+		recordUsage(b, userID, result.Usage.TotalTokens)
+		if err != nil {
+			return err
+		}
+		if decodeErr = json.Unmarshal([]byte(strings.TrimSpace(result.Text)), out); decodeErr == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("Ответ не соответствует схеме %s: %v", schemaName, decodeErr)
+}
+
+// Схема ответа /table: заголовки столбцов и строки таблицы
+var tableSchema = json.RawMessage(`{
+	"type": "object",
+	"properties": {
+		"title": {"type": "string"},
+		"columns": {"type": "array", "items": {"type": "string"}},
+		"rows": {"type": "array", "items": {"type": "array", "items": {"type": "string"}}}
+	},
+	"required": ["title", "columns", "rows"],
+	"additionalProperties": false
+}`)
+
+const tablePrompt = "Ответь на вопрос таблицей по данным базы знаний. Заполни title, columns и rows; " +
+	"в каждой строке столько же ячеек, сколько столбцов. Если данных нет, верни пустой rows.\n\nВопрос: "
+
+// Ответ ассистента по схеме tableSchema
+type structuredTable struct {
+	Title   string     `json:"title"`
+	Columns []string   `json:"columns"`
+	Rows    [][]string `json:"rows"`
+}
+
+const (
+	// Максимальная ширина ячейки таблицы в символах: более длинный текст обрезается
+	tableCellWidth = 30
+	// Длина части таблицы в сообщении с запасом под заголовок, теги и экранирование HTML
+	tablePartLimit = 3000
+)
+
+// /table <вопрос> — ответ ассистента таблицей, например сравнение тарифов или список контактов
+func handleTableCommand(b *botInstance, message *tgbotapi.Message) {
+	lang := userLanguage(b, message.From)
+	question := commandArgs(message)
+	if question == "" {
+		sendMessage(b, tgbotapi.NewMessage(message.Chat.ID, t(lang, "table.usage")))
+		return
+	}
+	if !checkQuota(b, message, lang) {
+		return
+	}
+	if !runSlots.Acquire() {
+		sendMessage(b, tgbotapi.NewMessage(message.Chat.ID, config.Errors.forCategory(lang, userErrorBusy)))
+		return
+	}
+	defer runSlots.Release()
+	b.sender.Request(tgbotapi.NewChatAction(message.Chat.ID, tgbotapi.ChatTyping))
+
+	ctx := newRequestContext()
+	log := requestLog(ctx, b.log)
+	var table structuredTable
+	if err := runStructured(ctx, b, message.From.ID, tablePrompt+question, "table", tableSchema, &table); err != nil {
+		log.Error("Ошибка получения таблицы", "user_id", message.From.ID, "error", err)
+		sendMessage(b, tgbotapi.NewMessage(message.Chat.ID, t(lang, "table.failed")))
+		return
+	}
+	if len(table.Columns) == 0 || len(table.Rows) == 0 {
+		sendMessage(b, tgbotapi.NewMessage(message.Chat.ID, t(lang, "table.empty")))
+		return
+	}
+
+	for i, part := range splitMessage(formatTable(table), tablePartLimit) {
+		msg := tgbotapi.NewMessage(message.Chat.ID, "<pre>"+html.EscapeString(part)+"</pre>")
+		if i == 0 && table.Title != "" {
+			msg.Text = "<b>" + html.EscapeString(table.Title) + "</b>\n" + msg.Text
+		}
+		msg.ParseMode = tgbotapi.ModeHTML
+		if err := sendMessage(b, msg); err != nil {
+			log.Error("Ошибка отправки таблицы", "user_id", message.From.ID, "error", err)
+			return
+		}
+	}
+}
+
+// Форматирует таблицу моноширинным текстом с выравниванием столбцов по самой длинной ячейке
+func formatTable(table structuredTable) string {
+	cell := func(row []string, i int) string {
+		if i >= len(row) {
+			return ""
+		}
+		s := strings.Join(strings.Fields(row[i]), " ")
+		if utf8.RuneCountInString(s) > tableCellWidth {
+			s = string([]rune(s)[:tableCellWidth-1]) + "…"
+		}
+		return s
+	}
+
+	rows := append([][]string{table.Columns}, table.Rows...)
+	widths := make([]int, len(table.Columns))
+	for _, row := range rows {
+		for i := range widths {
+			widths[i] = max(widths[i], utf8.RuneCountInString(cell(row, i)))
+		}
+	}
+
+	var sb strings.Builder
+	writeRow := func(row []string) {
+		for i, width := range widths {
+			s := cell(row, i)
+			if i > 0 {
+				sb.WriteString(" │ ")
+			}
+			sb.WriteString(s)
+			if i < len(widths)-1 {
+				sb.WriteString(strings.Repeat(" ", width-utf8.RuneCountInString(s)))
+			}
+		}
+		sb.WriteString("\n")
+	}
+	writeRow(table.Columns)
+	for i, width := range widths {
+		if i > 0 {
+			sb.WriteString("─┼─")
+		}
+		sb.WriteString(strings.Repeat("─", width))
+	}
+	sb.WriteString("\n")
+	for _, row := range table.Rows {
+		writeRow(row)
+	}
+	return sb.String()
+}
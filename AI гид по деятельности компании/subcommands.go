@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"time"
+
+	"proxyapi-bot/internal/openai"
+)
+
+// Подкоманды для разовых операций без запуска ботов. Настройки берутся из config.yaml,
+// результат выводится в stdout, журнал — в stderr.
+//
+//	upload <каталог>                               — создать Vector Store из файлов каталога и вывести его ID
+//	ask <assistant_id> <vector_store_id> "вопрос"  — задать один вопрос ассистенту и вывести ответ
+//	cleanup [-dry-run]                             — удалить ассистентов ботов, которых нет в файле состояния
+var subcommands = map[string]func(ctx context.Context, w io.Writer, args []string) error{
+	"upload":  runUploadSubcommand,
+	"ask":     runAskSubcommand,
+	"cleanup": runCleanupSubcommand,
+}
+
+// Выполняет подкоманду и возвращает код завершения процесса
+func runSubcommand(name string, args []string) int {
+	run, ok := subcommands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Неизвестная подкоманда %s, доступны: upload, ask, cleanup\n", name)
+		return 2
+	}
+	if err := loadConfig("config.yaml"); err != nil {
+		slog.Error("Ошибка загрузки конфигурации", "error", err)
+		return 1
+	}
+	setRedactedSecrets(&config)
+
+	if err := run(context.Background(), os.Stdout, args); err != nil {
+		slog.Error("Ошибка выполнения подкоманды", "subcommand", name, "error", err)
+		return 1
+	}
+	return 0
+}
+
+// upload <каталог> — загружает файлы каталога в новый Vector Store и выводит его ID
+func runUploadSubcommand(ctx context.Context, w io.Writer, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("Использование: upload <каталог>")
+	}
+	// Состояние хранит уже загруженные файлы: повторный запуск после сбоя их не дублирует
+	if err := loadState(config.StateFile); err != nil {
+		return fmt.Errorf("Ошибка загрузки состояния: %v", err)
+	}
+	api := newAPIClient(slog.Default())
+	vectorStoreID, report, err := createVectorStoreAndUploadFiles(ctx, api, slog.Default(), localSource{dir: args[0]})
+	if err != nil {
+		return err
+	}
+	if report.Uploaded == 0 {
+		return fmt.Errorf("Ни один файл не загружен: %s", report)
+	}
+	fmt.Fprintln(w, vectorStoreID)
+	return nil
+}
+
+// ask <assistant_id> <vector_store_id> "вопрос" — запускает ассистента с одним вопросом без
+// истории и выводит ответ. Пустой vector_store_id — без базы знаний
+func runAskSubcommand(ctx context.Context, w io.Writer, args []string) error {
+	if len(args) != 3 {
+		return fmt.Errorf(`Использование: ask <assistant_id> <vector_store_id> "вопрос"`)
+	}
+	api := newAPIClient(slog.Default())
+	run := openai.RunRequest{
+		AssistantID:         args[0],
+		VectorStoreID:       args[1],
+		Messages:            []map[string]interface{}{{"role": "user", "content": args[2]}},
+		Temperature:         *config.Temperature,
+		MaxCompletionTokens: config.MaxCompletionTokens,
+		MaxPromptTokens:     config.MaxPromptTokens,
+	}
+	// Модель ассистента неизвестна без отдельного запроса, поэтому берётся модель из настроек
+	if isReasoningModel(config.Model) {
+		run.Reasoning = true
+		run.ReasoningEffort = config.ReasoningEffort
+		run.StreamTimeout = time.Duration(config.ReasoningStreamTimeoutSeconds) * time.Second
+	}
+
+	result, err := api.CreateThreadRun(ctx, run, nil)
+	if result.ThreadID != "" && config.DeleteUnusedThreads {
+		if err := api.DeleteThread(ctx, result.ThreadID); err != nil {
+			slog.Warn("Не удалось удалить поток запуска", "thread_id", result.ThreadID, "error", err)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(w, result.Text)
+	return nil
+}
+
+// cleanup [-dry-run] — удаляет ассистентов с именами ботов из настроек, кроме сохранённых в файле
+// состояния: их оставляют запуски, состояние которых было потеряно. Потоки API перечислить
+// не позволяет, поэтому они не удаляются: потоки разовых запусков удаляет delete_unused_threads.
+func runCleanupSubcommand(ctx context.Context, w io.Writer, args []string) error {
+	flags := flag.NewFlagSet("cleanup", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "Только вывести ассистентов, которые будут удалены")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := loadState(config.StateFile); err != nil {
+		return fmt.Errorf("Ошибка загрузки состояния: %v", err)
+	}
+
+	api := newAPIClient(slog.Default())
+	assistants, err := api.ListAssistants(ctx)
+	if err != nil {
+		return err
+	}
+
+	var deleted, failed int
+	for _, a := range assistants {
+		if !slices.ContainsFunc(config.Bots, func(cfg BotConfig) bool { return cfg.Name == a.Name }) {
+			continue
+		}
+		if saved, ok := savedAssistantFor(a.Name); ok && saved.ID == a.ID {
+			continue
+		}
+		created := time.Unix(a.CreatedAt, 0).Format(time.DateTime)
+		if *dryRun {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", a.ID, a.Name, created)
+			continue
+		}
+		if err := api.DeleteAssistant(ctx, a.ID); err != nil {
+			slog.Error("Ошибка удаления ассистента", "assistant_id", a.ID, "error", err)
+			failed++
+			continue
+		}
+		fmt.Fprintf(w, "Удалён %s\t%s\t%s\n", a.ID, a.Name, created)
+		deleted++
+	}
+
+	if !*dryRun {
+		fmt.Fprintf(w, "Удалено ассистентов: %d\n", deleted)
+	}
+	if failed > 0 {
+		return fmt.Errorf("Не удалось удалить ассистентов: %d", failed)
+	}
+	return nil
+}
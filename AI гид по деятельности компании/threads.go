@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"proxyapi-bot/internal/openai"
+)
+
+// Возвращает, сколько сообщений истории хранится в сессии. В режиме потоков с
+// truncation_strategy last_messages контекст обрезает API, и локальная история
+// ограничивается тем же числом сообщений, чтобы не обрезать контекст дважды.
+// Вызывается с захваченным session.mu.
+func contextLimit(b *botInstance, session *UserSession) int {
+	if ts := config.TruncationStrategy; session.ThreadID != "" && ts != nil && ts.Type == "last_messages" {
+		return ts.LastMessages
+	}
+	return b.cfg.MaxContextMessages
+}
+
+// Время на удаление потока, которое не зависит от запроса пользователя
+const deleteThreadTimeout = 30 * time.Second
+
+// Удаляет поток в фоне, не задерживая ответ пользователю. Ошибка удаления только записывается
+// в журнал: неудалённый поток занимает место на стороне API, но не мешает работе бота.
+func deleteThreadLater(b *botInstance, threadID string) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), deleteThreadTimeout)
+		defer cancel()
+		if err := b.api.DeleteThread(ctx, threadID); err != nil && !isNotFound(err) {
+			b.log.Warn("Не удалось удалить поток", "thread_id", threadID, "error", err)
+			return
+		}
+		b.log.Debug("Поток удалён", "thread_id", threadID)
+	}()
+}
+
+// Отменяет в фоне запуск на стороне API, после того как бот перестал читать его ответ (/stop или
+// правка вопроса): иначе ассистент продолжит генерацию, расходуя токены, а поток останется занят
+func cancelRunLater(b *botInstance, threadID, runID string) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), deleteThreadTimeout)
+		defer cancel()
+		if err := b.api.CancelRun(ctx, threadID, runID); err != nil && !isNotFound(err) {
+			b.log.Warn("Не удалось отменить запуск", "thread_id", threadID, "run_id", runID, "error", err)
+			return
+		}
+		b.log.Debug("Запуск отменён", "thread_id", threadID, "run_id", runID)
+	}()
+}
+
+// Подготавливает поток пользователя к запуску. При первом сообщении поток создаётся
+// сразу со всей историей, затем в него добавляется только новый вопрос.
+// Если создать поток не удалось, запрос выполняется без потока, с передачей всей истории.
+func prepareThread(ctx context.Context, b *botInstance, userID int64, session *UserSession, run *runRequest) error {
+	log := requestLog(ctx, b.log)
+	if run.ThreadMessageAdded {
+		return nil
+	}
+
+	if run.ThreadID == "" {
+		session.mu.Lock()
+		run.ThreadID = session.ThreadID
+		session.mu.Unlock()
+	}
+
+	if run.ThreadID != "" {
+		err := b.api.AddThreadMessage(ctx, run.ThreadID, "user", userContent(run.Question, run.ImageURL), run.attachments())
+		if err == nil {
+			run.ThreadMessageAdded = true
+			return nil
+		}
+
+		var apiErr *openai.APIError
+		if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+			return err
+		}
+		// Поток удалён на стороне API — создаём новый
+		log.Warn("Поток пользователя не найден, будет создан новый", "user_id", userID, "thread_id", run.ThreadID)
+	}
+
+	threadID, err := b.api.CreateThread(ctx, run.Messages, run.VectorStoreID)
+	if err != nil {
+		log.Warn("Не удалось создать поток, запрос будет выполнен без него", "user_id", userID, "error", err)
+		run.ThreadID = ""
+		return nil
+	}
+
+	session.mu.Lock()
+	session.ThreadID = threadID
+	session.mu.Unlock()
+
+	run.ThreadID = threadID
+	run.ThreadMessageAdded = true
+	return nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"proxyapi-bot/internal/openai"
+)
+
+// Инструменты ассистента, которые можно указать в tools
+const (
+	toolFileSearch      = "file_search"
+	toolCodeInterpreter = "code_interpreter"
+	toolFunction        = "function"
+)
+
+var knownTools = []string{toolFileSearch, toolCodeInterpreter, toolFunction}
+
+// Имя функции по требованиям API
+var functionNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// FunctionConfig — функция, которую может вызвать ассистент с инструментом function
+type FunctionConfig struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description"`
+	// JSON Schema аргументов функции в виде строки JSON. Пусто — функция без аргументов.
+	Parameters string `yaml:"parameters"`
+}
+
+// Проверяет типы инструментов и описания функций. Неизвестные инструменты перечисляются
+// в ошибке все сразу: опечатка вроде file_serch иначе создала бы ассистента без поиска.
+func validateTools(tools []string, functions []FunctionConfig) error {
+	var unknown []string
+	hasFunction := false
+	for _, tool := range tools {
+		switch tool {
+		case toolFileSearch, toolCodeInterpreter:
+		case toolFunction:
+			hasFunction = true
+		default:
+			unknown = append(unknown, tool)
+		}
+	}
+	if len(unknown) > 0 {
+		return fmt.Errorf("Неизвестные инструменты в tools: %s (допустимы: %s)",
+			strings.Join(unknown, ", "), strings.Join(knownTools, ", "))
+	}
+
+	if !hasFunction {
+		return nil
+	}
+	// Инструмент function без описания функции API не принимает
+	if len(functions) == 0 {
+		return fmt.Errorf("Для инструмента function необходимо описать функции в functions")
+	}
+	names := make(map[string]bool, len(functions))
+	for i, function := range functions {
+		if !functionNamePattern.MatchString(function.Name) {
+			return fmt.Errorf("Неверное имя функции %d в functions: %q (допустимы латинские буквы, цифры, _ и -, не длиннее 64 символов)", i+1, function.Name)
+		}
+		if names[function.Name] {
+			return fmt.Errorf("Функция %s описана в functions несколько раз", function.Name)
+		}
+		names[function.Name] = true
+		if function.Parameters != "" {
+			var schema map[string]interface{}
+			if err := json.Unmarshal([]byte(function.Parameters), &schema); err != nil {
+				return fmt.Errorf("Неверная схема parameters функции %s: %v", function.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Описания функций для инструмента function
+func functionTools(functions []FunctionConfig) []openai.Tool {
+	tools := make([]openai.Tool, 0, len(functions))
+	for _, function := range functions {
+		definition := &openai.FunctionDefinition{Name: function.Name, Description: function.Description}
+		if function.Parameters != "" {
+			definition.Parameters = json.RawMessage(function.Parameters)
+		}
+		tools = append(tools, openai.Tool{Type: toolFunction, Function: definition})
+	}
+	return tools
+}
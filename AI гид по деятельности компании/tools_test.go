@@ -0,0 +1,39 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateTools(t *testing.T) {
+	weather := FunctionConfig{Name: "get_weather", Parameters: `{"type":"object"}`}
+	tests := []struct {
+		name      string
+		tools     []string
+		functions []FunctionConfig
+		wantErr   string
+	}{
+		{"известные инструменты", []string{"file_search", "code_interpreter"}, nil, ""},
+		{"функция со схемой", []string{"function"}, []FunctionConfig{weather}, ""},
+		{"функция без аргументов", []string{"function"}, []FunctionConfig{{Name: "get_time"}}, ""},
+		{"опечатки перечисляются все", []string{"file_serch", "code", "file_search"}, nil, "file_serch, code"},
+		{"function без functions", []string{"function"}, nil, "описать функции"},
+		{"неверное имя функции", []string{"function"}, []FunctionConfig{{Name: "get weather"}}, "Неверное имя функции"},
+		{"повтор функции", []string{"function"}, []FunctionConfig{weather, weather}, "несколько раз"},
+		{"неверная схема", []string{"function"}, []FunctionConfig{{Name: "get_weather", Parameters: "{"}}, "Неверная схема"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateTools(tt.tools, tt.functions)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("validateTools: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("validateTools = %v, want ошибку с %q", err, tt.wantErr)
+			}
+		})
+	}
+}
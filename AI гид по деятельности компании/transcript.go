@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// Запись журнала переписки
+type transcriptEntry struct {
+	Time   time.Time `json:"time"`
+	UserID int64     `json:"user_id"`
+	Role   string    `json:"role"`
+	Text   string    `json:"text"`
+}
+
+// transcriptWriter пишет переписку в файл JSON Lines с буферизацией и ротацией по размеру.
+// Нулевой указатель означает, что журнал отключён, и все методы ничего не делают.
+type transcriptWriter struct {
+	mu      sync.Mutex
+	path    string
+	maxSize int64
+	file    *os.File
+	buf     *bufio.Writer
+	size    int64
+}
+
+var transcript *transcriptWriter
+
+// Открывает журнал переписки и запускает периодический сброс буфера на диск
+func openTranscript(path string, maxSize int64) (*transcriptWriter, error) {
+	t := &transcriptWriter{path: path, maxSize: maxSize}
+	if err := t.open(); err != nil {
+		return nil, err
+	}
+
+	go func() {
+		for range time.Tick(time.Second) {
+			t.Flush()
+		}
+	}()
+	return t, nil
+}
+
+func (t *transcriptWriter) open() error {
+	file, err := os.OpenFile(t.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("Ошибка открытия журнала переписки: %v", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	t.file = file
+	t.buf = bufio.NewWriter(file)
+	t.size = info.Size()
+	return nil
+}
+
+// Добавляет запись в журнал
+func (t *transcriptWriter) Write(userID int64, role, text string) {
+	if t == nil {
+		return
+	}
+
+	line, err := json.Marshal(transcriptEntry{Time: time.Now(), UserID: userID, Role: role, Text: text})
+	if err != nil {
+		slog.Error("Ошибка формирования записи журнала переписки", "error", err)
+		return
+	}
+	line = append(line, '\n')
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.maxSize > 0 && t.size+int64(len(line)) > t.maxSize {
+		if err := t.rotateLocked(); err != nil {
+			slog.Error("Ошибка ротации журнала переписки", "error", err)
+		}
+	}
+
+	n, err := t.buf.Write(line)
+	t.size += int64(n)
+	if err != nil {
+		slog.Error("Ошибка записи журнала переписки", "error", err)
+	}
+}
+
+// Сбрасывает буфер на диск
+func (t *transcriptWriter) Flush() {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.buf.Flush(); err != nil {
+		slog.Error("Ошибка записи журнала переписки", "error", err)
+	}
+}
+
+// Переименовывает текущий файл, добавляя к имени время ротации, и открывает новый
+func (t *transcriptWriter) rotateLocked() error {
+	if err := t.buf.Flush(); err != nil {
+		return err
+	}
+	if err := t.file.Close(); err != nil {
+		return err
+	}
+
+	rotated := fmt.Sprintf("%s.%s", t.path, time.Now().Format("20060102-150405"))
+	if err := os.Rename(t.path, rotated); err != nil {
+		// Продолжаем писать в прежний файл
+		if openErr := t.open(); openErr != nil {
+			return openErr
+		}
+		return err
+	}
+	slog.Info("Журнал переписки ротирован", "file", rotated)
+
+	return t.open()
+}
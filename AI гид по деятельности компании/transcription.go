@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Голосовое сообщение превышает допустимую длительность или размер
+var errVoiceTooLong = errors.New("Голосовое сообщение слишком длинное")
+
+// Возвращает текст ответа пользователю при ошибке распознавания
+func voiceErrorMessage(lang string, err error) string {
+	if errors.Is(err, errVoiceTooLong) {
+		return t(lang, "voice.too_long", config.VoiceMaxDuration)
+	}
+	return t(lang, "voice.failed")
+}
+
+// Проверяет голосовое сообщение до распознавания: распознавание — платный запрос к API, поэтому
+// слишком длинное сообщение и сообщение при исчерпанном дневном лимите отклоняются сразу.
+// Длина распознанного текста проверяется потом вместе с остальными вопросами.
+func checkVoice(ctx context.Context, b *botInstance, message *tgbotapi.Message, lang string) bool {
+	voice := message.Voice
+	if voice.Duration > config.VoiceMaxDuration || int64(voice.FileSize) > config.VoiceMaxBytes {
+		requestLog(ctx, b.log).Warn("Голосовое сообщение длиннее допустимого", "user_id", message.From.ID,
+			"duration", voice.Duration, "file_size", voice.FileSize)
+		sendMessage(b, tgbotapi.NewMessage(message.Chat.ID, voiceErrorMessage(lang, errVoiceTooLong)))
+		return false
+	}
+	return checkQuota(b, message, lang)
+}
+
+// Скачивает голосовое сообщение во временный файл и распознаёт его
+func transcribeVoice(ctx context.Context, b *botInstance, voice *tgbotapi.Voice) (string, error) {
+	if voice.Duration > config.VoiceMaxDuration || int64(voice.FileSize) > config.VoiceMaxBytes {
+		return "", errVoiceTooLong
+	}
+
+	fileURL, err := b.sender.GetFileDirectURL(voice.FileID)
+	if err != nil {
+		return "", fmt.Errorf("Ошибка получения файла голосового сообщения: %v", err)
+	}
+
+	tmp, err := os.CreateTemp("", "voice-*.ogg")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	resp, err := http.Get(fileURL)
+	if err != nil {
+		return "", fmt.Errorf("Ошибка загрузки голосового сообщения: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Ошибка загрузки голосового сообщения: статус %d", resp.StatusCode)
+	}
+
+	// Размер, указанный Telegram, может отсутствовать, поэтому ограничиваем и само скачивание
+	n, err := io.Copy(tmp, io.LimitReader(resp.Body, config.VoiceMaxBytes+1))
+	if err != nil {
+		return "", fmt.Errorf("Ошибка загрузки голосового сообщения: %v", err)
+	}
+	if n > config.VoiceMaxBytes {
+		return "", errVoiceTooLong
+	}
+
+	return b.api.TranscribeAudio(ctx, config.TranscriptionURL, config.TranscriptionModel, tmp.Name())
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync/atomic"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"proxyapi-bot/internal/openai"
+)
+
+// Голосовое сообщение при исчерпанном дневном лимите и слишком длинное голосовое сообщение
+// отклоняются до скачивания и платного распознавания
+func TestVoiceRejectedBeforeTranscription(t *testing.T) {
+	tests := []struct {
+		name     string
+		voice    tgbotapi.Voice
+		runsUsed int
+		want     string
+	}{
+		{
+			name:     "исчерпан дневной лимит",
+			voice:    tgbotapi.Voice{FileID: "voice-1", Duration: 5},
+			runsUsed: 1,
+			want:     "Вы исчерпали дневной лимит запросов, приходите завтра.",
+		},
+		{
+			name:  "длиннее voice_max_duration",
+			voice: tgbotapi.Voice{FileID: "voice-1", Duration: 121},
+			want:  "Голосовое сообщение слишком длинное, максимум 120 секунд.",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestConfig(t, "user_daily_runs: 1\n")
+			var downloads atomic.Int32
+			files := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				downloads.Add(1)
+			}))
+			t.Cleanup(files.Close)
+			b, sender := newTestBot(t, &openai.Mock{
+				TranscribeAudioFunc: func(ctx context.Context, url, model, filePath string) (string, error) {
+					t.Error("Голосовое сообщение распознано")
+					return "", nil
+				},
+			})
+			sender.fileURL = files.URL
+			for range tt.runsUsed {
+				b.sessions.AddUsage(2, 10)
+			}
+
+			message := privateMessage(2, 1, "")
+			message.Voice = &tt.voice
+			handleMessages(b, message)
+			waitQueues(t, b)
+
+			if texts := sender.texts(); !slices.Equal(texts, []string{tt.want}) {
+				t.Errorf("Отправлено %q, want %q", texts, tt.want)
+			}
+			if n := downloads.Load(); n != 0 {
+				t.Errorf("Голосовое сообщение скачано %d раз", n)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"unicode/utf8"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Режимы голосовых ответов
+const (
+	ttsModeOff       = "off"
+	ttsModeVoiceOnly = "voice_only"
+	ttsModeBoth      = "both"
+)
+
+// Отправляет ответ голосовым сообщением. Если синтез не удался, возвращает ошибку,
+// и вызывающий код отправляет ответ текстом. Признак sendText сообщает, нужно ли
+// дополнительно отправить текст ответа.
+func sendVoiceAnswer(ctx context.Context, b *botInstance, chatID int64, lang, answer string) (sendText bool, err error) {
+	text := answer
+	truncated := false
+	if utf8.RuneCountInString(text) > config.TTSMaxChars {
+		text = truncateRunes(text, config.TTSMaxChars)
+		truncated = true
+	}
+
+	audio, err := b.api.SynthesizeSpeech(ctx, config.TTSModel, config.TTSVoice, text)
+	if err != nil {
+		return true, err
+	}
+
+	voice := tgbotapi.NewVoice(chatID, tgbotapi.FileBytes{Name: "answer.ogg", Bytes: audio})
+	if truncated {
+		voice.Caption = t(lang, "voice.partial_caption")
+	}
+	if _, err := b.sender.Send(voice); err != nil {
+		return true, err
+	}
+
+	return config.TTSMode == ttsModeBoth || truncated, nil
+}
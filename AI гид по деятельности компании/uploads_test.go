@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"slices"
+	"testing"
+
+	"proxyapi-bot/internal/openai"
+)
+
+// Хэш содержимого файла, под которым он запоминается после загрузки
+func contentHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// Повторная загрузка файла переиспользует прежний файл, только если он ещё есть в API
+// под тем же именем; иначе файл загружается заново, а устаревшая запись забывается
+func TestUploadSourceFileReuse(t *testing.T) {
+	const content = "содержимое about.txt"
+	tests := []struct {
+		name string
+		// Ранее загруженный файл: ключ — имя, под которым он запомнен, и его содержимое
+		savedName, savedContent string
+		// Ответ API на проверку файла file-old
+		getFile    func() (openai.FileInfo, error)
+		wantID     string
+		wantUpload bool
+		// Запись о file-old остаётся в файле состояния
+		wantKept bool
+	}{
+		{
+			name:       "файл не загружался",
+			wantID:     "file-new",
+			wantUpload: true,
+		},
+		{
+			name:      "файл есть в API",
+			savedName: "about.txt", savedContent: content,
+			getFile:  func() (openai.FileInfo, error) { return openai.FileInfo{ID: "file-old", Filename: "about.txt"}, nil },
+			wantID:   "file-old",
+			wantKept: true,
+		},
+		{
+			name:      "файл удалён в API",
+			savedName: "about.txt", savedContent: content,
+			getFile:    func() (openai.FileInfo, error) { return openai.FileInfo{}, &openai.APIError{StatusCode: 404} },
+			wantID:     "file-new",
+			wantUpload: true,
+		},
+		{
+			name:      "под ID другой файл",
+			savedName: "about.txt", savedContent: content,
+			getFile:    func() (openai.FileInfo, error) { return openai.FileInfo{ID: "file-old", Filename: "other.txt"}, nil },
+			wantID:     "file-new",
+			wantUpload: true,
+		},
+		{
+			// Запись не забывается, но её заменяет новый файл
+			name:      "ошибка проверки",
+			savedName: "about.txt", savedContent: content,
+			getFile:    func() (openai.FileInfo, error) { return openai.FileInfo{}, &openai.APIError{StatusCode: 500} },
+			wantID:     "file-new",
+			wantUpload: true,
+		},
+		{
+			name:      "изменилось содержимое",
+			savedName: "about.txt", savedContent: "прежнее содержимое",
+			wantID:     "file-new",
+			wantUpload: true,
+			wantKept:   true,
+		},
+		{
+			name:      "то же содержимое под другим именем",
+			savedName: "copy.txt", savedContent: content,
+			wantID:     "file-new",
+			wantUpload: true,
+			wantKept:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestConfig(t, "")
+			writeKnowledgeBase(t, "about.txt")
+			if tt.savedName != "" {
+				if err := saveUpload(contentHash(tt.savedContent), tt.savedName, "file-old"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			var uploaded []string
+			api := &openai.Mock{
+				GetFileFunc: func(ctx context.Context, fileID string) (openai.FileInfo, error) {
+					if tt.getFile == nil {
+						t.Errorf("Проверен файл %s, хотя запись о нём не подходит", fileID)
+						return openai.FileInfo{}, nil
+					}
+					return tt.getFile()
+				},
+				UploadFileFunc: func(ctx context.Context, fileName string, r io.Reader) (string, error) {
+					data, _ := io.ReadAll(r)
+					uploaded = append(uploaded, fileName+": "+string(data))
+					return "file-new", nil
+				},
+			}
+
+			fileID, hash, err := uploadSourceFile(context.Background(), api, slog.New(slog.NewTextHandler(io.Discard, nil)), localSource{dir: config.FilesPath}, "about.txt", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fileID != tt.wantID || hash != contentHash(content) {
+				t.Errorf("uploadSourceFile = %s, %s; want %s, хэш содержимого", fileID, hash, tt.wantID)
+			}
+			if wantUploaded := tt.wantUpload; (len(uploaded) == 1) != wantUploaded || (wantUploaded && uploaded[0] != "about.txt: "+content) {
+				t.Errorf("Загружено %q, ожидается загрузка: %v", uploaded, wantUploaded)
+			}
+			// Загруженный файл запоминается для следующего запуска
+			if saved, ok := savedUploadFor(contentHash(content), "about.txt"); !ok || saved.ID != tt.wantID {
+				t.Errorf("Запомнен файл %+v, %v; want %s", saved, ok, tt.wantID)
+			}
+			if kept := slices.Contains(savedUploadIDs(), "file-old"); tt.savedName != "" && kept != tt.wantKept {
+				t.Errorf("Запись о file-old сохранена: %v, want %v", kept, tt.wantKept)
+			}
+		})
+	}
+}
+
+// ID файлов, запомненных в файле состояния
+func savedUploadIDs() []string {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	var ids []string
+	for _, upload := range state.Uploads {
+		ids = append(ids, upload.ID)
+	}
+	return ids
+}
+
+// Загруженные файлы сохраняются в файле состояния и переживают перезапуск
+func TestSavedUploadsPersist(t *testing.T) {
+	useTestConfig(t, "")
+	for _, upload := range []savedUpload{{ID: "file-1", Name: "about.txt"}, {ID: "file-2", Name: "contacts.txt"}} {
+		if err := saveUpload("hash", upload.Name, upload.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := forgetUpload("file-2"); err != nil {
+		t.Fatal(err)
+	}
+
+	state = &BotState{}
+	if err := loadState(config.StateFile); err != nil {
+		t.Fatal(err)
+	}
+	if saved, ok := savedUploadFor("hash", "about.txt"); !ok || saved.ID != "file-1" {
+		t.Errorf("После перезапуска about.txt = %+v, %v", saved, ok)
+	}
+	if ids := savedUploadIDs(); !slices.Equal(ids, []string{"file-1"}) {
+		t.Errorf("После перезапуска запомнены файлы %q, want [file-1]", ids)
+	}
+}
+
+// Источник, считающий открытия файлов
+type countingSource struct {
+	FileSource
+	opens int
+}
+
+func (s *countingSource) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	s.opens++
+	return s.FileSource.Open(ctx, name)
+}
+
+// Файл читается один раз, если хэш известен заранее или файл с таким именем не загружался:
+// хэш считается по мере загрузки
+func TestUploadSourceFileReadsOnce(t *testing.T) {
+	const content = "содержимое about.txt"
+	tests := []struct {
+		name      string
+		hash      string
+		savedName string
+		wantOpens int
+	}{
+		{name: "файл не загружался", wantOpens: 1},
+		{name: "хэш посчитан при синхронизации", hash: contentHash(content), savedName: "about.txt", wantOpens: 1},
+		{name: "файл загружался под тем же именем", savedName: "about.txt", wantOpens: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestConfig(t, "")
+			writeKnowledgeBase(t, "about.txt")
+			if tt.savedName != "" {
+				if err := saveUpload(contentHash("прежнее содержимое"), tt.savedName, "file-old"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			api := &openai.Mock{
+				UploadFileFunc: func(ctx context.Context, fileName string, r io.Reader) (string, error) {
+					io.Copy(io.Discard, r)
+					return "file-new", nil
+				},
+			}
+			source := &countingSource{FileSource: localSource{dir: config.FilesPath}}
+
+			fileID, hash, err := uploadSourceFile(context.Background(), api, slog.New(slog.NewTextHandler(io.Discard, nil)), source, "about.txt", tt.hash)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fileID != "file-new" || hash != contentHash(content) || source.opens != tt.wantOpens {
+				t.Errorf("uploadSourceFile = %s, %s, открытий %d; want file-new, хэш содержимого, %d", fileID, hash, source.opens, tt.wantOpens)
+			}
+		})
+	}
+}
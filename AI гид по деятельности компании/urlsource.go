@@ -0,0 +1,291 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Сколько перенаправлений допускается при скачивании файла по file_urls
+const fileURLMaxRedirects = 5
+
+// Типы содержимого, которые принимает поиск file_search. Страница HTML вместо документа
+// обычно означает страницу входа или ошибки, поэтому она принимается, только если адрес
+// явно указывает на файл .html.
+var fileURLContentTypes = map[string]bool{
+	"application/pdf":    true,
+	"application/msword": true,
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document":   true,
+	"application/vnd.openxmlformats-officedocument.presentationml.presentation": true,
+	"application/json":         true,
+	"application/octet-stream": true,
+	"text/plain":               true,
+	"text/markdown":            true,
+	"text/csv":                 true,
+}
+
+var fileURLClient = &http.Client{
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= fileURLMaxRedirects {
+			return fmt.Errorf("Больше %d перенаправлений", fileURLMaxRedirects)
+		}
+		return nil
+	},
+}
+
+// Создаёт источник файлов бота: files_source или files_path и, если заданы, файлы по file_urls.
+// Архивы .zip из этих источников распаковываются.
+func newBotFileSource(cfg BotConfig) (FileSource, error) {
+	source, err := newFileSource(cfg.FilesSource, cfg.FilesPath)
+	if err != nil {
+		return nil, err
+	}
+	log := slog.With("bot", cfg.Name)
+	if len(cfg.FileURLs) == 0 {
+		return newArchiveSource(source, log), nil
+	}
+	for _, rawURL := range cfg.FileURLs {
+		u, err := url.Parse(rawURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("Неверный адрес в file_urls: %s", rawURL)
+		}
+	}
+	combined := &combinedSource{sources: []FileSource{source, &urlSource{urls: cfg.FileURLs}}}
+	return newArchiveSource(combined, log), nil
+}
+
+// combinedSource — файлы нескольких источников. Открывается файл в том источнике,
+// который вернул его в последнем List.
+type combinedSource struct {
+	sources []FileSource
+	owners  map[string]FileSource
+}
+
+func (s *combinedSource) List(ctx context.Context) ([]FileInfo, error) {
+	var files []FileInfo
+	s.owners = make(map[string]FileSource)
+	for _, source := range s.sources {
+		list, err := source.List(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range list {
+			if _, exists := s.owners[file.Name]; exists {
+				continue
+			}
+			s.owners[file.Name] = source
+			files = append(files, file)
+		}
+	}
+	return files, nil
+}
+
+func (s *combinedSource) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	source, ok := s.owners[name]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return source.Open(ctx, name)
+}
+
+// urlSource — файлы, скачиваемые по отдельным адресам. При получении списка запрашиваются
+// только заголовки: по ним определяются имя, размер и версия файла из ETag или Last-Modified,
+// так что неизменённый файл не скачивается. Содержимое скачивается во временный каталог при
+// каждом открытии. Файл, заголовки которого не удалось получить, остаётся в списке под своим
+// адресом, а его открытие возвращает ошибку: так он попадает в итог загрузки вместе
+// с остальными ошибками и не прерывает загрузку других файлов.
+type urlSource struct {
+	urls []string
+	// Адреса файлов и ошибки запроса по имени файла из последнего List
+	files  map[string]string
+	errors map[string]error
+}
+
+func (s *urlSource) List(ctx context.Context) ([]FileInfo, error) {
+	s.files = make(map[string]string)
+	s.errors = make(map[string]error)
+
+	var files []FileInfo
+	for _, rawURL := range s.urls {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		file, err := s.stat(ctx, rawURL)
+		if err != nil {
+			s.errors[rawURL] = err
+			files = append(files, FileInfo{Name: rawURL, Size: -1})
+			continue
+		}
+		s.files[file.Name] = rawURL
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+func (s *urlSource) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	if err, ok := s.errors[name]; ok {
+		return nil, err
+	}
+	rawURL, ok := s.files[name]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return s.download(ctx, rawURL)
+}
+
+// Запрашивает заголовки файла и проверяет их. Сервер, который не поддерживает HEAD,
+// запрашивается через GET без чтения содержимого.
+func (s *urlSource) stat(ctx context.Context, rawURL string) (FileInfo, error) {
+	ctx, cancel := context.WithTimeout(ctx, config.FileURLTimeout)
+	defer cancel()
+
+	resp, err := fileURLRequest(ctx, "HEAD", rawURL)
+	if err == nil && (resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented) {
+		resp.Body.Close()
+		resp, err = fileURLRequest(ctx, "GET", rawURL)
+	}
+	if err != nil {
+		return FileInfo{}, err
+	}
+	defer resp.Body.Close()
+	if err := checkFileURLResponse(resp, rawURL); err != nil {
+		return FileInfo{}, err
+	}
+
+	file := FileInfo{Name: s.uniqueName(fileURLName(resp)), Size: resp.ContentLength}
+	contentType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	html := contentType == "text/html" && (strings.HasSuffix(file.Name, ".html") || strings.HasSuffix(file.Name, ".htm"))
+	if contentType != "" && !fileURLContentTypes[contentType] && !html {
+		return FileInfo{}, fmt.Errorf("Файл %s имеет неподдерживаемый тип содержимого %s", rawURL, contentType)
+	}
+	if etag := resp.Header.Get("ETag"); etag != "" {
+		file.Version = "etag:" + etag
+	} else if modified := resp.Header.Get("Last-Modified"); modified != "" {
+		file.Version = "last-modified:" + modified
+	}
+	return file, nil
+}
+
+// Скачивает файл во временный каталог. Файл удаляется после закрытия.
+func (s *urlSource) download(ctx context.Context, rawURL string) (io.ReadCloser, error) {
+	ctx, cancel := context.WithTimeout(ctx, config.FileURLTimeout)
+	defer cancel()
+
+	resp, err := fileURLRequest(ctx, "GET", rawURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if err := checkFileURLResponse(resp, rawURL); err != nil {
+		return nil, err
+	}
+
+	dir, err := os.MkdirTemp("", "kb-urls-*")
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Create(filepath.Join(dir, "file"))
+	if err != nil {
+		os.Remove(dir)
+		return nil, err
+	}
+	// Размер в заголовке может отсутствовать, поэтому ограничивается и само скачивание
+	n, err := io.Copy(file, io.LimitReader(resp.Body, config.FileURLMaxBytes+1))
+	if err == nil && n > config.FileURLMaxBytes {
+		err = fmt.Errorf("Файл %s больше %d байт", rawURL, config.FileURLMaxBytes)
+	}
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		removeOnClose{file}.Close()
+		if errors.Is(err, context.DeadlineExceeded) {
+			return nil, fmt.Errorf("Файл %s не скачан за %s", rawURL, config.FileURLTimeout)
+		}
+		return nil, fmt.Errorf("Ошибка скачивания %s: %v", rawURL, err)
+	}
+	return removeOnClose{file}, nil
+}
+
+func fileURLRequest(ctx context.Context, method, rawURL string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := fileURLClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Ошибка скачивания %s: %v", rawURL, err)
+	}
+	return resp, nil
+}
+
+// Проверяет статус ответа и размер файла из заголовков
+func checkFileURLResponse(resp *http.Response, rawURL string) error {
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Ошибка скачивания %s: статус %d", rawURL, resp.StatusCode)
+	}
+	if resp.ContentLength > config.FileURLMaxBytes {
+		return fmt.Errorf("Файл %s больше %d байт", rawURL, config.FileURLMaxBytes)
+	}
+	return nil
+}
+
+// Возвращает имя файла из Content-Disposition или из последней части адреса.
+// Если у имени нет расширения, оно добавляется по типу содержимого: по расширению
+// API определяет формат файла.
+func fileURLName(resp *http.Response) string {
+	var name string
+	if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil {
+		name = path.Base(strings.ReplaceAll(params["filename"], "\\", "/"))
+	}
+	if name == "" || name == "." || name == "/" {
+		name = path.Base(resp.Request.URL.Path)
+	}
+	if name == "" || name == "." || name == "/" {
+		name = resp.Request.URL.Host
+	}
+	if path.Ext(name) == "" {
+		contentType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+		if exts, _ := mime.ExtensionsByType(contentType); len(exts) > 0 {
+			name += exts[0]
+		}
+	}
+	return name
+}
+
+// Добавляет к имени номер, если файл с таким именем уже есть в списке
+func (s *urlSource) uniqueName(name string) string {
+	if _, exists := s.files[name]; !exists {
+		return name
+	}
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for i := 2; ; i++ {
+		candidate := fmt.Sprintf("%s-%d%s", base, i, ext)
+		if _, exists := s.files[candidate]; !exists {
+			return candidate
+		}
+	}
+}
+
+// removeOnClose удаляет скачанный файл после того, как он прочитан
+type removeOnClose struct {
+	*os.File
+}
+
+func (f removeOnClose) Close() error {
+	err := f.File.Close()
+	os.Remove(f.Name())
+	// Каталог удаляется вместе с последним файлом
+	os.Remove(filepath.Dir(f.Name()))
+	return err
+}
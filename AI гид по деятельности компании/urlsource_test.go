@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"proxyapi-bot/internal/openai"
+)
+
+// Сервер файлов по file_urls. /guide отдаёт ETag, /notes не поддерживает HEAD и отдаёт
+// Last-Modified, /missing отвечает 404. Считает запросы содержимого
+type fileURLServer struct {
+	mu   sync.Mutex
+	etag string
+	gets int
+}
+
+func (s *fileURLServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch r.URL.Path {
+	case "/guide":
+		w.Header().Set("ETag", s.etag)
+		w.Header().Set("Content-Disposition", `attachment; filename="guide.txt"`)
+	case "/notes":
+		if r.Method == "HEAD" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Last-Modified", "Mon, 05 Oct 2026 10:00:00 GMT")
+		w.Header().Set("Content-Disposition", `attachment; filename="notes.txt"`)
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	body := "содержимое " + r.URL.Path + " " + s.etag
+	w.Header().Set("Content-Type", "text/plain")
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	if r.Method == "GET" {
+		s.gets++
+		io.WriteString(w, body)
+	}
+}
+
+func (s *fileURLServer) getCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.gets
+}
+
+// Список получается по заголовкам, а содержимое скачивается только при открытии
+func TestURLSource(t *testing.T) {
+	useTestConfig(t, "")
+	files := &fileURLServer{etag: `"v1"`}
+	server := httptest.NewServer(files)
+	t.Cleanup(server.Close)
+	source := &urlSource{urls: []string{server.URL + "/guide", server.URL + "/notes", server.URL + "/missing"}}
+
+	list, err := source.List(context.Background())
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	want := []FileInfo{
+		{Name: "guide.txt", Size: int64(len(`содержимое /guide "v1"`)), Version: `etag:"v1"`},
+		{Name: "notes.txt", Size: int64(len(`содержимое /notes "v1"`)), Version: "last-modified:Mon, 05 Oct 2026 10:00:00 GMT"},
+		{Name: server.URL + "/missing", Size: -1},
+	}
+	if !reflect.DeepEqual(list, want) {
+		t.Errorf("List = %+v, want %+v", list, want)
+	}
+	// Содержимое /notes запрошено вместо HEAD, но не прочитано
+	if gets := files.getCount(); gets != 1 {
+		t.Errorf("Запросов содержимого при получении списка: %d, want 1", gets)
+	}
+
+	r, err := source.Open(context.Background(), "guide.txt")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	data, err := io.ReadAll(r)
+	r.Close()
+	if err != nil || string(data) != `содержимое /guide "v1"` {
+		t.Errorf("Содержимое guide.txt = %q, %v", data, err)
+	}
+	if _, err := source.Open(context.Background(), server.URL+"/missing"); err == nil || !strings.Contains(err.Error(), "статус 404") {
+		t.Errorf("Open недоступного файла = %v, want ошибку со статусом 404", err)
+	}
+}
+
+// Синхронизация не скачивает файл, версия которого не изменилась, и загружает его заново,
+// когда меняется ETag
+func TestSyncSkipsUnchangedVersion(t *testing.T) {
+	useTestConfig(t, "")
+	files := &fileURLServer{etag: `"v1"`}
+	server := httptest.NewServer(files)
+	t.Cleanup(server.Close)
+	var uploaded []string
+	b, _ := newTestBot(t, &openai.Mock{
+		UploadFileFunc: func(ctx context.Context, fileName string, r io.Reader) (string, error) {
+			data, _ := io.ReadAll(r)
+			uploaded = append(uploaded, string(data))
+			return fmt.Sprintf("file-%d", len(uploaded)), nil
+		},
+		AddFileToVectorStoreFunc:      func(ctx context.Context, vectorStoreID, fileID string) error { return nil },
+		RemoveFileFromVectorStoreFunc: func(ctx context.Context, vectorStoreID, fileID string) error { return nil },
+		DeleteFileFunc:                func(ctx context.Context, fileID string) error { return nil },
+	})
+	b.source = &urlSource{urls: []string{server.URL + "/guide"}}
+
+	sync := func() syncReport {
+		t.Helper()
+		report, err := syncKnowledgeBase(context.Background(), b)
+		if err != nil || len(report.Failed) > 0 {
+			t.Fatalf("syncKnowledgeBase = %s, %v", report, err)
+		}
+		return report
+	}
+
+	if report := sync(); report.Added != 1 {
+		t.Errorf("Первая синхронизация: %s", report)
+	}
+	gets := files.getCount()
+	if report := sync(); report.Unchanged != 1 || files.getCount() != gets {
+		t.Errorf("Синхронизация без изменений: %s, запросов содержимого %d, want %d", report, files.getCount(), gets)
+	}
+
+	files.mu.Lock()
+	files.etag = `"v2"`
+	files.mu.Unlock()
+	if report := sync(); report.Updated != 1 {
+		t.Errorf("Синхронизация после смены ETag: %s", report)
+	}
+	want := []string{`содержимое /guide "v1"`, `содержимое /guide "v2"`}
+	if !slices.Equal(uploaded, want) {
+		t.Errorf("Загружены %q, want %q", uploaded, want)
+	}
+	if saved, _ := savedKnowledgeFor("test"); saved.Files["guide.txt"].Version != `etag:"v2"` {
+		t.Errorf("Сохранённая база знаний = %+v", saved)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import "sync"
+
+// userQueues выполняет задачи каждого пользователя по одной в порядке поступления, а задачи
+// разных пользователей — параллельно. Так ответы на быстро отправленные подряд вопросы
+// приходят в том же порядке, что и вопросы.
+//
+// У пользователя с задачами в очереди работает одна горутина. Она завершается, как только
+// очередь опустела, поэтому горутин не больше, чем пользователей с необработанными вопросами.
+type userQueues struct {
+	mu     sync.Mutex
+	queues map[int64][]func()
+}
+
+// Ставит задачу в очередь пользователя и при необходимости запускает её обработчик
+func (q *userQueues) Submit(userID int64, job func()) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.queues == nil {
+		q.queues = make(map[int64][]func())
+	}
+	pending, running := q.queues[userID]
+	q.queues[userID] = append(pending, job)
+	if !running {
+		go q.work(userID)
+	}
+}
+
+// Выполняет задачи пользователя, пока они есть, и удаляет опустевшую очередь
+func (q *userQueues) work(userID int64) {
+	for {
+		q.mu.Lock()
+		pending := q.queues[userID]
+		if len(pending) == 0 {
+			delete(q.queues, userID)
+			q.mu.Unlock()
+			return
+		}
+		job := pending[0]
+		pending[0] = nil
+		q.queues[userID] = pending[1:]
+		q.mu.Unlock()
+
+		job()
+	}
+}
+
+// Количество пользователей, у которых есть задачи в очереди или в работе
+func (q *userQueues) Active() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.queues)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Ждёт, пока у очередей не останется задач
+func waitUserQueues(t *testing.T, q *userQueues) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for q.Active() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Очереди не опустели")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// Задачи, быстро отправленные подряд, выполняются в порядке поступления и не одновременно
+func TestUserQueuesOrder(t *testing.T) {
+	var q userQueues
+	const users, jobs = 5, 200
+
+	var mu sync.Mutex
+	done := make(map[int64][]int)
+	running := make([]atomic.Int32, users)
+	for i := range jobs {
+		for user := range int64(users) {
+			q.Submit(user, func() {
+				if n := running[user].Add(1); n > 1 {
+					t.Errorf("У пользователя %d одновременно выполняются %d задачи", user, n)
+				}
+				mu.Lock()
+				done[user] = append(done[user], i)
+				mu.Unlock()
+				running[user].Add(-1)
+			})
+		}
+	}
+	waitUserQueues(t, &q)
+
+	mu.Lock()
+	defer mu.Unlock()
+	for user := range int64(users) {
+		if len(done[user]) != jobs || !slices.IsSorted(done[user]) {
+			t.Errorf("Задачи пользователя %d выполнены в порядке %v", user, done[user])
+		}
+	}
+}
+
+// Задача одного пользователя не задерживает задачи другого
+func TestUserQueuesConcurrentUsers(t *testing.T) {
+	var q userQueues
+	release := make(chan struct{})
+	finished := make(chan int64, 2)
+
+	// Задача пользователя 1 завершается, только когда выполнилась задача пользователя 2
+	q.Submit(1, func() {
+		select {
+		case <-release:
+		case <-time.After(5 * time.Second):
+			t.Error("Задача пользователя 2 не выполнилась, пока занят пользователь 1")
+		}
+		finished <- 1
+	})
+	q.Submit(2, func() {
+		finished <- 2
+		close(release)
+	})
+	waitUserQueues(t, &q)
+
+	if first := <-finished; first != 2 {
+		t.Errorf("Первой завершилась задача пользователя %d, want 2", first)
+	}
+}
+
+// Обработчик опустевшей очереди завершается, а новая задача запускает его снова
+func TestUserQueuesIdleWorker(t *testing.T) {
+	var q userQueues
+	ran := make(chan struct{}, 2)
+
+	q.Submit(1, func() { ran <- struct{}{} })
+	waitUserQueues(t, &q)
+	q.mu.Lock()
+	_, exists := q.queues[1]
+	q.mu.Unlock()
+	if exists {
+		t.Error("Опустевшая очередь не удалена")
+	}
+
+	q.Submit(1, func() { ran <- struct{}{} })
+	waitUserQueues(t, &q)
+	if len(ran) != 2 {
+		t.Errorf("Выполнено %d задач, want 2", len(ran))
+	}
+}
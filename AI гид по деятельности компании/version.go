@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Сведения о сборке. Задаются при сборке через -ldflags, например:
+//
+//	go build -ldflags "-X main.version=1.2.0 -X main.gitCommit=$(git rev-parse --short HEAD) -X main.buildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)" -o proxyapi-bot .
+//
+// Без -ldflags версия — dev, а коммит и дата берутся из сведений, которые go build
+// встраивает сам при сборке в рабочей копии git.
+var (
+	version   = "dev"
+	gitCommit = ""
+	buildDate = ""
+)
+
+// Сведения о сборке для журнала, /version, /stats и /readyz
+type buildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	BuildDate string `json:"build_date,omitempty"`
+}
+
+// Возвращает сведения о сборке, дополняя незаданные через -ldflags поля данными go build
+func currentBuild() buildInfo {
+	info := buildInfo{Version: version, Commit: gitCommit, BuildDate: buildDate}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range bi.Settings {
+			switch {
+			case s.Key == "vcs.revision" && info.Commit == "":
+				info.Commit = s.Value[:min(len(s.Value), 12)]
+			case s.Key == "vcs.time" && info.BuildDate == "":
+				info.BuildDate = s.Value
+			case s.Key == "vcs.modified" && s.Value == "true" && gitCommit == "" && info.Commit != "":
+				info.Commit += "-dirty"
+			}
+		}
+	}
+	return info
+}
+
+// Описание сборки одной строкой, например «1.2.0 (коммит 3f2a1c9, собрано 2025-03-01T10:00:00Z)»
+func (i buildInfo) String() string {
+	var details []string
+	if i.Commit != "" {
+		details = append(details, "коммит "+i.Commit)
+	}
+	if i.BuildDate != "" {
+		details = append(details, "собрано "+i.BuildDate)
+	}
+	if len(details) == 0 {
+		return i.Version
+	}
+	return fmt.Sprintf("%s (%s)", i.Version, strings.Join(details, ", "))
+}
+
+// Записывает в журнал версию сборки и основные действующие настройки. Ключ API и токены
+// в запись не попадают
+func logStartupBanner() {
+	build := currentBuild()
+	names := make([]string, 0, len(config.Bots))
+	for _, cfg := range config.Bots {
+		names = append(names, cfg.Name)
+	}
+	slog.Info("Запуск proxyapi-bot", "version", build.Version, "commit", build.Commit, "build_date", build.BuildDate)
+	slog.Info("Действующие настройки",
+		"api_url", config.ApiURL,
+		"provider", config.Provider,
+		"bots", strings.Join(names, ","),
+		"model", config.Model,
+		"webhook", config.WebhookURL != "",
+		"group_context_mode", config.GroupContextMode,
+		"routing_enabled", config.RoutingEnabled,
+		"moderation_enabled", config.ModerationEnabled,
+		"cache_ttl_hours", config.CacheTTLHours,
+		"max_concurrent_runs", config.MaxConcurrentRuns,
+		"max_input_chars", config.MaxInputChars,
+	)
+}
+
+// /version — показывает администратору версию запущенной сборки
+func handleVersionCommand(b *botInstance, message *tgbotapi.Message) {
+	lang := userLanguage(b, message.From)
+	if !isAdmin(message.From.ID) {
+		sendMessage(b, tgbotapi.NewMessage(message.Chat.ID, t(lang, "common.admin_only")))
+		return
+	}
+	sendMessage(b, tgbotapi.NewMessage(message.Chat.ID, t(lang, "version.report", currentBuild())))
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Фотография превышает photo_max_bytes
+var errPhotoTooLarge = errors.New("Фотография слишком большая")
+
+// Проверяет, что сообщение содержит фотографию и передача изображений включена
+func isVisionMessage(message *tgbotapi.Message) bool {
+	return config.VisionEnabled && len(message.Photo) > 0
+}
+
+// Возвращает самый крупный из размеров фотографии, присланных Telegram
+func largestPhoto(sizes []tgbotapi.PhotoSize) tgbotapi.PhotoSize {
+	largest := sizes[0]
+	for _, size := range sizes[1:] {
+		if size.Width*size.Height > largest.Width*largest.Height {
+			largest = size
+		}
+	}
+	return largest
+}
+
+// Формирует содержимое сообщения пользователя: строку или, если приложено изображение,
+// массив из текста и ссылки на изображение
+func userContent(text, imageURL string) interface{} {
+	if imageURL == "" {
+		return text
+	}
+	return []map[string]interface{}{
+		{"type": "text", "text": text},
+		{"type": "image_url", "image_url": map[string]interface{}{"url": imageURL}},
+	}
+}
+
+// Обрабатывает фотографию: подпись становится вопросом, а изображение передаётся ассистенту вместе с ним
+func handlePhotoMessage(ctx context.Context, b *botInstance, message *tgbotapi.Message, lang string) {
+	log := requestLog(ctx, b.log)
+	imageURL, err := downloadPhoto(b, largestPhoto(message.Photo))
+	if err != nil {
+		log.Error("Ошибка получения фотографии", "user_id", message.From.ID, "error", err)
+		text := t(lang, "photo.failed")
+		if errors.Is(err, errPhotoTooLarge) {
+			text = t(lang, "photo.too_large", config.PhotoMaxBytes>>20)
+		}
+		sendMessage(b, tgbotapi.NewMessage(message.Chat.ID, text))
+		return
+	}
+
+	query := strings.TrimSpace(message.Caption)
+	if query == "" {
+		query = t(lang, "photo.default_question")
+	}
+	handleUserQuery(ctx, b, message, query, imageURL, "", false, false)
+}
+
+// Скачивает фотографию из Telegram и возвращает её адресом data:. Ссылка на файл в Telegram
+// содержит токен бота, поэтому она не передаётся в API и не попадает в историю диалога.
+func downloadPhoto(b *botInstance, photo tgbotapi.PhotoSize) (string, error) {
+	if int64(photo.FileSize) > config.PhotoMaxBytes {
+		return "", errPhotoTooLarge
+	}
+
+	fileURL, err := b.sender.GetFileDirectURL(photo.FileID)
+	if err != nil {
+		return "", fmt.Errorf("Ошибка получения файла фотографии: %v", err)
+	}
+
+	resp, err := http.Get(fileURL)
+	if err != nil {
+		return "", fmt.Errorf("Ошибка скачивания фотографии: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Ошибка скачивания фотографии: статус %d", resp.StatusCode)
+	}
+
+	// Размер, указанный Telegram, может отсутствовать, поэтому ограничиваем и само скачивание
+	data, err := io.ReadAll(io.LimitReader(resp.Body, config.PhotoMaxBytes+1))
+	if err != nil {
+		return "", fmt.Errorf("Ошибка скачивания фотографии: %v", err)
+	}
+	if int64(len(data)) > config.PhotoMaxBytes {
+		return "", errPhotoTooLarge
+	}
+
+	return "data:" + http.DetectContentType(data) + ";base64," + base64.StdEncoding.EncodeToString(data), nil
+}
+
+// Сообщает пользователю, что модель не принимает изображения, и убирает изображение из истории,
+// чтобы следующие вопросы не отклонялись по той же причине
+func handleImageUnsupported(ctx context.Context, b *botInstance, chatID, userID int64, session *UserSession, run runRequest) {
+	log := requestLog(ctx, b.log)
+	log.Warn("Модель ассистента не поддерживает изображения", "user_id", userID)
+
+	session.mu.Lock()
+	for i, m := range session.Messages {
+		if parts, ok := m["content"].([]map[string]interface{}); ok && len(parts) > 0 {
+			session.Messages[i] = map[string]interface{}{"role": m["role"], "content": parts[0]["text"]}
+		}
+	}
+	// Изображение могло попасть в поток, поэтому следующий вопрос начнёт новый поток из очищенной истории
+	if run.ThreadMessageAdded {
+		session.ThreadID = ""
+	}
+	session.lastQuery = ""
+	session.mu.Unlock()
+
+	sendMessage(b, tgbotapi.NewMessage(chatID, t(run.Language, "photo.unsupported")))
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"proxyapi-bot/internal/openai"
+)
+
+// Фотография JPEG с подписью caption. Telegram отдаёт файл по ссылке с токеном бота
+func photoMessage(t *testing.T, sender *fakeSender, data []byte, caption string) *tgbotapi.Message {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(data)
+	}))
+	t.Cleanup(server.Close)
+	sender.fileURL = server.URL + "/file/bot" + config.TelegramBotToken
+
+	message := privateMessage(100, 1, "")
+	message.Caption = caption
+	message.Photo = []tgbotapi.PhotoSize{{FileID: "small", Width: 90, Height: 90}, {FileID: "large", Width: 800, Height: 600}}
+	return message
+}
+
+// Фотография передаётся ассистенту содержимым, а не ссылкой на файл Telegram с токеном бота,
+// и в выгрузку истории попадает только отметка об изображении
+func TestPhotoMessage(t *testing.T) {
+	useTestConfig(t, "vision_enabled: true\n")
+	var got openai.RunRequest
+	b, sender := newTestBot(t, &openai.Mock{
+		CreateThreadRunFunc: func(ctx context.Context, req openai.RunRequest, observer openai.RunObserver) (openai.RunResult, error) {
+			got = req
+			return openai.RunResult{Text: "ответ"}, nil
+		},
+	})
+	jpeg := []byte("\xff\xd8\xff\xe0\x00\x10JFIF\x00фото")
+
+	handlePhotoMessage(context.Background(), b, photoMessage(t, sender, jpeg, "Что это?"), "ru")
+	waitQueues(t, b)
+
+	want := userContent("Что это?", "data:image/jpeg;base64,"+base64.StdEncoding.EncodeToString(jpeg))
+	if len(got.Messages) != 1 || !jsonEqual(t, got.Messages[0]["content"], want) {
+		t.Errorf("Сообщения запуска %+v, want содержимое %+v", got.Messages, want)
+	}
+	request, _ := json.Marshal(got)
+	if strings.Contains(string(request), config.TelegramBotToken) {
+		t.Errorf("Токен бота передан в API: %s", request)
+	}
+
+	messages := loadExportMessages(context.Background(), b, privateSession(100))
+	for _, format := range exportFormats {
+		data, err := exportRenderers[format].Render("ru", "test", messages, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		mark := translate("ru", "export.image")
+		if format == "json" {
+			mark = `"image": true`
+		}
+		if !strings.Contains(string(data), mark) {
+			t.Errorf("В выгрузке %s нет отметки об изображении %q:\n%s", format, mark, data)
+		}
+		if strings.Contains(string(data), "base64") || strings.Contains(string(data), config.TelegramBotToken) {
+			t.Errorf("Изображение попало в выгрузку %s:\n%s", format, data)
+		}
+	}
+}
+
+// Фотография больше photo_max_bytes не передаётся ассистенту
+func TestPhotoMessageTooLarge(t *testing.T) {
+	useTestConfig(t, "vision_enabled: true\nphoto_max_bytes: 1048576\n")
+	runs := 0
+	b, sender := newTestBot(t, &openai.Mock{
+		CreateThreadRunFunc: func(ctx context.Context, req openai.RunRequest, observer openai.RunObserver) (openai.RunResult, error) {
+			runs++
+			return openai.RunResult{Text: "ответ"}, nil
+		},
+	})
+
+	handlePhotoMessage(context.Background(), b, photoMessage(t, sender, make([]byte, 2<<20), ""), "ru")
+	waitQueues(t, b)
+
+	sender.waitText(t, translate("ru", "photo.too_large", 1))
+	if runs != 0 {
+		t.Errorf("Ассистент запущен %d раз", runs)
+	}
+}
+
+// Сравнивает значения по их представлению в JSON
+func jsonEqual(t *testing.T, a, b interface{}) bool {
+	t.Helper()
+	ja, err := json.Marshal(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jb, err := json.Marshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(ja) == string(jb)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	updateModePolling = "polling"
+	updateModeWebhook = "webhook"
+
+	// Заголовок, в котором Telegram передаёт secret_token, указанный при установке вебхука
+	telegramSecretHeader = "X-Telegram-Bot-Api-Secret-Token"
+)
+
+// Возвращает канал обновлений Telegram в зависимости от режима update_mode
+// и функцию, которая прекращает получение обновлений и закрывает канал
+func getUpdatesChannel(b *botInstance) (tgbotapi.UpdatesChannel, func(), error) {
+	if config.UpdateMode == updateModeWebhook {
+		return startWebhook(b)
+	}
+
+	// Удаляем вебхук, оставшийся от предыдущего запуска, иначе getUpdates вернёт ошибку
+	if _, err := b.tg.Request(tgbotapi.DeleteWebhookConfig{}); err != nil {
+		b.log.Warn("Не удалось удалить вебхук перед запуском long polling", "error", err)
+	}
+
+	offset := updateOffsets.Next(b.cfg.Name)
+	if offset > 0 {
+		b.log.Info("Получение обновлений продолжается с сохранённого смещения", "offset", offset)
+	}
+	u := tgbotapi.NewUpdate(offset)
+	u.Timeout = config.PollingTimeoutSeconds
+
+	updates, stop := pollUpdates(b, u)
+	return trackUpdateOffsets(b, updates), stop, nil
+}
+
+// Устанавливает вебхук и запускает HTTP-сервер для приёма обновлений
+func startWebhook(b *botInstance) (tgbotapi.UpdatesChannel, func(), error) {
+	bot := b.tg
+	webhookURL, err := url.Parse(config.WebhookURL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Неверный webhook_url: %v", err)
+	}
+
+	params := tgbotapi.Params{"url": webhookURL.String()}
+	params.AddNonEmpty("secret_token", config.WebhookSecretToken)
+
+	// Самоподписанный сертификат нужно передать Telegram при установке вебхука
+	if config.WebhookCertFile != "" {
+		files := []tgbotapi.RequestFile{{
+			Name: "certificate",
+			Data: tgbotapi.FilePath(config.WebhookCertFile),
+		}}
+		_, err = bot.UploadFiles("setWebhook", params, files)
+	} else {
+		_, err = bot.MakeRequest("setWebhook", params)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("Ошибка установки вебхука: %v", err)
+	}
+
+	b.log.Info("Вебхук установлен", "url", webhookURL.Redacted())
+
+	updates := make(chan tgbotapi.Update, bot.Buffer)
+
+	path := webhookURL.Path
+	if path == "" {
+		path = "/"
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		if config.WebhookSecretToken != "" {
+			token := r.Header.Get(telegramSecretHeader)
+			if subtle.ConstantTimeCompare([]byte(token), []byte(config.WebhookSecretToken)) != 1 {
+				b.log.Warn("Запрос к вебхуку с неверным секретным токеном", "remote_addr", r.RemoteAddr)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+		}
+
+		update, err := bot.HandleUpdate(r)
+		if err != nil {
+			b.log.Error("Ошибка разбора обновления из вебхука", "error", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		updates <- *update
+	})
+
+	server := &http.Server{Addr: config.WebhookListenAddr, Handler: mux}
+
+	go func() {
+		var err error
+		if config.WebhookCertFile != "" && config.WebhookKeyFile != "" {
+			err = server.ListenAndServeTLS(config.WebhookCertFile, config.WebhookKeyFile)
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			b.log.Error("Ошибка HTTP-сервера вебхука", "error", err)
+		}
+	}()
+
+	b.log.Info("HTTP-сервер вебхука запущен", "addr", config.WebhookListenAddr, "path", path)
+
+	stop := func() {
+		// Shutdown дожидается завершения обработчиков, после чего канал можно закрыть
+		if err := server.Shutdown(context.Background()); err != nil {
+			b.log.Error("Ошибка остановки HTTP-сервера вебхука", "error", err)
+		}
+		close(updates)
+	}
+	return updates, stop, nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Подставляет в текст сведения о боте и пользователе: {bot_name}, {first_name}, {username}
+// и {date} — текущую дату по quota_timezone
+func expandPlaceholders(text string, b *botInstance, user *tgbotapi.User) string {
+	return strings.NewReplacer(
+		"{bot_name}", b.cfg.Name,
+		"{first_name}", user.FirstName,
+		"{username}", user.UserName,
+		"{date}", time.Now().In(quotaLocation).Format("02.01.2006"),
+	).Replace(text)
+}
+
+// Отправляет приветствие пользователю, который пишет боту впервые. Приветствие отправляется
+// один раз: отметка сохраняется в файле состояния. В историю диалога оно не попадает,
+// поэтому ассистент его не видит.
+func sendWelcome(b *botInstance, message *tgbotapi.Message, lang string) {
+	userID := message.From.ID
+	if _, exists := b.sessions.Get(chatSession(message.Chat, userID)); exists {
+		return
+	}
+	first, err := markGreeted(b.cfg.Name, userID)
+	if err != nil {
+		b.log.Error("Ошибка сохранения состояния", "error", err)
+	}
+	if !first {
+		return
+	}
+
+	text := config.WelcomeMessage
+	if text == "" {
+		text = t(lang, "welcome.message")
+	}
+	sendMessage(b, tgbotapi.NewMessage(message.Chat.ID, expandPlaceholders(text, b, message.From)))
+	b.log.Info("Отправлено приветствие новому пользователю", "user_id", userID)
+}